@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sync"
@@ -17,6 +18,8 @@ import (
 	"github.com/canonical/go-dqlite/client"
 	"github.com/canonical/go-dqlite/driver"
 	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/canonical/go-dqlite/tracing"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/semaphore"
 )
@@ -25,6 +28,9 @@ import (
 // https://pkg.go.dev/sync/atomic#AddInt64
 var driverIndex int64
 
+// Maximum time a new connection can take to send its authentication token.
+const authTimeout = 10 * time.Second
+
 // App is a high-level helper for initializing a typical dqlite-based Go
 // application.
 //
@@ -43,15 +49,27 @@ type App struct {
 	driver          *driver.Driver
 	driverName      string
 	log             client.LogFunc
+	logLevel        *logging.LevelVar
 	ctx             context.Context
 	stop            context.CancelFunc // Signal App.run() to stop.
 	proxyCh         chan struct{}      // Waits for App.proxy() to return.
 	runCh           chan struct{}      // Waits for App.run() to return.
 	readyCh         chan struct{}      // Waits for startup tasks
+	readyErr        error              // Set if startup tasks failed for good.
+	backupCh        chan struct{}      // Waits for App.backupLoop() to return.
+	doneCh          chan struct{}      // Closed when App.Close() returns.
+	closeOnce       sync.Once
+	closeErr        error
 	voters          int
 	standbys        int
 	roles           RolesConfig
 	options         *options
+	limiter         *connLimiter   // Limits incoming proxied connections.
+	acceptFunc      AcceptFunc     // Vets incoming proxied connections, if set.
+	auth            *authSetup     // Authenticates incoming proxied connections, if set.
+	listeners       sync.WaitGroup // Waits for goroutines started by App.Listen and the role watch.
+	watch           roleWatch      // Callbacks notified of role changes.
+	registered      sync.Map       // Names of the databases registered by App.Open.
 }
 
 // New creates a new application node.
@@ -61,6 +79,47 @@ func New(dir string, options ...Option) (app *App, err error) {
 		option(o)
 	}
 
+	logLevel := &logging.LevelVar{}
+	switch {
+	case o.LogLevel != client.LogNone:
+		logLevel.Set(o.LogLevel)
+	case o.Log == nil:
+		logLevel.Set(client.LogError)
+	default:
+		logLevel.Set(client.LogDebug)
+	}
+	if o.Log == nil {
+		o.Log = defaultLogFunc
+	}
+	o.Log = logging.Filter(o.Log, logLevel)
+
+	if o.Discovery != nil && o.Discovery.Kind != discoverySRV {
+		return nil, fmt.Errorf("unsupported discovery kind %q", o.Discovery.Kind)
+	}
+
+	if o.BackupSink != nil && (o.BackupInterval <= 0 || o.BackupRetention < 1) {
+		return nil, fmt.Errorf("invalid backup schedule: interval and retention must be positive")
+	}
+
+	if o.Auth != nil && o.TLS == nil && o.Conn == nil {
+		return nil, fmt.Errorf("authentication requires WithTLS or WithExternalConn")
+	}
+
+	if o.StatefulSet != nil {
+		if err := o.StatefulSet.configure(o); err != nil {
+			return nil, fmt.Errorf("configure stateful set node: %w", err)
+		}
+	}
+
+	// Use canonical addresses, so bare IPv6 literals and addresses without
+	// a port work, and the same address always compares equal. Addresses
+	// handled by an external connection are opaque to us.
+	if o.Conn == nil {
+		if err := normalizeAddresses(o); err != nil {
+			return nil, err
+		}
+	}
+
 	var nodeBindAddress string
 	if o.Conn != nil {
 		listener, err := net.Listen("unix", o.UnixSocket)
@@ -86,6 +145,7 @@ func New(dir string, options ...Option) (app *App, err error) {
 
 	// Load our ID, or generate one if we are joining.
 	info := client.NodeInfo{}
+	previousAddress := "" // Set if the node was restarted with a new address.
 	infoFileExists, err := fileExists(dir, infoFile)
 	if err != nil {
 		return nil, err
@@ -96,10 +156,18 @@ func New(dir string, options ...Option) (app *App, err error) {
 				return nil, err
 			}
 		}
+		if len(o.Cluster) == 0 && o.Discovery != nil {
+			if o.Cluster, err = o.Discovery.peers(context.Background(), o.Address); err != nil {
+				return nil, fmt.Errorf("discover cluster: %w", err)
+			}
+		}
 		if len(o.Cluster) == 0 {
 			info.ID = dqlite.BootstrapID
 		} else {
 			info.ID = dqlite.GenerateID(o.Address)
+			if o.StatefulSet != nil {
+				info.ID = o.StatefulSet.nodeID()
+			}
 			if err := fileWrite(dir, joinFile, []byte{}); err != nil {
 				return nil, err
 			}
@@ -115,8 +183,36 @@ func New(dir string, options ...Option) (app *App, err error) {
 		if err := fileUnmarshal(dir, infoFile, &info); err != nil {
 			return nil, err
 		}
+
+		// Check if a previous address change still has to be applied
+		// to the cluster configuration.
+		relocateFileExists, err := fileExists(dir, relocateFile)
+		if err != nil {
+			return nil, err
+		}
+		if relocateFileExists {
+			if err := fileUnmarshal(dir, relocateFile, &previousAddress); err != nil {
+				return nil, err
+			}
+		}
+
 		if o.Address != "" && o.Address != info.Address {
-			return nil, fmt.Errorf("address %q in info.yaml does not match %q", info.Address, o.Address)
+			// The node was restarted with a new address, e.g. because
+			// it runs in a container that got a different IP. Persist
+			// the new address and update the cluster configuration
+			// accordingly. The address known by the cluster is saved
+			// first, so the update is re-tried if it doesn't complete.
+			o.Log(client.LogInfo, "address changed from %s to %s", info.Address, o.Address)
+			if previousAddress == "" {
+				previousAddress = info.Address
+				if err := fileMarshal(dir, relocateFile, previousAddress); err != nil {
+					return nil, err
+				}
+			}
+			info.Address = o.Address
+			if err := fileMarshal(dir, infoFile, info); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -166,11 +262,35 @@ func New(dir string, options ...Option) (app *App, err error) {
 		cleanups = append(cleanups, func() { fileRemove(dir, storeFile) })
 	}
 
+	// If our address changed and we are the only node of the cluster,
+	// there's no leader that could update the configuration for us, so
+	// rewrite it before starting the node. Otherwise we'll ask the leader
+	// to do it once we are up.
+	relocate := false
+	if previousAddress != "" {
+		relocate, err = relocateSingleNode(store, info, previousAddress, dir)
+		if err != nil {
+			return nil, err
+		}
+		if !relocate {
+			if err := fileRemove(dir, relocateFile); err != nil {
+				return nil, fmt.Errorf("remove relocate file: %w", err)
+			}
+		}
+	}
+
 	// Start the local dqlite engine.
 	ctx, stop := context.WithCancel(context.Background())
+	if o.Tracer != nil {
+		ctx = tracing.WithTracer(ctx, o.Tracer)
+	}
 	var nodeDial client.DialFunc
 	if o.Conn != nil {
-		nodeDial = extDialFuncWithProxy(ctx, o.Conn.dialFunc)
+		dial := o.Conn.dialFunc
+		if o.Auth != nil {
+			dial = client.DialFuncWithToken(dial, o.Auth.Token)
+		}
+		nodeDial = extDialFuncWithProxy(ctx, dial)
 	} else if o.TLS != nil {
 		nodeBindAddress = fmt.Sprintf("@dqlite-%d", info.ID)
 
@@ -182,13 +302,15 @@ func New(dir string, options ...Option) (app *App, err error) {
 			nodeBindAddress = fmt.Sprintf("@snap.%s.dqlite-%d", snapInstanceName, info.ID)
 		}
 
-		nodeDial = makeNodeDialFunc(ctx, o.TLS.Dial)
+		nodeDial = makeNodeDialFunc(ctx, o.TLS.Dial, o.Auth)
 	} else {
 		nodeBindAddress = info.Address
+		if o.BindAddress != "" {
+			nodeBindAddress = o.BindAddress
+		}
 		nodeDial = client.DefaultDialFunc
 	}
-	node, err := dqlite.New(
-		info.ID, info.Address, dir,
+	nodeOptions := []dqlite.Option{
 		dqlite.WithBindAddress(nodeBindAddress),
 		dqlite.WithDialFunc(nodeDial),
 		dqlite.WithFailureDomain(o.FailureDomain),
@@ -196,7 +318,12 @@ func New(dir string, options ...Option) (app *App, err error) {
 		dqlite.WithSnapshotParams(o.SnapshotParams),
 		dqlite.WithDiskMode(o.DiskMode),
 		dqlite.WithAutoRecovery(o.AutoRecovery),
-	)
+	}
+	nodeOptions = append(nodeOptions, o.Functions...)
+	if len(o.Extensions) > 0 {
+		nodeOptions = append(nodeOptions, dqlite.WithExtensions(o.ExtensionsDir, o.Extensions...))
+	}
+	node, err := dqlite.New(info.ID, info.Address, dir, nodeOptions...)
 	if err != nil {
 		stop()
 		return nil, fmt.Errorf("create node: %w", err)
@@ -214,14 +341,22 @@ func New(dir string, options ...Option) (app *App, err error) {
 	} else if o.Conn != nil {
 		driverDial = o.Conn.dialFunc
 	}
+	if o.Auth != nil {
+		driverDial = client.DialFuncWithToken(driverDial, o.Auth.Token)
+	}
 
-	driver, err := driver.New(
-		store,
+	driverOptions := []driver.Option{
 		driver.WithDialFunc(driverDial),
 		driver.WithLogFunc(o.Log),
 		driver.WithTracing(o.Tracing),
 		driver.WithConcurrentLeaderConns(o.ConcurrentLeaderConns),
-	)
+		driver.WithMaxMessageSize(o.MaxMessageSize),
+	}
+	if o.AuditSink != nil {
+		driverOptions = append(driverOptions, driver.WithAuditSink(o.AuditSink))
+	}
+
+	driver, err := driver.New(store, driverOptions...)
 	if err != nil {
 		stop()
 		return nil, fmt.Errorf("create driver: %w", err)
@@ -250,22 +385,31 @@ func New(dir string, options ...Option) (app *App, err error) {
 		driver:          driver,
 		driverName:      driverName,
 		log:             o.Log,
+		logLevel:        logLevel,
 		tls:             o.TLS,
 		ctx:             ctx,
 		stop:            stop,
 		runCh:           make(chan struct{}, 0),
 		readyCh:         make(chan struct{}, 0),
+		doneCh:          make(chan struct{}),
 		voters:          o.Voters,
 		standbys:        o.StandBys,
 		roles:           RolesConfig{Voters: o.Voters, StandBys: o.StandBys},
+		limiter:         newConnLimiter(o.MaxConnections, o.ConnectionRate, o.ConnectionBurst),
+		acceptFunc:      o.AcceptFunc,
+		auth:            o.Auth,
 		options:         o,
 	}
 
 	// Start the proxy if a TLS configuration was provided.
 	if o.TLS != nil {
-		listener, err := net.Listen("tcp", info.Address)
+		address := info.Address
+		if o.BindAddress != "" {
+			address = o.BindAddress
+		}
+		listener, err := net.Listen("tcp", address)
 		if err != nil {
-			return nil, fmt.Errorf("listen to %s: %w", info.Address, err)
+			return nil, fmt.Errorf("listen to %s: %w", address, err)
 		}
 		proxyCh := make(chan struct{}, 0)
 
@@ -279,67 +423,178 @@ func New(dir string, options ...Option) (app *App, err error) {
 	} else if o.Conn != nil {
 		go func() {
 			for remote := range o.Conn.acceptCh {
+				address := remote.RemoteAddr()
+				if !app.limiter.acquire(address) {
+					app.warn("reject connection from %s: limit reached", address)
+					remote.Close()
+					continue
+				}
 
-				// keep forward compatible
-				_, isTcp := remote.(*net.TCPConn)
-				_, isTLS := remote.(*tls.Conn)
+				// Accepting and authenticating might block, don't
+				// hold back the other connections meanwhile.
+				go func(remote net.Conn) {
+					defer app.limiter.release()
 
-				if isTcp || isTLS {
-					// Write the status line and upgrade header by hand since w.WriteHeader() would fail after Hijack().
-					data := []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: dqlite\r\n\r\n")
-					n, err := remote.Write(data)
-					if err != nil || n != len(data) {
-						remote.Close()
-						panic(fmt.Errorf("failed to write connection header: %w", err))
+					remote, err := app.accept(remote)
+					if err != nil {
+						app.warn("reject connection from %s: %v", address, err)
+						return
 					}
-				}
 
-				local, err := net.Dial("unix", nodeBindAddress)
-				if err != nil {
-					remote.Close()
-					panic(fmt.Errorf("failed to connect to bind address %q: %w", nodeBindAddress, err))
-				}
+					// keep forward compatible
+					_, isTcp := remote.(*net.TCPConn)
+					_, isTLS := remote.(*tls.Conn)
+
+					if isTcp || isTLS {
+						// Write the status line and upgrade header by hand since w.WriteHeader() would fail after Hijack().
+						data := []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: dqlite\r\n\r\n")
+						n, err := remote.Write(data)
+						if err != nil || n != len(data) {
+							remote.Close()
+							panic(fmt.Errorf("failed to write connection header: %w", err))
+						}
+					}
 
-				go proxy(app.ctx, remote, local, nil)
+					if err := app.authenticate(remote); err != nil {
+						app.warn("reject connection from %s: %v", address, err)
+						return
+					}
+
+					local, err := net.Dial("unix", nodeBindAddress)
+					if err != nil {
+						remote.Close()
+						panic(fmt.Errorf("failed to connect to bind address %q: %w", nodeBindAddress, err))
+					}
+
+					proxy(app.ctx, remote, local, nil)
+				}(remote)
 			}
 		}()
 	}
 
-	go app.run(ctx, o, joinFileExists)
+	go app.run(ctx, o, joinFileExists, relocate)
+
+	if o.BackupSink != nil {
+		app.backupCh = make(chan struct{})
+		go app.backupLoop(ctx, o)
+	}
+
+	if len(o.HandoverSignals) > 0 {
+		app.handleSignals(ctx, o.HandoverSignals)
+	}
 
 	return app, nil
 }
 
+// Maximum time spent handing over when a signal is received, so that the node
+// gets closed within the default termination grace period of Kubernetes pods,
+// which is 30 seconds.
+const signalHandoverTimeout = 20 * time.Second
+
+// Hand over and close the node when one of the given signals is received,
+// until the given context is done.
+func (a *App) handleSignals(ctx context.Context, signals []os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			signal.Stop(ch)
+			return
+		case sig := <-ch:
+			a.info("received %s, handing over", sig)
+		}
+
+		// Restore the default behavior, so that a second signal can
+		// terminate the process if handing over takes too long.
+		signal.Stop(ch)
+
+		handoverCtx, cancel := context.WithTimeout(context.Background(), signalHandoverTimeout)
+		defer cancel()
+		if err := a.Handover(handoverCtx); err != nil {
+			a.warn("handover: %v", err)
+		}
+		if err := a.Close(); err != nil {
+			a.error("close: %v", err)
+		}
+	}()
+}
+
+// HandoverError is returned by Handover when some of the responsibilities of
+// the node could not be handed over.
+type HandoverError struct {
+	Role       client.NodeRole // Role still held by the node, or -1 if it was handed over.
+	Leadership bool            // Whether the node could not transfer leadership.
+	Err        error           // Underlying cause.
+}
+
+func (e *HandoverError) Error() string {
+	return fmt.Sprintf("handover: %v", e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e *HandoverError) Unwrap() error {
+	return e.Err
+}
+
+// Return the role held by the node with the given ID among the given nodes,
+// if it's one that Handover transfers, or -1.
+func handoverRole(nodes []client.NodeInfo, id uint64) client.NodeRole {
+	for _, node := range nodes {
+		if node.ID == id && (node.Role == client.Voter || node.Role == client.StandBy) {
+			return node.Role
+		}
+	}
+	return -1
+}
+
 // Handover transfers all responsibilities for this node (such has leadership
 // and voting rights) to another node, if one is available.
 //
 // This method should always be called before invoking Close(), in order to
 // gracefully shutdown a node.
-func (a *App) Handover(ctx context.Context) error {
-	// Set a hard limit of one minute, in case the user-provided context
-	// has no expiration. That avoids the call to stop responding forever
-	// in case a majority of the cluster is down and no leader is available.
-	// Watch out when removing or editing this context, the for loop at the
-	// end of this function will possibly run "forever" without it.
+//
+// All errors are returned as a *HandoverError, describing what the node still
+// holds.
+func (a *App) Handover(ctx context.Context, options ...HandoverOption) error {
+	o := defaultHandoverOptions()
+	for _, option := range options {
+		option(o)
+	}
+
+	// Set a hard limit, in case the user-provided context has no
+	// expiration. That avoids the call to stop responding forever in case
+	// a majority of the cluster is down and no leader is available. Watch
+	// out when removing or editing this context, the for loop at the end
+	// of this function will possibly run "forever" without it.
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, time.Minute)
+	ctx, cancel = context.WithTimeout(ctx, o.Timeout)
 	defer cancel()
 
+	// Until the current configuration is fetched, the role reported on
+	// failure is the one held according to the last known configuration.
+	role := client.NodeRole(-1)
+	if nodes, err := a.store.Get(ctx); err == nil {
+		role = handoverRole(nodes, a.id)
+	}
+
 	cli, err := a.Leader(ctx)
 	if err != nil {
-		return fmt.Errorf("find leader: %w", err)
+		return &HandoverError{Role: role, Err: fmt.Errorf("find leader: %w", err)}
 	}
 	defer cli.Close()
 
 	// Possibly transfer our role.
 	nodes, err := cli.Cluster(ctx)
 	if err != nil {
-		return fmt.Errorf("cluster servers: %w", err)
+		return &HandoverError{Role: role, Err: fmt.Errorf("cluster servers: %w", err)}
 	}
 
 	changes := a.makeRolesChanges(nodes)
 
 	role, candidates := changes.Handover(a.id)
+	candidates = preferNode(candidates, o.Successor)
 
 	if role != -1 {
 		for i, node := range candidates {
@@ -347,7 +602,10 @@ func (a *App) Handover(ctx context.Context) error {
 				a.warn("promote %s from %s to %s: %v", node.Address, node.Role, role, err)
 				if i == len(candidates)-1 {
 					// We could not promote any node
-					return fmt.Errorf("could not promote any online node to %s", role)
+					return &HandoverError{
+						Role: role,
+						Err:  fmt.Errorf("could not promote any online node to %s", role),
+					}
 				}
 				continue
 			}
@@ -359,15 +617,19 @@ func (a *App) Handover(ctx context.Context) error {
 	// Check if we are the current leader and transfer leadership if so.
 	leader, err := cli.Leader(ctx)
 	if err != nil {
-		return fmt.Errorf("leader address: %w", err)
+		return &HandoverError{Role: role, Err: fmt.Errorf("leader address: %w", err)}
 	}
 	if leader != nil && leader.Address == a.address {
 		nodes, err := cli.Cluster(ctx)
 		if err != nil {
-			return fmt.Errorf("cluster servers: %w", err)
+			return &HandoverError{
+				Role:       role,
+				Leadership: true,
+				Err:        fmt.Errorf("cluster servers: %w", err),
+			}
 		}
 		changes := a.makeRolesChanges(nodes)
-		voters := changes.list(client.Voter, true, nil)
+		voters := preferNode(changes.list(client.Voter, true, nil), o.Successor)
 
 		for i, voter := range voters {
 			if voter.Address == a.address {
@@ -376,12 +638,16 @@ func (a *App) Handover(ctx context.Context) error {
 			if err := cli.Transfer(ctx, voter.ID); err != nil {
 				a.warn("transfer leadership to %s: %v", voter.Address, err)
 				if i == len(voters)-1 {
-					return fmt.Errorf("transfer leadership: %w", err)
+					return &HandoverError{
+						Role:       role,
+						Leadership: true,
+						Err:        fmt.Errorf("transfer leadership: %w", err),
+					}
 				}
 			}
 			cli, err = a.Leader(ctx)
 			if err != nil {
-				return fmt.Errorf("find new leader: %w", err)
+				return &HandoverError{Role: role, Err: fmt.Errorf("find new leader: %w", err)}
 			}
 			defer cli.Close()
 			break
@@ -400,7 +666,10 @@ func (a *App) Handover(ctx context.Context) error {
 			}
 			select {
 			case <-ctx.Done():
-				return fmt.Errorf("demote ourselves context done: %w", err)
+				return &HandoverError{
+					Role: role,
+					Err:  fmt.Errorf("demote ourselves context done: %w", err),
+				}
 			default:
 				// Wait a bit before trying again
 				time.Sleep(time.Second)
@@ -412,17 +681,171 @@ func (a *App) Handover(ctx context.Context) error {
 	return nil
 }
 
+// Drain prepares this node for a restart, without causing write
+// unavailability windows in the rest of the cluster.
+//
+// It waits for the transactions started through this node's driver to finish,
+// transfers leadership to another voter if this node is the leader and, if
+// this node is a voter, promotes another node to voter and demotes this one to
+// stand-by. Once restarted, the node will be promoted back as needed by the
+// automatic roles adjustment.
+//
+// While Drain runs, beginning new transactions through this node's driver
+// fails with driver.ErrTransactionsPaused. If no stand-by can be promoted in
+// place of this node, it's not demoted, and an error is returned once
+// leadership has been transferred.
+//
+// Orchestration systems can use it to restart nodes one at a time.
+func (a *App) Drain(ctx context.Context) error {
+	// Set a hard limit of one minute, like Handover does.
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	// Refuse new transactions, so the ones in progress can't keep us
+	// waiting forever.
+	resume := a.driver.PauseTransactions()
+	defer resume()
+
+	for a.driver.Stats().Transactions > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for in-flight transactions: %w", ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	cli, err := a.Leader(ctx)
+	if err != nil {
+		return fmt.Errorf("find leader: %w", err)
+	}
+	defer cli.Close()
+
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return fmt.Errorf("cluster servers: %w", err)
+	}
+	changes := a.makeRolesChanges(nodes)
+	self := changes.get(a.id)
+	if self == nil || self.Role != client.Voter {
+		return nil
+	}
+
+	// Replace ourselves as voter.
+	promoted := false
+	for _, node := range changes.list(client.StandBy, true, nil) {
+		if err := cli.Assign(ctx, node.ID, client.Voter); err != nil {
+			a.warn("promote %s from %s to voter: %v", node.Address, node.Role, err)
+			continue
+		}
+		a.debug("promoted %s from %s to voter", node.Address, node.Role)
+		promoted = true
+		break
+	}
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		return fmt.Errorf("leader address: %w", err)
+	}
+	if leader != nil && leader.ID == a.id {
+		nodes, err := cli.Cluster(ctx)
+		if err != nil {
+			return fmt.Errorf("cluster servers: %w", err)
+		}
+		changes := a.makeRolesChanges(nodes)
+		transferred := false
+		for _, voter := range changes.list(client.Voter, true, nil) {
+			if voter.ID == a.id {
+				continue
+			}
+			if err := cli.Transfer(ctx, voter.ID); err != nil {
+				a.warn("transfer leadership to %s: %v", voter.Address, err)
+				continue
+			}
+			transferred = true
+			break
+		}
+		if !transferred {
+			return fmt.Errorf("could not transfer leadership to any online voter")
+		}
+		if cli, err = a.Leader(ctx); err != nil {
+			return fmt.Errorf("find new leader: %w", err)
+		}
+		defer cli.Close()
+	}
+
+	// Demoting ourselves without a replacement would reduce the number of
+	// voters, and thus the number of failures the cluster can tolerate.
+	if !promoted {
+		return fmt.Errorf("could not promote any online stand-by to voter: stay voter")
+	}
+
+	// The new leader might need to commit an entry from its new term before
+	// accepting configuration changes, so retry for a while.
+	for {
+		err = cli.Assign(ctx, a.id, client.StandBy)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("demote ourselves to stand-by: %w", err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Return a copy of the given nodes, with the node with the given ID moved to
+// the front if present.
+func preferNode(nodes []client.NodeInfo, id uint64) []client.NodeInfo {
+	sorted := make([]client.NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		if node.ID == id {
+			sorted = append(sorted, node)
+		}
+	}
+	for _, node := range nodes {
+		if node.ID != id {
+			sorted = append(sorted, node)
+		}
+	}
+	return sorted
+}
+
 // Close the application node, releasing all resources it created.
+//
+// It's safe to call Close multiple times: calls after the first one return
+// the same result.
 func (a *App) Close() error {
+	a.closeOnce.Do(func() {
+		a.closeErr = a.close()
+		close(a.doneCh)
+	})
+	return a.closeErr
+}
+
+// Done returns a channel that is closed once the application node has been
+// closed, either by App.Close or because of a signal configured with
+// WithAutoHandover.
+func (a *App) Done() <-chan struct{} {
+	return a.doneCh
+}
+
+func (a *App) close() error {
 	// Stop the run goroutine.
 	a.stop()
 	<-a.runCh
+	if a.backupCh != nil {
+		<-a.backupCh
+	}
+	a.listeners.Wait()
 
 	if a.listener != nil {
 		a.listener.Close()
 		<-a.proxyCh
 	}
-	if err := a.node.Close(); err != nil {
+	// The node was already stopped if its extensions didn't match.
+	if err := a.node.Close(); err != nil && err != dqlite.ErrAlreadyClosed {
 		return err
 	}
 	return nil
@@ -443,6 +866,20 @@ func (a *App) Driver() string {
 	return a.driverName
 }
 
+// Return true if this node is part of the cluster with its own address.
+func (a *App) joined(ctx context.Context, cli *client.Client) (bool, error) {
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get cluster servers: %w", err)
+	}
+	for _, node := range nodes {
+		if node.ID == a.id && node.Address == a.address {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Ready can be used to wait for a node to complete some initial tasks that are
 // initiated at startup. For example a brand new node will attempt to join the
 // cluster, a restarted node will check if it should assume some particular
@@ -451,16 +888,22 @@ func (a *App) Driver() string {
 // If this method returns without error it means that those initial tasks have
 // succeeded and follow-up operations like Open() are more likely to succeeed
 // quickly.
+//
+// If the node can't take part in the cluster, for example because it loads
+// different SQLite extensions than the other nodes or because another node has
+// the same ID, an error describing why is returned.
 func (a *App) Ready(ctx context.Context) error {
 	select {
 	case <-a.readyCh:
-		return nil
+		return a.readyErr
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
 
-// Open the dqlite database with the given name
+// Open the dqlite database with the given name, creating it if needed. The
+// database is added to the list returned by Databases, the first time it's
+// opened by this node.
 func (a *App) Open(ctx context.Context, database string) (*sql.DB, error) {
 	db, err := sql.Open(a.Driver(), database)
 	if err != nil {
@@ -482,6 +925,10 @@ func (a *App) Open(ctx context.Context, database string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if database != registryDatabase {
+		a.maybeRegisterDatabase(ctx, database)
+	}
+
 	return db, nil
 }
 
@@ -493,48 +940,159 @@ func (a *App) Leader(ctx context.Context, options ...client.Option) (*client.Cli
 	return client.FindLeader(ctx, a.store, allOptions...)
 }
 
+// LeaderInfo returns information about the current cluster leader.
+func (a *App) LeaderInfo(ctx context.Context) (*client.NodeInfo, error) {
+	cli, err := a.Leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	return cli.Leader(ctx)
+}
+
 // Client returns a client connected to the local node.
 func (a *App) Client(ctx context.Context) (*client.Client, error) {
 	return client.New(ctx, a.nodeBindAddress)
 }
 
+// Return the delay to wait before accepting connections again after a
+// temporary error, given the delay used after the previous consecutive one,
+// if any.
+func acceptBackoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		return time.Second
+	}
+	return delay
+}
+
 // Proxy incoming TLS connections.
+//
+// Temporary errors returned by the listener are retried with backoff, while
+// fatal ones stop the loop and are reported to the accept error hook.
 func (a *App) proxy() {
 	wg := sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(a.ctx)
+	defer func() {
+		cancel()
+		wg.Wait()
+		close(a.proxyCh)
+	}()
+
+	delay := time.Duration(0) // Backoff delay after temporary errors.
 	for {
 		client, err := a.listener.Accept()
 		if err != nil {
-			cancel()
-			wg.Wait()
-			close(a.proxyCh)
+			// The listener is closed by Close() after stopping the
+			// context, don't report that.
+			if ctx.Err() != nil {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				delay = acceptBackoff(delay)
+				a.warn("accept connection: %v; retrying in %s", err, delay)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				continue
+			}
+			a.error("accept connection: %v", err)
+			a.options.OnAcceptError(err)
 			return
 		}
+		delay = 0
 		address := client.RemoteAddr()
-		a.debug("new connection from %s", address)
-		server, err := net.Dial("unix", a.nodeBindAddress)
-		if err != nil {
-			a.error("dial local node: %v", err)
+		if !a.limiter.acquire(address) {
+			a.warn("reject connection from %s: limit reached", address)
 			client.Close()
 			continue
 		}
+		a.debug("new connection from %s", address)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := proxy(ctx, client, server, a.tls.Listen); err != nil {
+			defer a.limiter.release()
+			client, err := a.accept(client)
+			if err != nil {
+				a.warn("reject connection from %s: %v", address, err)
+				return
+			}
+			config := a.tls.Listen
+			if a.auth != nil {
+				// The token is sent after the TLS handshake.
+				client = tls.Server(client, config)
+				config = nil
+				if err := a.authenticate(client); err != nil {
+					a.warn("reject connection from %s: %v", address, err)
+					return
+				}
+			}
+			server, err := net.Dial("unix", a.nodeBindAddress)
+			if err != nil {
+				a.error("dial local node: %v", err)
+				client.Close()
+				return
+			}
+			if err := proxy(ctx, client, server, config); err != nil {
 				a.error("proxy: %v", err)
 			}
 		}()
 	}
 }
 
+// Run the accept function set with WithAcceptFunc, if any, on the given
+// incoming connection. The connection is closed if rejected.
+func (a *App) accept(conn net.Conn) (net.Conn, error) {
+	if a.acceptFunc == nil {
+		return conn, nil
+	}
+	accepted, err := a.acceptFunc(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// Check the token sent on the given connection, if authentication was enabled
+// with WithAuth. The connection is closed if the token is rejected.
+func (a *App) authenticate(conn net.Conn) error {
+	if a.auth == nil {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(authTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	token, err := protocol.ReadAuthToken(conn)
+	if err == nil {
+		err = a.auth.Verify(token)
+	}
+	if writeErr := protocol.WriteAuthResult(conn, err == nil); err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("authenticate: %w", err)
+	}
+
+	return nil
+}
+
 // Run background tasks. The join flag is true if the node is a brand new one
 // and should join the cluster.
-func (a *App) run(ctx context.Context, options *options, join bool) {
+func (a *App) run(ctx context.Context, options *options, join, relocate bool) {
 	defer close(a.runCh)
 
 	delay := time.Duration(0)
 	ready := false
+	leaderID := uint64(0) // ID of the last leader seen.
+	checkExtensions := true
 	for {
 		select {
 		case <-ctx.Done():
@@ -550,10 +1108,50 @@ func (a *App) run(ctx context.Context, options *options, join bool) {
 				continue
 			}
 
+			// Make sure we load the same SQLite extensions as the
+			// rest of the cluster before taking part in it. If we
+			// don't, stop the dqlite node, since as a member of an
+			// existing cluster it would otherwise keep voting and
+			// applying transactions that might use them.
+			if checkExtensions {
+				err := a.checkExtensions(ctx, cli, options.Extensions)
+				if errors.Is(err, ErrExtensionsMismatch) {
+					a.error("%v", err)
+					cli.Close()
+					if err := a.node.Close(); err != nil {
+						a.error("stop node: %v", err)
+					}
+					a.readyErr = err
+					close(a.readyCh)
+					return
+				}
+				if err != nil {
+					a.warn("check SQLite extensions: %v", err)
+					delay = time.Second
+					cli.Close()
+					continue
+				}
+				checkExtensions = false
+			}
+
 			// Attempt to join the cluster if this is a brand new node.
 			if join {
 				info := client.NodeInfo{ID: a.id, Address: a.address, Role: client.Spare}
-				if err := cli.Add(ctx, info); err != nil {
+				err := cli.Add(ctx, info)
+				if errors.Is(err, client.ErrDuplicateID) {
+					// Either a previous attempt went through, or
+					// another node has our ID, which won't change.
+					joined, checkErr := a.joined(ctx, cli)
+					if checkErr == nil && !joined {
+						a.error("join cluster: %v", err)
+						a.readyErr = err
+						close(a.readyCh)
+						cli.Close()
+						return
+					}
+					err = checkErr
+				}
+				if err != nil {
 					a.warn("join cluster: %v", err)
 					delay = time.Second
 					cli.Close()
@@ -566,6 +1164,25 @@ func (a *App) run(ctx context.Context, options *options, join bool) {
 
 			}
 
+			// Update our address in the cluster configuration if it
+			// changed since the last time we were started.
+			if relocate {
+				if err := a.relocate(ctx, cli); err != nil {
+					if err == errLeadershipTransferred {
+						a.debug("update address: %v, retry with the new leader", err)
+					} else {
+						a.warn("update address: %v", err)
+					}
+					delay = time.Second
+					cli.Close()
+					continue
+				}
+				relocate = false
+				if err := fileRemove(a.dir, relocateFile); err != nil {
+					a.error("remove relocate file: %v", err)
+				}
+			}
+
 			// Refresh our node store.
 			servers, err := cli.Cluster(ctx)
 			if err != nil {
@@ -601,6 +1218,14 @@ func (a *App) run(ctx context.Context, options *options, join bool) {
 				a.warn("adjust roles: %v", err)
 			}
 
+			// If we are the leader, let's see if any node should
+			// be removed because it disappeared from DNS.
+			if options.Discovery != nil {
+				if err := a.maybePruneNodes(ctx, cli, options.Discovery); err != nil {
+					a.warn("prune nodes: %v", err)
+				}
+			}
+
 			leader, err := cli.Leader(ctx)
 			if err != nil {
 				a.error("fetch leader info: %v", err)
@@ -608,6 +1233,11 @@ func (a *App) run(ctx context.Context, options *options, join bool) {
 				continue
 			}
 
+			if leader.ID != leaderID {
+				a.traceLeaderChange(ctx, leaderID, *leader)
+				leaderID = leader.ID
+			}
+
 			err = options.OnRolesAdjustment(*leader, servers)
 			if err != nil {
 				a.warn("roles adjustment hook: %v", err)
@@ -618,6 +1248,112 @@ func (a *App) run(ctx context.Context, options *options, join bool) {
 	}
 }
 
+// Record a change of the raft leader as observed by this node.
+func (a *App) traceLeaderChange(ctx context.Context, previous uint64, leader client.NodeInfo) {
+	a.debug("leader changed from %d to %d (%s)", previous, leader.ID, leader.Address)
+	_, span := tracing.Start(ctx, "dqlite.raft.LeaderChange", "")
+	tracing.SetAttributes(span,
+		tracing.Attribute{Key: tracing.LeaderIDKey, Value: leader.ID},
+		tracing.Attribute{Key: tracing.NodeAddressKey, Value: leader.Address},
+	)
+	span.End()
+}
+
+// Returned by relocate when this node was the leader and handed leadership
+// over, so the update must be re-tried with the new leader.
+var errLeadershipTransferred = errors.New("leadership transferred")
+
+// Update the address of this node in the cluster configuration, using the
+// given client connected to the leader.
+//
+// Since there's no way to change the address of an existing member, the node
+// is removed and added back with its new address and its previous role.
+func (a *App) relocate(ctx context.Context, cli *client.Client) error {
+	servers, err := cli.Cluster(ctx)
+	if err != nil {
+		return fmt.Errorf("get cluster servers: %w", err)
+	}
+
+	var node *client.NodeInfo
+	for i := range servers {
+		if servers[i].ID == a.id {
+			node = &servers[i]
+			break
+		}
+	}
+
+	// A previous attempt removed the node but failed to add it back. Add
+	// it as spare and let the startup promotion restore its role.
+	if node == nil {
+		info := client.NodeInfo{ID: a.id, Address: a.address, Role: client.Spare}
+		if err := cli.Add(ctx, info); err != nil {
+			return fmt.Errorf("add node with new address: %w", err)
+		}
+		return nil
+	}
+	if node.Address == a.address {
+		return nil
+	}
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		return fmt.Errorf("get leader: %w", err)
+	}
+
+	// The leader can't remove itself, hand leadership over to another
+	// voter first. The next attempt will talk to the new leader.
+	if leader.ID == a.id {
+		for _, server := range servers {
+			if server.ID == a.id || server.Role != client.Voter {
+				continue
+			}
+			if err := cli.Transfer(ctx, server.ID); err != nil {
+				return fmt.Errorf("transfer leadership: %w", err)
+			}
+			return errLeadershipTransferred
+		}
+		return fmt.Errorf("no voter to transfer leadership to")
+	}
+
+	a.info("update address from %s to %s", node.Address, a.address)
+
+	if err := cli.Remove(ctx, a.id); err != nil {
+		return fmt.Errorf("remove node with old address: %w", err)
+	}
+	info := client.NodeInfo{ID: a.id, Address: a.address, Role: node.Role}
+	if err := cli.Add(ctx, info); err != nil {
+		return fmt.Errorf("add node with new address: %w", err)
+	}
+
+	return nil
+}
+
+// If the node store shows that the given node is the only member of the
+// cluster, force a new configuration with its new address and update the store.
+// This must be done before the node is started.
+//
+// Return true if the node is part of a larger cluster, and the leader must be
+// asked to update the configuration instead.
+func relocateSingleNode(store client.NodeStore, info client.NodeInfo, previousAddress, dir string) (bool, error) {
+	nodes, err := store.Get(context.Background())
+	if err != nil {
+		return false, fmt.Errorf("get servers from store: %w", err)
+	}
+	if len(nodes) != 1 || (nodes[0].ID != info.ID && nodes[0].Address != previousAddress) {
+		return true, nil
+	}
+
+	node := dqlite.NodeInfo{ID: info.ID, Address: info.Address, Role: client.Voter}
+	if err := dqlite.ReconfigureMembershipExt(dir, []dqlite.NodeInfo{node}); err != nil {
+		return false, fmt.Errorf("reconfigure membership with new address: %w", err)
+	}
+	if err := store.Set(context.Background(), []client.NodeInfo{node}); err != nil {
+		return false, fmt.Errorf("update node store: %w", err)
+	}
+
+	return false, nil
+}
+
 // Possibly change our own role at startup.
 func (a *App) maybePromoteOurselves(ctx context.Context, cli *client.Client, nodes []client.NodeInfo) error {
 	roles := a.makeRolesChanges(nodes)
@@ -739,7 +1475,21 @@ func (a *App) makeRolesChanges(nodes []client.NodeInfo) RolesChanges {
 
 // Return the options to use for client.FindLeader() or client.New()
 func (a *App) clientOptions() []client.Option {
-	return []client.Option{client.WithDialFunc(a.dialFunc), client.WithLogFunc(a.log), client.WithConcurrentLeaderConns(*a.options.ConcurrentLeaderConns)}
+	return []client.Option{client.WithDialFunc(a.dialFunc), client.WithLogFunc(a.log), client.WithConcurrentLeaderConns(*a.options.ConcurrentLeaderConns),
+		client.WithMaxMessageSize(a.options.MaxMessageSize)}
+}
+
+// SetLogLevel changes the minimum level of the messages passed to the log
+// function, see WithLogLevel. It takes effect immediately for all messages
+// emitted by the App, the driver and the clients it creates, so verbose
+// logging can be turned on while diagnosing a problem without restarting the
+// node.
+//
+// Messages logged by libdqlite and libraft are not affected, since their
+// tracing is controlled by the LIBDQLITE_TRACE and LIBRAFT_TRACE environment
+// variables, which are read only once at startup.
+func (a *App) SetLogLevel(level client.LogLevel) {
+	a.logLevel.Set(level)
 }
 
 func (a *App) debug(format string, args ...interface{}) {
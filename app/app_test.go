@@ -3,24 +3,35 @@ package app_test
 import (
 	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
 	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/canonical/go-dqlite"
 	"github.com/canonical/go-dqlite/app"
 	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/driver"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -59,6 +70,39 @@ func TestNew_PristineJoiner(t *testing.T) {
 	assert.Equal(t, client.Spare, cluster[1].Role)
 }
 
+// A node whose SQLite extensions differ from the rest of the cluster doesn't
+// join it, and stops its dqlite node.
+func TestNew_ExtensionsMismatch(t *testing.T) {
+	addr1 := "127.0.0.1:9001"
+	addr2 := "127.0.0.1:9002"
+
+	app1, cleanup := newApp(t, app.WithAddress(addr1))
+	defer cleanup()
+
+	require.NoError(t, app1.Ready(context.Background()))
+
+	// Pretend that the first node loads an extension.
+	db, err := sql.Open(app1.Driver(), "dqlite-extensions")
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE nodes SET extensions = 'foo' WHERE id = ?", int64(app1.ID()))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	app2, cleanup := newApp(t, app.WithAddress(addr2), app.WithCluster([]string{addr1}))
+	defer cleanup()
+
+	err = app2.Ready(context.Background())
+	assert.True(t, errors.Is(err, app.ErrExtensionsMismatch))
+
+	cli, err := app1.Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, cluster, 1)
+}
+
 // Restart a node that had previously joined the cluster successfully.
 func TestNew_JoinerRestart(t *testing.T) {
 	addr1 := "127.0.0.1:9001"
@@ -82,6 +126,102 @@ func TestNew_JoinerRestart(t *testing.T) {
 	require.NoError(t, app2.Ready(context.Background()))
 }
 
+// Restart a single node with a different address.
+func TestNew_SingleNodeAddressChange(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	app1, cleanup := newAppWithDir(t, dir, app.WithAddress("127.0.0.1:9001"))
+	require.NoError(t, app1.Ready(context.Background()))
+	cleanup()
+
+	app1, cleanup = newAppWithDir(t, dir, app.WithAddress("127.0.0.1:9011"))
+	defer cleanup()
+
+	require.NoError(t, app1.Ready(context.Background()))
+	assert.Equal(t, "127.0.0.1:9011", app1.Address())
+
+	cli, err := app1.Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cluster, 1)
+	assert.Equal(t, "127.0.0.1:9011", cluster[0].Address)
+}
+
+// An address change that was persisted but not applied to the cluster
+// configuration is applied at the next restart, even if the address is the
+// same.
+func TestNew_PendingAddressChange(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	app1, cleanup := newAppWithDir(t, dir, app.WithAddress("127.0.0.1:9001"))
+	require.NoError(t, app1.Ready(context.Background()))
+	cleanup()
+
+	// Simulate a node stopped right after persisting its new address.
+	info, err := ioutil.ReadFile(filepath.Join(dir, "info.yaml"))
+	require.NoError(t, err)
+	info = []byte(strings.Replace(string(info), "127.0.0.1:9001", "127.0.0.1:9011", 1))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "info.yaml"), info, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "relocate.yaml"), []byte("127.0.0.1:9001\n"), 0600))
+
+	app1, cleanup = newAppWithDir(t, dir, app.WithAddress("127.0.0.1:9011"))
+	defer cleanup()
+
+	require.NoError(t, app1.Ready(context.Background()))
+
+	cli, err := app1.Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cluster, 1)
+	assert.Equal(t, "127.0.0.1:9011", cluster[0].Address)
+
+	_, err = os.Stat(filepath.Join(dir, "relocate.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// Restart a node that had previously joined the cluster with a different
+// address.
+func TestNew_JoinerAddressChange(t *testing.T) {
+	addr1 := "127.0.0.1:9001"
+	addr2 := "127.0.0.1:9002"
+	addr3 := "127.0.0.1:9012"
+
+	app1, cleanup := newApp(t, app.WithAddress(addr1))
+	defer cleanup()
+
+	require.NoError(t, app1.Ready(context.Background()))
+
+	dir2, cleanup := newDir(t)
+	defer cleanup()
+
+	app2, cleanup := newAppWithDir(t, dir2, app.WithAddress(addr2), app.WithCluster([]string{addr1}))
+	require.NoError(t, app2.Ready(context.Background()))
+	cleanup()
+
+	app2, cleanup = newAppWithDir(t, dir2, app.WithAddress(addr3))
+	defer cleanup()
+
+	require.NoError(t, app2.Ready(context.Background()))
+
+	cli, err := app1.Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cluster, 2)
+	assert.Equal(t, app2.ID(), cluster[1].ID)
+	assert.Equal(t, addr3, cluster[1].Address)
+}
+
 // The second joiner promotes itself and also the first joiner.
 func TestNew_SecondJoiner(t *testing.T) {
 	addr1 := "127.0.0.1:9001"
@@ -298,6 +438,41 @@ func TestHandover_Voter(t *testing.T) {
 	assert.Equal(t, client.Voter, cluster[3].Role)
 }
 
+// When a successor is given to Handover(), it's preferred over other
+// candidates.
+func TestHandover_Successor(t *testing.T) {
+	n := 5
+	apps := make([]*app.App, n)
+
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("127.0.0.1:900%d", i+1)
+		options := []app.Option{app.WithAddress(addr)}
+		if i > 0 {
+			options = append(options, app.WithCluster([]string{"127.0.0.1:9001"}))
+		}
+
+		app, cleanup := newApp(t, options...)
+		defer cleanup()
+
+		require.NoError(t, app.Ready(context.Background()))
+
+		apps[i] = app
+	}
+
+	cli, err := apps[0].Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	require.NoError(t, apps[2].Handover(context.Background(), app.WithHandoverSuccessor(apps[4].ID())))
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, client.Spare, cluster[2].Role)
+	assert.Equal(t, client.StandBy, cluster[3].Role)
+	assert.Equal(t, client.Voter, cluster[4].Role)
+}
+
 // In a two-node cluster only one of them is a voter. When Handover() is called
 // on the voter, the role and leadership are transfered.
 func TestHandover_TwoNodes(t *testing.T) {
@@ -532,7 +707,180 @@ func TestHandover_TransferLeadership(t *testing.T) {
 	assert.Equal(t, client.Voter, cluster[3].Role)
 }
 
+// The node hands over and closes itself when receiving one of the configured
+// signals.
+func TestHandover_AutoHandover(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9001"), app.WithAutoHandover(syscall.SIGUSR1))
+	defer cleanup()
+
+	require.NoError(t, app.Ready(context.Background()))
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case <-app.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("node not closed after signal")
+	}
+
+	// Closing again is harmless.
+	require.NoError(t, app.Close())
+}
+
+// Callbacks are notified of the role and leadership of the node.
+func TestOnLeadershipAcquired(t *testing.T) {
+	roles := make(chan [2]client.NodeRole, 1)
+	acquired := make(chan struct{}, 1)
+	lost := make(chan struct{}, 1)
+
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9001"))
+	defer cleanup()
+
+	require.NoError(t, app.Ready(context.Background()))
+
+	app.OnRoleChange(func(old, new client.NodeRole) { roles <- [2]client.NodeRole{old, new} })
+	app.OnLeadershipAcquired(func() { acquired <- struct{}{} })
+	app.OnLeadershipLost(func() { lost <- struct{}{} })
+
+	select {
+	case change := <-roles:
+		assert.Equal(t, [2]client.NodeRole{-1, client.Voter}, change)
+	case <-time.After(5 * time.Second):
+		t.Fatal("role change not notified")
+	}
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership not acquired")
+	}
+
+	require.NoError(t, app.Close())
+
+	select {
+	case <-lost:
+	default:
+		t.Fatal("leadership not lost on close")
+	}
+}
+
 // If a voter goes offline, another node takes its place.
+// When Drain() is called on the leader, leadership is transferred and the node
+// is demoted to stand-by after a replacement voter is promoted.
+func TestDrain_Leader(t *testing.T) {
+	n := 4
+	apps := make([]*app.App, n)
+
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("127.0.0.1:900%d", i+1)
+		options := []app.Option{app.WithAddress(addr)}
+		if i > 0 {
+			options = append(options, app.WithCluster([]string{"127.0.0.1:9001"}))
+		}
+
+		app, cleanup := newApp(t, options...)
+		defer cleanup()
+
+		require.NoError(t, app.Ready(context.Background()))
+
+		apps[i] = app
+	}
+
+	require.NoError(t, apps[0].Drain(context.Background()))
+
+	cli, err := apps[1].Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	leader, err := cli.Leader(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, apps[0].ID(), leader.ID)
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, client.StandBy, cluster[0].Role)
+	assert.Equal(t, client.Voter, cluster[1].Role)
+	assert.Equal(t, client.Voter, cluster[2].Role)
+	assert.Equal(t, client.Voter, cluster[3].Role)
+}
+
+// New transactions are refused while Drain() waits for the ones in progress.
+func TestDrain_PauseTransactions(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9001"))
+	defer cleanup()
+
+	require.NoError(t, app.Ready(context.Background()))
+
+	db, err := app.Open(context.Background(), "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Drain(context.Background())
+	}()
+
+	// Wait for Drain() to pause transactions.
+	for i := 0; ; i++ {
+		_, err = db.Begin()
+		if err != nil {
+			break
+		}
+		require.True(t, i < 100, "transactions not paused")
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, driver.ErrTransactionsPaused, err)
+
+	// There's no other voter to hand over to, so Drain() fails once the
+	// transaction is done.
+	require.NoError(t, tx.Commit())
+	assert.EqualError(t, <-done, "could not transfer leadership to any online voter")
+
+	// Transactions are accepted again once Drain() returns.
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+}
+
+// If no stand-by can replace the draining voter, it stays a voter.
+func TestDrain_NoReplacement(t *testing.T) {
+	n := 3
+	apps := make([]*app.App, n)
+
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("127.0.0.1:900%d", i+1)
+		options := []app.Option{app.WithAddress(addr)}
+		if i > 0 {
+			options = append(options, app.WithCluster([]string{"127.0.0.1:9001"}))
+		}
+
+		app, cleanup := newApp(t, options...)
+		defer cleanup()
+
+		require.NoError(t, app.Ready(context.Background()))
+
+		apps[i] = app
+	}
+
+	err := apps[0].Drain(context.Background())
+	assert.EqualError(t, err, "could not promote any online stand-by to voter: stay voter")
+
+	cli, err := apps[1].Leader(context.Background())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	leader, err := cli.Leader(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, apps[0].ID(), leader.ID)
+
+	cluster, err := cli.Cluster(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, client.Voter, cluster[0].Role)
+}
+
 func TestRolesAdjustment_ReplaceVoter(t *testing.T) {
 	n := 4
 	apps := make([]*app.App, n)
@@ -943,7 +1291,537 @@ func TestOpen(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDatabases(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	db, err := app.Open(context.Background(), "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), "CREATE TABLE foo(n INT)")
+	require.NoError(t, err)
+	_, err = db.ExecContext(context.Background(), `CREATE TABLE "a""b"(n INT)`)
+	require.NoError(t, err)
+
+	// Opening the database again doesn't register it twice.
+	other, err := app.Open(context.Background(), "test")
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+
+	names, err := app.Databases(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test"}, names)
+
+	require.NoError(t, app.Drop(context.Background(), "test"))
+
+	names, err = app.Databases(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, err = db.ExecContext(context.Background(), "SELECT n FROM foo")
+	assert.Error(t, err)
+	_, err = db.ExecContext(context.Background(), `SELECT n FROM "a""b"`)
+	assert.Error(t, err)
+}
+
+func TestCrossQuery(t *testing.T) {
+	queries := []app.CrossQuery{
+		{Database: "users", Query: "SELECT id, name FROM users"},
+		{Database: "orders", Query: "SELECT user, item FROM orders WHERE user = ?", Args: []interface{}{1}},
+	}
+	names := map[int]string{}
+	items := []string{}
+	join := func(query app.CrossQuery, rows *sql.Rows) error {
+		for rows.Next() {
+			var id int
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				return err
+			}
+			if query.Database == "users" {
+				names[id] = value
+			} else {
+				items = append(items, names[id]+": "+value)
+			}
+		}
+		return nil
+	}
+
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	ctx := context.Background()
+
+	users, err := app.Open(ctx, "users")
+	require.NoError(t, err)
+	defer users.Close()
+
+	_, err = users.ExecContext(ctx, "CREATE TABLE users(id INT, name TEXT); INSERT INTO users VALUES(1, 'alice')")
+	require.NoError(t, err)
+
+	// Attaching another database fails with a typed error.
+	_, err = users.ExecContext(ctx, "ATTACH DATABASE 'orders' AS orders")
+	assert.Equal(t, driver.ErrAttachNotSupported, err)
+
+	orders, err := app.Open(ctx, "orders")
+	require.NoError(t, err)
+	defer orders.Close()
+
+	_, err = orders.ExecContext(ctx, "CREATE TABLE orders(user INT, item TEXT); INSERT INTO orders VALUES(1, 'book')")
+	require.NoError(t, err)
+
+	require.NoError(t, app.CrossQuery(ctx, queries, join))
+	assert.Equal(t, []string{"alice: book"}, items)
+}
+
+func TestNotify(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	require.NoError(t, app.Notify(ctx, "foo", "before"))
+
+	ch, err := app.Listen(ctx, "foo")
+	require.NoError(t, err)
+
+	require.NoError(t, app.Notify(ctx, "bar", "ignored"))
+	require.NoError(t, app.Notify(ctx, "foo", "hello"))
+	require.NoError(t, app.Notify(ctx, "foo", "world"))
+
+	for _, payload := range []string{"hello", "world"} {
+		select {
+		case notification := <-ch:
+			assert.Equal(t, "foo", notification.Channel)
+			assert.Equal(t, payload, notification.Payload)
+		case <-ctx.Done():
+			t.Fatal("notification not received")
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrations := []app.Migration{
+		{Name: "create foo", SQL: "CREATE TABLE foo(n INT)"},
+		{Name: "create bar", SQL: "CREATE TABLE bar(n INT)"},
+	}
+	dryRun := app.WithMigrateDryRun()
+
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	db, err := app.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// A dry run doesn't change the schema.
+	n, err := app.Migrate(ctx, db, migrations, dryRun)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = db.ExecContext(ctx, "SELECT n FROM foo")
+	assert.Error(t, err)
+
+	n, err = app.Migrate(ctx, db, migrations[:1])
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = app.Migrate(ctx, db, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = db.ExecContext(ctx, "SELECT n FROM bar")
+	require.NoError(t, err)
+
+	// Up to date.
+	n, err = app.Migrate(ctx, db, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// The schema is newer than the known migrations.
+	_, err = app.Migrate(ctx, db, migrations[:1])
+	assert.Error(t, err)
+}
+
+// Nodes migrating concurrently, including followers, apply the migrations
+// only once.
+func TestMigrate_Concurrent(t *testing.T) {
+	migrations := []app.Migration{
+		{Name: "create foo", SQL: "CREATE TABLE foo(n INT)"},
+		{Name: "create bar", SQL: "CREATE TABLE bar(n INT)"},
+	}
+	addr1 := "127.0.0.1:9001"
+	addr2 := "127.0.0.1:9002"
+
+	app1, cleanup := newApp(t, app.WithAddress(addr1))
+	defer cleanup()
+
+	app2, cleanup := newApp(t, app.WithAddress(addr2), app.WithCluster([]string{addr1}))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, app2.Ready(ctx))
+
+	db1, err := app1.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db1.Close()
+
+	db2, err := app2.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db2.Close()
+
+	ns := make(chan int, 2)
+	errs := make(chan error, 2)
+	for _, node := range []struct {
+		app *app.App
+		db  *sql.DB
+	}{{app1, db1}, {app2, db2}} {
+		node := node
+		go func() {
+			n, err := node.app.Migrate(ctx, node.db, migrations)
+			ns <- n
+			errs <- err
+		}()
+	}
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	assert.Equal(t, len(migrations), <-ns+<-ns)
+
+	var count int
+	require.NoError(t, db2.QueryRowContext(ctx, "SELECT count(*) FROM schema_version").Scan(&count))
+	assert.Equal(t, len(migrations), count)
+}
+
+func TestVacuum(t *testing.T) {
+	full := app.WithVacuumFull()
+	batch := app.WithVacuumBatchSize(2)
+	invalidBatch := app.WithVacuumBatchSize(0)
+	errNotIncremental := app.ErrVacuumNotIncremental
+
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	db, err := app.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE test (t TEXT)")
+	require.NoError(t, err)
+
+	// The database must be switched to incremental auto-vacuum first.
+	_, err = app.Vacuum(ctx, db)
+	assert.Equal(t, errNotIncremental, err)
+
+	_, err = app.Vacuum(ctx, db, full)
+	require.NoError(t, err)
+
+	// Fill some pages and free them.
+	for i := 0; i < 10; i++ {
+		_, err = db.ExecContext(ctx, "INSERT INTO test(t) VALUES(?)", strings.Repeat("x", 4096))
+		require.NoError(t, err)
+	}
+	_, err = db.ExecContext(ctx, "DELETE FROM test")
+	require.NoError(t, err)
+
+	var before int
+	require.NoError(t, db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before))
+	require.True(t, before > 0)
+
+	_, err = app.Vacuum(ctx, db, invalidBatch)
+	assert.EqualError(t, err, "invalid vacuum batch size 0")
+
+	n, err := app.Vacuum(ctx, db, batch)
+	require.NoError(t, err)
+	assert.Equal(t, before, n)
+
+	var free int
+	require.NoError(t, db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&free))
+	assert.Equal(t, 0, free)
+}
+
+type sumAggregate struct {
+	sum int64
+}
+
+func (a *sumAggregate) Step(args []interface{}) error {
+	a.sum += args[0].(int64)
+	return nil
+}
+
+func (a *sumAggregate) Final() (interface{}, error) {
+	return a.sum, nil
+}
+
+func TestCustomFunctions(t *testing.T) {
+	reverse := app.WithScalarFunction("reverse", 1, func(args []interface{}) (interface{}, error) {
+		s := []rune(args[0].(string))
+		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+			s[i], s[j] = s[j], s[i]
+		}
+		return string(s), nil
+	})
+	total := app.WithAggregateFunction("total_int", 1, func() dqlite.Aggregate {
+		return &sumAggregate{}
+	})
+
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"), reverse, total)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	db, err := app.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	var s string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT reverse('dqlite')").Scan(&s))
+	assert.Equal(t, "etilqd", s)
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE test (n INT)")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO test(n) VALUES(1), (2), (3)")
+	require.NoError(t, err)
+
+	var n int64
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT total_int(n) FROM test").Scan(&n))
+	assert.Equal(t, int64(6), n)
+}
+
+func TestLeaderInfo(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	require.NoError(t, app.Ready(context.Background()))
+
+	leader, err := app.LeaderInfo(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, app.ID(), leader.ID)
+	assert.Equal(t, "127.0.0.1:9000", leader.Address)
+}
+
+func TestHealthHandler(t *testing.T) {
+	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"))
+	defer cleanup()
+
+	require.NoError(t, app.Ready(context.Background()))
+
+	recorder := httptest.NewRecorder()
+	app.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var health struct {
+		Ready    bool   `json:"ready"`
+		Role     string `json:"role"`
+		IsLeader bool   `json:"is_leader"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&health))
+
+	assert.True(t, health.Ready)
+	assert.Equal(t, "voter", health.Role)
+	assert.True(t, health.IsLeader)
+}
+
 // Open a database with disk-mode on a fresh one-node cluster.
+func TestBackupSchedule(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	sink := app.NewDirBackupSink(dir)
+	app, cleanup := newApp(t,
+		app.WithBackupSchedule(100*time.Millisecond, sink),
+		app.WithBackupRetention(2),
+	)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	db, err := app.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE foo (n INT)")
+	require.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	backups, err := sink.List(ctx, "test")
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+}
+
+func TestDirBackupSink(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sink := app.NewDirBackupSink(filepath.Join(dir, "backups"))
+
+	backups, err := sink.List(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, sink.Store(ctx, "test", taken, strings.NewReader("data")))
+	require.NoError(t, sink.Store(ctx, "test-2", taken, strings.NewReader("data")))
+
+	backups, err = sink.List(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.True(t, taken.Equal(backups[0]))
+
+	require.NoError(t, sink.Delete(ctx, "test", taken))
+
+	backups, err = sink.List(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestFileCertificate(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	crt := filepath.Join(dir, "cluster.crt")
+	key := filepath.Join(dir, "cluster.key")
+	for _, name := range []string{"cluster.crt", "cluster.key"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0600))
+	}
+
+	get := app.FileCertificate(crt, key)
+
+	cert1, err := get()
+	require.NoError(t, err)
+
+	// A broken file is ignored, and the current key pair kept.
+	require.NoError(t, ioutil.WriteFile(crt, []byte("garbage"), 0600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(crt, later, later))
+
+	cert2, err := get()
+	require.NoError(t, err)
+	assert.Equal(t, cert1, cert2)
+
+	// A new key pair is picked up.
+	certPEM, keyPEM := newKeyPair(t)
+	require.NoError(t, ioutil.WriteFile(crt, certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(key, keyPEM, 0600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(crt, later, later))
+
+	cert3, err := get()
+	require.NoError(t, err)
+	assert.NotEqual(t, cert1.Certificate[0], cert3.Certificate[0])
+}
+
+func TestRotatingTLSConfig(t *testing.T) {
+	_, pool := loadCert(t)
+	get := app.FileCertificate(filepath.Join("testdata", "cluster.crt"), filepath.Join("testdata", "cluster.key"))
+
+	listen, dial, err := app.RotatingTLSConfig(get, pool)
+	require.NoError(t, err)
+
+	app, cleanup := newAppWithNoTLS(t, app.WithAddress("127.0.0.1:9000"), app.WithTLS(listen, dial))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Ready(ctx))
+
+	cli, err := app.Leader(ctx)
+	require.NoError(t, err)
+	defer cli.Close()
+}
+
+// Generate a new self-signed key pair, returning the PEM encoded certificate
+// and key.
+func newKeyPair(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dqlite"},
+		DNSNames:     []string{"dqlite"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
+
+func TestAuth(t *testing.T) {
+	app1, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"), app.WithAuth("secret", app.StaticTokens("secret")))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := app1.Open(ctx, "test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE foo(n INT)")
+	require.NoError(t, err)
+
+	cert, pool := loadCert(t)
+	_, config := app.SimpleTLSConfig(cert, pool)
+	dial := client.DialFuncWithTLS(client.DefaultDialFunc, config)
+
+	cli, err := client.New(ctx, "127.0.0.1:9000", client.WithDialFunc(client.DialFuncWithToken(dial, "secret")))
+	require.NoError(t, err)
+	require.NoError(t, cli.Close())
+
+	_, err = client.New(ctx, "127.0.0.1:9000", client.WithDialFunc(client.DialFuncWithToken(dial, "wrong")))
+	assert.Equal(t, client.ErrAuthFailed, errors.Cause(err))
+}
+
+func TestAuth_RequiresProxy(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	_, err := app.New(dir, app.WithAddress("127.0.0.1:9000"), app.WithAuth("secret", app.StaticTokens("secret")))
+	assert.EqualError(t, err, "authentication requires WithTLS or WithExternalConn")
+}
+
 func TestOpenDisk(t *testing.T) {
 	app, cleanup := newApp(t, app.WithAddress("127.0.0.1:9000"), app.WithDiskMode(true))
 	defer cleanup()
@@ -1170,6 +2048,36 @@ func TestExternalConnWithPipe(t *testing.T) {
 	assert.Equal(t, client.Voter, cluster[2].Role)
 }
 
+// A peer that connects and never sends its token doesn't hold back other
+// incoming connections.
+func TestExternalConnWithSilentPeer(t *testing.T) {
+	acceptCh := make(chan net.Conn)
+	dialFunc := func(_ context.Context, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		acceptCh <- server
+		return client, nil
+	}
+
+	app1, cleanup := newAppWithNoTLS(t,
+		app.WithAddress("first"),
+		app.WithExternalConn(dialFunc, acceptCh),
+		app.WithAuth("secret", app.StaticTokens("secret")))
+	defer cleanup()
+
+	require.NoError(t, app1.Ready(context.Background()))
+
+	silent, err := dialFunc(context.Background(), "first")
+	require.NoError(t, err)
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	cli, err := client.New(ctx, "first", client.WithDialFunc(client.DialFuncWithToken(dialFunc, "secret")))
+	require.NoError(t, err)
+	require.NoError(t, cli.Close())
+}
+
 func TestParallelNewApp(t *testing.T) {
 	t.Parallel()
 	for i := 0; i < 100; i++ {
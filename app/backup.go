@@ -0,0 +1,185 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupSink stores the backups taken by an App configured with
+// WithBackupSchedule.
+type BackupSink interface {
+	// Store saves the backup of the given database taken at the given
+	// time, reading its content from r.
+	Store(ctx context.Context, database string, taken time.Time, r io.Reader) error
+
+	// List returns the times of the stored backups of the given database.
+	List(ctx context.Context, database string) ([]time.Time, error)
+
+	// Delete removes the backup of the given database taken at the given
+	// time.
+	Delete(ctx context.Context, database string, taken time.Time) error
+}
+
+// Format of the timestamps used in the names of backup files.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// Suffix of the names of backup files.
+const backupSuffix = ".backup"
+
+// NewDirBackupSink returns a BackupSink storing each backup as a standard
+// SQLite database file in the given directory, named after the database and
+// the time the backup was taken.
+func NewDirBackupSink(dir string) BackupSink {
+	return &dirBackupSink{dir: dir}
+}
+
+type dirBackupSink struct {
+	dir string
+}
+
+func (s *dirBackupSink) Store(ctx context.Context, database string, taken time.Time, r io.Reader) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+
+	// Write to a temporary file first, so an interrupted backup never
+	// shows up as a complete one.
+	file, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("create backup file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("write backup file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync backup file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close backup file: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), s.path(database, taken)); err != nil {
+		return fmt.Errorf("rename backup file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *dirBackupSink) List(ctx context.Context, database string) ([]time.Time, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read backup directory: %w", err)
+	}
+
+	prefix := database + "-"
+	taken := []time.Time{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(name[len(prefix):], backupSuffix))
+		if err != nil {
+			continue // Belongs to a database whose name has our prefix.
+		}
+		taken = append(taken, t)
+	}
+
+	return taken, nil
+}
+
+func (s *dirBackupSink) Delete(ctx context.Context, database string, taken time.Time) error {
+	if err := os.Remove(s.path(database, taken)); err != nil {
+		return fmt.Errorf("remove backup file: %w", err)
+	}
+	return nil
+}
+
+func (s *dirBackupSink) path(database string, taken time.Time) string {
+	name := fmt.Sprintf("%s-%s%s", database, taken.UTC().Format(backupTimeFormat), backupSuffix)
+	return filepath.Join(s.dir, name)
+}
+
+// Periodically back up all databases, if we are the leader.
+func (a *App) backupLoop(ctx context.Context, options *options) {
+	defer close(a.backupCh)
+
+	ticker := time.NewTicker(options.BackupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.maybeBackup(ctx, options); err != nil && ctx.Err() == nil {
+				a.warn("backup databases: %v", err)
+			}
+		}
+	}
+}
+
+// Back up all databases and prune old backups, if we are the leader.
+func (a *App) maybeBackup(ctx context.Context, options *options) error {
+	cli, err := a.Leader(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch leader info: %w", err)
+	}
+	if leader.ID != a.id {
+		return nil
+	}
+
+	databases, err := a.Databases(ctx)
+	if err != nil {
+		return err
+	}
+
+	sink := options.BackupSink
+	for _, database := range databases {
+		taken := time.Now()
+		var buf bytes.Buffer
+		if err := cli.Backup(ctx, database, &buf); err != nil {
+			return fmt.Errorf("back up %q: %w", database, err)
+		}
+		if err := sink.Store(ctx, database, taken, &buf); err != nil {
+			return fmt.Errorf("store backup of %q: %w", database, err)
+		}
+
+		backups, err := sink.List(ctx, database)
+		if err != nil {
+			return fmt.Errorf("list backups of %q: %w", database, err)
+		}
+		if len(backups) <= options.BackupRetention {
+			continue
+		}
+		sort.Slice(backups, func(i, j int) bool { return backups[i].Before(backups[j]) })
+		for _, t := range backups[:len(backups)-options.BackupRetention] {
+			if err := sink.Delete(ctx, database, t); err != nil {
+				return fmt.Errorf("prune backup of %q: %w", database, err)
+			}
+		}
+	}
+
+	return nil
+}
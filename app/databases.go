@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Name of the internal database keeping track of the databases opened with
+// App.Open.
+const registryDatabase = "dqlite-databases"
+
+// Schema of the registry database.
+const registrySchema = `
+CREATE TABLE IF NOT EXISTS databases (
+    name TEXT PRIMARY KEY
+)`
+
+// Databases returns the names of the databases opened with App.Open by any
+// node of the cluster and not dropped since.
+//
+// Databases created with previous versions of this package, or opened without
+// using App.Open, are not listed until they are opened again.
+func (a *App) Databases(ctx context.Context) ([]string, error) {
+	db, err := a.openRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM databases ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("query databases: %w", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan database name: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query databases: %w", err)
+	}
+
+	return names, nil
+}
+
+// CrossQuery is a query against one of the databases passed to
+// App.CrossQuery.
+type CrossQuery struct {
+	Database string
+	Query    string
+	Args     []interface{}
+}
+
+// CrossQuery runs each of the given queries against its database, in order,
+// calling fn with the resulting rows. The rows are closed when fn returns.
+//
+// Each dqlite database is replicated on its own, so dqlite doesn't support
+// ATTACH and statements can't join tables of different databases. CrossQuery
+// is a helper for reading from several databases and joining the results in
+// Go. The queries don't run in a single transaction, so they might observe
+// writes committed in between them.
+func (a *App) CrossQuery(ctx context.Context, queries []CrossQuery, fn func(query CrossQuery, rows *sql.Rows) error) error {
+	dbs := map[string]*sql.DB{}
+	defer func() {
+		for _, db := range dbs {
+			db.Close()
+		}
+	}()
+
+	for _, query := range queries {
+		db, ok := dbs[query.Database]
+		if !ok {
+			var err error
+			db, err = sql.Open(a.Driver(), query.Database)
+			if err != nil {
+				return err
+			}
+			dbs[query.Database] = db
+		}
+
+		rows, err := db.QueryContext(ctx, query.Query, query.Args...)
+		if err != nil {
+			return fmt.Errorf("query database %s: %w", query.Database, err)
+		}
+		err = fn(query, rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("query database %s: %w", query.Database, err)
+		}
+	}
+
+	return nil
+}
+
+// Drop deletes all tables, views, indexes and triggers of the database with
+// the given name, cluster-wide, and removes it from the list returned by
+// Databases.
+//
+// The dqlite engine has no way to delete the database itself, so an empty
+// database with the given name is left behind.
+func (a *App) Drop(ctx context.Context, name string) error {
+	if name == registryDatabase {
+		return fmt.Errorf("can't drop internal database %q", name)
+	}
+
+	db, err := a.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Drop views before tables, since they might depend on them. Indexes
+	// and triggers go away with their tables.
+	rows, err := tx.QueryContext(ctx, `
+SELECT type, name FROM sqlite_master
+ WHERE type IN ('view', 'table') AND name NOT LIKE 'sqlite_%'
+ ORDER BY type = 'table'`)
+	if err != nil {
+		return fmt.Errorf("query schema: %w", err)
+	}
+	objects := [][2]string{}
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan schema: %w", err)
+		}
+		objects = append(objects, [2]string{kind, name})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query schema: %w", err)
+	}
+
+	for _, object := range objects {
+		stmt := fmt.Sprintf("DROP %s IF EXISTS %s", object[0], quoteIdentifier(object[1]))
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("drop %s %s: %w", object[0], object[1], err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	registry, err := a.openRegistry(ctx)
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+
+	if _, err := registry.ExecContext(ctx, "DELETE FROM databases WHERE name = ?", name); err != nil {
+		return fmt.Errorf("unregister database: %w", err)
+	}
+	a.registered.Delete(name)
+
+	return nil
+}
+
+// Add the database with the given name to the registry, unless this node did
+// it already. Failures are only logged, since the database itself can be used
+// anyway.
+func (a *App) maybeRegisterDatabase(ctx context.Context, name string) {
+	if _, ok := a.registered.Load(name); ok {
+		return
+	}
+	if err := a.registerDatabase(ctx, name); err != nil {
+		a.warn("database %s not listed by App.Databases: %v", name, err)
+		return
+	}
+	a.registered.Store(name, true)
+}
+
+// Add the database with the given name to the registry.
+func (a *App) registerDatabase(ctx context.Context, name string) error {
+	db, err := a.openRegistry(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "INSERT OR IGNORE INTO databases(name) VALUES(?)", name); err != nil {
+		return fmt.Errorf("register database: %w", err)
+	}
+
+	return nil
+}
+
+// Open the registry database, creating its schema if needed.
+func (a *App) openRegistry(ctx context.Context) (*sql.DB, error) {
+	db, err := sql.Open(a.Driver(), registryDatabase)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, registrySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create registry schema: %w", err)
+	}
+	return db, nil
+}
+
+// Quote the given name as an SQL identifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
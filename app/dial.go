@@ -7,11 +7,14 @@ import (
 	"net"
 
 	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/internal/protocol"
 )
 
 // Like client.DialFuncWithTLS but also starts the proxy, since the raft
 // connect function only supports Unix and TCP connections.
-func makeNodeDialFunc(appCtx context.Context, config *tls.Config) client.DialFunc {
+//
+// If auth is not nil, its token is sent after the TLS handshake.
+func makeNodeDialFunc(appCtx context.Context, config *tls.Config, auth *authSetup) client.DialFunc {
 	dial := func(ctx context.Context, addr string) (net.Conn, error) {
 		clonedConfig := config.Clone()
 		if len(clonedConfig.ServerName) == 0 {
@@ -32,6 +35,18 @@ func makeNodeDialFunc(appCtx context.Context, config *tls.Config) client.DialFun
 			return nil, fmt.Errorf("create pair of Unix sockets: %w", err)
 		}
 
+		if auth != nil {
+			tlsConn := tls.Client(conn, clonedConfig)
+			if err := protocol.Authenticate(ctx, tlsConn, auth.Token); err != nil {
+				tlsConn.Close()
+				goUnix.Close()
+				cUnix.Close()
+				return nil, err
+			}
+			go proxy(appCtx, tlsConn, goUnix, nil)
+			return cUnix, nil
+		}
+
 		go proxy(appCtx, conn, goUnix, clonedConfig)
 
 		return cUnix, nil
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Discovery kinds supported by WithDiscovery.
+const (
+	discoverySRV = "srv"
+)
+
+// Number of consecutive lookups a node must be missing from before the leader
+// removes it from the cluster, and number of identical consecutive lookups a
+// brand new node must see before bootstrapping the cluster.
+const discoveryLookups = 3
+
+// Resolver used for discovery, implemented by net.Resolver.
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type discoverySetup struct {
+	Kind string
+	Name string
+
+	resolver resolver
+	interval time.Duration  // Pause between the lookups made before bootstrapping.
+	misses   map[uint64]int // Consecutive lookups each node was missing from.
+}
+
+func newDiscoverySetup(kind, name string) *discoverySetup {
+	return &discoverySetup{
+		Kind:     kind,
+		Name:     name,
+		resolver: net.DefaultResolver,
+		interval: time.Second,
+		misses:   map[uint64]int{},
+	}
+}
+
+// Resolve the addresses of the nodes advertised in DNS, normalized and
+// sorted.
+func (d *discoverySetup) addresses(ctx context.Context) ([]string, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup SRV records of %s: %w", d.Name, err)
+	}
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		address, err := client.NormalizeAddress(net.JoinHostPort(host, fmt.Sprint(record.Port)))
+		if err != nil {
+			return nil, fmt.Errorf("SRV record of %s: %w", d.Name, err)
+		}
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// Return the endpoints the given node address stands for: its normalized form
+// and, if its host is a name, the IP addresses it resolves to, with the same
+// port. SRV targets are host names while nodes usually advertise IPs, so
+// addresses are compared through their endpoints.
+//
+// If the host can't be resolved, the normalized address is still returned,
+// along with the error.
+func (d *discoverySetup) endpoints(ctx context.Context, address string) (map[string]bool, error) {
+	address, err := client.NormalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := map[string]bool{address: true}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return endpoints, nil // Abstract Unix socket or IP address.
+	}
+	ips, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return endpoints, fmt.Errorf("lookup %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		endpoints[net.JoinHostPort(ip, port)] = true
+	}
+	return endpoints, nil
+}
+
+// Return true if the given sets of endpoints have one in common.
+func overlap(a, b map[string]bool) bool {
+	for endpoint := range a {
+		if b[endpoint] {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the addresses of the peers a brand new node with the given address
+// should join. An empty list means that the node should bootstrap the cluster,
+// which happens if it's the first of the advertised nodes.
+//
+// A node only bootstraps after the same list of nodes was returned by several
+// consecutive lookups, to reduce the risk of two nodes bootstrapping separate
+// clusters because one of them got a partial answer. A node which is not
+// advertised never bootstraps.
+func (d *discoverySetup) peers(ctx context.Context, address string) ([]string, error) {
+	self, err := d.endpoints(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for stable := 0; stable < discoveryLookups; {
+		if addresses != nil {
+			select {
+			case <-time.After(d.interval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		current, err := d.addresses(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(current) == 0 {
+			return nil, fmt.Errorf("no node advertised in %s", d.Name)
+		}
+		if reflect.DeepEqual(current, addresses) {
+			stable++
+		} else {
+			stable = 1
+		}
+		addresses = current
+
+		peers := make([]string, 0, len(addresses))
+		first := false
+		for i, peer := range addresses {
+			endpoints, err := d.endpoints(ctx, peer)
+			if err != nil {
+				return nil, err
+			}
+			if overlap(endpoints, self) {
+				first = i == 0
+				continue
+			}
+			peers = append(peers, peer)
+		}
+		if !first {
+			return peers, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Return the nodes of the given cluster that were missing from enough
+// consecutive lookups to be removed. The node with the given ID is never
+// returned.
+//
+// Nothing is returned if the lookup fails or returns no node, which most
+// likely means a transient failure.
+func (d *discoverySetup) missing(ctx context.Context, nodes []client.NodeInfo, id uint64) ([]client.NodeInfo, error) {
+	addresses, err := d.addresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+
+	advertised := map[string]bool{}
+	for _, address := range addresses {
+		endpoints, err := d.endpoints(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		for endpoint := range endpoints {
+			advertised[endpoint] = true
+		}
+	}
+
+	var missing []client.NodeInfo
+	current := make(map[uint64]bool, len(nodes))
+	for _, node := range nodes {
+		current[node.ID] = true
+		if node.ID == id {
+			continue
+		}
+		// A node whose host can't be resolved is only matched by name.
+		endpoints, err := d.endpoints(ctx, node.Address)
+		if endpoints == nil {
+			return nil, err
+		}
+		if overlap(endpoints, advertised) {
+			delete(d.misses, node.ID)
+			continue
+		}
+		d.misses[node.ID]++
+		if d.misses[node.ID] >= discoveryLookups {
+			missing = append(missing, node)
+		}
+	}
+
+	// Forget about nodes that left the cluster.
+	for nodeID := range d.misses {
+		if !current[nodeID] {
+			delete(d.misses, nodeID)
+		}
+	}
+
+	return missing, nil
+}
+
+// If we are the leader, remove from the cluster the nodes which are no longer
+// advertised in DNS.
+func (a *App) maybePruneNodes(ctx context.Context, cli *client.Client, discovery *discoverySetup) error {
+	info, err := cli.Leader(ctx)
+	if err != nil {
+		return err
+	}
+	if info.ID != a.id {
+		return nil
+	}
+
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return err
+	}
+
+	missing, err := discovery.missing(ctx, nodes, a.id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range missing {
+		a.info("remove node %d at %s: no longer advertised in DNS", node.ID, node.Address)
+		if err := cli.Remove(ctx, node.ID); err != nil {
+			return fmt.Errorf("remove node %d: %w", node.ID, err)
+		}
+	}
+
+	return nil
+}
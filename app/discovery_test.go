@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Nodes advertising IP addresses are matched with SRV targets through the
+// addresses their host names resolve to.
+func TestDiscovery_PeersResolved(t *testing.T) {
+	resolver := newFakeResolver()
+	resolver.set("node1", "10.0.0.1", 9001)
+	resolver.set("node2", "10.0.0.2", 9001)
+	resolver.set("node3", "10.0.0.3", 9001)
+	discovery := newFakeDiscovery(resolver)
+
+	peers, err := discovery.peers(context.Background(), "10.0.0.1:9001")
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+	assert.Equal(t, discoveryLookups, resolver.lookups)
+
+	peers, err = discovery.peers(context.Background(), "10.0.0.2:9001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node1:9001", "node3:9001"}, peers)
+}
+
+// A node only bootstraps after consecutive lookups return the same nodes.
+func TestDiscovery_PeersUnstable(t *testing.T) {
+	resolver := newFakeResolver()
+	resolver.set("node2", "10.0.0.2", 9001)
+	discovery := newFakeDiscovery(resolver)
+
+	// The first node shows up in the second lookup, so the second node
+	// joins it instead of bootstrapping.
+	resolver.onLookup = func(n int) {
+		if n == 2 {
+			resolver.set("node1", "10.0.0.1", 9001)
+		}
+	}
+	peers, err := discovery.peers(context.Background(), "10.0.0.2:9001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node1:9001"}, peers)
+}
+
+// A node which is not advertised never bootstraps.
+func TestDiscovery_PeersNotAdvertised(t *testing.T) {
+	resolver := newFakeResolver()
+	resolver.set("node2", "10.0.0.2", 9001)
+	discovery := newFakeDiscovery(resolver)
+
+	peers, err := discovery.peers(context.Background(), "10.0.0.1:9001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node2:9001"}, peers)
+
+	resolver.records = nil
+	_, err = discovery.peers(context.Background(), "10.0.0.1:9001")
+	assert.EqualError(t, err, "no node advertised in _dqlite._tcp.example.com")
+}
+
+// Nodes are only reported as missing after several consecutive lookups, and
+// the count starts over when they show up again.
+func TestDiscovery_Missing(t *testing.T) {
+	resolver := newFakeResolver()
+	resolver.set("node1", "10.0.0.1", 9001)
+	resolver.set("node2", "10.0.0.2", 9001)
+	discovery := newFakeDiscovery(resolver)
+
+	nodes := []client.NodeInfo{
+		{ID: 1, Address: "10.0.0.1:9001"},
+		{ID: 2, Address: "10.0.0.2:9001"},
+		{ID: 3, Address: "10.0.0.3:9001"},
+	}
+	missing := func() []client.NodeInfo {
+		missing, err := discovery.missing(context.Background(), nodes, 1)
+		require.NoError(t, err)
+		return missing
+	}
+
+	for i := 1; i < discoveryLookups; i++ {
+		assert.Empty(t, missing())
+	}
+	resolver.set("node3", "10.0.0.3", 9001)
+	assert.Empty(t, missing())
+
+	resolver.unset("node3")
+	for i := 1; i < discoveryLookups; i++ {
+		assert.Empty(t, missing())
+	}
+	assert.Equal(t, nodes[2:], missing())
+}
+
+// A partial answer where target names don't resolve doesn't cause healthy
+// nodes to be removed, and an empty answer is ignored.
+func TestDiscovery_MissingTransient(t *testing.T) {
+	resolver := newFakeResolver()
+	resolver.set("node1", "10.0.0.1", 9001)
+	resolver.set("node2", "10.0.0.2", 9001)
+	discovery := newFakeDiscovery(resolver)
+
+	nodes := []client.NodeInfo{
+		{ID: 1, Address: "10.0.0.1:9001"},
+		{ID: 2, Address: "10.0.0.2:9001"},
+	}
+
+	delete(resolver.hosts, "node2")
+	for i := 0; i < discoveryLookups; i++ {
+		_, err := discovery.missing(context.Background(), nodes, 1)
+		assert.Error(t, err)
+	}
+
+	resolver.records = nil
+	for i := 0; i < discoveryLookups; i++ {
+		missing, err := discovery.missing(context.Background(), nodes, 1)
+		require.NoError(t, err)
+		assert.Empty(t, missing)
+	}
+}
+
+func newFakeDiscovery(resolver *fakeResolver) *discoverySetup {
+	discovery := newDiscoverySetup(discoverySRV, "_dqlite._tcp.example.com")
+	discovery.resolver = resolver
+	discovery.interval = 0
+	return discovery
+}
+
+// Resolver serving SRV records and host addresses from memory.
+type fakeResolver struct {
+	mu       sync.Mutex
+	records  []*net.SRV
+	hosts    map[string][]string
+	lookups  int              // Number of SRV lookups.
+	onLookup func(lookup int) // Called before each SRV lookup.
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{hosts: map[string][]string{}}
+}
+
+// Advertise a node with the given host name, IP and port.
+func (r *fakeResolver) set(host, ip string, port uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, &net.SRV{Target: host + ".", Port: port})
+	r.hosts[host] = []string{ip}
+}
+
+// Stop advertising the node with the given host name.
+func (r *fakeResolver) unset(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, record := range r.records {
+		if record.Target == host+"." {
+			r.records = append(r.records[:i], r.records[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	r.lookups++
+	lookups, onLookup := r.lookups, r.onLookup
+	r.mu.Unlock()
+	if onLookup != nil {
+		onLookup(lookups)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]*net.SRV, len(r.records))
+	copy(records, r.records)
+	return name, records, nil
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ips, ok := r.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host")
+	}
+	return ips, nil
+}
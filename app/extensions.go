@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Name of the internal database keeping track of the SQLite extensions loaded
+// by each node, see WithExtensions.
+const extensionsDatabase = "dqlite-extensions"
+
+// Schema of the extensions database.
+const extensionsSchema = `
+CREATE TABLE IF NOT EXISTS nodes (
+    id         INTEGER PRIMARY KEY,
+    extensions TEXT NOT NULL
+)`
+
+// ErrExtensionsMismatch is returned by App.Ready when the node loads different
+// SQLite extensions than another member of the cluster, in which case the
+// dqlite node has been stopped.
+var ErrExtensionsMismatch = errors.New("SQLite extensions differ from the rest of the cluster")
+
+// Check that this node loads the same SQLite extensions as the other members
+// of the cluster that recorded theirs, then record the extensions of this
+// node, possibly none.
+func (a *App) checkExtensions(ctx context.Context, cli *client.Client, names []string) error {
+	extensions := formatExtensions(names)
+
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return fmt.Errorf("get cluster servers: %w", err)
+	}
+	members := map[uint64]bool{}
+	for _, node := range nodes {
+		members[node.ID] = true
+	}
+
+	db, err := sql.Open(a.Driver(), extensionsDatabase)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, extensionsSchema); err != nil {
+		return fmt.Errorf("create extensions schema: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, extensions FROM nodes")
+	if err != nil {
+		return fmt.Errorf("query extensions: %w", err)
+	}
+	defer rows.Close()
+
+	recorded := ""
+	for rows.Next() {
+		var id uint64
+		var other string
+		if err := rows.Scan(&id, &other); err != nil {
+			return fmt.Errorf("scan extensions: %w", err)
+		}
+		if id == a.id {
+			recorded = other
+			continue
+		}
+		// Nodes that left the cluster don't matter.
+		if !members[id] {
+			continue
+		}
+		if other != extensions {
+			return fmt.Errorf("%w: node %d loads [%s], this node loads [%s]", ErrExtensionsMismatch, id, other, extensions)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query extensions: %w", err)
+	}
+	rows.Close()
+
+	if recorded == extensions {
+		return nil
+	}
+
+	query := "INSERT OR REPLACE INTO nodes(id, extensions) VALUES(?, ?)"
+	if _, err := db.ExecContext(ctx, query, int64(a.id), extensions); err != nil {
+		return fmt.Errorf("record extensions: %w", err)
+	}
+
+	return nil
+}
+
+// Return a canonical representation of the given set of extensions.
+func formatExtensions(names []string) string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
@@ -21,6 +21,11 @@ const (
 	// the cluster. In case the node doesn't successfully make it to join
 	// the cluster first time it's started, it will re-try the next time.
 	joinFile = "join"
+
+	// Hold the previous address of a node that was restarted with a new
+	// one, until the cluster configuration is updated accordingly. In case
+	// that doesn't succeed, it will be re-tried the next time.
+	relocateFile = "relocate.yaml"
 )
 
 // Return true if the given file exists in the given directory.
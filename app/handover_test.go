@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// If no leader can be found, the error reports the role held according to
+// the last known configuration.
+func TestHandover_NoLeader(t *testing.T) {
+	cases := []struct {
+		role     client.NodeRole
+		expected client.NodeRole
+	}{
+		{client.Voter, client.Voter},
+		{client.StandBy, client.StandBy},
+		{client.Spare, -1},
+	}
+	for _, c := range cases {
+		t.Run(c.role.String(), func(t *testing.T) {
+			store := client.NewInmemNodeStore()
+			require.NoError(t, store.Set(context.Background(), []client.NodeInfo{
+				{ID: 1, Address: "1", Role: c.role},
+				{ID: 2, Address: "2", Role: client.Voter},
+			}))
+			app := &App{
+				id:    1,
+				store: store,
+				dialFunc: func(context.Context, string) (net.Conn, error) {
+					return nil, errors.New("unreachable")
+				},
+				log:     func(client.LogLevel, string, ...interface{}) {},
+				options: defaultOptions(),
+			}
+
+			err := app.Handover(context.Background(), WithHandoverTimeout(50*time.Millisecond))
+
+			var handoverErr *HandoverError
+			require.True(t, errors.As(err, &handoverErr))
+			assert.Equal(t, c.expected, handoverErr.Role)
+			assert.False(t, handoverErr.Leadership)
+			assert.Contains(t, err.Error(), "handover: find leader:")
+		})
+	}
+}
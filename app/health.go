@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Health describes the state of an application node, as reported by the
+// handler returned by App.HealthHandler.
+type Health struct {
+	ID            uint64 `json:"id"`
+	Address       string `json:"address"`
+	Ready         bool   `json:"ready"`                    // Whether App.Ready would return.
+	Role          string `json:"role,omitempty"`           // Role of the node, if known.
+	LeaderID      uint64 `json:"leader_id,omitempty"`      // ID of the current leader, if any.
+	LeaderAddress string `json:"leader_address,omitempty"` // Address of the current leader, if any.
+	IsLeader      bool   `json:"is_leader"`
+	DiskUsage     int64  `json:"disk_usage"` // Size of the data directory, in bytes.
+	Error         string `json:"error,omitempty"`
+}
+
+// HealthHandler returns an HTTP handler reporting the state of this node as
+// JSON, suitable for liveness and readiness probes.
+//
+// The handler responds with status 200 if the node is ready and a leader is
+// available, and with status 503 otherwise.
+//
+// The raft log indexes are not reported, since the C library does not expose
+// them while the node is running.
+func (a *App) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		health := a.health(ctx)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Ready || health.LeaderAddress == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
+// Gather information about the health of this node.
+func (a *App) health(ctx context.Context) Health {
+	health := Health{
+		ID:      a.id,
+		Address: a.address,
+	}
+
+	select {
+	case <-a.readyCh:
+		health.Ready = true
+	default:
+	}
+
+	if usage, err := diskUsage(a.dir); err == nil {
+		health.DiskUsage = usage
+	}
+
+	cli, err := a.Leader(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer cli.Close()
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if leader == nil {
+		return health
+	}
+	health.LeaderID = leader.ID
+	health.LeaderAddress = leader.Address
+	health.IsLeader = leader.ID == a.id
+
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	for _, node := range nodes {
+		if node.ID == a.id {
+			health.Role = node.Role.String()
+			break
+		}
+	}
+
+	return health
+}
+
+// Return the total size of the regular files in the given directory tree.
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// File holding the namespace of the pod, mounted by Kubernetes.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Fill the address and cluster options of a node running as pod of a
+// Kubernetes StatefulSet.
+func (s *statefulSetSetup) configure(o *options) error {
+	pod, err := s.hostname()
+	if err != nil {
+		return fmt.Errorf("get pod name: %w", err)
+	}
+	i := strings.LastIndexByte(pod, '-')
+	if i < 0 {
+		return fmt.Errorf("pod name %q has no ordinal suffix", pod)
+	}
+	prefix := pod[:i]
+	ordinal, err := strconv.Atoi(pod[i+1:])
+	if err != nil || ordinal < 0 {
+		return fmt.Errorf("pod name %q has no ordinal suffix", pod)
+	}
+	s.ordinal = ordinal
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		data, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return fmt.Errorf("get pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	address := func(ordinal int) string {
+		return fmt.Sprintf("%s-%d.%s.%s.svc:%d", prefix, ordinal, s.Service, namespace, s.Port)
+	}
+
+	// The DNS name of the pod only resolves once the pod is ready, so
+	// listen to all interfaces and only advertise the name.
+	if o.Address == "" {
+		o.Address = address(ordinal)
+		o.BindAddress = fmt.Sprintf("0.0.0.0:%d", s.Port)
+	}
+
+	// The first pod bootstraps the cluster, the others join the pods that
+	// were started before them.
+	if len(o.Cluster) == 0 {
+		for j := 0; j < ordinal; j++ {
+			o.Cluster = append(o.Cluster, address(j))
+		}
+	}
+
+	return nil
+}
+
+// Return the ID of a pod joining the cluster, derived from its ordinal, so
+// that a pod keeps its identity if its volume is replaced. The ID of the pod
+// bootstrapping the cluster is dqlite.BootstrapID as for any other node.
+func (s *statefulSetSetup) nodeID() uint64 {
+	return uint64(s.ordinal) + 1
+}
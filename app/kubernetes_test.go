@@ -0,0 +1,83 @@
+package app
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatefulSet_Configure(t *testing.T) {
+	defer setenv(t, "POD_NAMESPACE", "prod")()
+
+	cases := []struct {
+		pod     string
+		address string
+		cluster []string
+		id      uint64
+	}{
+		{"db-0", "db-0.dqlite.prod.svc:9000", nil, 1},
+		{"db-2", "db-2.dqlite.prod.svc:9000", []string{"db-0.dqlite.prod.svc:9000", "db-1.dqlite.prod.svc:9000"}, 3},
+		{"my-db-1", "my-db-1.dqlite.prod.svc:9000", []string{"my-db-0.dqlite.prod.svc:9000"}, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.pod, func(t *testing.T) {
+			s := newStatefulSetSetup(c.pod)
+			o := defaultOptions()
+			require.NoError(t, s.configure(o))
+			assert.Equal(t, c.address, o.Address)
+			assert.Equal(t, "0.0.0.0:9000", o.BindAddress)
+			assert.Equal(t, c.cluster, o.Cluster)
+			assert.Equal(t, c.id, s.nodeID())
+		})
+	}
+}
+
+// Addresses set with WithAddress and WithCluster are left alone.
+func TestStatefulSet_ConfigureExplicit(t *testing.T) {
+	defer setenv(t, "POD_NAMESPACE", "prod")()
+
+	s := newStatefulSetSetup("db-1")
+	o := defaultOptions()
+	o.Address = "10.0.0.2:9000"
+	o.Cluster = []string{"10.0.0.1:9000"}
+	require.NoError(t, s.configure(o))
+	assert.Equal(t, "10.0.0.2:9000", o.Address)
+	assert.Equal(t, "", o.BindAddress)
+	assert.Equal(t, []string{"10.0.0.1:9000"}, o.Cluster)
+	assert.Equal(t, uint64(2), s.nodeID())
+}
+
+func TestStatefulSet_ConfigureBadPodName(t *testing.T) {
+	defer setenv(t, "POD_NAMESPACE", "prod")()
+
+	for _, pod := range []string{"db", "db-x", "db-"} {
+		t.Run(pod, func(t *testing.T) {
+			s := newStatefulSetSetup(pod)
+			err := s.configure(defaultOptions())
+			assert.EqualError(t, err, "pod name \""+pod+"\" has no ordinal suffix")
+		})
+	}
+}
+
+func newStatefulSetSetup(pod string) *statefulSetSetup {
+	return &statefulSetSetup{
+		Service:  "dqlite",
+		Port:     9000,
+		hostname: func() (string, error) { return pod, nil },
+	}
+}
+
+// Set the given environment variable, returning a function that restores it.
+func setenv(t *testing.T, key, value string) func() {
+	previous, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	return func() {
+		if ok {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Interval between checks of the role of this node, performed once a callback
+// has been registered with OnRoleChange, OnLeadershipAcquired or
+// OnLeadershipLost.
+const roleWatchInterval = time.Second
+
+// Callbacks notified of changes of the role of this node.
+type roleWatch struct {
+	start     sync.Once
+	mu        sync.Mutex
+	callbacks []*roleCallback
+}
+
+// A callback registered with OnRoleChange, OnLeadershipAcquired or
+// OnLeadershipLost, along with the last state it was notified about, so that
+// callbacks registered late are brought up to date too.
+type roleCallback struct {
+	role     func(old, new client.NodeRole)
+	acquired func()
+	lost     func()
+
+	lastRole   client.NodeRole
+	lastLeader bool
+}
+
+// Notify the callback if the given state differs from the last one it saw.
+func (c *roleCallback) update(role client.NodeRole, leader bool) {
+	if role != c.lastRole && c.role != nil {
+		c.role(c.lastRole, role)
+	}
+	c.lastRole = role
+
+	if leader != c.lastLeader {
+		if leader && c.acquired != nil {
+			c.acquired()
+		}
+		if !leader && c.lost != nil {
+			c.lost()
+		}
+	}
+	c.lastLeader = leader
+}
+
+// OnRoleChange registers a function to be called whenever the role of this
+// node in the cluster changes, for example when it gets promoted from stand-by
+// to voter.
+//
+// The first call happens as soon as the current role is known, with old set
+// to -1.
+//
+// Callbacks are run one at a time from a single goroutine, which checks the
+// role of the node every second, so they should not block.
+func (a *App) OnRoleChange(f func(old, new client.NodeRole)) {
+	a.addRoleCallback(&roleCallback{role: f})
+}
+
+// OnLeadershipAcquired registers a function to be called whenever this node
+// becomes the leader of the cluster, including when it's already the leader
+// at the time of registration. It can be used to start background jobs that
+// should only run on the leader.
+//
+// Callbacks are run as described in OnRoleChange.
+func (a *App) OnLeadershipAcquired(f func()) {
+	a.addRoleCallback(&roleCallback{acquired: f})
+}
+
+// OnLeadershipLost registers a function to be called whenever this node stops
+// being the leader of the cluster, including when it's closed while being the
+// leader. It can be used to stop the jobs started by a function registered
+// with OnLeadershipAcquired.
+//
+// Callbacks are run as described in OnRoleChange.
+func (a *App) OnLeadershipLost(f func()) {
+	a.addRoleCallback(&roleCallback{lost: f})
+}
+
+// Register the given callback and start the goroutine watching the role of
+// this node, if it's not running.
+func (a *App) addRoleCallback(callback *roleCallback) {
+	callback.lastRole = -1
+
+	a.watch.mu.Lock()
+	a.watch.callbacks = append(a.watch.callbacks, callback)
+	a.watch.mu.Unlock()
+
+	a.watch.start.Do(func() {
+		if a.ctx.Err() != nil {
+			return // The node is closed.
+		}
+		a.listeners.Add(1)
+		go a.watchRole()
+	})
+}
+
+// Periodically check the role of this node and notify the registered
+// callbacks about changes, until the node is closed.
+func (a *App) watchRole() {
+	defer a.listeners.Done()
+
+	role := client.NodeRole(-1)
+	leader := false
+
+	ticker := time.NewTicker(roleWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		newRole, newLeader, err := a.currentRole(a.ctx)
+		if err != nil {
+			a.debug("check role: %v", err)
+		} else {
+			if newLeader && !leader {
+				a.info("leadership acquired")
+			}
+			if !newLeader && leader {
+				a.info("leadership lost")
+			}
+			role, leader = newRole, newLeader
+			a.notifyRole(role, leader)
+		}
+
+		select {
+		case <-a.ctx.Done():
+			// Callbacks should stop any leader-only work.
+			if leader {
+				a.notifyRole(role, false)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Return the role of this node, and whether it's the leader, according to the
+// local node.
+func (a *App) currentRole(ctx context.Context) (client.NodeRole, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, roleWatchInterval)
+	defer cancel()
+
+	cli, err := a.Client(ctx)
+	if err != nil {
+		return -1, false, err
+	}
+	defer cli.Close()
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		return -1, false, err
+	}
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return -1, false, err
+	}
+	for _, node := range nodes {
+		if node.ID == a.id {
+			return node.Role, leader != nil && leader.ID == a.id, nil
+		}
+	}
+
+	return -1, false, fmt.Errorf("node %d is not part of the cluster", a.id)
+}
+
+// Bring all registered callbacks up to date with the given state.
+func (a *App) notifyRole(role client.NodeRole, leader bool) {
+	a.watch.mu.Lock()
+	callbacks := append([]*roleCallback{}, a.watch.callbacks...)
+	a.watch.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.update(role, leader)
+	}
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Maximum number of per-IP rate limiting buckets to keep before pruning the
+// ones that are full again.
+const maxRateBuckets = 1024
+
+// Enforce the limits on incoming connections set with WithMaxConnections and
+// WithConnectionRateLimit. The zero value enforces no limit.
+type connLimiter struct {
+	max   int     // Maximum number of concurrent connections, 0 means no limit.
+	rate  float64 // Connections per second allowed from a single IP, 0 means no limit.
+	burst float64 // Connections allowed in a burst from a single IP.
+
+	mu      sync.Mutex
+	active  int
+	buckets map[string]*rateBucket
+}
+
+// Token bucket rate limiting the connections from a single IP.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newConnLimiter(max int, rate float64, burst int) *connLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &connLimiter{
+		max:     max,
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*rateBucket{},
+	}
+}
+
+// Try to admit a new connection from the given remote address. If true is
+// returned, release must be called once the connection is closed.
+func (l *connLimiter) acquire(addr net.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.active >= l.max {
+		return false
+	}
+	if l.rate > 0 && !l.allow(remoteIP(addr), time.Now()) {
+		return false
+	}
+
+	l.active++
+	return true
+}
+
+// Release a connection admitted by acquire.
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+}
+
+// Consume a token from the bucket of the given IP, if available.
+func (l *connLimiter) allow(ip string, now time.Time) bool {
+	if len(l.buckets) >= maxRateBuckets {
+		l.prune(now)
+	}
+
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &rateBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Remove the buckets that have been refilled, since they are equivalent to
+// new ones.
+func (l *connLimiter) prune(now time.Time) {
+	for ip, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// Return the IP of the given address, or its string form if it has no IP
+// (e.g. for Unix sockets or pipes).
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnLimiter_MaxConnections(t *testing.T) {
+	limiter := newConnLimiter(2, 0, 0)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+
+	assert.True(t, limiter.acquire(addr))
+	assert.True(t, limiter.acquire(addr))
+	assert.False(t, limiter.acquire(addr))
+
+	limiter.release()
+	assert.True(t, limiter.acquire(addr))
+}
+
+func TestConnLimiter_Rate(t *testing.T) {
+	limiter := newConnLimiter(0, 1, 2)
+	now := time.Now()
+
+	assert.True(t, limiter.allow("10.0.0.1", now))
+	assert.True(t, limiter.allow("10.0.0.1", now))
+	assert.False(t, limiter.allow("10.0.0.1", now))
+
+	// Other IPs have their own bucket.
+	assert.True(t, limiter.allow("10.0.0.2", now))
+
+	// Tokens are refilled over time.
+	assert.True(t, limiter.allow("10.0.0.1", now.Add(time.Second)))
+	assert.False(t, limiter.allow("10.0.0.1", now.Add(time.Second)))
+}
@@ -0,0 +1,289 @@
+// Package locks implements cluster-wide locks and singleton task election on
+// top of a dqlite database.
+//
+// Locks are rows of a replicated table, each with an owner and an expiry
+// time. A lock whose holder crashes or gets partitioned away is released
+// automatically once it expires, so holders must refresh their locks before
+// the TTL elapses, as RunSingleton does.
+//
+// Expiry times are computed using the clock of the node acquiring or
+// refreshing a lock, so clocks of the nodes in the cluster should be kept in
+// sync, and TTLs should be large compared to the expected clock skew.
+package locks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schema of the table holding the locks.
+const schema = `
+CREATE TABLE IF NOT EXISTS locks (
+    name    TEXT PRIMARY KEY,
+    owner   TEXT NOT NULL,
+    token   INTEGER NOT NULL,
+    expires INTEGER NOT NULL
+)`
+
+// ErrLockHeld is returned by TryAcquireLock when the lock is held by someone
+// else.
+var ErrLockHeld = errors.New("lock is held by another owner")
+
+// ErrLockLost is returned when refreshing or releasing a lock that expired
+// and possibly got acquired by someone else in the meantime.
+var ErrLockLost = errors.New("lock was lost")
+
+// Store manages the locks kept in a dqlite database.
+type Store struct {
+	db    *sql.DB
+	retry time.Duration
+}
+
+// Option can be used to tweak store parameters.
+type Option func(*options)
+
+type options struct {
+	RetryInterval time.Duration
+}
+
+// WithRetryInterval sets how often AcquireLock and RunSingleton check again
+// whether a lock held by someone else was released.
+//
+// The default is one second.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(options *options) {
+		options.RetryInterval = interval
+	}
+}
+
+// New creates a Store keeping its locks in the given database, typically one
+// returned by app.App.Open, creating the locks table if needed.
+func New(ctx context.Context, db *sql.DB, options ...Option) (*Store, error) {
+	o := defaultOptions()
+
+	for _, option := range options {
+		option(o)
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("create locks schema: %w", err)
+	}
+
+	return &Store{db: db, retry: o.RetryInterval}, nil
+}
+
+// Lock is a cluster-wide lock held by this process.
+type Lock struct {
+	store *Store
+	name  string
+	owner string
+	token int64
+	ttl   time.Duration
+}
+
+// Name returns the name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token returns a number that increases every time the lock is acquired, and
+// that can be used as fencing token to reject writes from previous holders.
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Refresh extends the expiry of the lock by its TTL, returning ErrLockLost
+// if it already expired and was acquired by someone else.
+func (l *Lock) Refresh(ctx context.Context) error {
+	expires := time.Now().Add(l.ttl).UnixNano()
+	result, err := l.store.db.ExecContext(ctx,
+		"UPDATE locks SET expires = ? WHERE name = ? AND owner = ? AND token = ?",
+		expires, l.name, l.owner, l.token)
+	if err != nil {
+		return fmt.Errorf("refresh lock %s: %w", l.name, err)
+	}
+	return checkHeld(result)
+}
+
+// Release releases the lock, returning ErrLockLost if it already expired and
+// was acquired by someone else.
+func (l *Lock) Release(ctx context.Context) error {
+	// Mark the lock as expired instead of deleting it, so the token keeps
+	// increasing across acquisitions.
+	result, err := l.store.db.ExecContext(ctx,
+		"UPDATE locks SET expires = 0 WHERE name = ? AND owner = ? AND token = ?",
+		l.name, l.owner, l.token)
+	if err != nil {
+		return fmt.Errorf("release lock %s: %w", l.name, err)
+	}
+	return checkHeld(result)
+}
+
+// AcquireLock acquires the lock with the given name, waiting for it to be
+// released or to expire if it's held by someone else. The lock expires after
+// the given TTL, which must be positive, unless refreshed.
+func (s *Store) AcquireLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	for {
+		lock, err := s.TryAcquireLock(ctx, name, ttl)
+		if err != ErrLockHeld {
+			return lock, err
+		}
+
+		select {
+		case <-time.After(s.retry):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryAcquireLock is like AcquireLock, but returns ErrLockHeld immediately if
+// the lock is held by someone else.
+func (s *Store) TryAcquireLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid TTL %s for lock %s", ttl, name)
+	}
+
+	owner, err := newOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// Take over the lock only if it's expired. A single statement makes the
+	// check and the update atomic.
+	result, err := s.db.ExecContext(ctx, `
+INSERT INTO locks(name, owner, token, expires) VALUES(?, ?, 1, ?)
+  ON CONFLICT(name) DO UPDATE
+    SET owner = excluded.owner, token = locks.token + 1, expires = excluded.expires
+    WHERE locks.expires <= ?`,
+		name, owner, now.Add(ttl).UnixNano(), now.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	} else if n == 0 {
+		return nil, ErrLockHeld
+	}
+
+	lock := &Lock{store: s, name: name, owner: owner, ttl: ttl}
+	row := s.db.QueryRowContext(ctx, "SELECT token FROM locks WHERE name = ? AND owner = ?", name, owner)
+	if err := row.Scan(&lock.token); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLockLost
+		}
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+
+	return lock, nil
+}
+
+// RunSingleton runs the given task on at most one node of the cluster at a
+// time, electing the node that acquires the lock with the given name.
+//
+// It waits for the lock to be acquired, then runs the task while refreshing
+// the lock every third of the given TTL. If refreshing fails the context
+// passed to the task is cancelled, and RunSingleton returns ErrLockLost once
+// the task returns. Otherwise the lock is released and the task's error is
+// returned.
+func (s *Store) RunSingleton(ctx context.Context, name string, ttl time.Duration, task func(ctx context.Context) error) error {
+	// The lock is refreshed every third of the TTL.
+	if ttl/3 <= 0 {
+		return fmt.Errorf("invalid TTL %s for lock %s", ttl, name)
+	}
+
+	lock, err := s.AcquireLock(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			// Don't use the task context, which gets cancelled when
+			// the caller gives up, not when the lock is lost.
+			refreshCtx, refreshCancel := context.WithTimeout(context.Background(), ttl/3)
+			err := lock.Refresh(refreshCtx)
+			refreshCancel()
+			if err != nil {
+				lost <- err
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err = task(taskCtx)
+	close(done)
+	<-stopped
+
+	select {
+	case refreshErr := <-lost:
+		return fmt.Errorf("singleton %s: %w", name, wrapLost(refreshErr))
+	default:
+	}
+
+	// Use a fresh context, since ctx might be done.
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), ttl)
+	defer releaseCancel()
+	if releaseErr := lock.Release(releaseCtx); releaseErr != nil && err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// Make sure the given refresh error matches ErrLockLost.
+func wrapLost(err error) error {
+	if errors.Is(err, ErrLockLost) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrLockLost, err)
+}
+
+// Return ErrLockLost if the given statement didn't affect the lock.
+func checkHeld(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Return a random identifier for a new lock owner.
+func newOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate lock owner: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func defaultOptions() *options {
+	return &options{
+		RetryInterval: time.Second,
+	}
+}
@@ -0,0 +1,128 @@
+package locks_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/app"
+	"github.com/canonical/go-dqlite/app/locks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_TryAcquireLock(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	lock, err := store.TryAcquireLock(ctx, "test", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "test", lock.Name())
+	assert.Equal(t, int64(1), lock.Token())
+
+	_, err = store.TryAcquireLock(ctx, "test", time.Second)
+	assert.Equal(t, locks.ErrLockHeld, err)
+
+	require.NoError(t, lock.Refresh(ctx))
+	require.NoError(t, lock.Release(ctx))
+
+	lock, err = store.TryAcquireLock(ctx, "test", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lock.Token())
+}
+
+func TestStore_InvalidTTL(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	_, err := store.TryAcquireLock(ctx, "test", 0)
+	assert.EqualError(t, err, "invalid TTL 0s for lock test")
+
+	_, err = store.AcquireLock(ctx, "test", -time.Second)
+	assert.EqualError(t, err, "invalid TTL -1s for lock test")
+
+	err = store.RunSingleton(ctx, "test", 2*time.Nanosecond, func(ctx context.Context) error {
+		return nil
+	})
+	assert.EqualError(t, err, "invalid TTL 2ns for lock test")
+}
+
+func TestStore_AcquireLockExpired(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	lock1, err := store.TryAcquireLock(ctx, "test", 100*time.Millisecond)
+	require.NoError(t, err)
+
+	lock2, err := store.AcquireLock(ctx, "test", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lock2.Token())
+
+	assert.Equal(t, locks.ErrLockLost, lock1.Refresh(ctx))
+	assert.Equal(t, locks.ErrLockLost, lock1.Release(ctx))
+}
+
+func TestStore_RunSingleton(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// The lock is refreshed while the task runs for longer than the TTL.
+	err := store.RunSingleton(ctx, "test", 150*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(500 * time.Millisecond)
+		_, err := store.TryAcquireLock(ctx, "test", time.Second)
+		assert.Equal(t, locks.ErrLockHeld, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The lock was released.
+	_, err = store.TryAcquireLock(ctx, "test", time.Second)
+	require.NoError(t, err)
+
+	// Errors returned by the task are passed through.
+	errTask := errors.New("boom")
+	err = store.RunSingleton(ctx, "other", time.Second, func(ctx context.Context) error {
+		return errTask
+	})
+	assert.Equal(t, errTask, err)
+}
+
+func newStore(t *testing.T) (*locks.Store, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dqlite-locks-test-")
+	require.NoError(t, err)
+
+	a, err := app.New(dir, app.WithAddress("127.0.0.1:9101"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, a.Ready(ctx))
+
+	db, err := a.Open(ctx, "locks")
+	require.NoError(t, err)
+
+	store, err := locks.New(ctx, db, locks.WithRetryInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	cleanup := func() {
+		db.Close()
+		require.NoError(t, a.Close())
+		os.RemoveAll(dir)
+	}
+
+	return store, cleanup
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/canonical/go-dqlite/driver"
+)
+
+// Schema of the table tracking the migrations applied to a database, one row
+// for each migration.
+const migrateSchema = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name    TEXT NOT NULL,
+    applied INTEGER NOT NULL
+)`
+
+// Pause before retrying migrations that conflicted with the ones applied
+// concurrently by another node.
+const migrateInterval = 500 * time.Millisecond
+
+// Migration is a step of the evolution of a database schema, see
+// App.Migrate.
+type Migration struct {
+	Name string // Short description of the migration.
+
+	// SQL statements to execute. Ignored if Func is set.
+	SQL string
+
+	// Function performing the migration using the given transaction, for
+	// migrations that can't be expressed as plain SQL.
+	Func func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Migrate brings the schema of the given database, typically returned by
+// Open, up to date by applying the given migrations.
+//
+// The version of the schema is the number of migrations applied, which is
+// tracked in the replicated schema_version table. Migrations must thus never
+// be removed or reordered, only appended.
+//
+// Any node can apply migrations: they are applied all at once in a single
+// transaction, which first checks the schema version again, so when nodes
+// start concurrently only one of them applies the migrations, and the others
+// find them applied. If the schema is already newer than the given
+// migrations, which happens when this node runs an older version of the
+// application than other nodes, an error is returned.
+//
+// Migrate returns the number of migrations applied, or that would be applied
+// when using WithMigrateDryRun.
+func (a *App) Migrate(ctx context.Context, db *sql.DB, migrations []Migration, options ...MigrateOption) (int, error) {
+	o := defaultMigrateOptions()
+	for _, option := range options {
+		option(o)
+	}
+
+	if _, err := db.ExecContext(ctx, migrateSchema); err != nil {
+		return 0, fmt.Errorf("create schema_version table: %w", err)
+	}
+
+	for {
+		version, err := schemaVersion(ctx, db)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkSchemaVersion(version, len(migrations)); err != nil || version == len(migrations) {
+			return 0, err
+		}
+
+		n, err := a.applyMigrations(ctx, db, migrations, o.DryRun)
+		if !isBusy(err) {
+			return n, err
+		}
+
+		// Another node committed a transaction, most likely the same
+		// migrations, after ours started: check the version again.
+		a.debug("schema migration conflicted with another transaction: %v", err)
+
+		select {
+		case <-time.After(migrateInterval):
+		case <-ctx.Done():
+			return 0, fmt.Errorf("migrate schema to version %d: %w", len(migrations), ctx.Err())
+		}
+	}
+}
+
+// Apply the pending migrations in a single transaction, rolling it back if
+// dryRun is true.
+func (a *App) applyMigrations(ctx context.Context, db *sql.DB, migrations []Migration, dryRun bool) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Check the version again within the transaction, in case another
+	// node applied the migrations in the meantime.
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkSchemaVersion(version, len(migrations)); err != nil {
+		return 0, err
+	}
+
+	for i, migration := range migrations[version:] {
+		n := version + i + 1
+		a.info("applying schema migration %d (%s)", n, migration.Name)
+		if migration.Func != nil {
+			err = migration.Func(ctx, tx)
+		} else {
+			_, err = tx.ExecContext(ctx, migration.SQL)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("apply migration %d (%s): %w", n, migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_version(version, name, applied) VALUES(?, ?, ?)",
+			n, migration.Name, time.Now().Unix()); err != nil {
+			return 0, fmt.Errorf("record migration %d: %w", n, err)
+		}
+	}
+
+	// In dry-run mode the deferred rollback discards the changes.
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("commit transaction: %w", err)
+		}
+	}
+
+	return len(migrations) - version, nil
+}
+
+// Return whether the given error is due to a conflict with a concurrent
+// transaction.
+func isBusy(err error) bool {
+	var e driver.Error
+	return errors.As(err, &e) && e.PrimaryCode() == driver.ErrBusy
+}
+
+// Return the current schema version.
+func schemaVersion(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}) (int, error) {
+	var version int
+	row := q.QueryRowContext(ctx, "SELECT IFNULL(MAX(version), 0) FROM schema_version")
+	if err := row.Scan(&version); err != nil {
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Fail if the schema is newer than the known migrations.
+func checkSchemaVersion(version, known int) error {
+	if version > known {
+		return fmt.Errorf("schema version %d is newer than the %d known migrations", version, known)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Name of the internal database holding the notifications sent with
+// App.Notify.
+const notifyDatabase = "dqlite-notifications"
+
+// Schema of the notifications database. The AUTOINCREMENT keyword guarantees
+// that IDs are never reused, even after old notifications get deleted.
+const notifySchema = `
+CREATE TABLE IF NOT EXISTS notifications (
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS notifications_channel ON notifications (channel, id)`
+
+// Notifications older than this are deleted by App.Notify.
+const notifyRetention = time.Minute
+
+// Interval between checks for new notifications performed by App.Listen.
+const listenInterval = 100 * time.Millisecond
+
+// Notification is sent on the channels returned by App.Listen.
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// Notify sends a notification with the given payload on the given channel to
+// all listeners in the cluster, see Listen.
+//
+// Notifications are replicated like any other write, so they are delivered
+// only once committed and in the order they were committed.
+func (a *App) Notify(ctx context.Context, channel string, payload string) error {
+	db, err := a.openNotify(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM notifications WHERE created < ?", now.Add(-notifyRetention).UnixNano()); err != nil {
+		return fmt.Errorf("delete old notifications: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO notifications(channel, payload, created) VALUES(?, ?, ?)", channel, payload, now.UnixNano()); err != nil {
+		return fmt.Errorf("insert notification: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Listen returns a Go channel receiving the notifications sent on the given
+// channel with Notify, by any node of the cluster, after Listen returns.
+//
+// The returned Go channel is closed when the given context is done or the
+// App is closed. Notifications are delivered in order, but a listener that
+// falls behind by more than a minute might miss some of them.
+func (a *App) Listen(ctx context.Context, channel string) (<-chan Notification, error) {
+	db, err := a.openNotify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var last int64
+	row := db.QueryRowContext(ctx, "SELECT IFNULL(MAX(id), 0) FROM notifications")
+	if err := row.Scan(&last); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("query last notification: %w", err)
+	}
+
+	ch := make(chan Notification)
+
+	a.listeners.Add(1)
+	go func() {
+		defer a.listeners.Done()
+		defer db.Close()
+		defer close(ch)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-a.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		ticker := time.NewTicker(listenInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			payloads, ids, err := queryNotifications(ctx, db, channel, last)
+			if err != nil {
+				if ctx.Err() == nil {
+					a.warn("listen on %s: %v", channel, err)
+				}
+				continue
+			}
+			for i, payload := range payloads {
+				select {
+				case ch <- Notification{Channel: channel, Payload: payload}:
+					last = ids[i]
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Return the payloads and IDs of the notifications sent on the given channel
+// after the one with the given ID.
+func queryNotifications(ctx context.Context, db *sql.DB, channel string, after int64) ([]string, []int64, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, payload FROM notifications WHERE channel = ? AND id > ? ORDER BY id", channel, after)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	payloads := []string{}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		var payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, nil, fmt.Errorf("scan notification: %w", err)
+		}
+		payloads = append(payloads, payload)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("query notifications: %w", err)
+	}
+
+	return payloads, ids, nil
+}
+
+// Open the notifications database, creating its schema if needed.
+func (a *App) openNotify(ctx context.Context) (*sql.DB, error) {
+	db, err := sql.Open(a.Driver(), notifyDatabase)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, notifySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create notifications schema: %w", err)
+	}
+	return db, nil
+}
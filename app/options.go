@@ -1,16 +1,21 @@
 package app
 
 import (
+	"crypto/subtle"
 	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/canonical/go-dqlite"
 	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/driver"
 	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/canonical/go-dqlite/tracing"
 )
 
 // Option can be used to tweak app parameters.
@@ -28,7 +33,14 @@ type Option func(*options)
 // If not given the first non-loopback IP address of any of the system network
 // interfaces will be used, with port 9000.
 //
-// The address must be stable across application restarts.
+// Bare IPv6 literals are accepted and a missing port defaults to 9000, so
+// "::1" is the same as "[::1]:9000". Host names are resolved every time a
+// connection is made.
+//
+// The address is persisted in the data directory, so it can be omitted when
+// restarting the application node. If a different address is given, for
+// example because the node runs in a container that got a new IP, the cluster
+// configuration is updated to use the new address once the node is started.
 func WithAddress(address string) Option {
 	return func(options *options) {
 		options.Address = address
@@ -46,6 +58,54 @@ func WithCluster(cluster []string) Option {
 	}
 }
 
+// WithDiscovery enables automatic discovery of the cluster nodes.
+//
+// The only supported kind is "srv", in which case name is a DNS name whose SRV
+// records list the addresses of all nodes, for example
+// "_dqlite._tcp.example.com".
+//
+// When a brand new node starts and WithCluster is not used, the node whose
+// address comes first in the sorted list of advertised addresses bootstraps
+// the cluster, while all others join it. The bootstrapping node waits until
+// several consecutive lookups return the same list. Afterwards the leader
+// periodically resolves the records again and removes from the cluster the
+// nodes which were missing from several consecutive lookups.
+//
+// Advertised host names are resolved before being compared with node
+// addresses, so nodes can use IP addresses.
+func WithDiscovery(kind string, name string) Option {
+	return func(options *options) {
+		options.Discovery = newDiscoverySetup(kind, name)
+	}
+}
+
+// WithStatefulSet configures the node to run as pod of a Kubernetes
+// StatefulSet, whose pods are exposed by the given headless service and
+// listen to the given port.
+//
+// The node address is derived from the pod name and namespace, as
+// "<pod>.<service>.<namespace>.svc:<port>", unless WithAddress is used. The
+// namespace is taken from the POD_NAMESPACE environment variable if set, or
+// from the service account otherwise. Since that name only resolves once the
+// pod is ready, the node listens to the given port on all interfaces.
+//
+// The ID of the pods joining the cluster is derived from their ordinal, so it
+// doesn't change if the volume of a pod is replaced.
+//
+// When a brand new node starts, the pod with ordinal 0 bootstraps the cluster,
+// while the other pods join it using the addresses of the pods with a lower
+// ordinal, unless WithCluster is used. This works with the default
+// OrderedReady pod management policy, which starts pods one at a time.
+func WithStatefulSet(service string, port int) Option {
+	return func(options *options) {
+		options.StatefulSet = &statefulSetSetup{
+			Service:  service,
+			Port:     port,
+			hostname: os.Hostname,
+		}
+	}
+}
+
 // WithExternalConn enables passing an external dial function that will be used
 // whenever dqlite needs to make an outside connection.
 //
@@ -66,6 +126,10 @@ func WithExternalConn(dialFunc client.DialFunc, acceptCh chan net.Conn) Option {
 //
 // The "dial" parameter must hold the TLS configuration to use when
 // establishing outgoing connections to other application nodes.
+//
+// In order to also verify the identity of peer nodes, set the
+// VerifyPeerCertificate field of both configurations using
+// client.VerifyPeerNames.
 func WithTLS(listen *tls.Config, dial *tls.Config) Option {
 	return func(options *options) {
 		options.TLS = &tlsSetup{
@@ -75,6 +139,123 @@ func WithTLS(listen *tls.Config, dial *tls.Config) Option {
 	}
 }
 
+// AcceptFunc vets an incoming connection before it's handed to the dqlite
+// node. It returns the connection to use, possibly wrapping the given one, or
+// an error if the connection should be rejected.
+type AcceptFunc func(net.Conn) (net.Conn, error)
+
+// WithAcceptFunc sets a function invoked on every incoming connection, from
+// both clients and other nodes, before it's handed to the dqlite node. It can
+// be used to implement token checks or IP allow lists.
+//
+// With WithTLS the function sees the connection before the TLS handshake;
+// client.VerifyPeerNames can be used to validate the identity of peers.
+//
+// The function is effective only when the application proxies incoming
+// connections, that is when WithTLS or WithExternalConn are used.
+func WithAcceptFunc(accept AcceptFunc) Option {
+	return func(options *options) {
+		options.AcceptFunc = accept
+	}
+}
+
+// TokenVerifier checks the token sent by a client or another node when
+// connecting, returning an error if it should be rejected.
+type TokenVerifier func(token string) error
+
+// StaticTokens returns a TokenVerifier accepting only the given tokens.
+func StaticTokens(tokens ...string) TokenVerifier {
+	return func(token string) error {
+		for _, valid := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid token")
+	}
+}
+
+// WithAuth requires every incoming connection, from both clients and other
+// nodes, to authenticate with a token accepted by the given verifier, before
+// it's handed to the dqlite node.
+//
+// The given token is sent by this node when connecting to other nodes, and by
+// the clients and database connections created by the application. External
+// clients can use client.DialFuncWithToken, or the "_token" parameter of the
+// driver data source name.
+//
+// The token is sent after the TLS handshake, if any, so it's only protected
+// from eavesdropping when WithTLS is used. Authentication requires the
+// application to proxy incoming connections, that is WithTLS or
+// WithExternalConn must be used as well.
+func WithAuth(token string, verifier TokenVerifier) Option {
+	return func(options *options) {
+		options.Auth = &authSetup{
+			Token:  token,
+			Verify: verifier,
+		}
+	}
+}
+
+// WithAuditSink sets a sink receiving a record for every write statement
+// executed through the databases returned by App.Open, see driver.AuditSink.
+//
+// Use driver.WithAuditIdentity to attach the identity of the user on whose
+// behalf statements are executed to their records.
+func WithAuditSink(sink driver.AuditSink) Option {
+	return func(options *options) {
+		options.AuditSink = sink
+	}
+}
+
+// WithMaxConnections sets the maximum number of concurrent incoming
+// connections that the node accepts. Additional connections are closed right
+// away.
+//
+// The limit is enforced only when the application proxies incoming
+// connections, that is when WithTLS or WithExternalConn are used.
+func WithMaxConnections(n int) Option {
+	return func(options *options) {
+		options.MaxConnections = n
+	}
+}
+
+// WithConnectionRateLimit limits the rate of incoming connections accepted
+// from a single IP address to the given number per second, allowing bursts of
+// up to the given size. Connections exceeding the rate are closed right away.
+//
+// The limit is enforced only when the application proxies incoming
+// connections, that is when WithTLS or WithExternalConn are used.
+func WithConnectionRateLimit(perSecond float64, burst int) Option {
+	return func(options *options) {
+		options.ConnectionRate = perSecond
+		options.ConnectionBurst = burst
+	}
+}
+
+// WithBackupSchedule makes the node back up all databases returned by
+// App.Databases at the given interval, storing the backups in the given sink,
+// as long as it is the cluster leader.
+//
+// Old backups are pruned according to WithBackupRetention.
+func WithBackupSchedule(interval time.Duration, sink BackupSink) Option {
+	return func(options *options) {
+		options.BackupInterval = interval
+		options.BackupSink = sink
+	}
+}
+
+// WithBackupRetention sets how many backups of each database are kept when
+// using WithBackupSchedule. Older backups are deleted from the sink after a
+// new one is stored.
+//
+// The default is 7.
+func WithBackupRetention(n int) Option {
+	return func(options *options) {
+		options.BackupRetention = n
+	}
+}
+
 // WithUnixSocket allows setting a specific socket path for communication between go-dqlite and dqlite.
 //
 // The default is an empty string which means a random abstract unix socket.
@@ -149,6 +330,17 @@ func WithRolesAdjustmentHook(hook func(leader client.NodeInfo, cluster []client.
 	}
 }
 
+// WithAcceptErrorHook sets a function invoked when the listener used to accept
+// connections from clients and other nodes fails with a non-temporary error.
+// After that the node is no longer reachable, so the hook should typically
+// trigger a restart of the application. Temporary errors are retried with
+// backoff and only logged.
+func WithAcceptErrorHook(hook func(err error)) Option {
+	return func(o *options) {
+		o.OnAcceptError = hook
+	}
+}
+
 // WithLogFunc sets a custom log function.
 func WithLogFunc(log client.LogFunc) Option {
 	return func(options *options) {
@@ -156,6 +348,17 @@ func WithLogFunc(log client.LogFunc) Option {
 	}
 }
 
+// WithLogLevel sets the minimum level of the messages passed to the log
+// function. It can be changed later with App.SetLogLevel.
+//
+// The default is LogDebug when a custom log function is set with WithLogFunc,
+// and LogError otherwise.
+func WithLogLevel(level client.LogLevel) Option {
+	return func(options *options) {
+		options.LogLevel = level
+	}
+}
+
 // WithTracing will emit a log message at the given level every time a
 // statement gets executed.
 func WithTracing(level client.LogLevel) Option {
@@ -164,6 +367,14 @@ func WithTracing(level client.LogLevel) Option {
 	}
 }
 
+// WithTracer sets a tracer used to surface raft activity observed by the
+// application, such as leadership changes and membership changes, as spans.
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(options *options) {
+		options.Tracer = tracer
+	}
+}
+
 // WithFailureDomain sets the node's failure domain.
 //
 // Failure domains are taken into account when deciding which nodes to promote
@@ -174,7 +385,8 @@ func WithFailureDomain(code uint64) Option {
 	}
 }
 
-// WithNetworkLatency sets the average one-way network latency.
+// WithNetworkLatency sets the average one-way network latency of the node,
+// see dqlite.WithNetworkLatency for when and how to set it.
 func WithNetworkLatency(latency time.Duration) Option {
 	return func(options *options) {
 		options.NetworkLatency = latency
@@ -192,6 +404,17 @@ func WithConcurrentLeaderConns(maxConns *int64) Option {
 	}
 }
 
+// WithMaxMessageSize sets the maximum size in bytes of the requests and
+// responses exchanged by the driver and the clients created by the App, see
+// driver.WithMaxMessageSize.
+//
+// The nodes themselves don't have a configurable limit.
+func WithMaxMessageSize(bytes uint64) Option {
+	return func(o *options) {
+		o.MaxMessageSize = bytes
+	}
+}
+
 // WithSnapshotParams sets the raft snapshot parameters.
 func WithSnapshotParams(params dqlite.SnapshotParams) Option {
 	return func(options *options) {
@@ -224,11 +447,178 @@ func WithAutoRecovery(recovery bool) Option {
 	}
 }
 
+// WithScalarFunction registers a custom SQL scalar function on the node. All
+// nodes of the cluster must register the same functions, see
+// dqlite.WithScalarFunction.
+func WithScalarFunction(name string, nargs int, fn dqlite.ScalarFunc) Option {
+	return func(options *options) {
+		options.Functions = append(options.Functions, dqlite.WithScalarFunction(name, nargs, fn))
+	}
+}
+
+// WithExtensions loads the SQLite extensions with the given names from the
+// given directory when the node starts, see dqlite.WithExtensions.
+//
+// All nodes of the cluster must load the same extensions. Each node records
+// the extensions it loads in the cluster, nodes not using this option being
+// recorded as loading none. A node loading a different set than another member
+// stops its dqlite engine, so it doesn't join the cluster or, if it's already
+// a member, doesn't vote or apply transactions: App.Ready returns an error
+// wrapping ErrExtensionsMismatch instead. Changing the set of extensions of an
+// existing cluster thus requires removing nodes and adding them back.
+func WithExtensions(dir string, names ...string) Option {
+	return func(options *options) {
+		options.ExtensionsDir = dir
+		options.Extensions = append(options.Extensions, names...)
+	}
+}
+
+// WithAggregateFunction registers a custom SQL aggregate function on the node.
+// All nodes of the cluster must register the same functions, see
+// dqlite.WithAggregateFunction.
+func WithAggregateFunction(name string, nargs int, newAggregate func() dqlite.Aggregate) Option {
+	return func(options *options) {
+		options.Functions = append(options.Functions, dqlite.WithAggregateFunction(name, nargs, newAggregate))
+	}
+}
+
+// WithAutoHandover makes the application node hand over its responsibilities
+// and close itself when the process receives one of the given signals, or
+// SIGTERM or SIGINT if none is given.
+//
+// This is equivalent to calling App.Handover, with a timeout of 20 seconds,
+// followed by App.Close upon receiving the signal. Receiving one of the
+// signals again while handing over terminates the process as if this option
+// wasn't used. Use App.Done to wait for the node to be closed before exiting
+// the process:
+//
+//	node, err := app.New(dir, app.WithAutoHandover())
+//	...
+//	<-node.Done()
+func WithAutoHandover(signals ...os.Signal) Option {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	return func(options *options) {
+		options.HandoverSignals = signals
+	}
+}
+
+// HandoverOption can be used to tweak the behavior of App.Handover.
+type HandoverOption func(*handoverOptions)
+
+// WithHandoverSuccessor sets the ID of the node which should preferably
+// receive the role and the leadership of the node being handed over. If that
+// node can't take them, other nodes are tried as usual.
+func WithHandoverSuccessor(id uint64) HandoverOption {
+	return func(options *handoverOptions) {
+		options.Successor = id
+	}
+}
+
+// WithHandoverTimeout sets a hard deadline for the whole handover process,
+// regardless of the deadline of the given context. The default is one minute.
+func WithHandoverTimeout(timeout time.Duration) HandoverOption {
+	return func(options *handoverOptions) {
+		options.Timeout = timeout
+	}
+}
+
+type handoverOptions struct {
+	Successor uint64
+	Timeout   time.Duration
+}
+
+// Create a handover options object with sane defaults.
+func defaultHandoverOptions() *handoverOptions {
+	return &handoverOptions{
+		Timeout: time.Minute,
+	}
+}
+
+// MigrateOption can be used to tweak the behavior of App.Migrate.
+type MigrateOption func(*migrateOptions)
+
+// WithMigrateDryRun makes App.Migrate apply the pending migrations in a
+// transaction that is rolled back, in order to check that they succeed
+// without changing the schema.
+func WithMigrateDryRun() MigrateOption {
+	return func(options *migrateOptions) {
+		options.DryRun = true
+	}
+}
+
+type migrateOptions struct {
+	DryRun bool
+}
+
+// Create a migrate options object with sane defaults.
+func defaultMigrateOptions() *migrateOptions {
+	return &migrateOptions{}
+}
+
+// VacuumOption can be used to tweak the behavior of App.Vacuum.
+type VacuumOption func(*vacuumOptions)
+
+// WithVacuumBatchSize sets the maximum number of pages released by each
+// transaction performed by App.Vacuum. It must be at least 1, and the default
+// is 1000.
+func WithVacuumBatchSize(pages int) VacuumOption {
+	return func(options *vacuumOptions) {
+		options.BatchSize = pages
+	}
+}
+
+// WithVacuumPause sets how long App.Vacuum waits between transactions, to
+// leave room for other writers. The default is 100 milliseconds.
+func WithVacuumPause(pause time.Duration) VacuumOption {
+	return func(options *vacuumOptions) {
+		options.Pause = pause
+	}
+}
+
+// WithVacuumFull makes App.Vacuum switch databases that are not in incremental
+// auto-vacuum mode to that mode, by running a full VACUUM. The whole database
+// is then replicated in a single raft entry, so this should be done when the
+// database is small or the cluster is idle.
+func WithVacuumFull() VacuumOption {
+	return func(options *vacuumOptions) {
+		options.Full = true
+	}
+}
+
+type vacuumOptions struct {
+	BatchSize int
+	Pause     time.Duration
+	Full      bool
+}
+
+// Create a vacuum options object with sane defaults.
+func defaultVacuumOptions() *vacuumOptions {
+	return &vacuumOptions{
+		BatchSize: 1000,
+		Pause:     100 * time.Millisecond,
+	}
+}
+
+type statefulSetSetup struct {
+	Service string
+	Port    int
+
+	hostname func() (string, error) // Return the name of the pod.
+	ordinal  int                    // Ordinal of the pod, set by configure.
+}
+
 type tlsSetup struct {
 	Listen *tls.Config
 	Dial   *tls.Config
 }
 
+type authSetup struct {
+	Token  string
+	Verify TokenVerifier
+}
+
 type connSetup struct {
 	dialFunc client.DialFunc
 	acceptCh chan net.Conn
@@ -236,8 +626,10 @@ type connSetup struct {
 
 type options struct {
 	Address                  string
+	BindAddress              string
 	Cluster                  []string
 	Log                      client.LogFunc
+	LogLevel                 client.LogLevel
 	Tracing                  client.LogLevel
 	TLS                      *tlsSetup
 	Conn                     *connSetup
@@ -245,6 +637,7 @@ type options struct {
 	StandBys                 int
 	RolesAdjustmentFrequency time.Duration
 	OnRolesAdjustment        func(client.NodeInfo, []client.NodeInfo) error
+	OnAcceptError            func(error)
 	FailureDomain            uint64
 	NetworkLatency           time.Duration
 	ConcurrentLeaderConns    *int64
@@ -252,21 +645,39 @@ type options struct {
 	SnapshotParams           dqlite.SnapshotParams
 	DiskMode                 bool
 	AutoRecovery             bool
+	Tracer                   tracing.Tracer
+	Discovery                *discoverySetup
+	StatefulSet              *statefulSetSetup
+	MaxConnections           int
+	ConnectionRate           float64
+	ConnectionBurst          int
+	AcceptFunc               AcceptFunc
+	Auth                     *authSetup
+	AuditSink                driver.AuditSink
+	BackupInterval           time.Duration
+	BackupSink               BackupSink
+	BackupRetention          int
+	HandoverSignals          []os.Signal
+	MaxMessageSize           uint64
+	Functions                []dqlite.Option
+	ExtensionsDir            string
+	Extensions               []string
 }
 
 // Create a options object with sane defaults.
 func defaultOptions() *options {
 	maxConns := protocol.MaxConcurrentLeaderConns
 	return &options{
-		Log:                      defaultLogFunc,
 		Tracing:                  client.LogNone,
 		Voters:                   3,
 		StandBys:                 3,
 		RolesAdjustmentFrequency: 30 * time.Second,
 		OnRolesAdjustment:        func(client.NodeInfo, []client.NodeInfo) error { return nil },
+		OnAcceptError:            func(error) {},
 		DiskMode:                 false, // Be explicit about not enabling disk-mode by default.
 		AutoRecovery:             true,
 		ConcurrentLeaderConns:    &maxConns,
+		BackupRetention:          7,
 	}
 }
 
@@ -293,6 +704,27 @@ func isIpV4(ip string) bool {
 	return strings.Count(ip, ":") < 2
 }
 
+// Normalize the node address and the cluster addresses in the given options.
+func normalizeAddresses(o *options) error {
+	if o.Address != "" {
+		address, err := client.NormalizeAddress(o.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address: %w", err)
+		}
+		o.Address = address
+	}
+	cluster := make([]string, len(o.Cluster))
+	for i, address := range o.Cluster {
+		address, err := client.NormalizeAddress(address)
+		if err != nil {
+			return fmt.Errorf("invalid cluster address: %w", err)
+		}
+		cluster[i] = address
+	}
+	o.Cluster = cluster
+	return nil
+}
+
 func defaultAddress() (addr string, err error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -324,11 +756,9 @@ func defaultAddress() (addr string, err error) {
 	return "", fmt.Errorf("no suitable net.Interface found: %v", err)
 }
 
+// Log messages using the standard logger. Messages are filtered according to
+// the log level, which is LogError by default.
 func defaultLogFunc(l client.LogLevel, format string, a ...interface{}) {
-	// Log only error messages
-	if l != client.LogError {
-		return
-	}
 	msg := fmt.Sprintf("["+l.String()+"]"+" dqlite: "+format, a...)
 	log.Printf(msg)
 }
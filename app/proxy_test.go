@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptBackoff(t *testing.T) {
+	delays := []time.Duration{}
+	delay := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		delay = acceptBackoff(delay)
+		delays = append(delays, delay)
+	}
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{
+		5 * ms, 10 * ms, 20 * ms, 40 * ms, 80 * ms, 160 * ms, 320 * ms, 640 * ms, time.Second, time.Second,
+	}, delays)
+}
+
+// Temporary accept errors are retried, while a fatal one stops the proxy and
+// is reported to the accept error hook.
+func TestProxy_AcceptErrors(t *testing.T) {
+	fatal := errors.New("listener broken")
+	listener := &fakeListener{errs: []error{temporaryError{}, temporaryError{}, fatal}}
+
+	var mu sync.Mutex
+	var warnings []string
+	var reported error
+	app := newProxyApp(listener, func(l client.LogLevel, format string, a ...interface{}) {
+		if l == client.LogWarn {
+			mu.Lock()
+			warnings = append(warnings, fmt.Sprintf(format, a...))
+			mu.Unlock()
+		}
+	})
+	app.options.OnAcceptError = func(err error) { reported = err }
+
+	go app.proxy()
+	select {
+	case <-app.proxyCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy didn't stop")
+	}
+
+	assert.Equal(t, fatal, reported)
+	assert.Equal(t, []string{
+		"accept connection: temporary; retrying in 5ms",
+		"accept connection: temporary; retrying in 10ms",
+	}, warnings)
+}
+
+// Errors caused by closing the listener when the app stops are not reported.
+func TestProxy_AcceptClosed(t *testing.T) {
+	listener := &fakeListener{errs: []error{errors.New("use of closed network connection")}}
+	app := newProxyApp(listener, func(client.LogLevel, string, ...interface{}) {})
+	app.options.OnAcceptError = func(err error) { t.Errorf("unexpected accept error: %v", err) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.ctx = ctx
+	cancel()
+
+	app.proxy()
+}
+
+func newProxyApp(listener net.Listener, log client.LogFunc) *App {
+	return &App{
+		ctx:      context.Background(),
+		listener: listener,
+		log:      log,
+		options:  defaultOptions(),
+		proxyCh:  make(chan struct{}),
+	}
+}
+
+// Listener returning the given errors from Accept, in order.
+type fakeListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
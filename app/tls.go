@@ -4,6 +4,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"os"
+	"sync"
+	"time"
 )
 
 // SimpleTLSConfig returns a pair of TLS configuration objects with sane
@@ -112,3 +115,101 @@ func SimpleDialTLSConfig(cert tls.Certificate, pool *x509.CertPool) *tls.Config
 
 	return config
 }
+
+// CertificateFunc returns the key pair to present in TLS handshakes. It's
+// called for every new connection, so it can return a different certificate
+// after the current one gets rotated.
+type CertificateFunc func() (*tls.Certificate, error)
+
+// FileCertificate returns a CertificateFunc that loads the key pair from the
+// given PEM files, and loads it again whenever the modification time of
+// either file changes.
+//
+// If reloading fails, for example because only one of the two files was
+// replaced so far, the previously loaded key pair keeps being used.
+func FileCertificate(certFile, keyFile string) CertificateFunc {
+	var (
+		mu       sync.Mutex
+		cert     *tls.Certificate
+		modified time.Time
+	)
+	return func() (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		latest := time.Time{}
+		for _, name := range []string{certFile, keyFile} {
+			info, err := os.Stat(name)
+			if err != nil {
+				if cert != nil {
+					return cert, nil
+				}
+				return nil, fmt.Errorf("stat %s: %w", name, err)
+			}
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+		if cert != nil && latest.Equal(modified) {
+			return cert, nil
+		}
+
+		keypair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			if cert != nil {
+				return cert, nil
+			}
+			return nil, fmt.Errorf("load key pair: %w", err)
+		}
+		cert = &keypair
+		modified = latest
+
+		return cert, nil
+	}
+}
+
+// RotatingTLSConfig is like SimpleTLSConfig, but instead of using a fixed key
+// pair it calls the given function each time a connection gets established,
+// so short-lived certificates can be rotated without restarting the node.
+//
+// Connections that are already established, including the ones used for
+// replication, are not affected by a rotation.
+//
+// The server name of the dial config is taken from the certificate returned
+// by the first call of the given function, so rotated certificates must keep
+// the same first DNS name.
+func RotatingTLSConfig(get CertificateFunc, pool *x509.CertPool) (*tls.Config, *tls.Config, error) {
+	cert, err := get()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listen := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return get()
+		},
+		RootCAs:    pool,
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+
+	dial := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return get()
+		},
+	}
+
+	x509cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	if len(x509cert.DNSNames) == 0 {
+		return nil, nil, fmt.Errorf("certificate has no DNS extension")
+	}
+	dial.ServerName = x509cert.DNSNames[0]
+
+	return listen, dial, nil
+}
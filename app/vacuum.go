@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Values of the auto_vacuum pragma.
+const (
+	autoVacuumNone        = 0
+	autoVacuumIncremental = 2
+)
+
+// ErrVacuumNotIncremental is returned by Vacuum when the database doesn't use
+// incremental auto-vacuum and WithVacuumFull was not given.
+var ErrVacuumNotIncremental = fmt.Errorf("database is not in incremental auto-vacuum mode")
+
+// Vacuum releases the free pages of the given database, typically returned by
+// Open, shrinking its file on all nodes.
+//
+// A plain VACUUM rewrites the whole database in a single transaction, which
+// dqlite replicates as one raft entry as large as the database itself. Vacuum
+// uses incremental vacuum instead, releasing at most a batch of pages per
+// transaction (see WithVacuumBatchSize), so each replicated entry stays small
+// and other writers can make progress between batches.
+//
+// Incremental vacuum requires the database to be in incremental auto-vacuum
+// mode. If it isn't, ErrVacuumNotIncremental is returned, unless
+// WithVacuumFull is given: in that case the mode is switched and a single
+// full VACUUM is run, which is needed only once in the life of the database.
+//
+// Vacuum returns the number of pages released.
+func (a *App) Vacuum(ctx context.Context, db *sql.DB, options ...VacuumOption) (int, error) {
+	o := defaultVacuumOptions()
+	for _, option := range options {
+		option(o)
+	}
+	if o.BatchSize < 1 {
+		return 0, fmt.Errorf("invalid vacuum batch size %d", o.BatchSize)
+	}
+
+	var mode int
+	if err := db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return 0, fmt.Errorf("get auto_vacuum mode: %w", err)
+	}
+
+	if mode != autoVacuumIncremental {
+		if !o.Full {
+			return 0, ErrVacuumNotIncremental
+		}
+		return a.vacuumFull(ctx, db)
+	}
+
+	free, err := freelistCount(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for free > 0 {
+		batch := free
+		if batch > o.BatchSize {
+			batch = o.BatchSize
+		}
+		a.debug("vacuum: release %d of %d free pages", batch, free)
+		query := fmt.Sprintf("PRAGMA incremental_vacuum(%d)", batch)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return released, fmt.Errorf("incremental vacuum: %w", err)
+		}
+
+		// Count the pages actually released, which might be fewer
+		// than requested. Other writers might free or reuse pages too.
+		remaining, err := freelistCount(ctx, db)
+		if err != nil {
+			return released, err
+		}
+		if remaining >= free {
+			a.debug("vacuum: no page released, %d free pages left", remaining)
+			return released, nil
+		}
+		released += free - remaining
+		free = remaining
+
+		if free == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return released, ctx.Err()
+		case <-time.After(o.Pause):
+		}
+	}
+
+	return released, nil
+}
+
+// Switch the database to incremental auto-vacuum mode and rebuild it, which
+// releases all free pages at once.
+func (a *App) vacuumFull(ctx context.Context, db *sql.DB) (int, error) {
+	free, err := freelistCount(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	a.info("vacuum: switch to incremental auto-vacuum and run full vacuum")
+	if _, err := db.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return 0, fmt.Errorf("set auto_vacuum mode: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return 0, fmt.Errorf("vacuum: %w", err)
+	}
+
+	remaining, err := freelistCount(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if remaining >= free {
+		return 0, nil
+	}
+
+	return free - remaining, nil
+}
+
+// Return the number of unused pages in the given database.
+func freelistCount(ctx context.Context, db *sql.DB) (int, error) {
+	var free int
+	if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&free); err != nil {
+		return 0, fmt.Errorf("get freelist count: %w", err)
+	}
+	return free, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/canonical/go-dqlite/app"
@@ -33,6 +34,11 @@ func createWorkers(o *options) []*worker {
 			workers[i] = newWorker(kvWriter, o)
 		case kvReadWrite:
 			workers[i] = newWorker(kvReaderWriter, o)
+			workers[i].readPercent = 50
+		case kvMixed:
+			workers[i] = newWorker(kvReaderWriter, o)
+		case batchInsert:
+			workers[i] = newWorker(batchInserter, o)
 		}
 	}
 	return workers
@@ -91,6 +97,27 @@ func (bm *Benchmark) reportFiles() map[string]string {
 	return allReports
 }
 
+// Returns a summary of the results of all workers, by type of work.
+func (bm *Benchmark) summary() string {
+	all := newTracker()
+	for _, worker := range bm.workers {
+		worker.tracker.lock.RLock()
+		for w, measurements := range worker.tracker.measurements {
+			all.measurements[w] = append(all.measurements[w], measurements...)
+		}
+		for w, errors := range worker.tracker.errors {
+			all.errors[w] = append(all.errors[w], errors...)
+		}
+		worker.tracker.lock.RUnlock()
+	}
+
+	var sb strings.Builder
+	for w, report := range all.report() {
+		fmt.Fprintf(&sb, "%s: %s\n", w, report.summary())
+	}
+	return sb.String()
+}
+
 func (bm *Benchmark) reportResults() error {
 	dir := path.Join(bm.dir, "results")
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -198,6 +225,6 @@ func (bm *Benchmark) Run(ch <-chan os.Signal) error {
 	if err := bm.reportResults(); err != nil {
 		return err
 	}
-	fmt.Printf("Benchmark done. Results available here:\n%s\n", path.Join(bm.dir, "results"))
+	fmt.Printf("Benchmark done.\n%sResults available here:\n%s\n", bm.summary(), path.Join(bm.dir, "results"))
 	return nil
 }
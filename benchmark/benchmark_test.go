@@ -84,6 +84,42 @@ func TestNew_KvReadWrite(t *testing.T) {
 	bmRun(t, bm, app, db)
 }
 
+// Create a Benchmark with a mixed workload.
+func TestNew_Mixed(t *testing.T) {
+	dir, app, db, cleanup := bmSetup(t, addr1, nil)
+	defer cleanup()
+
+	bm, err := benchmark.New(
+		app,
+		db,
+		dir,
+		benchmark.WithCluster([]string{addr1}),
+		benchmark.WithDuration(1),
+		benchmark.WithWorkload("mixed"),
+		benchmark.WithReadPercent(75))
+	require.NoError(t, err)
+
+	bmRun(t, bm, app, db)
+}
+
+// Create a Benchmark with a batch insert workload.
+func TestNew_BatchInsert(t *testing.T) {
+	dir, app, db, cleanup := bmSetup(t, addr1, nil)
+	defer cleanup()
+
+	bm, err := benchmark.New(
+		app,
+		db,
+		dir,
+		benchmark.WithCluster([]string{addr1}),
+		benchmark.WithDuration(1),
+		benchmark.WithWorkload("batchinsert"),
+		benchmark.WithBatchSize(10))
+	require.NoError(t, err)
+
+	bmRun(t, bm, app, db)
+}
+
 // Create a clustered Benchmark.
 func TestNew_ClusteredKvReadWrite(t *testing.T) {
 	dir, app, db, cleanup := bmSetup(t, addr1, nil)
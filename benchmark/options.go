@@ -10,6 +10,8 @@ type workload int32
 const (
 	kvWrite     workload = iota
 	kvReadWrite workload = iota
+	kvMixed     workload = iota
+	batchInsert workload = iota
 )
 
 type Option func(*options)
@@ -21,6 +23,8 @@ type options struct {
 	nWorkers       int
 	kvKeySizeB     int
 	kvValueSizeB   int
+	readPercent    int
+	batchSize      int
 }
 
 func parseWorkload(workload string) workload {
@@ -29,6 +33,10 @@ func parseWorkload(workload string) workload {
 		return kvWrite
 	case "kvreadwrite":
 		return kvReadWrite
+	case "mixed":
+		return kvMixed
+	case "batchinsert":
+		return batchInsert
 	default:
 		return kvWrite
 	}
@@ -69,6 +77,21 @@ func WithKvValueSize(bytes int) Option {
 	}
 }
 
+// WithReadPercent sets the percentage of reads of the "mixed" workload.
+func WithReadPercent(percent int) Option {
+	return func(options *options) {
+		options.readPercent = percent
+	}
+}
+
+// WithBatchSize sets the number of rows inserted by each transaction of the
+// "batchinsert" workload.
+func WithBatchSize(n int) Option {
+	return func(options *options) {
+		options.batchSize = n
+	}
+}
+
 // WithCluster sets the cluster option of the benchmark. A benchmark will only
 // start once the whole cluster is online.
 func WithCluster(cluster []string) Option {
@@ -94,5 +117,7 @@ func defaultOptions() *options {
 		kvValueSizeB:   1024,
 		nWorkers:       1,
 		workload:       kvWrite,
+		readPercent:    90,
+		batchSize:      100,
 	}
 }
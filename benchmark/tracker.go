@@ -3,6 +3,7 @@ package benchmark
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -45,6 +46,10 @@ type report struct {
 	avgDuration   time.Duration
 	maxDuration   time.Duration
 	minDuration   time.Duration
+	p50Duration   time.Duration
+	p90Duration   time.Duration
+	p99Duration   time.Duration
+	throughput    float64 // Operations per second.
 	measurements  []measurement
 	errors        []measurementErr
 }
@@ -62,16 +67,42 @@ func (r report) String() string {
 
 	return fmt.Sprintf("n %d\n"+
 		"n_err %d\n"+
+		"throughput [ops/s] %.2f\n"+
 		"avg [ms] %s\n"+
 		"max [ms] %s\n"+
 		"min [ms] %s\n"+
+		"p50 [ms] %s\n"+
+		"p90 [ms] %s\n"+
+		"p99 [ms] %s\n"+
 		"measurements [timestamp in ns] [ms]\n%s\n"+
 		"errors\n%s\n",
-		r.n, r.nErr, durToMs(r.avgDuration),
+		r.n, r.nErr, r.throughput, durToMs(r.avgDuration),
 		durToMs(r.maxDuration), durToMs(r.minDuration),
+		durToMs(r.p50Duration), durToMs(r.p90Duration), durToMs(r.p99Duration),
 		msb.String(), esb.String())
 }
 
+// Summary returns a one-line summary of the report.
+func (r report) summary() string {
+	return fmt.Sprintf("n %d, n_err %d, throughput %.2f ops/s, "+
+		"latency [ms] avg %s, p50 %s, p90 %s, p99 %s, max %s",
+		r.n, r.nErr, r.throughput, durToMs(r.avgDuration),
+		durToMs(r.p50Duration), durToMs(r.p90Duration), durToMs(r.p99Duration),
+		durToMs(r.maxDuration))
+}
+
+// Return the given percentile of the given sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
 func (t *tracker) measure(start time.Time, work work, err *error) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -101,6 +132,8 @@ func (t *tracker) report() map[work]report {
 			errors:        t.errors[w],
 		}
 
+		durations := make([]time.Duration, 0, report.n)
+		var first, last time.Time
 		for _, m := range t.measurements[w] {
 			report.totalDuration += m.duration
 			if m.duration < report.minDuration {
@@ -109,11 +142,26 @@ func (t *tracker) report() map[work]report {
 			if m.duration > report.maxDuration {
 				report.maxDuration = m.duration
 			}
+			if first.IsZero() || m.start.Before(first) {
+				first = m.start
+			}
+			if end := m.start.Add(m.duration); end.After(last) {
+				last = end
+			}
+			durations = append(durations, m.duration)
 		}
 
 		if report.n > 0 {
 			report.avgDuration = report.totalDuration / time.Duration(report.n)
 		}
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		report.p50Duration = percentile(durations, 50)
+		report.p90Duration = percentile(durations, 90)
+		report.p99Duration = percentile(durations, 99)
+		if elapsed := last.Sub(first); elapsed > 0 {
+			report.throughput = float64(report.n) / elapsed.Seconds()
+		}
 		reports[w] = report
 	}
 
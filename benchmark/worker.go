@@ -19,6 +19,8 @@ func (w work) String() string {
 		return "exec"
 	case query:
 		return "query"
+	case batch:
+		return "batch"
 	case none:
 		return "none"
 	default:
@@ -31,10 +33,12 @@ const (
 	none  work = iota
 	exec  work = iota // a `write`
 	query work = iota // a `read`
+	batch work = iota // a transaction with many `write`s
 
 	kvWriter       workerType = iota
 	kvReader       workerType = iota
 	kvReaderWriter workerType = iota
+	batchInserter  workerType = iota
 
 	kvReadSql  = "SELECT value FROM model WHERE key = ?"
 	kvWriteSql = "INSERT OR REPLACE INTO model(key, value) VALUES(?, ?)"
@@ -53,6 +57,8 @@ type worker struct {
 	kvKeySizeB   int
 	kvValueSizeB int
 	kvKeys       []string
+	readPercent  int // Percentage of reads of a kvReaderWriter.
+	batchSize    int // Rows inserted by each transaction of a batchInserter.
 }
 
 // Thanks to https://stackoverflow.com/a/22892986
@@ -90,13 +96,19 @@ func (w *worker) getWork() (work, string, []interface{}) {
 		k, v := w.randNewKey(), w.randValue()
 		return exec, kvWriteSql, []interface{}{k, v}
 	case kvReaderWriter:
-		read := rand.Intn(2) == 0
+		read := rand.Intn(100) < w.readPercent
 		if read && len(w.kvKeys) != 0 {
 			k, _ := w.randExistingKey()
 			return query, kvReadSql, []interface{}{k}
 		}
 		k, v := w.randNewKey(), w.randValue()
 		return exec, kvWriteSql, []interface{}{k, v}
+	case batchInserter:
+		args := make([]interface{}, 0, 2*w.batchSize)
+		for i := 0; i < w.batchSize; i++ {
+			args = append(args, w.randNewKey(), w.randValue())
+		}
+		return batch, kvWriteSql, args
 	default:
 		return none, "", []interface{}{}
 	}
@@ -122,11 +134,30 @@ func (w *worker) doWork(ctx context.Context, db *sql.DB) {
 	case query:
 		defer w.tracker.measure(time.Now(), work, &err)
 		err = db.QueryRowContext(ctx, q, args...).Scan(&str)
+	case batch:
+		defer w.tracker.measure(time.Now(), work, &err)
+		err = execBatch(ctx, db, q, args)
 	default:
 		return
 	}
 }
 
+// Execute the given statement in a single transaction once for every pair of
+// arguments.
+func execBatch(ctx context.Context, db *sql.DB, q string, args []interface{}) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		if _, err := tx.ExecContext(ctx, q, args[i], args[i+1]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (w *worker) run(ctx context.Context, db *sql.DB) {
 	for {
 		if ctx.Err() != nil {
@@ -146,6 +177,8 @@ func newWorker(workerType workerType, o *options) *worker {
 		workerType:   workerType,
 		kvKeySizeB:   o.kvKeySizeB,
 		kvValueSizeB: o.kvValueSizeB,
+		readPercent:  o.readPercent,
+		batchSize:    o.batchSize,
 		tracker:      newTracker(),
 	}
 }
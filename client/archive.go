@@ -0,0 +1,358 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// ArchiveOffset identifies the position in the WAL of a database up to which
+// committed frames have been archived. It can be passed to Archive using
+// WithArchiveOffset in order to resume archiving without shipping a new full
+// copy of the database.
+type ArchiveOffset struct {
+	Salt   uint64 // Salt of the WAL generation being archived.
+	Frames int    // Number of frames of that generation already archived.
+}
+
+// ArchiveOption can be used to tweak the behavior of Archive.
+type ArchiveOption func(*archiveOptions)
+
+type archiveOptions struct {
+	Interval time.Duration
+	Offset   ArchiveOffset
+	OnOffset func(ArchiveOffset)
+}
+
+// WithArchiveInterval sets how often the database is polled for newly
+// committed frames. It also sets the granularity of point-in-time recovery.
+//
+// The default is one second.
+func WithArchiveInterval(interval time.Duration) ArchiveOption {
+	return func(options *archiveOptions) {
+		options.Interval = interval
+	}
+}
+
+// WithArchiveOffset sets the offset to resume archiving from, as previously
+// reported to the function set with WithArchiveOffsetFunc.
+func WithArchiveOffset(offset ArchiveOffset) ArchiveOption {
+	return func(options *archiveOptions) {
+		options.Offset = offset
+	}
+}
+
+// WithArchiveOffsetFunc sets a function that will be invoked with the new
+// offset every time new data has been written to the archive, for example in
+// order to persist it.
+func WithArchiveOffsetFunc(f func(ArchiveOffset)) ArchiveOption {
+	return func(options *archiveOptions) {
+		options.OnOffset = f
+	}
+}
+
+func defaultArchiveOptions() *archiveOptions {
+	return &archiveOptions{
+		Interval: time.Second,
+		OnOffset: func(ArchiveOffset) {},
+	}
+}
+
+// Archive continuously ships the committed WAL frames of the database with the
+// given name to w, until the given context is done.
+//
+// The archive is a sequence of timestamped records, each holding either a full
+// copy of the database or a batch of WAL frames to apply on top of it. A full
+// copy is written when archiving starts without an offset and whenever the WAL
+// gets restarted after a checkpoint. Use Replay to reconstruct the database as
+// it was at a given point in time.
+//
+// Polling only queries the data version of the database: the database and its
+// WAL are dumped from the node only when a transaction was committed since the
+// previous poll, and only the new frames are written to w.
+//
+// The client should be connected to the leader. Any error, for example due to
+// a leadership change, stops archiving: it can be resumed with a new client
+// using the last reported offset.
+func (c *Client) Archive(ctx context.Context, dbname string, w io.Writer, options ...ArchiveOption) error {
+	o := defaultArchiveOptions()
+	for _, option := range options {
+		option(o)
+	}
+
+	watch, err := c.watchDatabase(ctx, dbname)
+	if err != nil {
+		return err
+	}
+	defer watch.protocol.Close()
+
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	offset := o.Offset
+	version := int64(-1)
+	for {
+		// A dump transfers the whole database and WAL, so only request
+		// one when the database changed since the previous one. The
+		// version must be read first, so that changes committed while
+		// dumping are picked up at the next poll.
+		current, err := watch.dataVersion(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if current != version {
+			files, err := c.Dump(ctx, dbname)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			db, wal := splitDump(files)
+
+			next, err := archive(w, time.Now(), db, wal, offset)
+			if err != nil {
+				return err
+			}
+			if next != offset {
+				offset = next
+				o.OnOffset(offset)
+			}
+			version = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Open the database with the given name on a dedicated connection, used to
+// detect changes cheaply.
+func (c *Client) watchDatabase(ctx context.Context, dbname string) (*restoreTarget, error) {
+	p, err := c.pool.connect(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open new connection")
+	}
+
+	request := protocol.Message{}
+	request.Init(4096)
+	response := protocol.Message{}
+	response.Init(4096)
+
+	protocol.EncodeOpen(&request, dbname, 0, "volatile")
+	if err := p.Call(ctx, &request, &response); err != nil {
+		p.Close()
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+	id, err := protocol.DecodeDb(&response)
+	if err != nil {
+		p.Close()
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	return &restoreTarget{
+		protocol: p,
+		db:       uint64(id),
+		request:  &request,
+		response: &response,
+	}, nil
+}
+
+// Return the data version of the database, which changes every time another
+// connection commits a transaction.
+func (t *restoreTarget) dataVersion(ctx context.Context) (int64, error) {
+	rows, err := t.query(ctx, "PRAGMA data_version")
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		return 0, errors.New("unexpected data version result")
+	}
+	version, ok := rows[0][0].(int64)
+	if !ok {
+		return 0, errors.Errorf("unexpected data version %v", rows[0][0])
+	}
+	return version, nil
+}
+
+// Kinds of archive records.
+const (
+	archiveBase   = uint32(1) // Full copy of the database.
+	archiveFrames = uint32(2) // WAL frames to apply to the previous records.
+)
+
+// Every archive record starts with a header holding the magic string, the
+// record kind, the WAL page size, a reserved word, the timestamp in
+// nanoseconds, the WAL salt and the length of the data that follows.
+const archiveHeaderSize = 40
+
+var archiveMagic = []byte("DQAR")
+
+// Write to w the data needed to bring the archive up to date with the given
+// database and WAL files, returning the new offset.
+func archive(w io.Writer, now time.Time, db, wal []byte, offset ArchiveOffset) (ArchiveOffset, error) {
+	if len(wal) == 0 {
+		// Nothing was written since the database was created.
+		return offset, nil
+	}
+
+	pageSize, err := walPageSize(wal)
+	if err != nil {
+		return offset, err
+	}
+	salt := binary.BigEndian.Uint64(wal[16:24])
+	committed := walCommittedFrames(wal, pageSize)
+
+	if salt != offset.Salt || committed < offset.Frames {
+		data, err := mergeWAL(db, wal)
+		if err != nil {
+			return offset, errors.Wrap(err, "merge WAL")
+		}
+		if err := writeArchiveRecord(w, archiveBase, pageSize, now, salt, data); err != nil {
+			return offset, err
+		}
+		return ArchiveOffset{Salt: salt, Frames: committed}, nil
+	}
+
+	if committed == offset.Frames {
+		return offset, nil
+	}
+
+	frameSize := walFrameHeaderSize + pageSize
+	start := walHeaderSize + offset.Frames*frameSize
+	end := walHeaderSize + committed*frameSize
+	if err := writeArchiveRecord(w, archiveFrames, pageSize, now, salt, wal[start:end]); err != nil {
+		return offset, err
+	}
+
+	return ArchiveOffset{Salt: salt, Frames: committed}, nil
+}
+
+func writeArchiveRecord(w io.Writer, kind uint32, pageSize int, now time.Time, salt uint64, data []byte) error {
+	header := make([]byte, archiveHeaderSize)
+	copy(header[0:4], archiveMagic)
+	binary.BigEndian.PutUint32(header[4:8], kind)
+	binary.BigEndian.PutUint32(header[8:12], uint32(pageSize))
+	binary.BigEndian.PutUint64(header[16:24], uint64(now.UnixNano()))
+	binary.BigEndian.PutUint64(header[24:32], salt)
+	binary.BigEndian.PutUint64(header[32:40], uint64(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, "write archive record header")
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "write archive record data")
+	}
+
+	return nil
+}
+
+// Replay reads an archive written by Archive from r and writes to w the
+// database as it was at the given point in time, as a standard SQLite database
+// file. If until is the zero time, the whole archive is replayed.
+func Replay(r io.Reader, until time.Time, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, archiveHeaderSize)
+
+	var db []byte
+	var salt uint64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrap(err, "read archive record header")
+		}
+		if string(header[0:4]) != string(archiveMagic) {
+			return fmt.Errorf("invalid archive record")
+		}
+		kind := binary.BigEndian.Uint32(header[4:8])
+		pageSize := binary.BigEndian.Uint32(header[8:12])
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(header[16:24])))
+		recordSalt := binary.BigEndian.Uint64(header[24:32])
+		size := binary.BigEndian.Uint64(header[32:40])
+
+		if !until.IsZero() && timestamp.After(until) {
+			break
+		}
+
+		if err := checkArchiveRecord(kind, pageSize, size); err != nil {
+			return err
+		}
+
+		// Don't trust the size to allocate the data up front: grow the
+		// buffer as the data is actually read.
+		buf := bytes.NewBuffer(nil)
+		if _, err := io.CopyN(buf, reader, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return errors.Wrap(err, "read archive record data")
+		}
+		data := buf.Bytes()
+
+		switch kind {
+		case archiveBase:
+			db = data
+			salt = recordSalt
+		case archiveFrames:
+			if db == nil {
+				return fmt.Errorf("archive has no full copy of the database")
+			}
+			if recordSalt != salt {
+				return fmt.Errorf("archive has a gap at %s", timestamp)
+			}
+			// The frames were validated when archived, and their
+			// checksums can't be verified without the frames that
+			// preceded them in the WAL.
+			var err error
+			if db, err = applyFrames(db, data, int(pageSize)); err != nil {
+				return errors.Wrap(err, "apply WAL frames")
+			}
+		}
+	}
+
+	if db == nil {
+		return fmt.Errorf("archive has no full copy of the database")
+	}
+
+	if _, err := w.Write(db); err != nil {
+		return errors.Wrap(err, "write database")
+	}
+
+	return nil
+}
+
+// Check that the header of an archive record is consistent: base records hold
+// whole pages and frames records hold whole frames.
+func checkArchiveRecord(kind uint32, pageSize uint32, size uint64) error {
+	if pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("invalid archive page size %d", pageSize)
+	}
+	unit := uint64(pageSize)
+	switch kind {
+	case archiveBase:
+	case archiveFrames:
+		unit += walFrameHeaderSize
+	default:
+		return fmt.Errorf("unknown archive record kind %d", kind)
+	}
+	if size%unit != 0 || size > math.MaxInt32*unit {
+		return fmt.Errorf("invalid archive record size %d", size)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// +build !nosqlite3,!nocgo
+
+package client_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dqlite-archive-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA wal_autocheckpoint=0")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE test (n INT)")
+	require.NoError(t, err)
+
+	var archive bytes.Buffer
+	offset := client.ArchiveOffset{}
+	start := time.Now()
+
+	// Archive a snapshot after each batch of inserts, one second apart.
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 10; j++ {
+			_, err = db.Exec("INSERT INTO test(n) VALUES(?)", j)
+			require.NoError(t, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		wal, err := ioutil.ReadFile(path + "-wal")
+		require.NoError(t, err)
+
+		now := start.Add(time.Duration(i) * time.Second)
+		next, err := client.ArchiveFiles(&archive, now, data, wal, offset)
+		require.NoError(t, err)
+		assert.True(t, next.Frames > offset.Frames)
+		offset = next
+	}
+
+	// Nothing new to archive.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	wal, err := ioutil.ReadFile(path + "-wal")
+	require.NoError(t, err)
+	size := archive.Len()
+	next, err := client.ArchiveFiles(&archive, time.Now(), data, wal, offset)
+	require.NoError(t, err)
+	assert.Equal(t, offset, next)
+	assert.Equal(t, size, archive.Len())
+
+	cases := []struct {
+		until time.Time
+		count int
+	}{
+		{start, 10},
+		{start.Add(time.Second), 20},
+		{time.Time{}, 30},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		require.NoError(t, client.Replay(bytes.NewReader(archive.Bytes()), c.until, &buf))
+
+		restored := filepath.Join(dir, "restored.db")
+		require.NoError(t, ioutil.WriteFile(restored, buf.Bytes(), 0600))
+
+		rdb, err := sql.Open("sqlite3", restored)
+		require.NoError(t, err)
+		var count int
+		require.NoError(t, rdb.QueryRow("SELECT count(*) FROM test").Scan(&count))
+		assert.Equal(t, c.count, count)
+		require.NoError(t, rdb.Close())
+		require.NoError(t, os.Remove(restored))
+	}
+}
+
+// Records with inconsistent headers are rejected without trusting their size.
+func TestReplay_InvalidRecord(t *testing.T) {
+	header := func(kind, pageSize uint32, size uint64) []byte {
+		header := make([]byte, 40)
+		copy(header, "DQAR")
+		binary.BigEndian.PutUint32(header[4:8], kind)
+		binary.BigEndian.PutUint32(header[8:12], pageSize)
+		binary.BigEndian.PutUint64(header[32:40], size)
+		return header
+	}
+
+	cases := []struct {
+		title  string
+		record []byte
+		err    string
+	}{
+		{"bad page size", header(1, 1000, 1000), "invalid archive page size 1000"},
+		{"bad kind", header(3, 4096, 4096), "unknown archive record kind 3"},
+		{"partial page", header(1, 4096, 100), "invalid archive record size 100"},
+		{"partial frame", header(2, 4096, 4096), "invalid archive record size 4096"},
+		{"size out of bounds", header(1, 4096, 1<<62), "invalid archive record size 4611686018427387904"},
+		{"huge size", header(1, 4096, 1<<40), "read archive record data: unexpected EOF"},
+		{"truncated", append(header(1, 4096, 4096), 0), "read archive record data: unexpected EOF"},
+		{"page number 0", bytes.Join([][]byte{
+			header(1, 4096, 4096), make([]byte, 4096),
+			header(2, 4096, 4096+24), make([]byte, 4096+24),
+		}, nil), "apply WAL frames: invalid page number 0 in WAL frame 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			err := client.Replay(bytes.NewReader(c.record), time.Time{}, ioutil.Discard)
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
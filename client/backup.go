@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Size of the WAL file header and of each WAL frame header.
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+// Magic number of WAL files, whose least significant bit is set if the
+// checksums are computed on big-endian words.
+const walMagic = 0x377f0682
+
+// Backup writes to w a transactionally consistent copy of the database with
+// the given name, as a standard SQLite database file.
+//
+// The copy is taken from the node the client is connected to, so the client
+// should be connected to the leader in order to get the most recent data, for
+// example by creating it with FindLeader. Writes can continue while the backup
+// is taken.
+func (c *Client) Backup(ctx context.Context, dbname string, w io.Writer) error {
+	files, err := c.Dump(ctx, dbname)
+	if err != nil {
+		return err
+	}
+
+	db, wal := splitDump(files)
+
+	data, err := mergeWAL(db, wal)
+	if err != nil {
+		return fmt.Errorf("merge WAL: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+
+	return nil
+}
+
+// Apply the committed frames of the given WAL to the given database file,
+// returning the resulting database file.
+func mergeWAL(db []byte, wal []byte) ([]byte, error) {
+	if len(wal) == 0 {
+		return db, nil
+	}
+	pageSize, err := walPageSize(wal)
+	if err != nil {
+		return nil, err
+	}
+	committed := walCommittedFrames(wal, pageSize)
+	end := walHeaderSize + committed*(walFrameHeaderSize+pageSize)
+
+	return applyFrames(db, wal[walHeaderSize:end], pageSize)
+}
+
+// Apply the given WAL frames to the given database file, returning the
+// resulting database file. Frames following the last commit frame are left
+// out.
+func applyFrames(db []byte, frames []byte, pageSize int) ([]byte, error) {
+	merged := make([]byte, len(db))
+	copy(merged, db)
+
+	// Frames are applied to a scratch copy and published only once a
+	// commit frame is found, so partial transactions are left out.
+	pending := map[uint32][]byte{}
+	frameSize := walFrameHeaderSize + pageSize
+	for offset := 0; offset+frameSize <= len(frames); offset += frameSize {
+		header := frames[offset : offset+walFrameHeaderSize]
+		pgno := binary.BigEndian.Uint32(header[0:4])
+		if pgno == 0 {
+			return nil, fmt.Errorf("invalid page number 0 in WAL frame %d", offset/frameSize+1)
+		}
+		pending[pgno] = frames[offset+walFrameHeaderSize : offset+frameSize]
+
+		commit := int(binary.BigEndian.Uint32(header[4:8]))
+		if commit == 0 {
+			continue
+		}
+
+		size := commit * pageSize
+		if size > len(merged) {
+			merged = append(merged, make([]byte, size-len(merged))...)
+		}
+		merged = merged[:size]
+		for pgno, page := range pending {
+			if int(pgno) > commit {
+				continue
+			}
+			copy(merged[int(pgno-1)*pageSize:], page)
+		}
+		pending = map[uint32][]byte{}
+	}
+
+	return merged, nil
+}
+
+// Split the files returned by Dump into the database file and the WAL file.
+func splitDump(files []File) (db []byte, wal []byte) {
+	for _, file := range files {
+		if strings.HasSuffix(file.Name, "-wal") {
+			wal = file.Data
+		} else {
+			db = file.Data
+		}
+	}
+	return db, wal
+}
+
+// Validate the header of the given WAL and return its page size.
+func walPageSize(wal []byte) (int, error) {
+	if len(wal) < walHeaderSize {
+		return 0, fmt.Errorf("WAL too short (%d bytes)", len(wal))
+	}
+	if magic := binary.BigEndian.Uint32(wal[0:4]); magic&^1 != walMagic {
+		return 0, fmt.Errorf("invalid WAL magic %#x", magic)
+	}
+	pageSize := int(binary.BigEndian.Uint32(wal[8:12]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return 0, fmt.Errorf("invalid WAL page size %d", pageSize)
+	}
+	return pageSize, nil
+}
+
+// Return the number of frames of the given WAL up to and including its last
+// commit frame.
+//
+// As SQLite does when recovering a WAL, frames are only considered up to the
+// first one which doesn't have the salt of the header, whose checksum doesn't
+// match the cumulative checksum of the header and the frames before it, or
+// whose page number is zero. Such frames are left over from a previous
+// generation of the WAL or were only partially written. If the checksum of
+// the header itself doesn't match, the WAL holds no frames.
+func walCommittedFrames(wal []byte, pageSize int) int {
+	// The least significant bit of the magic number tells the byte order
+	// of the checksummed words.
+	order := binary.ByteOrder(binary.LittleEndian)
+	if binary.BigEndian.Uint32(wal[0:4])&1 == 1 {
+		order = binary.BigEndian
+	}
+
+	s0, s1 := walChecksum(order, 0, 0, wal[:24])
+	if s0 != binary.BigEndian.Uint32(wal[24:28]) || s1 != binary.BigEndian.Uint32(wal[28:32]) {
+		return 0
+	}
+
+	salt := wal[16:24]
+	frameSize := walFrameHeaderSize + pageSize
+	committed := 0
+	for i, offset := 0, walHeaderSize; offset+frameSize <= len(wal); i, offset = i+1, offset+frameSize {
+		header := wal[offset : offset+walFrameHeaderSize]
+		if string(header[8:16]) != string(salt) {
+			break
+		}
+		if binary.BigEndian.Uint32(header[0:4]) == 0 {
+			break
+		}
+		s0, s1 = walChecksum(order, s0, s1, header[:8])
+		s0, s1 = walChecksum(order, s0, s1, wal[offset+walFrameHeaderSize:offset+frameSize])
+		if s0 != binary.BigEndian.Uint32(header[16:20]) || s1 != binary.BigEndian.Uint32(header[20:24]) {
+			break
+		}
+		if binary.BigEndian.Uint32(header[4:8]) != 0 {
+			committed = i + 1
+		}
+	}
+	return committed
+}
+
+// Update the given WAL checksum with the given data, whose length must be a
+// multiple of 8, using the same algorithm as SQLite.
+func walChecksum(order binary.ByteOrder, s0, s1 uint32, data []byte) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:]) + s1
+		s1 += order.Uint32(data[i+4:]) + s0
+	}
+	return s0, s1
+}
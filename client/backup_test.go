@@ -0,0 +1,165 @@
+// +build !nosqlite3,!nocgo
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dqlite-backup-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data, wal := newWAL(t, dir, 100)
+
+	merged, err := client.MergeWAL(data, wal)
+	require.NoError(t, err)
+	assert.Equal(t, 100, countRows(t, dir, merged))
+}
+
+// Frames are only applied up to the first one whose checksum doesn't match,
+// and none is applied if the checksum of the WAL header doesn't match.
+func TestMergeWAL_Checksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dqlite-backup-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data, wal := newWAL(t, dir, 100)
+	pageSize := int(binary.BigEndian.Uint32(wal[8:12]))
+	frameSize := 24 + pageSize
+	frames := (len(wal) - 32) / frameSize
+
+	// Corrupt the last byte of the page of a frame in the middle.
+	corrupted := append([]byte{}, wal...)
+	corrupted[32+(frames/2+1)*frameSize-1] ^= 0xff
+	merged, err := client.MergeWAL(data, corrupted)
+	require.NoError(t, err)
+	count := countRows(t, dir, merged)
+	assert.True(t, count > 0 && count < 100, "unexpected count %d", count)
+
+	// Corrupt the checksum of the header.
+	corrupted = append([]byte{}, wal...)
+	corrupted[24] ^= 0xff
+	merged, err = client.MergeWAL(data, corrupted)
+	require.NoError(t, err)
+	assert.Equal(t, data, merged)
+}
+
+// Create a database in WAL mode in the given directory, insert the given
+// number of rows, one per transaction, and return the content of the
+// database file and of the WAL.
+func newWAL(t *testing.T, dir string, n int) ([]byte, []byte) {
+	path := filepath.Join(dir, "test.db")
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA wal_autocheckpoint=0")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE test (n INT)")
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		_, err = db.Exec("INSERT INTO test(n) VALUES(?)", i)
+		require.NoError(t, err)
+	}
+
+	// Read the files while the connection is open, so the WAL is not
+	// checkpointed.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	wal, err := ioutil.ReadFile(path + "-wal")
+	require.NoError(t, err)
+	require.NotEmpty(t, wal)
+
+	return data, wal
+}
+
+// Write the given database file to the given directory, check its integrity
+// and return the number of rows of its test table.
+func countRows(t *testing.T, dir string, data []byte) int {
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, ioutil.WriteFile(backup, data, 0600))
+	defer os.Remove(backup)
+
+	restored, err := sql.Open("sqlite3", backup)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	var count int
+	require.NoError(t, restored.QueryRow("SELECT count(*) FROM test").Scan(&count))
+
+	var check string
+	require.NoError(t, restored.QueryRow("PRAGMA integrity_check").Scan(&check))
+	assert.Equal(t, "ok", fmt.Sprint(check))
+
+	return count
+}
+
+func TestClient_BackupRestore(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli, err := client.New(ctx, node.BindAddress())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	dir, err := ioutil.TempDir("", "dqlite-restore-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "source.db")
+	src, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = src.Exec(`
+CREATE TABLE test (n INT, t DATETIME);
+CREATE INDEX test_n ON test(n);
+PRAGMA user_version=7;
+INSERT INTO test(n, t) VALUES(1, '2020-01-01 00:00:00'), (2, NULL);
+`)
+	require.NoError(t, err)
+	require.NoError(t, src.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, cli.Restore(ctx, "test.db", bytes.NewReader(data)))
+
+	var buf bytes.Buffer
+	require.NoError(t, cli.Backup(ctx, "test.db", &buf))
+
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, ioutil.WriteFile(backup, buf.Bytes(), 0600))
+
+	db, err := sql.Open("sqlite3", backup)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM test WHERE n > 0").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	var version int
+	require.NoError(t, db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, 7, version)
+
+	var value string
+	require.NoError(t, db.QueryRow("SELECT +t FROM test WHERE n = 1").Scan(&value))
+	assert.Equal(t, "2020-01-01 00:00:00", value)
+}
@@ -2,8 +2,11 @@ package client
 
 import (
 	"context"
+	"database/sql/driver"
+	"time"
 
 	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/canonical/go-dqlite/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -12,7 +15,7 @@ type DialFunc = protocol.DialFunc
 
 // Client speaks the dqlite wire protocol.
 type Client struct {
-	protocol *protocol.Protocol
+	pool *pool
 }
 
 // Option that can be used to tweak client parameters.
@@ -22,6 +25,14 @@ type options struct {
 	DialFunc              DialFunc
 	LogFunc               LogFunc
 	ConcurrentLeaderConns int64
+	Concurrency           int
+	MaxMessageSize        uint64
+	PreferredNodes        func(NodeInfo) bool
+	CircuitBreaker        *CircuitBreaker
+	RetryBudget           *RetryBudget
+	DialTimeout           time.Duration
+	HandshakeTimeout      time.Duration
+	ConnectTimeout        time.Duration
 }
 
 // WithDialFunc sets a custom dial function for creating the client network
@@ -50,6 +61,125 @@ func WithConcurrentLeaderConns(maxConns int64) Option {
 	}
 }
 
+// WithConcurrency sets the maximum number of connections the client opens to
+// the node it's connected to, allowing up to that many requests to run in
+// parallel. Additional connections are opened on demand.
+//
+// The default is 1, meaning that all requests are serialized over a single
+// connection.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.Concurrency = n
+	}
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of the requests sent and
+// of the responses received by the client. Requests or responses exceeding it
+// fail with ErrMessageTooLarge.
+//
+// Note that the limit applies to whole responses: a query returning many rows
+// might be split by the node into several responses, each of which must fit.
+//
+// The default is 0, meaning no limit.
+func WithMaxMessageSize(bytes uint64) Option {
+	return func(o *options) {
+		o.MaxMessageSize = bytes
+	}
+}
+
+// WithPreferredNodes makes FindLeader ask the nodes matching the given filter
+// for the current leader before the others, which are asked only if none of
+// the preferred ones can point to it. For example, a filter selecting the
+// nodes in the caller's availability zone avoids cross-zone traffic while
+// probing.
+//
+// This only affects leader discovery: the resulting client is always
+// connected to the leader, wherever it is.
+func WithPreferredNodes(filter func(NodeInfo) bool) Option {
+	return func(o *options) {
+		o.PreferredNodes = filter
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing the network connection to
+// a node, separately for each node and each attempt. It doesn't include the
+// protocol handshake, see WithHandshakeTimeout.
+//
+// The default used by FindLeader is 5 seconds, while New relies only on its
+// context.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.DialTimeout = timeout
+	}
+}
+
+// WithHandshakeTimeout sets the timeout for the protocol handshake with a node
+// once the network connection is established, separately for each node and
+// each attempt. When looking for the leader, it also covers asking the node
+// who the leader is.
+//
+// On lossy networks this allows waiting patiently for connections to be
+// established while still giving up quickly on nodes that accept connections
+// but don't respond.
+//
+// The default is no timeout other than the one of the whole attempt to probe
+// a node, which for FindLeader is 15 seconds.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.HandshakeTimeout = timeout
+	}
+}
+
+// WithConnectTimeout sets the overall deadline for FindLeader to find the
+// leader and connect to it, across all attempts and retries. It also applies
+// to the additional connections opened because of WithConcurrency.
+//
+// The default is to keep retrying until the given context is done.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.ConnectTimeout = timeout
+	}
+}
+
+// CircuitBreaker makes FindLeader skip the nodes that repeatedly failed to
+// accept a connection, see WithCircuitBreaker.
+type CircuitBreaker = protocol.CircuitBreaker
+
+// NewCircuitBreaker returns a circuit breaker that opens for a node after the
+// given number of consecutive failed connection attempts, and lets a new
+// attempt through only after the given cooldown period.
+var NewCircuitBreaker = protocol.NewCircuitBreaker
+
+// RetryBudget limits the number of retries FindLeader makes, see
+// WithRetryBudget.
+type RetryBudget = protocol.RetryBudget
+
+// NewRetryBudget returns a retry budget allowing the given number of retries
+// within each time window of the given length.
+var NewRetryBudget = protocol.NewRetryBudget
+
+// WithCircuitBreaker makes FindLeader skip the nodes whose breaker is open,
+// instead of dialing them again and waiting for the attempt to fail. The same
+// breaker can be shared by many calls, so they all benefit from what the
+// others observed.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(o *options) {
+		o.CircuitBreaker = breaker
+	}
+}
+
+// WithRetryBudget makes FindLeader stop retrying and return an error as soon
+// as the given budget is spent, instead of waiting for its context to be
+// canceled. Sharing the same
+// budget between many calls bounds the overall number of retries, so that if
+// the whole cluster is down callers fail fast instead of piling up behind
+// their backoff delays.
+func WithRetryBudget(budget *RetryBudget) Option {
+	return func(o *options) {
+		o.RetryBudget = budget
+	}
+}
+
 // New creates a new client connected to the dqlite node with the given
 // address.
 func New(ctx context.Context, address string, options ...Option) (*Client, error) {
@@ -59,22 +189,77 @@ func New(ctx context.Context, address string, options ...Option) (*Client, error
 		option(o)
 	}
 	// Establish the connection.
-	conn, err := o.DialFunc(ctx, address)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to establish network connection")
+	connect := func(ctx context.Context) (*protocol.Protocol, error) {
+		dialCtx := ctx
+		if o.DialTimeout > 0 {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithTimeout(ctx, o.DialTimeout)
+			defer cancel()
+		}
+		conn, err := o.DialFunc(dialCtx, address)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to establish network connection")
+		}
+
+		if o.HandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.HandshakeTimeout)
+			defer cancel()
+		}
+		protocol, err := protocol.Handshake(ctx, conn, protocol.VersionOne)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		protocol.SetMaxMessageSize(o.MaxMessageSize)
+
+		return protocol, nil
 	}
 
-	protocol, err := protocol.Handshake(ctx, conn, protocol.VersionOne)
+	protocol, err := connect(ctx)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
 
-	client := &Client{protocol: protocol}
+	client := &Client{pool: newPool(o.Concurrency, protocol, connect)}
 
 	return client, nil
 }
 
+// Send a request over one of the client's connections and receive the
+// response.
+//
+// If the node replies with a failure response, the error it carries is
+// returned, turned into an ErrNotLeader error if the node is not the leader.
+func (c *Client) call(ctx context.Context, request, response *protocol.Message) error {
+	p, err := c.pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = p.Call(ctx, request, response)
+	if err == nil {
+		err = protocol.DecodeError(response)
+	}
+	if e, ok := err.(protocol.ErrRequest); ok && e.NotLeader() {
+		notLeader, leaderErr := p.NotLeader(ctx)
+		if leaderErr != nil {
+			err = leaderErr // Don't reuse the connection.
+		}
+		c.pool.release(p, err)
+		return notLeader
+	}
+	c.pool.release(p, err)
+	return err
+}
+
+// ErrNotLeader is returned by requests that must be served by the leader,
+// when the node the client is connected to is not the leader.
+type ErrNotLeader = protocol.ErrNotLeader
+
+// ErrMessageTooLarge is returned when a request or a response exceeds the
+// size set with WithMaxMessageSize.
+type ErrMessageTooLarge = protocol.ErrMessageTooLarge
+
 // Leader returns information about the current leader, if any.
 func (c *Client) Leader(ctx context.Context) (*NodeInfo, error) {
 	request := protocol.Message{}
@@ -84,7 +269,7 @@ func (c *Client) Leader(ctx context.Context) (*NodeInfo, error) {
 
 	protocol.EncodeLeader(&request)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return nil, errors.Wrap(err, "failed to send Leader request")
 	}
 
@@ -98,6 +283,28 @@ func (c *Client) Leader(ctx context.Context) (*NodeInfo, error) {
 	return info, nil
 }
 
+// Ping checks that the node this client is connected to is alive and
+// responsive, by performing a lightweight round-trip that does not touch any
+// database.
+func (c *Client) Ping(ctx context.Context) error {
+	request := protocol.Message{}
+	request.Init(16)
+	response := protocol.Message{}
+	response.Init(512)
+
+	protocol.EncodeLeader(&request)
+
+	if err := c.call(ctx, &request, &response); err != nil {
+		return errors.Wrap(err, "failed to send Leader request")
+	}
+
+	if _, _, err := protocol.DecodeNode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse Node response")
+	}
+
+	return nil
+}
+
 // Cluster returns information about all nodes in the cluster.
 func (c *Client) Cluster(ctx context.Context) ([]NodeInfo, error) {
 	request := protocol.Message{}
@@ -107,7 +314,7 @@ func (c *Client) Cluster(ctx context.Context) ([]NodeInfo, error) {
 
 	protocol.EncodeCluster(&request, protocol.ClusterFormatV1)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return nil, errors.Wrap(err, "failed to send Cluster request")
 	}
 
@@ -137,7 +344,7 @@ func (c *Client) Dump(ctx context.Context, dbname string) ([]File, error) {
 
 	protocol.EncodeDump(&request, dbname)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return nil, errors.Wrap(err, "failed to send dump request")
 	}
 
@@ -156,16 +363,108 @@ func (c *Client) Dump(ctx context.Context, dbname string) ([]File, error) {
 		}
 		dump = append(dump, File{Name: name, Data: data})
 	}
+	if err := files.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to parse files response")
+	}
 
 	return dump, nil
 }
 
+// DatabaseSize returns the size in bytes of the database with the given name,
+// as of its last committed transaction.
+//
+// The node the client is connected to must be the leader, and the database is
+// created if it doesn't exist yet.
+func (c *Client) DatabaseSize(ctx context.Context, name string) (uint64, error) {
+	// A connection can open only one database, and can't close it, so use
+	// a dedicated one.
+	p, err := c.pool.connect(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open new connection")
+	}
+	defer p.Close()
+
+	request := protocol.Message{}
+	request.Init(4096)
+	response := protocol.Message{}
+	response.Init(4096)
+
+	send := func() error {
+		err := p.Call(ctx, &request, &response)
+		if err == nil {
+			err = protocol.DecodeError(&response)
+		}
+		if e, ok := err.(protocol.ErrRequest); ok && e.NotLeader() {
+			notLeader, _ := p.NotLeader(ctx)
+			return notLeader
+		}
+		return err
+	}
+
+	protocol.EncodeOpen(&request, name, 0, "volatile")
+	if err := send(); err != nil {
+		return 0, errors.Wrap(err, "failed to open database")
+	}
+	db, err := protocol.DecodeDb(&response)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse db response")
+	}
+
+	protocol.EncodeQuerySQLV0(&request, uint64(db),
+		"SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()", nil)
+	if err := send(); err != nil {
+		return 0, errors.Wrap(err, "failed to query database size")
+	}
+	rows, err := protocol.DecodeRows(&response)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse rows response")
+	}
+	values := make([]driver.Value, 1)
+	err = rows.Next(values)
+	rows.Close()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse rows response")
+	}
+	size, ok := values[0].(int64)
+	if !ok {
+		return 0, errors.Errorf("unexpected database size %v", values[0])
+	}
+
+	return uint64(size), nil
+}
+
+// ErrDuplicateID is returned by Client.Add when the cluster already has a
+// node with the same ID as the one being added.
+var ErrDuplicateID = errors.New("node ID already in use")
+
 // Add a node to a cluster.
 //
 // The new node will have the role specified in node.Role. Note that if the
 // desired role is Voter, the node being added must be online, since it will be
 // granted voting rights only once it catches up with the leader's log.
+//
+// If another node of the cluster has the same ID, an error wrapping
+// ErrDuplicateID is returned.
 func (c *Client) Add(ctx context.Context, node NodeInfo) error {
+	ctx, span := tracing.Start(ctx, "dqlite.client.Add", "")
+	defer span.End()
+	tracing.SetAttributes(span,
+		tracing.Attribute{Key: tracing.NodeIDKey, Value: node.ID},
+		tracing.Attribute{Key: tracing.NodeAddressKey, Value: node.Address},
+	)
+
+	// Catch ID collisions before the leader rejects them with a generic
+	// error.
+	nodes, err := c.Cluster(ctx)
+	if err != nil {
+		return err
+	}
+	for _, other := range nodes {
+		if other.ID == node.ID {
+			return errors.Wrapf(ErrDuplicateID, "node %d has address %s", other.ID, other.Address)
+		}
+	}
+
 	request := protocol.Message{}
 	response := protocol.Message{}
 
@@ -174,7 +473,7 @@ func (c *Client) Add(ctx context.Context, node NodeInfo) error {
 
 	protocol.EncodeAdd(&request, node.ID, node.Address)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return err
 	}
 
@@ -202,6 +501,13 @@ func (c *Client) Add(ctx context.Context, node NodeInfo) error {
 // If the target node does not exist or has already the desired role, an error
 // is returned.
 func (c *Client) Assign(ctx context.Context, id uint64, role NodeRole) error {
+	ctx, span := tracing.Start(ctx, "dqlite.client.Assign", "")
+	defer span.End()
+	tracing.SetAttributes(span,
+		tracing.Attribute{Key: tracing.NodeIDKey, Value: id},
+		tracing.Attribute{Key: tracing.NodeRoleKey, Value: role.String()},
+	)
+
 	request := protocol.Message{}
 	response := protocol.Message{}
 
@@ -210,7 +516,7 @@ func (c *Client) Assign(ctx context.Context, id uint64, role NodeRole) error {
 
 	protocol.EncodeAssign(&request, id, uint64(role))
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return err
 	}
 
@@ -225,6 +531,10 @@ func (c *Client) Assign(ctx context.Context, id uint64, role NodeRole) error {
 //
 // This must be invoked one client connected to the current leader.
 func (c *Client) Transfer(ctx context.Context, id uint64) error {
+	ctx, span := tracing.Start(ctx, "dqlite.client.Transfer", "")
+	defer span.End()
+	tracing.SetAttributes(span, tracing.Attribute{Key: tracing.NodeIDKey, Value: id})
+
 	request := protocol.Message{}
 	response := protocol.Message{}
 
@@ -233,7 +543,7 @@ func (c *Client) Transfer(ctx context.Context, id uint64) error {
 
 	protocol.EncodeTransfer(&request, id)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return err
 	}
 
@@ -246,6 +556,10 @@ func (c *Client) Transfer(ctx context.Context, id uint64) error {
 
 // Remove a node from the cluster.
 func (c *Client) Remove(ctx context.Context, id uint64) error {
+	ctx, span := tracing.Start(ctx, "dqlite.client.Remove", "")
+	defer span.End()
+	tracing.SetAttributes(span, tracing.Attribute{Key: tracing.NodeIDKey, Value: id})
+
 	request := protocol.Message{}
 	request.Init(4096)
 	response := protocol.Message{}
@@ -253,7 +567,7 @@ func (c *Client) Remove(ctx context.Context, id uint64) error {
 
 	protocol.EncodeRemove(&request, id)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return err
 	}
 
@@ -279,7 +593,7 @@ func (c *Client) Describe(ctx context.Context) (*NodeMetadata, error) {
 
 	protocol.EncodeDescribe(&request, protocol.RequestDescribeFormatV0)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return nil, err
 	}
 
@@ -305,7 +619,7 @@ func (c *Client) Weight(ctx context.Context, weight uint64) error {
 
 	protocol.EncodeWeight(&request, weight)
 
-	if err := c.protocol.Call(ctx, &request, &response); err != nil {
+	if err := c.call(ctx, &request, &response); err != nil {
 		return err
 	}
 
@@ -318,7 +632,7 @@ func (c *Client) Weight(ctx context.Context, weight uint64) error {
 
 // Close the client.
 func (c *Client) Close() error {
-	return c.protocol.Close()
+	return c.pool.close()
 }
 
 // Create a client options object with sane defaults.
@@ -327,5 +641,6 @@ func defaultOptions() *options {
 		DialFunc:              DefaultDialFunc,
 		LogFunc:               DefaultLogFunc,
 		ConcurrentLeaderConns: protocol.MaxConcurrentLeaderConns,
+		Concurrency:           1,
 	}
 }
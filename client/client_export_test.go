@@ -1,9 +1,20 @@
 package client
 
 import (
+	"context"
+
 	"github.com/canonical/go-dqlite/internal/protocol"
 )
 
 func (c *Client) Protocol() *protocol.Protocol {
-	return c.protocol
+	p, err := c.pool.acquire(context.Background())
+	if err != nil {
+		return nil
+	}
+	c.pool.release(p, nil)
+	return p
 }
+
+var MergeWAL = mergeWAL
+
+var ArchiveFiles = archive
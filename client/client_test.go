@@ -33,6 +33,47 @@ func TestClient_Leader(t *testing.T) {
 	assert.Equal(t, leader.Address, "@1001")
 }
 
+func TestClient_Ping(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := client.New(ctx, node.BindAddress())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Ping(ctx))
+
+	require.NoError(t, client.Close())
+	assert.Error(t, client.Ping(ctx))
+}
+
+func TestClient_Concurrency(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cli, err := client.New(ctx, node.BindAddress(), client.WithConcurrency(4))
+	require.NoError(t, err)
+
+	errs := make(chan error, 16)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := cli.Leader(ctx)
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	require.NoError(t, cli.Close())
+	assert.Error(t, cli.Ping(ctx))
+}
+
 func TestClient_Dump(t *testing.T) {
 	node, cleanup := newNode(t)
 	defer cleanup()
@@ -76,6 +117,46 @@ func TestClient_Dump(t *testing.T) {
 	assert.Equal(t, 8272, len(files[1].Data))
 }
 
+func TestClient_DatabaseSize(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := client.New(ctx, node.BindAddress())
+	require.NoError(t, err)
+	defer client.Close()
+
+	size, err := client.DatabaseSize(ctx, "test.db")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), size)
+
+	request := protocol.Message{}
+	request.Init(4096)
+
+	response := protocol.Message{}
+	response.Init(4096)
+
+	protocol.EncodeOpen(&request, "test.db", 0, "volatile")
+
+	p := client.Protocol()
+	err = p.Call(ctx, &request, &response)
+	require.NoError(t, err)
+
+	db, err := protocol.DecodeDb(&response)
+	require.NoError(t, err)
+
+	protocol.EncodeExecSQLV0(&request, uint64(db), "CREATE TABLE foo (n INT)", nil)
+
+	err = p.Call(ctx, &request, &response)
+	require.NoError(t, err)
+
+	size, err = client.DatabaseSize(ctx, "test.db")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8192), size)
+}
+
 func TestClient_Cluster(t *testing.T) {
 	node, cleanup := newNode(t)
 	defer cleanup()
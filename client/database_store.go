@@ -1,4 +1,4 @@
-// +build !nosqlite3
+// +build !nosqlite3,!nocgo
 
 package client
 
@@ -31,14 +31,18 @@ type DatabaseNodeStore struct {
 // DefaultNodeStore creates a new NodeStore using the given filename.
 //
 // If the filename ends with ".yaml" then the YamlNodeStore implementation will
-// be used. Otherwise the SQLite-based one will be picked, with default names
-// for the schema, table and column parameters.
+// be used, and if it ends with ".json" the JSONNodeStore one. Otherwise the
+// SQLite-based one will be picked, with default names for the schema, table
+// and column parameters.
 //
 // It also creates the table if it doesn't exist yet.
 func DefaultNodeStore(filename string) (NodeStore, error) {
 	if strings.HasSuffix(filename, ".yaml") {
 		return NewYamlNodeStore(filename)
 	}
+	if strings.HasSuffix(filename, ".json") {
+		return NewJSONNodeStore(filename)
+	}
 
 	// Open the database.
 	db, err := sql.Open("sqlite3", filename)
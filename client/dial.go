@@ -14,12 +14,30 @@ func DefaultDialFunc(ctx context.Context, address string) (net.Conn, error) {
 	return protocol.Dial(ctx, address)
 }
 
+// DefaultPort is the port assumed by NormalizeAddress for addresses that don't
+// specify one.
+const DefaultPort = protocol.DefaultPort
+
+// NormalizeAddress returns the canonical "host:port" form of the given node
+// address. Bare IPv6 literals are enclosed in brackets, a missing port is
+// replaced with DefaultPort, and host names are kept as they are, to be
+// resolved at dial time. Abstract Unix socket addresses are not changed.
+//
+// The default dial function applies it automatically.
+func NormalizeAddress(address string) (string, error) {
+	return protocol.NormalizeAddress(address)
+}
+
 // DialFuncWithTLS returns a dial function that uses TLS encryption.
 //
 // The given dial function will be used to establish the network connection,
 // and the given TLS config will be used for encryption.
 func DialFuncWithTLS(dial DialFunc, config *tls.Config) DialFunc {
 	return func(ctx context.Context, addr string) (net.Conn, error) {
+		addr, err := NormalizeAddress(addr)
+		if err != nil {
+			return nil, err
+		}
 		clonedConfig := config.Clone()
 		if len(clonedConfig.ServerName) == 0 {
 			remoteIP, _, err := net.SplitHostPort(addr)
@@ -35,3 +53,28 @@ func DialFuncWithTLS(dial DialFunc, config *tls.Config) DialFunc {
 		return tls.Client(conn, clonedConfig), nil
 	}
 }
+
+// DialFuncWithToken returns a dial function that authenticates new connections
+// by sending the given token, as required by nodes of applications created
+// with app.WithAuth.
+//
+// The given dial function will be used to establish the network connection.
+// When combined with DialFuncWithTLS, the latter should be passed as dial
+// function here, so that the token is sent encrypted.
+func DialFuncWithToken(dial DialFunc, token string) DialFunc {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := protocol.Authenticate(ctx, conn, token); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// ErrAuthFailed is returned when a node rejects the token sent by a dial
+// function created with DialFuncWithToken.
+var ErrAuthFailed = protocol.ErrAuthFailed
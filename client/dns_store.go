@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSNodeStore resolves the addresses of the dqlite nodes from DNS, so clients
+// can be configured with a single stable name instead of a static list of
+// addresses.
+//
+// Results are cached for a fixed time, since the Go resolver does not expose
+// the TTL of DNS records. If a lookup fails, the last successful result is
+// returned, if any.
+type DNSNodeStore struct {
+	host     string // Name to resolve.
+	port     string // Port of the nodes, or empty for SRV lookups.
+	ttl      time.Duration
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	servers []NodeInfo
+	expires time.Time
+}
+
+// DNSNodeStoreOption can be used to tweak DNSNodeStore parameters.
+type DNSNodeStoreOption func(*dnsNodeStoreOptions)
+
+type dnsNodeStoreOptions struct {
+	TTL      time.Duration
+	Resolver *net.Resolver
+}
+
+// WithDNSCacheTTL sets how long resolved addresses are cached.
+//
+// The default is 30 seconds.
+func WithDNSCacheTTL(ttl time.Duration) DNSNodeStoreOption {
+	return func(options *dnsNodeStoreOptions) {
+		options.TTL = ttl
+	}
+}
+
+// WithDNSResolver sets the resolver used to perform lookups.
+//
+// The default is net.DefaultResolver.
+func WithDNSResolver(resolver *net.Resolver) DNSNodeStoreOption {
+	return func(options *dnsNodeStoreOptions) {
+		options.Resolver = resolver
+	}
+}
+
+// NewDNSNodeStore creates a new DNSNodeStore resolving the given name.
+//
+// If the name has the form "host:port", the A and AAAA records of host are
+// looked up, and all nodes are assumed to listen on the given port. Otherwise
+// the name is looked up as SRV record, for example "_dqlite._tcp.example.com",
+// which also provides the port of each node.
+func NewDNSNodeStore(name string, options ...DNSNodeStoreOption) *DNSNodeStore {
+	o := &dnsNodeStoreOptions{
+		TTL:      30 * time.Second,
+		Resolver: net.DefaultResolver,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		host = name
+		port = ""
+	}
+
+	return &DNSNodeStore{
+		host:     host,
+		port:     port,
+		ttl:      o.TTL,
+		resolver: o.Resolver,
+	}
+}
+
+// Get the current servers, resolving them again if the cached ones expired.
+func (s *DNSNodeStore) Get(ctx context.Context) ([]NodeInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.servers == nil || time.Now().After(s.expires) {
+		servers, err := s.lookup(ctx)
+		if err != nil && s.servers == nil {
+			return nil, err
+		}
+		if err == nil {
+			s.servers = servers
+			s.expires = time.Now().Add(s.ttl)
+		}
+	}
+
+	ret := make([]NodeInfo, len(s.servers))
+	copy(ret, s.servers)
+	return ret, nil
+}
+
+// Set does nothing, since DNS is the source of truth for the servers.
+func (s *DNSNodeStore) Set(ctx context.Context, servers []NodeInfo) error {
+	return nil
+}
+
+// Resolve the addresses of the servers, sorted.
+func (s *DNSNodeStore) lookup(ctx context.Context) ([]NodeInfo, error) {
+	addresses := []string{}
+
+	if s.port == "" {
+		_, records, err := s.resolver.LookupSRV(ctx, "", "", s.host)
+		if err != nil {
+			return nil, fmt.Errorf("lookup SRV records of %s: %w", s.host, err)
+		}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			addresses = append(addresses, net.JoinHostPort(host, fmt.Sprint(record.Port)))
+		}
+	} else {
+		ips, err := s.resolver.LookupIPAddr(ctx, s.host)
+		if err != nil {
+			return nil, fmt.Errorf("lookup addresses of %s: %w", s.host, err)
+		}
+		for _, ip := range ips {
+			addresses = append(addresses, net.JoinHostPort(ip.String(), s.port))
+		}
+	}
+
+	sort.Strings(addresses)
+
+	servers := make([]NodeInfo, len(addresses))
+	for i, address := range addresses {
+		servers[i].Address = address
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,42 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSNodeStore(t *testing.T) {
+	store := client.NewDNSNodeStore("127.0.0.1:9001")
+
+	servers, err := store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []client.NodeInfo{{Address: "127.0.0.1:9001"}}, servers)
+
+	// Set is a no-op.
+	require.NoError(t, store.Set(context.Background(), []client.NodeInfo{{Address: "1.2.3.4:666"}}))
+
+	servers, err = store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []client.NodeInfo{{Address: "127.0.0.1:9001"}}, servers)
+}
+
+func TestDNSNodeStore_LookupError(t *testing.T) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, fmt.Errorf("no network")
+		},
+	}
+
+	for _, name := range []string{"dqlite.invalid:9001", "_dqlite._tcp.dqlite.invalid"} {
+		store := client.NewDNSNodeStore(name, client.WithDNSResolver(resolver))
+		_, err := store.Get(context.Background())
+		assert.Error(t, err)
+	}
+}
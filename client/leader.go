@@ -12,6 +12,9 @@ import (
 // each of them check if it's the current leader. If no leader is found, the
 // function will keep retrying (with a capped exponential backoff) until the
 // given context is canceled.
+//
+// Additional connections opened because of WithConcurrency go through the
+// same search, so they connect to whichever node is leader at that time.
 func FindLeader(ctx context.Context, store NodeStore, options ...Option) (*Client, error) {
 	o := defaultOptions()
 
@@ -21,7 +24,14 @@ func FindLeader(ctx context.Context, store NodeStore, options ...Option) (*Clien
 
 	config := protocol.Config{
 		Dial:                  o.DialFunc,
+		DialTimeout:           o.DialTimeout,
+		HandshakeTimeout:      o.HandshakeTimeout,
+		ConnectTimeout:        o.ConnectTimeout,
 		ConcurrentLeaderConns: o.ConcurrentLeaderConns,
+		MaxMessageSize:        o.MaxMessageSize,
+		PreferredNodes:        o.PreferredNodes,
+		CircuitBreaker:        o.CircuitBreaker,
+		RetryBudget:           o.RetryBudget,
 	}
 	connector := protocol.NewConnector(0, store, config, o.LogFunc)
 	protocol, err := connector.Connect(ctx)
@@ -29,7 +39,7 @@ func FindLeader(ctx context.Context, store NodeStore, options ...Option) (*Clien
 		return nil, err
 	}
 
-	client := &Client{protocol: protocol}
+	client := &Client{pool: newPool(o.Concurrency, protocol, connector.Connect)}
 
 	return client, nil
 }
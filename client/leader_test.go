@@ -2,6 +2,7 @@ package client_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -37,10 +38,18 @@ func TestMembership(t *testing.T) {
 	store := client.NewInmemNodeStore()
 	store.Set(context.Background(), []client.NodeInfo{infos[0]})
 
+	errDuplicateID := client.ErrDuplicateID
+
 	client, err := client.FindLeader(ctx, store)
 	require.NoError(t, err)
 	defer client.Close()
 
 	err = client.Add(ctx, infos[1])
 	require.NoError(t, err)
+
+	// The ID of the second node can't be reused.
+	duplicate := infos[2]
+	duplicate.ID = infos[1].ID
+	err = client.Add(ctx, duplicate)
+	require.True(t, errors.Is(err, errDuplicateID), "unexpected error %v", err)
 }
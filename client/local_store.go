@@ -0,0 +1,151 @@
+// +build !nosqlite3,!nocgo
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// LocalNodeStore persists the full information about dqlite nodes (ID, address
+// and role) in a local, non-replicated, SQLite database file.
+//
+// The schema of the database is created and upgraded automatically. Files
+// created by DefaultNodeStore are upgraded in place, with their nodes getting
+// ID 1 and the Voter role until the next call to Set.
+type LocalNodeStore struct {
+	db *sql.DB
+}
+
+// Schema migrations of the LocalNodeStore database, the version of the schema
+// being the number of migrations applied, tracked with PRAGMA user_version.
+var localNodeStoreMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS servers (address TEXT, UNIQUE(address))`,
+	`ALTER TABLE servers ADD COLUMN id INTEGER NOT NULL DEFAULT 1;
+	 ALTER TABLE servers ADD COLUMN role INTEGER NOT NULL DEFAULT 0`,
+}
+
+// NewLocalNodeStore creates a new LocalNodeStore backed by the SQLite database
+// file with the given name, creating it if needed.
+func NewLocalNodeStore(filename string) (*LocalNodeStore, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	// Since we're setting SQLite single-thread mode, we need to have one
+	// connection at most.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateLocalNodeStore(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &LocalNodeStore{db: db}, nil
+}
+
+// Apply the schema migrations that were not applied yet.
+func migrateLocalNodeStore(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return errors.Wrap(err, "failed to read schema version")
+	}
+	if version > len(localNodeStoreMigrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(localNodeStoreMigrations))
+	}
+
+	// Files created by DefaultNodeStore have the first version of the
+	// schema, but no version number.
+	if version == 0 {
+		var count int
+		err := tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'servers'").Scan(&count)
+		if err != nil {
+			return errors.Wrap(err, "failed to check servers table")
+		}
+		if count == 1 {
+			version = 1
+		}
+	}
+
+	for i := version; i < len(localNodeStoreMigrations); i++ {
+		if _, err := tx.Exec(localNodeStoreMigrations[i]); err != nil {
+			return errors.Wrapf(err, "failed to upgrade schema to version %d", i+1)
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version=%d", len(localNodeStoreMigrations))); err != nil {
+		return errors.Wrap(err, "failed to update schema version")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Get the current servers.
+func (s *LocalNodeStore) Get(ctx context.Context) ([]NodeInfo, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, address, role FROM servers ORDER BY rowid")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query servers table")
+	}
+	defer rows.Close()
+
+	servers := make([]NodeInfo, 0)
+	for rows.Next() {
+		var server NodeInfo
+		if err := rows.Scan(&server.ID, &server.Address, &server.Role); err != nil {
+			return nil, errors.Wrap(err, "failed to fetch server")
+		}
+		servers = append(servers, server)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "result set failure")
+	}
+
+	return servers, nil
+}
+
+// Set the servers.
+func (s *LocalNodeStore) Set(ctx context.Context, servers []NodeInfo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM servers"); err != nil {
+		return errors.Wrap(err, "failed to delete existing servers rows")
+	}
+
+	for _, server := range servers {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO servers(id, address, role) VALUES (?, ?, ?)",
+			server.ID, server.Address, server.Role)
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert server %s", server.Address)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Close the underlying database.
+func (s *LocalNodeStore) Close() error {
+	return s.db.Close()
+}
@@ -1,4 +1,4 @@
-// +build nosqlite3
+// +build nosqlite3 nocgo
 
 package client
 
@@ -10,11 +10,14 @@ import (
 
 // DefaultNodeStore creates a new NodeStore using the given filename.
 //
-// The filename must end with ".yaml".
+// The filename must end with ".yaml" or ".json".
 func DefaultNodeStore(filename string) (NodeStore, error) {
 	if strings.HasSuffix(filename, ".yaml") {
 		return NewYamlNodeStore(filename)
 	}
+	if strings.HasSuffix(filename, ".json") {
+		return NewJSONNodeStore(filename)
+	}
 
 	return nil, errors.New("built without support for DatabaseNodeStore")
 }
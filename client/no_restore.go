@@ -0,0 +1,16 @@
+// +build nosqlite3 nocgo
+
+package client
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Restore replaces the content of the database with the given name with the
+// content of the standard SQLite database file read from r.
+func (c *Client) Restore(ctx context.Context, dbname string, r io.Reader) error {
+	return errors.New("built without support for Restore")
+}
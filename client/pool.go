@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// Pool of connections to the same node, handed out one request at a time.
+//
+// Connections are created lazily, up to the pool size, and connections that
+// hit an error other than a plain request failure are discarded, so they get
+// replaced by fresh ones the next time they are needed.
+type pool struct {
+	connect func(context.Context) (*protocol.Protocol, error)
+	idle    chan *protocol.Protocol // Open connections not currently in use.
+	slots   chan struct{}           // One entry for each open connection.
+	done    chan struct{}           // Closed when the pool gets closed.
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Create a new pool of the given size, holding the given open connection.
+func newPool(size int, p *protocol.Protocol, connect func(context.Context) (*protocol.Protocol, error)) *pool {
+	if size < 1 {
+		size = 1
+	}
+	pool := &pool{
+		connect: connect,
+		idle:    make(chan *protocol.Protocol, size),
+		slots:   make(chan struct{}, size),
+		done:    make(chan struct{}),
+	}
+	pool.slots <- struct{}{}
+	pool.idle <- p
+	return pool
+}
+
+// Return an idle connection, opening a new one if none is available and the
+// pool is not full, or waiting for one to be released otherwise.
+func (p *pool) acquire(ctx context.Context) (*protocol.Protocol, error) {
+	select {
+	case <-p.done:
+		return nil, errors.New("client is closed")
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+
+	select {
+	case <-p.done:
+		return nil, errors.New("client is closed")
+	case conn := <-p.idle:
+		return conn, nil
+	case p.slots <- struct{}{}:
+		conn, err := p.connect(ctx)
+		if err != nil {
+			<-p.slots
+			return nil, errors.Wrap(err, "failed to open new connection")
+		}
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Give back a connection obtained with acquire, along with the error returned
+// by the last request performed with it, if any.
+func (p *pool) release(conn *protocol.Protocol, err error) {
+	if err != nil {
+		if _, ok := errors.Cause(err).(protocol.ErrRequest); !ok {
+			p.discard(conn)
+			return
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		conn.Close()
+		<-p.slots
+		return
+	}
+
+	p.idle <- conn
+}
+
+// Close a connection obtained with acquire, instead of giving it back.
+func (p *pool) discard(conn *protocol.Protocol) {
+	conn.Close()
+	<-p.slots
+}
+
+// Close all idle connections, and any connection in use as soon as it gets
+// released.
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	var err error
+	for {
+		select {
+		case conn := <-p.idle:
+			if closeErr := conn.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			<-p.slots
+		default:
+			return err
+		}
+	}
+}
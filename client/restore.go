@@ -0,0 +1,289 @@
+// +build !nosqlite3,!nocgo
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// Restore replaces the content of the database with the given name with the
+// content of the standard SQLite database file read from r.
+//
+// The schema and the rows of the given file are replayed as a single
+// transaction against the node the client is connected to, which must be the
+// leader, so the new content gets replicated through raft like any other
+// write. Any table or view already present in the database is dropped.
+//
+// Since a dqlite connection can only have a single database open, the
+// connection used by Restore is closed afterwards, and a new one is opened on
+// demand for later requests.
+func (c *Client) Restore(ctx context.Context, dbname string, r io.Reader) error {
+	file, err := ioutil.TempFile("", "dqlite-restore-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to read database file")
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+file.Name()+"?mode=ro")
+	if err != nil {
+		return errors.Wrap(err, "failed to open database file")
+	}
+	defer src.Close()
+
+	request := protocol.Message{}
+	request.Init(4096)
+	response := protocol.Message{}
+	response.Init(4096)
+
+	p, err := c.pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.pool.discard(p)
+
+	protocol.EncodeOpen(&request, dbname, 0, "volatile")
+	if err := p.Call(ctx, &request, &response); err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+	id, err := protocol.DecodeDb(&response)
+	if err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+
+	dst := &restoreTarget{
+		protocol: p,
+		db:       uint64(id),
+		request:  &request,
+		response: &response,
+	}
+
+	// Foreign keys are checked by the source database already, and
+	// disabling them lets us drop and fill tables in any order.
+	if err := dst.exec(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+		return err
+	}
+	if err := dst.exec(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	if err := restore(ctx, src, dst); err != nil {
+		dst.exec(ctx, "ROLLBACK")
+		return err
+	}
+
+	return dst.exec(ctx, "COMMIT")
+}
+
+// Replay the content of the src database against the dst one.
+func restore(ctx context.Context, src *sql.DB, dst *restoreTarget) error {
+	existing, err := dst.query(ctx, `
+SELECT type, name FROM sqlite_master
+ WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	for _, row := range existing {
+		kind := strings.ToUpper(row[0].(string))
+		if err := dst.exec(ctx, fmt.Sprintf("DROP %s IF EXISTS %s", kind, quoteIdent(row[1].(string)))); err != nil {
+			return err
+		}
+	}
+
+	type object struct {
+		kind string
+		name string
+		sql  string
+	}
+
+	rows, err := src.QueryContext(ctx, `
+SELECT type, name, sql FROM sqlite_master
+ WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY rowid`)
+	if err != nil {
+		return errors.Wrap(err, "failed to read schema")
+	}
+	objects := []object{}
+	for rows.Next() {
+		o := object{}
+		if err := rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "failed to read schema")
+		}
+		objects = append(objects, o)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "failed to read schema")
+	}
+
+	// Create and fill tables first, then add indexes, triggers and views,
+	// so triggers don't fire while copying rows.
+	for _, o := range objects {
+		if o.kind != "table" {
+			continue
+		}
+		if err := dst.exec(ctx, o.sql); err != nil {
+			return err
+		}
+		if err := restoreTable(ctx, src, dst, o.name); err != nil {
+			return err
+		}
+	}
+	for _, o := range objects {
+		if o.kind == "table" {
+			continue
+		}
+		if err := dst.exec(ctx, o.sql); err != nil {
+			return err
+		}
+	}
+
+	var version int64
+	if err := src.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return errors.Wrap(err, "failed to read user version")
+	}
+
+	return dst.exec(ctx, fmt.Sprintf("PRAGMA user_version=%d", version))
+}
+
+// Copy all rows of the given table from src to dst.
+func restoreTable(ctx context.Context, src *sql.DB, dst *restoreTarget, table string) error {
+	rows, err := src.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", quoteIdent(table)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read columns of table %s", table)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to read columns of table %s", table)
+	}
+
+	// The unary plus turns each column into an expression, which prevents
+	// the SQLite bindings from converting values based on the declared
+	// column type (e.g. DATETIME), so they are copied verbatim.
+	selected := make([]string, len(columns))
+	names := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = "+" + quoteIdent(column)
+		names[i] = quoteIdent(column)
+		params[i] = "?"
+	}
+	insert := fmt.Sprintf(
+		"INSERT INTO %s(%s) VALUES(%s)",
+		quoteIdent(table), strings.Join(names, ", "), strings.Join(params, ", "))
+
+	rows, err = src.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s", strings.Join(selected, ", "), quoteIdent(table)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read table %s", table)
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return errors.Wrapf(err, "failed to read table %s", table)
+		}
+		args := make([]driver.NamedValue, len(values))
+		for i, value := range values {
+			args[i] = driver.NamedValue{Ordinal: i + 1, Value: *value.(*interface{})}
+		}
+		if err := dst.exec(ctx, insert, args...); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrapf(rows.Err(), "failed to read table %s", table)
+}
+
+// Quote the given SQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Database opened on a dqlite connection, used as target of a restore.
+type restoreTarget struct {
+	protocol *protocol.Protocol
+	db       uint64
+	request  *protocol.Message
+	response *protocol.Message
+}
+
+func (t *restoreTarget) exec(ctx context.Context, sql string, args ...driver.NamedValue) error {
+	if int64(len(args)) > math.MaxUint32 {
+		return fmt.Errorf("too many parameters (%d)", len(args))
+	} else if len(args) > math.MaxUint8 {
+		protocol.EncodeExecSQLV1(t.request, t.db, sql, args)
+	} else {
+		protocol.EncodeExecSQLV0(t.request, t.db, sql, args)
+	}
+
+	if err := t.protocol.Call(ctx, t.request, t.response); err != nil {
+		return errors.Wrapf(err, "failed to execute %q", sql)
+	}
+	if _, err := protocol.DecodeResult(t.response); err != nil {
+		return errors.Wrapf(err, "failed to execute %q", sql)
+	}
+
+	return nil
+}
+
+func (t *restoreTarget) query(ctx context.Context, sql string) ([][]driver.Value, error) {
+	protocol.EncodeQuerySQLV0(t.request, t.db, sql, nil)
+
+	if err := t.protocol.Call(ctx, t.request, t.response); err != nil {
+		return nil, errors.Wrapf(err, "failed to query %q", sql)
+	}
+	rows, err := protocol.DecodeRows(t.response)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query %q", sql)
+	}
+
+	result := [][]driver.Value{}
+	for {
+		row := make([]driver.Value, len(rows.Columns))
+		err := rows.Next(row)
+		if err == protocol.ErrRowsPart {
+			rows.Close()
+			if err := t.protocol.More(ctx, t.response); err != nil {
+				return nil, errors.Wrapf(err, "failed to query %q", sql)
+			}
+			rows, err = protocol.DecodeRows(t.response)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to query %q", sql)
+			}
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(err, "failed to query %q", sql)
+		}
+		result = append(result, row)
+	}
+	rows.Close()
+
+	return result, nil
+}
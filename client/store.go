@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"sync"
@@ -22,6 +23,10 @@ type NodeRole = protocol.NodeRole
 // NodeInfo holds information about a single server.
 type NodeInfo = protocol.NodeInfo
 
+// NodeStoreWatcher is an optional interface that a NodeStore can implement if
+// it can push changes of the cluster servers.
+type NodeStoreWatcher = protocol.NodeStoreWatcher
+
 // InmemNodeStore keeps the list of target dqlite nodes in memory.
 type InmemNodeStore = protocol.InmemNodeStore
 
@@ -37,22 +42,9 @@ type YamlNodeStore struct {
 
 // NewYamlNodeStore creates a new YamlNodeStore backed by the given YAML file.
 func NewYamlNodeStore(path string) (*YamlNodeStore, error) {
-	servers := []NodeInfo{}
-
-	_, err := os.Stat(path)
+	servers, err := loadNodes(path, yaml.Unmarshal)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	} else {
-		data, err := ioutil.ReadFile(path)
-		if err != nil {
-			return nil, err
-		}
-
-		if err := yaml.Unmarshal(data, &servers); err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	store := &YamlNodeStore{
@@ -77,12 +69,54 @@ func (s *YamlNodeStore) Set(ctx context.Context, servers []NodeInfo) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := yaml.Marshal(servers)
+	servers, err := storeNodes(s.path, servers, yaml.Marshal)
 	if err != nil {
 		return err
 	}
 
-	if err := renameio.WriteFile(s.path, data, 0600); err != nil {
+	s.servers = servers
+
+	return nil
+}
+
+// Persists a list addresses of dqlite nodes in a JSON file.
+type JSONNodeStore struct {
+	path    string
+	servers []NodeInfo
+	mu      sync.RWMutex
+}
+
+// NewJSONNodeStore creates a new JSONNodeStore backed by the given JSON file.
+func NewJSONNodeStore(path string) (*JSONNodeStore, error) {
+	servers, err := loadNodes(path, json.Unmarshal)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &JSONNodeStore{
+		path:    path,
+		servers: servers,
+	}
+
+	return store, nil
+}
+
+// Get the current servers.
+func (s *JSONNodeStore) Get(ctx context.Context) ([]NodeInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make([]NodeInfo, len(s.servers))
+	copy(ret, s.servers)
+	return ret, nil
+}
+
+// Set the servers addresses.
+func (s *JSONNodeStore) Set(ctx context.Context, servers []NodeInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers, err := storeNodes(s.path, servers, json.Marshal)
+	if err != nil {
 		return err
 	}
 
@@ -90,3 +124,40 @@ func (s *YamlNodeStore) Set(ctx context.Context, servers []NodeInfo) error {
 
 	return nil
 }
+
+// Load the list of nodes stored in the given file, if it exists.
+func loadNodes(path string, unmarshal func([]byte, interface{}) error) ([]NodeInfo, error) {
+	servers := []NodeInfo{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return servers, nil
+		}
+		return nil, err
+	}
+
+	if err := unmarshal(data, &servers); err != nil {
+		return nil, err
+	}
+
+	return servers, nil
+}
+
+// Atomically replace the content of the given file with the given list of
+// nodes, returning a copy of the list that the caller can't modify.
+func storeNodes(path string, servers []NodeInfo, marshal func(interface{}) ([]byte, error)) ([]NodeInfo, error) {
+	data, err := marshal(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := renameio.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	ret := make([]NodeInfo, len(servers))
+	copy(ret, servers)
+
+	return ret, nil
+}
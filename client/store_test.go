@@ -1,10 +1,13 @@
-// +build !nosqlite3
+// +build !nosqlite3,!nocgo
 
 package client_test
 
 import (
 	"context"
 	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	dqlite "github.com/canonical/go-dqlite"
@@ -59,6 +62,89 @@ func TestDefaultNodeStore(t *testing.T) {
 		servers)
 }
 
+// Exercise persisting servers to a YAML or JSON file and loading them back
+// with a new store.
+func TestFileNodeStore(t *testing.T) {
+	for _, ext := range []string{".yaml", ".json"} {
+		t.Run(ext, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "dqlite-store-test-")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "servers"+ext)
+
+			store, err := client.DefaultNodeStore(path)
+			require.NoError(t, err)
+
+			servers, err := store.Get(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, servers)
+
+			nodes := []client.NodeInfo{
+				{ID: 1, Address: "1.2.3.4:666", Role: client.Voter},
+				{ID: 2, Address: "5.6.7.8:666", Role: client.Spare},
+			}
+			require.NoError(t, store.Set(context.Background(), nodes))
+
+			expected := []client.NodeInfo{
+				{ID: 1, Address: "1.2.3.4:666", Role: client.Voter},
+				{ID: 2, Address: "5.6.7.8:666", Role: client.Spare},
+			}
+
+			// Modifying the given slice does not affect the store.
+			nodes[0].Address = "9.9.9.9:666"
+
+			servers, err = store.Get(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, expected, servers)
+
+			// A new store loads the persisted servers.
+			store, err = client.DefaultNodeStore(path)
+			require.NoError(t, err)
+
+			servers, err = store.Get(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, expected, servers)
+		})
+	}
+}
+
+// Exercise persisting servers in a LocalNodeStore, upgrading a file created
+// by DefaultNodeStore.
+func TestLocalNodeStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dqlite-store-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "servers.db")
+
+	legacy, err := client.DefaultNodeStore(path)
+	require.NoError(t, err)
+	require.NoError(t, legacy.Set(context.Background(), []client.NodeInfo{{Address: "1.2.3.4:666"}}))
+
+	store, err := client.NewLocalNodeStore(path)
+	require.NoError(t, err)
+
+	servers, err := store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666", Role: client.Voter}}, servers)
+
+	nodes := []client.NodeInfo{
+		{ID: 2, Address: "5.6.7.8:666", Role: client.StandBy},
+		{ID: 3, Address: "9.9.9.9:666", Role: client.Spare},
+	}
+	require.NoError(t, store.Set(context.Background(), nodes))
+	require.NoError(t, store.Close())
+
+	store, err = client.NewLocalNodeStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	servers, err = store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, nodes, servers)
+}
+
 func TestConfigMultiThread(t *testing.T) {
 	cleanup := dummyDBSetup(t)
 	defer cleanup()
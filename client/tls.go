@@ -0,0 +1,38 @@
+package client
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// VerifyPeerNames returns a function that can be used as VerifyPeerCertificate
+// hook of a tls.Config, in order to check that the certificate presented by
+// the other end of a connection identifies one of the given peers.
+//
+// The standard TLS verification only checks that a client certificate is
+// signed by a trusted CA, and a server certificate by the name that was
+// dialed. When all nodes share the same CA, this hook can be used on both the
+// listen and dial configurations to restrict the accepted identities to the
+// known cluster members. Names are matched against the DNS names and IP
+// addresses of the peer certificate.
+//
+// Only certificates that passed the standard verification are accepted, so
+// the hook fails if it's disabled, for example with InsecureSkipVerify, or
+// with a ClientAuth type that doesn't verify client certificates.
+func VerifyPeerNames(names ...string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return fmt.Errorf("no verified peer certificate")
+		}
+		leaf := verifiedChains[0][0]
+
+		for _, name := range names {
+			if leaf.VerifyHostname(name) == nil {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("peer certificate is not valid for any of %s", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,48 @@
+package client_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPeerNames(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dqlite-test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"node1.test"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+
+	rawCerts := [][]byte{raw}
+	verifiedChains := [][]*x509.Certificate{{cert}}
+
+	assert.NoError(t, client.VerifyPeerNames("node1.test")(rawCerts, verifiedChains))
+	assert.NoError(t, client.VerifyPeerNames("node2.test", "10.0.0.1")(rawCerts, verifiedChains))
+	assert.Error(t, client.VerifyPeerNames("node2.test")(rawCerts, verifiedChains))
+
+	// Certificates that weren't verified are rejected, even with a matching
+	// name.
+	assert.EqualError(t, client.VerifyPeerNames("node1.test")(rawCerts, nil), "no verified peer certificate")
+	assert.Error(t, client.VerifyPeerNames("node1.test")(nil, nil))
+}
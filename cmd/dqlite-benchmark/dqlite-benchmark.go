@@ -23,6 +23,8 @@ const (
 	defaultDurationS      = 60
 	defaultKvKeySize      = 32
 	defaultKvValueSize    = 1024
+	defaultReadPercent    = 90
+	defaultBatchSize      = 100
 	defaultWorkers        = 1
 	defaultWorkload       = "kvwrite"
 	docString             = "For benchmarking dqlite.\n\n" +
@@ -40,7 +42,8 @@ const (
 		"dqlite-benchmark --db 127.0.0.1:9003 --join 127.0.0.1:9001 --driver --cluster 127.0.0.1:9001,127.0.0.1:9002,127.0.0.1:9003 &\n\n" +
 		"The results can be found on the `driver` node in " + defaultDir + "/results or in the directory provided to the tool.\n" +
 		"Benchmark results are files named `n-q-timestamp` where `n` is the number of the worker,\n" +
-		"`q` is the type of query that was tracked. All results in the file are in milliseconds.\n"
+		"`q` is the type of query that was tracked. All results in the file are in milliseconds.\n" +
+		"A summary with throughput and latency percentiles is also printed at the end.\n"
 )
 
 func signalChannel() chan os.Signal {
@@ -62,6 +65,8 @@ func main() {
 	var join *[]string
 	var kvKeySize int
 	var kvValueSize int
+	var readPercent int
+	var batchSize int
 	var workers int
 	var workload string
 	var diskMode bool
@@ -116,6 +121,8 @@ func main() {
 				benchmark.WithWorkers(workers),
 				benchmark.WithKvKeySize(kvKeySize),
 				benchmark.WithKvValueSize(kvValueSize),
+				benchmark.WithReadPercent(readPercent),
+				benchmark.WithBatchSize(batchSize),
 				benchmark.WithCluster(*cluster),
 				benchmark.WithClusterTimeout(clusterTimeout),
 			)
@@ -140,12 +147,14 @@ func main() {
 		"The driver will wait for all nodes to be online before running the benchmark.")
 	flags.IntVar(&clusterTimeout, "cluster-timeout", defaultClusterTimeout, "How long the benchmark should wait in seconds for the whole cluster to be online.")
 	flags.StringVarP(&dir, "dir", "D", defaultDir, "Data directory.")
-	flags.StringVarP(&workload, "workload", "w", defaultWorkload, "The workload to run: \"kvwrite\" or \"kvreadwrite\".")
+	flags.StringVarP(&workload, "workload", "w", defaultWorkload, "The workload to run: \"kvwrite\", \"kvreadwrite\", \"mixed\" or \"batchinsert\".")
 	flags.BoolVar(&driver, "driver", defaultDriver, "Set this flag to run the benchmark from this instance. Must be set on 1 node.")
 	flags.IntVar(&duration, "duration", defaultDurationS, "Run duration in seconds.")
 	flags.IntVar(&workers, "workers", defaultWorkers, "Number of workers executing the workload.")
 	flags.IntVar(&kvKeySize, "key-size", defaultKvKeySize, "Size of the KV keys in bytes.")
 	flags.IntVar(&kvValueSize, "value-size", defaultKvValueSize, "Size of the KV values in bytes.")
+	flags.IntVar(&readPercent, "read-percent", defaultReadPercent, "Percentage of reads of the \"mixed\" workload.")
+	flags.IntVar(&batchSize, "batch-size", defaultBatchSize, "Rows inserted by each transaction of the \"batchinsert\" workload.")
 	flags.BoolVar(&diskMode, "disk", defaultDiskMode, "Warning: Unstable, Experimental. Set this flag to enable dqlite's disk-mode.")
 
 	cmd.MarkFlagRequired("db")
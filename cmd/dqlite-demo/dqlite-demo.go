@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
 
@@ -38,7 +37,13 @@ func main() {
 
 Complete documentation is available at https://github.com/canonical/go-dqlite`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			dir := filepath.Join(dir, db)
+			// Normalize the address, so the same data directory is
+			// used no matter how it's spelled.
+			address, err := client.NormalizeAddress(db)
+			if err != nil {
+				return err
+			}
+			dir := filepath.Join(dir, address)
 			if err := os.MkdirAll(dir, 0755); err != nil {
 				return errors.Wrapf(err, "can't create %s", dir)
 			}
@@ -49,8 +54,9 @@ Complete documentation is available at https://github.com/canonical/go-dqlite`,
 				log.Printf(fmt.Sprintf("%s: %s: %s\n", api, l.String(), format), a...)
 			}
 
-			options := []app.Option{app.WithAddress(db), app.WithCluster(*join), app.WithLogFunc(logFunc),
-				app.WithDiskMode(diskMode)}
+			options := []app.Option{app.WithAddress(address), app.WithCluster(*join), app.WithLogFunc(logFunc),
+				app.WithDiskMode(diskMode),
+				app.WithAutoHandover(unix.SIGPWR, unix.SIGINT, unix.SIGQUIT, unix.SIGTERM)}
 
 			// Set TLS options
 			if (crt != "" && key == "") || (key != "" && crt == "") {
@@ -120,27 +126,20 @@ Complete documentation is available at https://github.com/canonical/go-dqlite`,
 
 			go http.Serve(listener, nil)
 
-			ch := make(chan os.Signal, 32)
-			signal.Notify(ch, unix.SIGPWR)
-			signal.Notify(ch, unix.SIGINT)
-			signal.Notify(ch, unix.SIGQUIT)
-			signal.Notify(ch, unix.SIGTERM)
-
-			<-ch
+			// The node hands over and closes itself upon receiving
+			// a termination signal.
+			<-app.Done()
 
 			listener.Close()
 			db.Close()
 
-			app.Handover(context.Background())
-			app.Close()
-
 			return nil
 		},
 	}
 
 	flags := cmd.Flags()
 	flags.StringVarP(&api, "api", "a", "", "address used to expose the demo API")
-	flags.StringVarP(&db, "db", "d", "", "address used for internal database replication")
+	flags.StringVarP(&db, "db", "d", "", "address used for internal database replication (IPv6 literals and a missing port, defaulting to 9000, are accepted)")
 	join = flags.StringSliceP("join", "j", nil, "database addresses of existing nodes")
 	flags.StringVarP(&dir, "dir", "D", "/tmp/dqlite-demo", "data directory")
 	flags.BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
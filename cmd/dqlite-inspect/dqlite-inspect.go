@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/canonical/go-dqlite/internal/raftlog"
+)
+
+func main() {
+	var entries bool
+
+	cmd := &cobra.Command{
+		Use:   "dqlite-inspect <dir>",
+		Short: "Print the raft state stored in a node's data directory",
+		Long: `Read the raft files in the data directory of a dqlite node and print the
+metadata, the snapshots, the segments with the range of entries they hold,
+and the last cluster configuration stored.
+
+The node must not be running. The directory is never modified.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspect(cmd.OutOrStdout(), args[0], entries)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&entries, "entries", "e", false, "print every entry of each segment")
+
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func inspect(w io.Writer, dir string, printEntries bool) error {
+	metadata, err := raftlog.ReadMetadata(dir)
+	if err != nil {
+		return err
+	}
+	segments, snapshots, err := raftlog.List(dir)
+	if err != nil {
+		return err
+	}
+
+	if metadata == nil {
+		fmt.Fprintln(w, "Metadata: none")
+	} else {
+		fmt.Fprintf(w, "Metadata: term %d, voted for %d (version %d)\n",
+			metadata.Term, metadata.VotedFor, metadata.Version)
+	}
+
+	fmt.Fprintf(w, "\nSnapshots: %d\n", len(snapshots))
+	for _, snapshot := range snapshots {
+		taken := time.Unix(0, int64(snapshot.Timestamp)*int64(time.Millisecond)).UTC()
+		fmt.Fprintf(w, "  %s: term %d, index %d, taken %s, %d bytes\n",
+			filepath.Base(snapshot.Path), snapshot.Term, snapshot.Index,
+			taken.Format(time.RFC3339), snapshot.Size)
+		if snapshot.Err != nil {
+			fmt.Fprintf(w, "    damaged: %v\n", snapshot.Err)
+		}
+	}
+
+	// The last configuration seen, and its index.
+	var configuration []raftlog.Server
+	var configurationIndex uint64
+	for _, snapshot := range snapshots {
+		if snapshot.Err == nil {
+			configuration = snapshot.Configuration
+			configurationIndex = snapshot.ConfigurationIndex
+		}
+	}
+
+	// Index of the next entry, or zero if unknown. Open segments are
+	// named after a counter, so their first index follows the previous
+	// segment.
+	next := uint64(0)
+	if len(snapshots) == 0 {
+		next = 1
+	}
+
+	fmt.Fprintf(w, "\nSegments: %d\n", len(segments))
+	for _, segment := range segments {
+		if !segment.Open {
+			next = segment.FirstIndex
+		}
+		entries, end, err := raftlog.ReadSegment(segment.Path)
+
+		fmt.Fprintf(w, "  %s: %s, %d bytes\n", filepath.Base(segment.Path), describeEntries(next, entries), segment.Size)
+		if !segment.Open && err == nil {
+			if expected := segment.LastIndex - segment.FirstIndex + 1; uint64(len(entries)) != expected {
+				fmt.Fprintf(w, "    warning: expected %d entries\n", expected)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(w, "    damaged: %v (valid data ends at offset %d)\n", err, end)
+		}
+
+		for i, entry := range entries {
+			index := uint64(0)
+			if next != 0 {
+				index = next + uint64(i)
+			}
+			if printEntries {
+				fmt.Fprintf(w, "    %s term %d, %s, %d bytes\n", formatIndex(index), entry.Term, entry.Type, len(entry.Data))
+			}
+			if entry.Type != raftlog.Change {
+				continue
+			}
+			servers, err := raftlog.DecodeConfiguration(entry.Data)
+			if err != nil {
+				fmt.Fprintf(w, "    warning: invalid configuration at %s: %v\n", formatIndex(index), err)
+				continue
+			}
+			configuration = servers
+			configurationIndex = index
+		}
+
+		if next != 0 {
+			next += uint64(len(entries))
+		}
+	}
+
+	if configuration == nil {
+		fmt.Fprintln(w, "\nConfiguration: none")
+		return nil
+	}
+	fmt.Fprintf(w, "\nConfiguration (index %s):\n", formatIndex(configurationIndex))
+	for _, server := range configuration {
+		fmt.Fprintf(w, "  %d %s %s\n", server.ID, server.Address, server.Role)
+	}
+
+	return nil
+}
+
+// Describe the range of indexes and terms of the given entries, the first of
+// which has the given index, if known.
+func describeEntries(first uint64, entries []raftlog.Entry) string {
+	n := len(entries)
+	if n == 0 {
+		return "no entries"
+	}
+	indexes := "unknown indexes"
+	if first != 0 {
+		indexes = fmt.Sprintf("entries %d-%d", first, first+uint64(n)-1)
+	}
+	return fmt.Sprintf("%s (%d entries, terms %d-%d)", indexes, n, entries[0].Term, entries[n-1].Term)
+}
+
+func formatIndex(index uint64) string {
+	if index == 0 {
+		return "?"
+	}
+	return fmt.Sprint(index)
+}
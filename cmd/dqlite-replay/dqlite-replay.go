@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+func main() {
+	var until string
+
+	cmd := &cobra.Command{
+		Use:   "dqlite-replay <archive> <database>",
+		Short: "Reconstruct a database from a WAL archive",
+		Long: `Read an archive written by client.Archive and write the database as it
+was at the given point in time as a standard SQLite database file.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var t time.Time
+			if until != "" {
+				var err error
+				t, err = time.Parse(time.RFC3339, until)
+				if err != nil {
+					return fmt.Errorf("parse until: %w", err)
+				}
+			}
+
+			archive, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			database, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+
+			if err := client.Replay(archive, t, database); err != nil {
+				database.Close()
+				os.Remove(args[1])
+				return err
+			}
+
+			return database.Close()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&until, "until", "u", "", "point in time to recover, in RFC3339 format (default: end of the archive)")
+
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
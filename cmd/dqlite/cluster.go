@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Create the "cluster" command and its subcommands, which manage the cluster
+// membership. The connect function returns the node store and dial function
+// built from the global flags.
+func newClusterCmd(connect func() (client.NodeStore, client.DialFunc, error), format *string, timeoutMsec *uint) *cobra.Command {
+	// Run the given function with a client connected to the leader.
+	withLeader := func(f func(ctx context.Context, cli *client.Client) error) error {
+		store, dial, err := connect()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*timeoutMsec)*time.Millisecond)
+		defer cancel()
+
+		cli, err := client.FindLeader(ctx, store, client.WithDialFunc(dial))
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		return f(ctx, cli)
+	}
+
+	cluster := &cobra.Command{
+		Use:   "cluster",
+		Short: "Manage the cluster membership",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the nodes of the cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				nodes, err := cli.Cluster(ctx)
+				if err != nil {
+					return err
+				}
+				return printNodes(*format, nodes...)
+			})
+		},
+	}
+
+	leader := &cobra.Command{
+		Use:   "leader",
+		Short: "Show the current leader",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				node, err := cli.Leader(ctx)
+				if err != nil {
+					return err
+				}
+				if node == nil {
+					return fmt.Errorf("no leader")
+				}
+				return printNodes(*format, *node)
+			})
+		},
+	}
+
+	var role string
+	add := &cobra.Command{
+		Use:   "add <id> <address>",
+		Short: "Add a node to the cluster",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad node ID %q", args[0])
+			}
+			address, err := client.NormalizeAddress(args[1])
+			if err != nil {
+				return err
+			}
+			r, err := parseRole(role)
+			if err != nil {
+				return err
+			}
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				return cli.Add(ctx, client.NodeInfo{ID: id, Address: address, Role: r})
+			})
+		},
+	}
+	add.Flags().StringVarP(&role, "role", "r", "spare", "role of the new node (voter, stand-by, spare)")
+
+	remove := &cobra.Command{
+		Use:   "remove <id|address>",
+		Short: "Remove a node from the cluster",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				id, err := findNode(ctx, cli, args[0])
+				if err != nil {
+					return err
+				}
+				return cli.Remove(ctx, id)
+			})
+		},
+	}
+
+	assign := &cobra.Command{
+		Use:   "assign <id|address> <role>",
+		Short: "Assign a role to a node (voter, stand-by, spare)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := parseRole(args[1])
+			if err != nil {
+				return err
+			}
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				id, err := findNode(ctx, cli, args[0])
+				if err != nil {
+					return err
+				}
+				return cli.Assign(ctx, id, r)
+			})
+		},
+	}
+
+	transfer := &cobra.Command{
+		Use:   "transfer <id|address>",
+		Short: "Transfer leadership to a node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withLeader(func(ctx context.Context, cli *client.Client) error {
+				id, err := findNode(ctx, cli, args[0])
+				if err != nil {
+					return err
+				}
+				return cli.Transfer(ctx, id)
+			})
+		},
+	}
+
+	cluster.AddCommand(list, leader, add, remove, assign, transfer)
+
+	return cluster
+}
+
+// Print the given nodes in the given format.
+func printNodes(format string, nodes ...client.NodeInfo) error {
+	switch format {
+	case "tabular":
+		for _, node := range nodes {
+			fmt.Printf("%d|%s|%s\n", node.ID, node.Address, node.Role)
+		}
+	case "json":
+		data, err := json.MarshalIndent(nodes, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"ID", "Address", "Role"})
+		for _, node := range nodes {
+			writer.Write([]string{fmt.Sprint(node.ID), node.Address, node.Role.String()})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+	return nil
+}
+
+// Return the ID of the node with the given ID or address.
+func findNode(ctx context.Context, cli *client.Client, node string) (uint64, error) {
+	nodes, err := cli.Cluster(ctx)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(node, 10, 64)
+	address, _ := client.NormalizeAddress(node)
+	for _, info := range nodes {
+		if (err == nil && info.ID == id) || info.Address == node || info.Address == address {
+			return info.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no node has ID or address %q", node)
+}
+
+// Parse the given role name.
+func parseRole(role string) (client.NodeRole, error) {
+	for _, r := range []client.NodeRole{client.Voter, client.StandBy, client.Spare} {
+		if strings.EqualFold(role, r.String()) || strings.EqualFold(role, strings.Replace(r.String(), "-", "", -1)) {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q", role)
+}
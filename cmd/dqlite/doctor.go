@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	dqlite "github.com/canonical/go-dqlite"
+)
+
+// Create the "doctor" command, which checks and optionally repairs the data
+// directory of a stopped node.
+func newDoctorCmd() *cobra.Command {
+	var repair bool
+	var yes bool
+
+	doctor := &cobra.Command{
+		Use:   "doctor <dir>",
+		Short: "Check the data directory of a stopped node",
+		Long: `Validate the raft files in the data directory of a node that is not
+running: check the checksums of all log entries, and detect truncated
+segments and gaps in the log.
+
+With --repair, a damaged log tail is truncated: everything from the first
+damaged entry on is dropped. Dropped entries might have been committed, so
+only repair a node whose peers hold a healthy copy of the log.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := args[0]
+			out := cmd.OutOrStdout()
+
+			report, err := dqlite.CheckDataDir(dir)
+			if err != nil {
+				return err
+			}
+			if len(report.Problems) == 0 {
+				fmt.Fprintln(out, "No problems found")
+				return nil
+			}
+			for _, problem := range report.Problems {
+				fmt.Fprintln(out, problem)
+			}
+
+			tail := report.Tail
+			if tail == nil {
+				return fmt.Errorf("found problems that can't be repaired automatically")
+			}
+			fmt.Fprintf(out, "\nThe log can be repaired by keeping %d entries of %s and removing %d following segments.\n",
+				tail.Entries, filepath.Base(tail.Segment.Path), len(tail.Dropped))
+			if !repair {
+				return fmt.Errorf("log is damaged, run again with --repair to truncate it")
+			}
+
+			if !yes {
+				ok, err := confirm(cmd.InOrStdin(), out, "Truncate the log?")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("aborted")
+				}
+			}
+			if err := dqlite.RepairDataDir(dir, report); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Log truncated")
+
+			report, err = dqlite.CheckDataDir(dir)
+			if err != nil {
+				return err
+			}
+			if len(report.Problems) > 0 {
+				return fmt.Errorf("some problems remain, run the command again for details")
+			}
+			return nil
+		},
+	}
+
+	flags := doctor.Flags()
+	flags.BoolVar(&repair, "repair", false, "truncate a damaged log tail")
+	flags.BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation before repairing")
+
+	return doctor
+}
+
+// Ask the given yes/no question, defaulting to no.
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
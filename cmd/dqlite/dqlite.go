@@ -31,60 +31,9 @@ func main() {
 		Short: "Standard dqlite shell",
 		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(*servers) == 0 {
-				return fmt.Errorf("no servers provided")
-			}
-			var store client.NodeStore
-			var err error
-
-			first := (*servers)[0]
-			if strings.HasPrefix(first, "file://") {
-				if len(*servers) > 1 {
-					return fmt.Errorf("can't mix server store and explicit list")
-				}
-				path := first[len("file://"):]
-				if _, err := os.Stat(path); err != nil {
-					return fmt.Errorf("open servers store: %w", err)
-				}
-
-				store, err = client.DefaultNodeStore(path)
-				if err != nil {
-					return fmt.Errorf("open servers store: %w", err)
-				}
-			} else {
-				infos := make([]client.NodeInfo, len(*servers))
-				for i, address := range *servers {
-					infos[i].Address = address
-				}
-				store = client.NewInmemNodeStore()
-				store.Set(context.Background(), infos)
-			}
-
-			if (crt != "" && key == "") || (key != "" && crt == "") {
-				return fmt.Errorf("both TLS certificate and key must be given")
-			}
-
-			dial := client.DefaultDialFunc
-
-			if crt != "" {
-				cert, err := tls.LoadX509KeyPair(crt, key)
-				if err != nil {
-					return err
-				}
-
-				data, err := ioutil.ReadFile(crt)
-				if err != nil {
-					return err
-				}
-
-				pool := x509.NewCertPool()
-				if !pool.AppendCertsFromPEM(data) {
-					return fmt.Errorf("bad certificate")
-				}
-
-				config := app.SimpleDialTLSConfig(cert, pool)
-				dial = client.DialFuncWithTLS(dial, config)
-
+			store, dial, err := connect(*servers, crt, key)
+			if err != nil {
+				return err
 			}
 
 			sh, err := shell.New(args[0], store, shell.WithDialFunc(dial), shell.WithFormat(format))
@@ -135,16 +84,84 @@ func main() {
 		},
 	}
 
-	flags := cmd.Flags()
+	flags := cmd.PersistentFlags()
 	servers = flags.StringSliceP("servers", "s", nil, "comma-separated list of db servers, or file://<store>")
 	flags.StringVarP(&crt, "cert", "c", "", "public TLS cert")
 	flags.StringVarP(&key, "key", "k", "", "private TLS key")
-	flags.StringVarP(&format, "format", "f", "tabular", "output format (tabular, json)")
+	flags.StringVarP(&format, "format", "f", "tabular", "output format (tabular, json, csv)")
 	flags.UintVar(&timeoutMsec, "timeout", 2000, "timeout of each request (msec)")
 
-	cmd.MarkFlagRequired("servers")
+	cmd.AddCommand(newClusterCmd(func() (client.NodeStore, client.DialFunc, error) {
+		return connect(*servers, crt, key)
+	}, &format, &timeoutMsec))
+	cmd.AddCommand(newDoctorCmd())
 
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+// Create the node store and the dial function to use for connecting to the
+// given servers, optionally with TLS.
+func connect(servers []string, crt, key string) (client.NodeStore, client.DialFunc, error) {
+	if len(servers) == 0 {
+		return nil, nil, fmt.Errorf("no servers provided")
+	}
+	var store client.NodeStore
+	var err error
+
+	first := servers[0]
+	if strings.HasPrefix(first, "file://") {
+		if len(servers) > 1 {
+			return nil, nil, fmt.Errorf("can't mix server store and explicit list")
+		}
+		path := first[len("file://"):]
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, fmt.Errorf("open servers store: %w", err)
+		}
+
+		store, err = client.DefaultNodeStore(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open servers store: %w", err)
+		}
+	} else {
+		infos := make([]client.NodeInfo, len(servers))
+		for i, address := range servers {
+			address, err := client.NormalizeAddress(address)
+			if err != nil {
+				return nil, nil, err
+			}
+			infos[i].Address = address
+		}
+		store = client.NewInmemNodeStore()
+		store.Set(context.Background(), infos)
+	}
+
+	if (crt != "" && key == "") || (key != "" && crt == "") {
+		return nil, nil, fmt.Errorf("both TLS certificate and key must be given")
+	}
+
+	dial := client.DefaultDialFunc
+
+	if crt != "" {
+		cert, err := tls.LoadX509KeyPair(crt, key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := ioutil.ReadFile(crt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("bad certificate")
+		}
+
+		config := app.SimpleDialTLSConfig(cert, pool)
+		dial = client.DialFuncWithTLS(dial, config)
+	}
+
+	return store, dial, nil
+}
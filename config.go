@@ -1,4 +1,4 @@
-// +build !nosqlite3
+// +build !nosqlite3,!nocgo
 
 package dqlite
 
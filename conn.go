@@ -0,0 +1,89 @@
+package dqlite
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// ConnMatcher returns a function telling whether a connection carries the
+// dqlite protocol, by looking at the first 8 bytes sent by the peer. These
+// are either the protocol version, sent by clients and by other nodes, or
+// the authentication request sent by dial functions created with
+// client.DialFuncWithToken.
+//
+// The returned function can be used as a cmux matcher, to serve dqlite and
+// other protocols such as gRPC or HTTP on the same port:
+//
+//	m := cmux.New(listener)
+//	dqliteListener := m.Match(dqlite.ConnMatcher())
+//	httpListener := m.Match(cmux.Any())
+//
+// Connections accepted from dqliteListener can then be passed to
+// Node.HandleConn, or to the channel given to app.WithExternalConn.
+func ConnMatcher() func(io.Reader) bool {
+	return func(r io.Reader) bool {
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return false
+		}
+		switch binary.LittleEndian.Uint64(buf) {
+		case protocol.VersionOne, protocol.VersionLegacy, protocol.AuthMagic:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// HandleConn serves the dqlite protocol over the given connection, typically
+// accepted from a listener shared with other protocols and selected with
+// ConnMatcher. The connection is relayed to the bind address of the node,
+// which must be running.
+//
+// HandleConn blocks until either side closes the connection, so it's normally
+// run in its own goroutine. The given connection is always closed when it
+// returns.
+//
+// A bare node does not check authentication tokens: connections made with
+// client.DialFuncWithToken must be handled by an app.App instead.
+func (s *Node) HandleConn(conn net.Conn) error {
+	defer conn.Close()
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrAlreadyClosed
+	}
+
+	local, err := client.DefaultDialFunc(context.Background(), s.BindAddress())
+	if err != nil {
+		return errors.Wrap(err, "connect to bind address")
+	}
+	defer local.Close()
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(local, conn)
+		done <- err
+	}()
+	go func() {
+		_, err := io.Copy(conn, local)
+		done <- err
+	}()
+
+	// Once one direction is done, close both connections to stop the
+	// other one too.
+	err = <-done
+	conn.Close()
+	local.Close()
+	<-done
+
+	return err
+}
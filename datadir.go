@@ -0,0 +1,75 @@
+package dqlite
+
+import (
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/internal/raftlog"
+)
+
+// DataDirReport describes the problems found by CheckDataDir. If the raft log
+// is damaged, its Tail field describes the part of the log that
+// RepairDataDir would drop.
+type DataDirReport = raftlog.Report
+
+// CheckDataDir validates the raft files in the data directory of a node,
+// without modifying them: it verifies the checksums of every batch of log
+// entries, detects truncated segments and gaps in the log, and checks the
+// metadata files.
+//
+// The node must not be running.
+func CheckDataDir(dir string) (*DataDirReport, error) {
+	return raftlog.Check(dir)
+}
+
+// RepairDataDir drops the damaged tail of the raft log described by a report
+// returned by CheckDataDir, which must have been run on the same directory,
+// with the node still stopped. Everything from the first damaged batch on is
+// removed, so the node will restart with a shorter, valid log. Problems not
+// affecting the log, such as damaged metadata files, are not repaired.
+//
+// Dropped entries might have been committed, so this is safe only if the
+// other nodes of the cluster hold them: once restarted, the node will get
+// them back from the leader. It's a no-op if the log is not damaged.
+func RepairDataDir(dir string, report *DataDirReport) error {
+	if report.Tail == nil {
+		return nil
+	}
+	return raftlog.Truncate(dir, report.Tail)
+}
+
+// ReadConfiguration returns the last cluster configuration stored in the data
+// directory of a node, which must not be running. This is the configuration
+// the node will use when restarted, until it learns a newer one from the
+// leader.
+//
+// It returns an empty list if the node has never been part of a cluster, and
+// fails if the log is damaged, see CheckDataDir.
+func ReadConfiguration(dir string) ([]NodeInfo, error) {
+	servers, _, err := raftlog.ReadConfiguration(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := make([]NodeInfo, len(servers))
+	for i, server := range servers {
+		cluster[i] = NodeInfo{ID: server.ID, Address: server.Address}
+		switch server.Role {
+		case raftlog.Voter:
+			cluster[i].Role = client.Voter
+		case raftlog.StandBy:
+			cluster[i].Role = client.StandBy
+		default:
+			cluster[i].Role = client.Spare
+		}
+	}
+
+	return cluster, nil
+}
+
+// WriteConfiguration forces the given cluster configuration in the data
+// directory of a node, which must not be running.
+//
+// This is the same as ReconfigureMembershipExt, whose documentation describes
+// the steps to follow to do it safely.
+func WriteConfiguration(dir string, cluster []NodeInfo) error {
+	return ReconfigureMembershipExt(dir, cluster)
+}
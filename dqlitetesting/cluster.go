@@ -0,0 +1,236 @@
+//go:build go1.14
+// +build go1.14
+
+// Package dqlitetesting provides helpers for running in-process dqlite
+// clusters in tests.
+package dqlitetesting
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/app"
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Cluster is a set of application nodes running in the current process and
+// listening on the loopback interface.
+type Cluster struct {
+	Apps  []*app.App       // Nodes of the cluster, the first one being the bootstrap node.
+	DBs   []*sql.DB        // Handles of the test database, one for each node.
+	Store client.NodeStore // Store holding the addresses of all nodes.
+
+	// DialFunc must be used by clients connecting to the nodes, for
+	// example with client.WithDialFunc or driver.WithDialFunc.
+	DialFunc client.DialFunc
+
+	dirs []string // Data directories, removed on cleanup.
+}
+
+// Option can be used to tweak cluster parameters.
+type Option func(*options)
+
+type options struct {
+	Database   string
+	Timeout    time.Duration
+	AppOptions []app.Option
+	Network    *Network
+}
+
+// WithDatabase sets the name of the database opened on each node.
+//
+// The default is "test".
+func WithDatabase(name string) Option {
+	return func(options *options) {
+		options.Database = name
+	}
+}
+
+// WithTimeout sets how long to wait for each node to join the cluster and
+// open the database.
+//
+// The default is 30 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithAppOptions sets additional options passed to app.New for every node.
+// The address, the cluster and the log function are always set by NewCluster.
+func WithAppOptions(appOptions ...app.Option) Option {
+	return func(options *options) {
+		options.AppOptions = append(options.AppOptions, appOptions...)
+	}
+}
+
+// WithNetwork makes the nodes connect to each other through in-process pipes
+// subject to the faults injected with the given Network.
+//
+// Node addresses are then plain names, only reachable with the dial function
+// of the cluster.
+func WithNetwork(network *Network) Option {
+	return func(options *options) {
+		options.Network = network
+	}
+}
+
+// NewCluster starts a cluster of n nodes, each with its own temporary data
+// directory, and opens the test database on each of them. The test fails
+// right away if any node can't be started.
+//
+// Everything is torn down when the test and all its subtests complete.
+func NewCluster(t testing.TB, n int, options ...Option) *Cluster {
+	t.Helper()
+
+	o := defaultOptions()
+	for _, option := range options {
+		option(o)
+	}
+
+	cluster := &Cluster{
+		Apps:     make([]*app.App, 0, n),
+		DBs:      make([]*sql.DB, 0, n),
+		Store:    client.NewInmemNodeStore(),
+		DialFunc: client.DefaultDialFunc,
+	}
+
+	// Channels receiving the connections to each node, if using pipes.
+	var pipes sync.Map
+	if o.Network != nil {
+		cluster.DialFunc = func(ctx context.Context, address string) (net.Conn, error) {
+			ch, ok := pipes.Load(address)
+			if !ok {
+				return nil, fmt.Errorf("dial %s: no such node", address)
+			}
+			local, remote := net.Pipe()
+			select {
+			case ch.(chan net.Conn) <- remote:
+				return local, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(pipeAcceptTimeout):
+				return nil, fmt.Errorf("dial %s: node not accepting connections", address)
+			}
+		}
+	}
+	t.Cleanup(cluster.close(t))
+
+	nodes := make([]client.NodeInfo, 0, n)
+	for i := 0; i < n; i++ {
+		dir, err := ioutil.TempDir("", "dqlite-testing-")
+		if err != nil {
+			t.Fatalf("create data directory: %v", err)
+		}
+		cluster.dirs = append(cluster.dirs, dir)
+
+		var address string
+		appOptions := []app.Option{app.WithLogFunc(logFunc(t, i))}
+		if o.Network != nil {
+			address = fmt.Sprintf("node%d", i+1)
+			acceptCh := make(chan net.Conn)
+			pipes.Store(address, acceptCh)
+			appOptions = append(appOptions,
+				app.WithExternalConn(o.Network.Dial(address, cluster.DialFunc), acceptCh),
+				app.WithAcceptFunc(o.Network.Accept(address)))
+		} else {
+			address, err = freeAddress()
+			if err != nil {
+				t.Fatalf("find free address: %v", err)
+			}
+		}
+		appOptions = append(appOptions, app.WithAddress(address))
+		if i > 0 {
+			appOptions = append(appOptions, app.WithCluster([]string{cluster.Apps[0].Address()}))
+		}
+		appOptions = append(appOptions, o.AppOptions...)
+
+		node, err := app.New(dir, appOptions...)
+		if err != nil {
+			t.Fatalf("create node %d: %v", i, err)
+		}
+		cluster.Apps = append(cluster.Apps, node)
+
+		ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+		err = node.Ready(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("node %d not ready: %v", i, err)
+		}
+
+		nodes = append(nodes, client.NodeInfo{ID: node.ID(), Address: node.Address()})
+	}
+
+	if err := cluster.Store.Set(context.Background(), nodes); err != nil {
+		t.Fatalf("set node store: %v", err)
+	}
+
+	for i, node := range cluster.Apps {
+		ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+		db, err := node.Open(ctx, o.Database)
+		cancel()
+		if err != nil {
+			t.Fatalf("open database on node %d: %v", i, err)
+		}
+		cluster.DBs = append(cluster.DBs, db)
+	}
+
+	return cluster
+}
+
+// Maximum time to wait for a node to receive a connection over a pipe.
+const pipeAcceptTimeout = 5 * time.Second
+
+// Create a options object with sane defaults.
+func defaultOptions() *options {
+	return &options{
+		Database: "test",
+		Timeout:  30 * time.Second,
+	}
+}
+
+// Return a function closing all database handles and nodes, in reverse order,
+// and removing their data directories.
+func (c *Cluster) close(t testing.TB) func() {
+	return func() {
+		for _, db := range c.DBs {
+			db.Close()
+		}
+		for i := len(c.Apps) - 1; i >= 0; i-- {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			c.Apps[i].Handover(ctx)
+			cancel()
+			if err := c.Apps[i].Close(); err != nil {
+				t.Errorf("close node %d: %v", i, err)
+			}
+		}
+		for _, dir := range c.dirs {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// Return a loopback address with a port that is currently free.
+func freeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
+
+// Return a log function forwarding the messages of the node with the given
+// index to the test log.
+func logFunc(t testing.TB, index int) client.LogFunc {
+	return func(l client.LogLevel, format string, a ...interface{}) {
+		t.Logf(fmt.Sprintf("%d: %s: %s", index, l.String(), format), a...)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build go1.14
+// +build go1.14
+
+package dqlitetesting_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/dqlitetesting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCluster(t *testing.T) {
+	cluster := dqlitetesting.NewCluster(t, 3)
+	require.Len(t, cluster.DBs, 3)
+
+	ctx := context.Background()
+
+	_, err := cluster.DBs[0].ExecContext(ctx, "CREATE TABLE test (n INT)")
+	require.NoError(t, err)
+	_, err = cluster.DBs[1].ExecContext(ctx, "INSERT INTO test(n) VALUES(1)")
+	require.NoError(t, err)
+
+	var n int
+	require.NoError(t, cluster.DBs[2].QueryRowContext(ctx, "SELECT n FROM test").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	cli, err := client.FindLeader(ctx, cluster.Store)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	nodes, err := cli.Cluster(ctx)
+	require.NoError(t, err)
+	assert.Len(t, nodes, 3)
+}
+
+func TestNewCluster_IsolateLeader(t *testing.T) {
+	network := dqlitetesting.NewNetwork()
+	cluster := dqlitetesting.NewCluster(t, 3, dqlitetesting.WithNetwork(network))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dial := client.WithDialFunc(cluster.DialFunc)
+
+	cli, err := client.FindLeader(ctx, cluster.Store, dial)
+	require.NoError(t, err)
+	leader, err := cli.Leader(ctx)
+	require.NoError(t, err)
+	cli.Close()
+
+	network.Isolate(leader.Address)
+
+	for {
+		cli, err := client.FindLeader(ctx, cluster.Store, dial)
+		require.NoError(t, err)
+		info, err := cli.Leader(ctx)
+		cli.Close()
+		if err == nil && info.Address != leader.Address {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
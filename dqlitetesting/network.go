@@ -0,0 +1,184 @@
+package dqlitetesting
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/canonical/go-dqlite/app"
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Network injects faults into the connections between dqlite nodes, in order
+// to write deterministic failover tests.
+//
+// Nodes are identified by their address. Connections must be established with
+// the dial functions returned by Dial and accepted through the functions
+// returned by Accept, typically by passing them to app.WithExternalConn and
+// app.WithAcceptFunc, as done by NewCluster with WithNetwork.
+//
+// Faults apply to both new and established connections.
+type Network struct {
+	mu       sync.Mutex
+	latency  map[link]time.Duration
+	cut      map[link]bool
+	isolated map[string]bool
+	conns    map[*faultyConn]struct{}
+}
+
+// A direction of the network path between two nodes.
+type link struct {
+	from string
+	to   string
+}
+
+// NewNetwork creates a new Network without any fault.
+func NewNetwork() *Network {
+	return &Network{
+		latency:  map[link]time.Duration{},
+		cut:      map[link]bool{},
+		isolated: map[string]bool{},
+		conns:    map[*faultyConn]struct{}{},
+	}
+}
+
+// Dial returns a dial function to be used by the node with the given address,
+// which establishes connections using the given dial function unless the
+// target is partitioned from the node.
+func (n *Network) Dial(from string, dial client.DialFunc) client.DialFunc {
+	return func(ctx context.Context, to string) (net.Conn, error) {
+		if n.blocked(from, to) {
+			return nil, fmt.Errorf("dial %s from %s: network partitioned", to, from)
+		}
+		conn, err := dial(ctx, to)
+		if err != nil {
+			return nil, err
+		}
+		return n.track(conn, from, to), nil
+	}
+}
+
+// Accept returns an accept function to be used by the node with the given
+// address, which rejects incoming connections while the node is isolated.
+//
+// Since the remote address of an incoming connection does not identify the
+// node that established it, only isolation is enforced on this side, while
+// partitions between specific nodes are enforced by Dial.
+func (n *Network) Accept(at string) app.AcceptFunc {
+	return func(conn net.Conn) (net.Conn, error) {
+		n.mu.Lock()
+		isolated := n.isolated[at]
+		n.mu.Unlock()
+		if isolated {
+			return nil, fmt.Errorf("node %s is isolated", at)
+		}
+		return n.track(conn, "", at), nil
+	}
+}
+
+// Partition cuts the network between the two nodes with the given addresses,
+// in both directions, closing the connections between them.
+func (n *Network) Partition(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut[link{from: a, to: b}] = true
+	n.cut[link{from: b, to: a}] = true
+	n.closeLocked(func(l link) bool {
+		return (l.from == a && l.to == b) || (l.from == b && l.to == a)
+	})
+}
+
+// Isolate cuts the network between the node with the given address and all
+// other nodes and clients, closing all its connections.
+func (n *Network) Isolate(node string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.isolated[node] = true
+	n.closeLocked(func(l link) bool {
+		return l.from == node || l.to == node
+	})
+}
+
+// Drop closes all connections currently established between the two nodes
+// with the given addresses, without preventing new ones.
+func (n *Network) Drop(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closeLocked(func(l link) bool {
+		return (l.from == a && l.to == b) || (l.from == b && l.to == a)
+	})
+}
+
+// SetLatency delays every write performed on connections established by the
+// node with address from to the node with address to by the given amount.
+// A zero latency removes the delay.
+func (n *Network) SetLatency(from, to string, latency time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if latency == 0 {
+		delete(n.latency, link{from: from, to: to})
+		return
+	}
+	n.latency[link{from: from, to: to}] = latency
+}
+
+// Heal removes all partitions, isolations and latencies.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.latency = map[link]time.Duration{}
+	n.cut = map[link]bool{}
+	n.isolated = map[string]bool{}
+}
+
+// Whether connections from the given node to the given node are prevented.
+func (n *Network) blocked(from, to string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.isolated[from] || n.isolated[to] || n.cut[link{from: from, to: to}]
+}
+
+// Wrap the given connection so it's subject to faults.
+func (n *Network) track(conn net.Conn, from, to string) net.Conn {
+	c := &faultyConn{Conn: conn, network: n, link: link{from: from, to: to}}
+	n.mu.Lock()
+	n.conns[c] = struct{}{}
+	n.mu.Unlock()
+	return c
+}
+
+// Close all connections whose link matches the given function.
+func (n *Network) closeLocked(match func(link) bool) {
+	for c := range n.conns {
+		if match(c.link) {
+			c.Conn.Close()
+			delete(n.conns, c)
+		}
+	}
+}
+
+// Connection subject to the faults of a Network.
+type faultyConn struct {
+	net.Conn
+	network *Network
+	link    link
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	c.network.mu.Lock()
+	latency := c.network.latency[c.link]
+	c.network.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *faultyConn) Close() error {
+	c.network.mu.Lock()
+	delete(c.network.conns, c)
+	c.network.mu.Unlock()
+	return c.Conn.Close()
+}
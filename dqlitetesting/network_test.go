@@ -0,0 +1,89 @@
+package dqlitetesting_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/dqlitetesting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork_Partition(t *testing.T) {
+	network := dqlitetesting.NewNetwork()
+	dial := network.Dial("a", pipeDial)
+	ctx := context.Background()
+
+	conn, err := dial(ctx, "b")
+	require.NoError(t, err)
+
+	network.Partition("b", "a")
+
+	// Existing connections get closed.
+	_, err = conn.Write([]byte{0})
+	assert.Error(t, err)
+
+	_, err = dial(ctx, "b")
+	assert.EqualError(t, err, "dial b from a: network partitioned")
+
+	conn, err = dial(ctx, "c")
+	require.NoError(t, err)
+	conn.Close()
+
+	network.Heal()
+
+	conn, err = dial(ctx, "b")
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestNetwork_Isolate(t *testing.T) {
+	network := dqlitetesting.NewNetwork()
+	accept := network.Accept("b")
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	conn, err := accept(remote)
+	require.NoError(t, err)
+
+	network.Isolate("b")
+
+	_, err = conn.Write([]byte{0})
+	assert.Error(t, err)
+
+	_, err = accept(remote)
+	assert.EqualError(t, err, "node b is isolated")
+
+	_, err = network.Dial("a", pipeDial)(context.Background(), "b")
+	assert.Error(t, err)
+}
+
+func TestNetwork_SetLatency(t *testing.T) {
+	network := dqlitetesting.NewNetwork()
+	network.SetLatency("a", "b", 10*time.Millisecond)
+
+	conn, err := network.Dial("a", pipeDial)(context.Background(), "b")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = conn.Write([]byte{0})
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
+
+// Dial function returning one end of a pipe, whose other end drains all data.
+func pipeDial(ctx context.Context, address string) (net.Conn, error) {
+	local, remote := net.Pipe()
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return local, nil
+}
@@ -0,0 +1,159 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// ActiveStatement describes a statement being executed by one of the
+// connections of a driver, as returned by Driver.ActiveStatements.
+type ActiveStatement struct {
+	ID       uint64        // Identifies the statement in Driver.Interrupt calls.
+	Conn     uint64        // Identifies the driver connection executing it.
+	Database string        // Name of the database.
+	Digest   string        // Digest of the statement text, see QueryDigest.
+	Elapsed  time.Duration // Time since the statement was sent.
+}
+
+// ErrInterrupted is returned by statements interrupted with Driver.Interrupt.
+var ErrInterrupted = fmt.Errorf("statement interrupted")
+
+// ActiveStatements returns the statements currently being executed by the
+// connections of this driver, ordered by ID.
+//
+// A statement is active from the moment it's sent to the leader until the
+// first response is received, so the time spent fetching further batches of
+// rows of a query is not accounted.
+func (d *Driver) ActiveStatements() []ActiveStatement {
+	return d.active.list()
+}
+
+// Interrupt interrupts the active statement with the given ID, which then
+// fails with ErrInterrupted.
+//
+// The network connection executing the statement is closed, and the leader
+// stops executing the statement once it notices, at the latest when sending
+// the next batch of rows. The driver connection is discarded, along with its
+// transaction, if any.
+func (d *Driver) Interrupt(id uint64) error {
+	return d.active.interrupt(id)
+}
+
+// Registry of the statements being executed by the connections of a driver.
+type activeRegistry struct {
+	conns uint64 // Number of connections created so far (first for atomic alignment).
+
+	mu         sync.Mutex
+	next       uint64
+	statements map[uint64]*activeStatement
+}
+
+type activeStatement struct {
+	conn        *activeConn
+	query       string
+	started     time.Time
+	protocol    *protocol.Protocol
+	interrupted bool
+}
+
+func newActiveRegistry() *activeRegistry {
+	return &activeRegistry{statements: map[uint64]*activeStatement{}}
+}
+
+// Return a handle for tracking the statements of a new connection to the
+// given database.
+func (a *activeRegistry) conn(database string) *activeConn {
+	return &activeConn{
+		registry: a,
+		id:       atomic.AddUint64(&a.conns, 1),
+		database: database,
+	}
+}
+
+func (a *activeRegistry) list() []ActiveStatement {
+	now := time.Now()
+
+	a.mu.Lock()
+	statements := make([]ActiveStatement, 0, len(a.statements))
+	for id, statement := range a.statements {
+		statements = append(statements, ActiveStatement{
+			ID:       id,
+			Conn:     statement.conn.id,
+			Database: statement.conn.database,
+			Digest:   statement.query,
+			Elapsed:  now.Sub(statement.started),
+		})
+	}
+	a.mu.Unlock()
+
+	// Compute digests outside of the lock.
+	for i := range statements {
+		statements[i].Digest = QueryDigest(statements[i].Digest)
+	}
+	sort.Slice(statements, func(i, j int) bool { return statements[i].ID < statements[j].ID })
+
+	return statements
+}
+
+func (a *activeRegistry) interrupt(id uint64) error {
+	a.mu.Lock()
+	statement, ok := a.statements[id]
+	if ok {
+		statement.interrupted = true
+		atomic.StoreInt32(&statement.conn.interrupted, 1)
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no active statement with ID %d", id)
+	}
+
+	statement.protocol.Abort()
+
+	return nil
+}
+
+// Tracks the statements executed by a single connection.
+type activeConn struct {
+	interrupted int32 // Set to 1 if a statement was interrupted (first for atomic alignment).
+	registry    *activeRegistry
+	id          uint64
+	database    string
+}
+
+// Perform the given RPC like callWithLabels, tracking it as an active
+// statement for its duration.
+func (c *activeConn) call(ctx context.Context, labels []string, query string, p *protocol.Protocol, request, response *protocol.Message) error {
+	a := c.registry
+	statement := &activeStatement{conn: c, query: query, started: time.Now(), protocol: p}
+
+	a.mu.Lock()
+	a.next++
+	id := a.next
+	a.statements[id] = statement
+	a.mu.Unlock()
+
+	err := callWithLabels(ctx, labels, p, request, response)
+
+	a.mu.Lock()
+	delete(a.statements, id)
+	interrupted := statement.interrupted
+	a.mu.Unlock()
+
+	if interrupted {
+		return ErrInterrupted
+	}
+	return err
+}
+
+// Return true if a statement of this connection was interrupted, meaning its
+// network connection is gone.
+func (c *activeConn) broken() bool {
+	return atomic.LoadInt32(&c.interrupted) == 1
+}
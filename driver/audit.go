@@ -0,0 +1,94 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// AuditRecord describes a write statement executed by a connection.
+type AuditRecord struct {
+	Time      time.Time     // When the statement was sent to the leader.
+	Identity  string        // Identity set with WithAuditIdentity, if any.
+	Database  string        // Name of the database.
+	Node      string        // Address of the leader that executed the statement.
+	Kind      StatementKind // Kind of the statement, or of its first write.
+	Statement string        // SQL text of the statement.
+	Digest    string        // Hex encoded SHA-256 digest of the statement and its parameters.
+	Err       error         // Error returned by the leader, if any.
+}
+
+// AuditSink receives a record for every write statement executed through a
+// Driver, that is every statement whose kind is not StatementSelect or
+// StatementTxn. Statements starting with WITH are classified by their main
+// verb. A query made of several statements is audited if any of them is a
+// write, with the kind of the first write.
+//
+// The Audit method is called synchronously after the statement returns, with
+// the statement context, and must be safe to call concurrently.
+type AuditSink interface {
+	Audit(ctx context.Context, record AuditRecord)
+}
+
+// AuditFunc adapts a plain function to the AuditSink interface.
+type AuditFunc func(ctx context.Context, record AuditRecord)
+
+// Audit calls f(ctx, record).
+func (f AuditFunc) Audit(ctx context.Context, record AuditRecord) {
+	f(ctx, record)
+}
+
+// WithAuditSink sets a sink receiving a record for every write statement
+// executed by connections created by this driver.
+func WithAuditSink(sink AuditSink) Option {
+	return func(options *options) {
+		options.AuditSink = sink
+	}
+}
+
+type auditIdentityKey struct{}
+
+// WithAuditIdentity returns a context that attaches the given identity, for
+// example the name of the user on whose behalf statements are executed, to
+// the audit records of statements it's passed to.
+func WithAuditIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, auditIdentityKey{}, identity)
+}
+
+// Send a record about the given statements to the given sink, unless they are
+// all read-only.
+func audit(ctx context.Context, sink AuditSink, p *protocol.Protocol, database string, query string, args []driver.NamedValue, start time.Time, err error) {
+	kind, ok := writeKind(query)
+	if !ok {
+		return
+	}
+
+	identity, _ := ctx.Value(auditIdentityKey{}).(string)
+	_, node := p.Node()
+
+	sink.Audit(ctx, AuditRecord{
+		Time:      start,
+		Identity:  identity,
+		Database:  database,
+		Node:      node,
+		Kind:      kind,
+		Statement: query,
+		Digest:    auditDigest(query, args),
+		Err:       err,
+	})
+}
+
+// Return the digest of the given statement and parameters.
+func auditDigest(query string, args []driver.NamedValue) string {
+	h := sha256.New()
+	h.Write([]byte(query))
+	for _, arg := range args {
+		fmt.Fprintf(h, "\x00%d:%s:%T:%v", arg.Ordinal, arg.Name, arg.Value, arg.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testID [2]byte
+
+type testCount uint8
+
+func TestConn_CheckNamedValue(t *testing.T) {
+	o := defaultOptions()
+	WithConverter(testID{}, func(v interface{}) (driver.Value, error) {
+		id := v.(testID)
+		return fmt.Sprintf("%x", id[:]), nil
+	})(o)
+	WithConverter(testCount(0), func(v interface{}) (driver.Value, error) {
+		if v.(testCount) == 0 {
+			return nil, errors.New("zero count")
+		}
+		return int(v.(testCount)), nil // Converted again to int64.
+	})(o)
+	WithConverter(struct{}{}, func(v interface{}) (driver.Value, error) {
+		return v, nil // Not a valid driver.Value.
+	})(o)
+	conn := &Conn{converters: o.Converters, timeFormat: TimeFormatUnix}
+
+	cases := []struct {
+		value interface{}
+		want  interface{}
+		err   string
+	}{
+		{testID{0xab, 0xcd}, "abcd", ""},
+		{testCount(3), int64(3), ""},
+		{testCount(0), nil, "zero count"},
+		{struct{}{}, nil, "unsupported type struct {}, a struct"},
+		{time.Unix(1700000000, 0), int64(1700000000), ""},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%T", c.value), func(t *testing.T) {
+			nv := driver.NamedValue{Ordinal: 1, Value: c.value}
+			err := conn.CheckNamedValue(&nv)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, nv.Value)
+		})
+	}
+}
+
+// Values without a converter are left to the default conversion.
+func TestConn_CheckNamedValueSkip(t *testing.T) {
+	o := defaultOptions()
+	WithConverter(testID{}, func(v interface{}) (driver.Value, error) {
+		return "", nil
+	})(o)
+	conn := &Conn{converters: o.Converters}
+
+	for _, value := range []interface{}{int64(1), "foo", &testID{}, nil} {
+		nv := driver.NamedValue{Ordinal: 1, Value: value}
+		assert.Equal(t, driver.ErrSkip, conn.CheckNamedValue(&nv))
+		assert.Equal(t, value, nv.Value)
+	}
+}
@@ -17,11 +17,17 @@ package driver
 import (
 	"context"
 	"database/sql/driver"
+	"expvar"
 	"fmt"
 	"io"
 	"math"
 	"net"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -29,6 +35,7 @@ import (
 
 	"github.com/canonical/go-dqlite/client"
 	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/canonical/go-dqlite/logging"
 	"github.com/canonical/go-dqlite/tracing"
 )
 
@@ -42,11 +49,50 @@ type Driver struct {
 	clientConfig          protocol.Config  // Configuration for dqlite client instances
 	tracing               client.LogLevel  // Whether to trace statements
 	concurrentLeaderConns *int64           // Maximum number of concurrent connections to other cluster members while probing for leadership.
+	queryTimeout          time.Duration    // Default timeout for each statement.
+	stats                 *stats           // Activity counters.
+	converters            converters       // Custom parameter converters.
+	timeFormat            TimeFormat       // Encoding of time.Time parameters.
+	timeLocation          *time.Location   // Location of decoded timestamps.
+	tracePropagation      bool             // Whether to send trace context to the server.
+	profilerLabels        bool             // Whether to set pprof labels.
+	idlePing              time.Duration    // Ping connections idle for longer than this.
+	audit                 AuditSink        // Receives records of write statements.
+	maxDatabaseSize       uint64           // Size limit of databases, in bytes.
+	active                *activeRegistry  // Statements being executed.
+	paused                *int32           // Non-zero while new transactions are refused.
 }
 
 // Error is returned in case of database errors.
+//
+// Its Code field holds the result code returned by the node, which may be an
+// extended one: for example a UNIQUE constraint violation has Code set to
+// SQLITE_CONSTRAINT_UNIQUE, and its PrimaryCode method returns ErrConstraint.
+// Errors can be matched with errors.Is against an Error whose Code is a
+// primary code, matching all its extended codes, or an extended code, for an
+// exact match.
 type Error = protocol.Error
 
+// ErrMessageTooLarge is returned when a request or a response exceeds the size
+// set with WithMaxMessageSize.
+type ErrMessageTooLarge = protocol.ErrMessageTooLarge
+
+// ErrNotLeader is returned when the node a connection is established with is
+// not the leader anymore.
+//
+// It matches driver.ErrBadConn with errors.Is, so database/sql retries the
+// statement over a new connection, established with the new leader, and only
+// returns ErrNotLeader if all retries fail. With Go versions older than 1.18,
+// whose database/sql doesn't use errors.Is, driver.ErrBadConn is returned
+// instead.
+//
+// Its LeaderAddress field is only set if the new leader is already known to
+// the driver, for example because another connection found it: the driver
+// doesn't ask for it, to avoid an extra round trip while failing the
+// statement. Instead, the next connection starts by asking the node that lost
+// leadership who the new leader is.
+type ErrNotLeader = protocol.ErrNotLeader
+
 // Error codes. Values here mostly overlap with native SQLite codes.
 const (
 	ErrBusy                = 5
@@ -56,6 +102,8 @@ const (
 	ErrIoErrNotLeader      = errIoErr | (40 << 8)
 	ErrIoErrLeadershipLost = errIoErr | (41 << 8)
 	errNotFound            = 12
+	ErrFull                = 13
+	ErrConstraint          = 19
 
 	// Legacy error codes before version-3.32.1+replication4. Kept here
 	// for backward compatibility, but should eventually be dropped.
@@ -151,6 +199,31 @@ func WithAttemptTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithDialTimeout sets the timeout for establishing the network connection to
+// each individual server while looking for the leader. It's not bound by the
+// attempt timeout, and doesn't include the protocol handshake.
+//
+// If not used, the default is 5 seconds.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.DialTimeout = timeout
+	}
+}
+
+// WithHandshakeTimeout sets the timeout for the protocol handshake with each
+// individual server once the network connection is established, including
+// asking it who the leader is. The attempt timeout still applies as well.
+//
+// On lossy networks, this allows a generous dial timeout while still giving
+// up quickly on servers that accept connections but don't respond.
+//
+// If not used, the default is to rely on the attempt timeout only.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.HandshakeTimeout = timeout
+	}
+}
+
 // WithRetryLimit sets the maximum number of connection retries.
 //
 // If not used, the default is 0 (unlimited retries)
@@ -189,6 +262,260 @@ func WithTracing(level client.LogLevel) Option {
 	}
 }
 
+// WithDefaultQueryTimeout sets a default timeout for every statement executed
+// by connections created by this driver. The timeout can be overridden for a
+// single statement by passing it a context created with WithQueryTimeout.
+//
+// If not used, the default is 0 (no timeout).
+func WithDefaultQueryTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.QueryTimeout = timeout
+	}
+}
+
+type contextKey string
+
+const (
+	queryTimeoutContextKey contextKey = "query-timeout"
+)
+
+// WithQueryTimeout returns a context that caps the execution time of any
+// statement it's passed to, overriding the driver's default query timeout. A
+// zero timeout disables the cap altogether.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutContextKey, timeout)
+}
+
+// Return a context honoring the query timeout set on the given context, or the
+// given default timeout if none is set.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if value, ok := ctx.Value(queryTimeoutContextKey).(time.Duration); ok {
+		timeout = value
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Prepend the trace context of the given span to the query, as a comment in
+// the sqlcommenter format. The query is returned unchanged if the span can't
+// be propagated.
+func withTraceParent(span tracing.Span, query string) string {
+	parent := tracing.TraceParent(span)
+	if parent == "" {
+		return query
+	}
+	return fmt.Sprintf("/*traceparent='%s'*/ %s", parent, query)
+}
+
+// Annotate the given span with the node the protocol is connected to.
+func traceNode(span tracing.Span, protocol *protocol.Protocol) {
+	id, address := protocol.Node()
+	tracing.SetAttributes(span,
+		tracing.Attribute{Key: tracing.NodeAddressKey, Value: address},
+		tracing.Attribute{Key: tracing.LeaderIDKey, Value: id},
+	)
+}
+
+// WithIdlePing makes the sql package check connections that have been idle
+// for longer than the given duration before reusing them, by pinging the node
+// they are connected to. Connections that fail the ping, for example because
+// the network connection was silently dropped or the node is no longer the
+// leader, are discarded and replaced with new ones, instead of failing the
+// first statement executed on them.
+//
+// If not used, the default is 0 (idle connections are reused without checks).
+func WithIdlePing(idle time.Duration) Option {
+	return func(options *options) {
+		options.IdlePing = idle
+	}
+}
+
+// WithMaxDatabaseSize limits the size of the databases opened with the
+// driver to the given number of bytes, rounded down to a multiple of the
+// database page size. Statements that would grow a database beyond that fail
+// with an Error whose Code is ErrFull, while reads and statements that don't
+// allocate new pages keep working.
+//
+// The limit is enforced by the leader on each connection opened by the
+// driver, so writers using different limits or other drivers are not
+// affected. A database already larger than the limit can't grow any further.
+//
+// If not used, the default is 0 (no limit).
+func WithMaxDatabaseSize(bytes uint64) Option {
+	return func(options *options) {
+		options.MaxDatabaseSize = bytes
+	}
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of the requests sent and
+// of the responses received over connections opened by the driver, for
+// example to allow statements binding or returning large blobs while still
+// protecting the application against runaway results.
+//
+// Statements exceeding it fail with ErrMessageTooLarge. A connection that
+// received a response exceeding it is discarded.
+//
+// If not used, the default is 0 (no limit).
+func WithMaxMessageSize(bytes uint64) Option {
+	return func(options *options) {
+		options.MaxMessageSize = bytes
+	}
+}
+
+// WithPreferredNodes makes the driver ask the nodes matching the given filter
+// for the current leader before the others when opening a connection, see
+// client.WithPreferredNodes.
+//
+// Statements are still always executed by the leader.
+func WithPreferredNodes(filter func(client.NodeInfo) bool) Option {
+	return func(options *options) {
+		options.PreferredNodes = filter
+	}
+}
+
+// WithCircuitBreaker makes the driver skip the nodes that failed the given
+// number of consecutive connection attempts, until the given cooldown period
+// has elapsed. After that a single attempt is made: if it succeeds the node
+// is used again, otherwise it's skipped for another cooldown period.
+//
+// The state of the breaker is shared by all connections opened by the driver.
+//
+// If not used, the default is to always try all nodes.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(options *options) {
+		options.CircuitBreaker = client.NewCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithRetryBudget limits the number of retries that connections opened by the
+// driver can make while looking for the leader, to the given amount within
+// each time window of the given length. Once the budget is spent, opening a
+// connection fails with ErrNoAvailableLeader after a single attempt, instead
+// of backing off and retrying, so that a cluster-wide outage doesn't pile up
+// goroutines waiting for a leader.
+//
+// If not used, the default is no limit besides the one set by
+// WithRetryLimit.
+func WithRetryBudget(retries int, window time.Duration) Option {
+	return func(options *options) {
+		options.RetryBudget = client.NewRetryBudget(retries, window)
+	}
+}
+
+// WithStatsVar publishes the driver statistics returned by Driver.Stats() as
+// an expvar variable with the given name.
+//
+// Since expvar names are global, the given name must be unique within the
+// process.
+func WithStatsVar(name string) Option {
+	return func(options *options) {
+		options.StatsVar = name
+	}
+}
+
+// ConverterFunc converts a Go value of a custom type into a value that can be
+// bound to a statement parameter, for example by turning a uuid.UUID into a
+// string or a []byte.
+type ConverterFunc func(interface{}) (driver.Value, error)
+
+// WithConverter registers a function that converts statement parameters
+// having the same type as the given sample value.
+//
+// This avoids having to implement the driver.Valuer interface on types that
+// are commonly used as parameters across an application. The value returned
+// by the converter is in turn subject to the standard conversion rules of
+// database/sql/driver.
+func WithConverter(sample interface{}, convert ConverterFunc) Option {
+	return func(options *options) {
+		if options.Converters == nil {
+			options.Converters = converters{}
+		}
+		options.Converters[reflect.TypeOf(sample)] = convert
+	}
+}
+
+// Custom converters indexed by the type of the value they convert.
+type converters map[reflect.Type]ConverterFunc
+
+// Convert the given parameter using the matching custom converter, if any.
+func (c converters) check(nv *driver.NamedValue) error {
+	convert, ok := c[reflect.TypeOf(nv.Value)]
+	if !ok {
+		return driver.ErrSkip
+	}
+	value, err := convert(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(value)
+	return err
+}
+
+// WithTimeFormat sets how time.Time statement parameters are stored.
+//
+// Timestamps stored in columns declared as DATETIME, DATE or TIMESTAMP are
+// automatically decoded into time.Time values when queried. With
+// TimeFormatJulianDay, both integer and fractional day numbers are decoded.
+// Julian day numbers computed by the query itself, for example using SQLite's
+// julianday() function, are returned as int64 or float64 values, since they
+// don't come from a timestamp column.
+//
+// If not used, the default is TimeFormatISO8601.
+func WithTimeFormat(format TimeFormat) Option {
+	return func(options *options) {
+		options.TimeFormat = format
+	}
+}
+
+// WithTimeLocation sets the location of time.Time values decoded from query
+// results.
+//
+// If not used, timestamps are returned in the location they were stored with,
+// or in UTC if they carry no time zone information.
+func WithTimeLocation(location *time.Location) Option {
+	return func(options *options) {
+		options.TimeLocation = location
+	}
+}
+
+// WithTracePropagation enables propagating the context of the spans started
+// by the driver to the server.
+//
+// The trace context is prepended to the text of executed statements as a SQL
+// comment in the sqlcommenter format, for example:
+//
+//	/*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/ SELECT ...
+//
+// so that server-side logs can be correlated with client-side spans. It only
+// has effect with tracers whose spans implement tracing.Propagator.
+func WithTracePropagation(enabled bool) Option {
+	return func(options *options) {
+		options.TracePropagation = enabled
+	}
+}
+
+// WithProfilerLabels enables setting pprof labels around the execution of
+// statements, so CPU profiles can be attributed to specific queries.
+//
+// The labels are ProfilerLabelDatabase, holding the database name, and
+// ProfilerLabelQuery, holding the digest of the statement text as returned by
+// QueryDigest.
+func WithProfilerLabels(enabled bool) Option {
+	return func(options *options) {
+		options.ProfilerLabels = enabled
+	}
+}
+
+// WithObserver sets an observer notified about queries, errors and
+// connections, for example in order to export metrics.
+func WithObserver(observer Observer) Option {
+	return func(options *options) {
+		options.Observer = observer
+	}
+}
+
 // NewDriver creates a new dqlite driver, which also implements the
 // driver.Driver interface.
 func New(store client.NodeStore, options ...Option) (*Driver, error) {
@@ -206,22 +533,71 @@ func New(store client.NodeStore, options ...Option) (*Driver, error) {
 		contextTimeout:        o.ContextTimeout,
 		tracing:               o.Tracing,
 		concurrentLeaderConns: o.ConcurrentLeaderConns,
+		queryTimeout:          o.QueryTimeout,
+		stats:                 &stats{observer: o.Observer},
+		converters:            o.Converters,
+		timeFormat:            o.TimeFormat,
+		timeLocation:          o.TimeLocation,
+		tracePropagation:      o.TracePropagation,
+		profilerLabels:        o.ProfilerLabels,
+		idlePing:              o.IdlePing,
+		audit:                 o.AuditSink,
+		maxDatabaseSize:       o.MaxDatabaseSize,
+		active:                newActiveRegistry(),
+		paused:                new(int32),
 		clientConfig: protocol.Config{
-			Dial:           o.Dial,
-			AttemptTimeout: o.AttemptTimeout,
-			BackoffFactor:  o.ConnectionBackoffFactor,
-			BackoffCap:     o.ConnectionBackoffCap,
-			RetryLimit:     o.RetryLimit,
+			Dial:             o.Dial,
+			DialTimeout:      o.DialTimeout,
+			HandshakeTimeout: o.HandshakeTimeout,
+			AttemptTimeout:   o.AttemptTimeout,
+			BackoffFactor:    o.ConnectionBackoffFactor,
+			BackoffCap:       o.ConnectionBackoffCap,
+			RetryLimit:       o.RetryLimit,
+			LeaderHint:       &protocol.LeaderHint{},
+			MaxMessageSize:   o.MaxMessageSize,
+			PreferredNodes:   o.PreferredNodes,
+			CircuitBreaker:   o.CircuitBreaker,
+			RetryBudget:      o.RetryBudget,
 		},
 	}
+	driver.clientConfig.Retries = &driver.stats.retries
+
+	if o.StatsVar != "" {
+		expvar.Publish(o.StatsVar, expvar.Func(func() interface{} {
+			return driver.Stats()
+		}))
+	}
 
 	return driver, nil
 }
 
+// Stats returns a snapshot of the driver statistics.
+func (d *Driver) Stats() Stats {
+	return d.stats.snapshot()
+}
+
+// ErrTransactionsPaused is returned when beginning a transaction while
+// transactions are paused with Driver.PauseTransactions.
+var ErrTransactionsPaused = errors.New("new transactions are paused")
+
+// PauseTransactions makes connections created by this driver refuse to begin
+// new transactions, failing with ErrTransactionsPaused, until the returned
+// function is called. Transactions in progress are not affected, and can be
+// waited for using the Transactions field of Stats.
+func (d *Driver) PauseTransactions() (resume func()) {
+	atomic.AddInt32(d.paused, 1)
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { atomic.AddInt32(d.paused, -1) })
+	}
+}
+
 // Hold configuration options for a dqlite driver.
 type options struct {
 	Log                     client.LogFunc
 	Dial                    protocol.DialFunc
+	DialTimeout             time.Duration
+	HandshakeTimeout        time.Duration
 	AttemptTimeout          time.Duration
 	ConnectionTimeout       time.Duration
 	ContextTimeout          time.Duration
@@ -231,6 +607,21 @@ type options struct {
 	RetryLimit              uint
 	Context                 context.Context
 	Tracing                 client.LogLevel
+	QueryTimeout            time.Duration
+	StatsVar                string
+	Converters              converters
+	TimeFormat              TimeFormat
+	TimeLocation            *time.Location
+	Observer                Observer
+	TracePropagation        bool
+	ProfilerLabels          bool
+	IdlePing                time.Duration
+	AuditSink               AuditSink
+	MaxDatabaseSize         uint64
+	MaxMessageSize          uint64
+	PreferredNodes          func(client.NodeInfo) bool
+	CircuitBreaker          *client.CircuitBreaker
+	RetryBudget             *client.RetryBudget
 }
 
 // Create a options object with sane defaults.
@@ -247,8 +638,10 @@ func defaultOptions() *options {
 // A Connector represents a driver in a fixed configuration and can create any
 // number of equivalent Conns for use by multiple goroutines.
 type Connector struct {
-	uri    string
-	driver *Driver
+	uri     string
+	token   string   // Authentication token, if any.
+	pragmas []pragma // PRAGMAs to set on every new connection.
+	driver  *Driver
 }
 
 // Connect returns a connection to the database.
@@ -266,12 +659,27 @@ func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
 	// TODO: generate a client ID.
 	config := c.driver.clientConfig
 	config.ConcurrentLeaderConns = *c.driver.concurrentLeaderConns
+	if c.token != "" {
+		config.Dial = client.DialFuncWithToken(config.Dial, c.token)
+	}
 	connector := protocol.NewConnector(0, c.driver.store, config, c.driver.log)
 
 	conn := &Conn{
 		log:            c.driver.log,
 		contextTimeout: c.driver.contextTimeout,
 		tracing:        c.driver.tracing,
+		queryTimeout:   c.driver.queryTimeout,
+		stats:          c.driver.stats,
+		converters:     c.driver.converters,
+		timeFormat:     c.driver.timeFormat,
+		timeLocation:   c.driver.timeLocation,
+		propagate:      c.driver.tracePropagation,
+		profile:        c.driver.profilerLabels,
+		idlePing:       c.driver.idlePing,
+		audit:          c.driver.audit,
+		database:       c.uri,
+		active:         c.driver.active.conn(c.uri),
+		paused:         c.driver.paused,
 	}
 
 	var err error
@@ -280,6 +688,12 @@ func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
 		return nil, driverError(conn.log, errors.Wrap(err, "failed to create dqlite connection"))
 	}
 
+	id, address := conn.protocol.Node()
+	conn.log = logging.WithFields(conn.log,
+		logging.Field{Key: "node_id", Value: id},
+		logging.Field{Key: "address", Value: address},
+		logging.Field{Key: "database", Value: c.uri})
+
 	conn.request.Init(4096)
 	conn.response.Init(4096)
 
@@ -296,6 +710,23 @@ func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
 		return nil, driverError(conn.log, errors.Wrap(err, "failed to open database"))
 	}
 
+	if c.driver.maxDatabaseSize > 0 {
+		if err := conn.limitSize(ctx, c.driver.maxDatabaseSize); err != nil {
+			conn.protocol.Close()
+			return nil, errors.Wrap(err, "failed to set database size limit")
+		}
+	}
+
+	for _, p := range c.pragmas {
+		query := fmt.Sprintf("PRAGMA %s = %s", p.name, p.value)
+		if err := conn.execInternal(ctx, query); err != nil {
+			conn.protocol.Close()
+			return nil, errors.Wrapf(err, "failed to set PRAGMA %s", p.name)
+		}
+	}
+
+	c.driver.stats.connected()
+
 	return conn, nil
 }
 
@@ -307,19 +738,117 @@ func (c *Connector) Driver() driver.Driver {
 // OpenConnector must parse the name in the same format that Driver.Open
 // parses the name parameter.
 func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	uri, token, pragmas, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
 	connector := &Connector{
-		uri:    name,
-		driver: d,
+		uri:     uri,
+		token:   token,
+		pragmas: pragmas,
+		driver:  d,
 	}
 	return connector, nil
 }
 
+// Query parameter of the data source name holding the authentication token.
+const tokenParam = "_token"
+
+// Prefix of the query parameters of the data source name that are applied as
+// PRAGMAs to every new connection.
+const pragmaPrefix = "_"
+
+// A PRAGMA set on every new connection.
+type pragma struct {
+	name  string
+	value string
+}
+
+// Names and values accepted for PRAGMAs set through the data source name.
+// They end up verbatim in a statement, so anything that could be used to
+// inject SQL is rejected.
+var (
+	pragmaNameRe  = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	pragmaValueRe = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+)
+
+// Remove the authentication token and the PRAGMA parameters from the given
+// data source name, returning the resulting name, the token, if any, and the
+// PRAGMAs in the order they appear.
+func parseName(name string) (string, string, []pragma, error) {
+	i := strings.IndexByte(name, '?')
+	if i == -1 {
+		return name, "", nil, nil
+	}
+	if _, err := url.ParseQuery(name[i+1:]); err != nil {
+		return "", "", nil, errors.Wrap(err, "invalid query parameters")
+	}
+
+	var token string
+	var pragmas []pragma
+	values := url.Values{}
+	stripped := false
+
+	for _, param := range strings.Split(name[i+1:], "&") {
+		if param == "" {
+			continue
+		}
+		key, value := param, ""
+		if j := strings.IndexByte(param, '='); j != -1 {
+			key, value = param[:j], param[j+1:]
+		}
+		key, _ = url.QueryUnescape(key) // Already validated by ParseQuery.
+		value, _ = url.QueryUnescape(value)
+
+		switch {
+		case key == tokenParam:
+			token = value
+		case strings.HasPrefix(key, pragmaPrefix):
+			p := pragma{name: strings.ToLower(key[len(pragmaPrefix):]), value: value}
+			if !pragmaNameRe.MatchString(p.name) {
+				return "", "", nil, errors.Errorf("invalid PRAGMA parameter %q", key)
+			}
+			if !pragmaValueRe.MatchString(p.value) {
+				return "", "", nil, errors.Errorf("invalid value %q for PRAGMA parameter %q", value, key)
+			}
+			pragmas = append(pragmas, p)
+		default:
+			values.Add(key, value)
+			continue
+		}
+		stripped = true
+	}
+
+	if !stripped {
+		return name, "", nil, nil
+	}
+
+	uri := name[:i]
+	if len(values) > 0 {
+		uri += "?" + values.Encode()
+	}
+
+	return uri, token, pragmas, nil
+}
+
 // Open establishes a new connection to a SQLite database on the dqlite server.
 //
 // The given name must be a pure file name without any directory segment,
 // dqlite will connect to a database with that name in its data directory.
 //
-// Query parameters are always valid except for "mode=memory".
+// Query parameters are always valid except for "mode=memory". The "_token"
+// parameter is not passed to dqlite: it sets the token sent to nodes requiring
+// authentication, see client.DialFuncWithToken.
+//
+// Any other parameter starting with an underscore is not passed to dqlite
+// either, but applied as a PRAGMA every time a new connection is created, so
+// that the setting survives connections being recycled by the pool. For
+// example "app.db?_foreign_keys=on&_cache_size=-8000" runs:
+//
+//	PRAGMA foreign_keys = on
+//	PRAGMA cache_size = -8000
+//
+// on each connection, in that order.
 //
 // If this node is not the leader, or the leader is unknown an ErrNotLeader
 // error is returned.
@@ -343,6 +872,16 @@ func (d *Driver) SetContextTimeout(timeout time.Duration) {}
 // leader available in the cluster.
 var ErrNoAvailableLeader = protocol.ErrNoAvailableLeader
 
+// ErrAttachNotSupported is returned when preparing, executing or querying SQL
+// text containing an ATTACH or DETACH statement, including when it's not the
+// first of several statements. The check happens before anything is sent to
+// the cluster. Match it with errors.Is.
+//
+// Each dqlite database is replicated on its own, so statements and
+// transactions can't span several databases. See app.App.CrossQuery for
+// reading from several databases at once.
+var ErrAttachNotSupported = errors.New("ATTACH and DETACH are not supported by dqlite")
+
 // Conn implements the sql.Conn interface.
 type Conn struct {
 	log            client.LogFunc
@@ -352,6 +891,18 @@ type Conn struct {
 	id             uint32 // Database ID.
 	contextTimeout time.Duration
 	tracing        client.LogLevel
+	queryTimeout   time.Duration
+	stats          *stats
+	converters     converters
+	timeFormat     TimeFormat
+	timeLocation   *time.Location
+	propagate      bool
+	profile        bool   // Whether to set pprof labels.
+	database       string // Name of the database, for pprof labels.
+	idlePing       time.Duration
+	audit          AuditSink
+	active         *activeConn
+	paused         *int32
 }
 
 // PrepareContext returns a prepared statement, bound to this connection.
@@ -360,13 +911,30 @@ type Conn struct {
 func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	ctx, span := tracing.Start(ctx, "dqlite.driver.PrepareContext", query)
 	defer span.End()
+	traceNode(span, c.protocol)
+
+	if isAttach(query) {
+		return nil, ErrAttachNotSupported
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, c.queryTimeout)
+	defer cancel()
 
 	stmt := &Stmt{
-		protocol: c.protocol,
-		request:  &c.request,
-		response: &c.response,
-		log:      c.log,
-		tracing:  c.tracing,
+		protocol:     c.protocol,
+		request:      &c.request,
+		response:     &c.response,
+		log:          c.log,
+		tracing:      c.tracing,
+		queryTimeout: c.queryTimeout,
+		stats:        c.stats,
+		timeFormat:   c.timeFormat,
+		timeLocation: c.timeLocation,
+		kind:         classifyStatement(query),
+		audit:        c.audit,
+		database:     c.database,
+		active:       c.active,
+		sql:          query,
 	}
 
 	protocol.EncodePrepare(&c.request, uint64(c.id), query)
@@ -377,24 +945,94 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 	}
 	err := c.protocol.Call(ctx, &c.request, &c.response)
 	if c.tracing != client.LogNone {
-		c.log(c.tracing, "%.3fs request prepared: %q", time.Since(start).Seconds(), query)
+		logRequest(c.log, c.tracing, "prepare", "%.3fs request prepared: %q", time.Since(start).Seconds(), query)
 	}
 	if err != nil {
-		return nil, driverError(c.log, err)
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
 	stmt.db, stmt.id, stmt.params, err = protocol.DecodeStmt(&c.response)
 	if err != nil {
-		return nil, driverError(c.log, err)
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
-	if c.tracing != client.LogNone {
-		stmt.sql = query
+	if c.profile {
+		stmt.labels = profilerLabels(c.database, query)
 	}
 
 	return stmt, nil
 }
 
+// Set the maximum number of pages of the database, so it doesn't grow beyond
+// the given size.
+func (c *Conn) limitSize(ctx context.Context, size uint64) error {
+	pageSize, err := c.queryInternal(ctx, "PRAGMA page_size")
+	if err != nil {
+		return err
+	}
+	if pageSize <= 0 {
+		return fmt.Errorf("unexpected page size %d", pageSize)
+	}
+
+	pages := size / uint64(pageSize)
+	if pages == 0 {
+		pages = 1
+	}
+	return c.execInternal(ctx, fmt.Sprintf("PRAGMA max_page_count = %d", pages))
+}
+
+// Execute a statement issued by the driver itself when setting up the
+// connection. Unlike ExecContext, it doesn't produce audit records, spans or
+// statistics, and isn't tracked as an active statement.
+func (c *Conn) execInternal(ctx context.Context, query string) error {
+	protocol.EncodeExecSQLV0(&c.request, uint64(c.id), query, nil)
+	if err := c.protocol.Call(ctx, &c.request, &c.response); err != nil {
+		return driverError(c.log, err)
+	}
+	if _, err := protocol.DecodeResult(&c.response); err != nil {
+		return driverError(c.log, err)
+	}
+	return nil
+}
+
+// Run a query issued by the driver itself and returning a single integer,
+// like execInternal.
+func (c *Conn) queryInternal(ctx context.Context, query string) (int64, error) {
+	protocol.EncodeQuerySQLV0(&c.request, uint64(c.id), query, nil)
+	if err := c.protocol.Call(ctx, &c.request, &c.response); err != nil {
+		return 0, driverError(c.log, err)
+	}
+	rows, err := protocol.DecodeRows(&c.response)
+	if err != nil {
+		return 0, driverError(c.log, err)
+	}
+	values := make([]driver.Value, 1)
+	err = rows.Next(values)
+	rows.Close()
+	if err != nil {
+		return 0, driverError(c.log, err)
+	}
+	value, ok := values[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected result %v", values[0])
+	}
+	return value, nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, applying the custom
+// converters registered with WithConverter and the time format set with
+// WithTimeFormat.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if err := c.converters.check(nv); err != driver.ErrSkip {
+		return err
+	}
+	if t, ok := nv.Value.(time.Time); ok {
+		nv.Value = encodeTime(t, c.timeFormat)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
 // Prepare returns a prepared statement, bound to this connection.
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 	return c.PrepareContext(context.Background(), query)
@@ -404,31 +1042,51 @@ func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
 	ctx, span := tracing.Start(ctx, "dqlite.driver.ExecContext", query)
 	defer span.End()
+	traceNode(span, c.protocol)
+
+	if isAttach(query) {
+		return nil, ErrAttachNotSupported
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	sql := query
+	if c.propagate {
+		sql = withTraceParent(span, query)
+	}
 
 	if int64(len(args)) > math.MaxUint32 {
 		return nil, driverError(c.log, fmt.Errorf("too many parameters (%d)", len(args)))
 	} else if len(args) > math.MaxUint8 {
-		protocol.EncodeExecSQLV1(&c.request, uint64(c.id), query, args)
+		protocol.EncodeExecSQLV1(&c.request, uint64(c.id), sql, args)
 	} else {
-		protocol.EncodeExecSQLV0(&c.request, uint64(c.id), query, args)
+		protocol.EncodeExecSQLV0(&c.request, uint64(c.id), sql, args)
 	}
 
-	var start time.Time
-	if c.tracing != client.LogNone {
-		start = time.Now()
+	var labels []string
+	if c.profile {
+		labels = profilerLabels(c.database, query)
 	}
-	err := c.protocol.Call(ctx, &c.request, &c.response)
+
+	kind := classifyStatement(query)
+	start := time.Now()
+	err := c.active.call(ctx, labels, query, c.protocol, &c.request, &c.response)
+	c.stats.query(kind, time.Since(start))
 	if c.tracing != client.LogNone {
-		c.log(c.tracing, "%.3fs request exec: %q", time.Since(start).Seconds(), query)
+		logRequest(c.log, c.tracing, "exec", "%.3fs request exec: %q", time.Since(start).Seconds(), query)
+	}
+	if c.audit != nil {
+		audit(ctx, c.audit, c.protocol, c.database, query, args, start, err)
 	}
 	if err != nil {
-		return nil, driverError(c.log, err)
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
 	var result protocol.Result
 	result, err = protocol.DecodeResult(&c.response)
 	if err != nil {
-		return nil, driverError(c.log, err)
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
 	return &Result{result: result}, nil
@@ -443,31 +1101,55 @@ func (c *Conn) Query(query string, args []driver.Value) (driver.Rows, error) {
 func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
 	ctx, span := tracing.Start(ctx, "dqlite.driver.QueryContext", query)
 	defer span.End()
+	traceNode(span, c.protocol)
+
+	if isAttach(query) {
+		return nil, ErrAttachNotSupported
+	}
+
+	// The context must outlive this call, since it's used by the returned
+	// Rows object, so it gets cancelled only on failure or by Rows.Close().
+	ctx, cancel := withQueryTimeout(ctx, c.queryTimeout)
+
+	sql := query
+	if c.propagate {
+		sql = withTraceParent(span, query)
+	}
 
 	if int64(len(args)) > math.MaxUint32 {
+		cancel()
 		return nil, driverError(c.log, fmt.Errorf("too many parameters (%d)", len(args)))
 	} else if len(args) > math.MaxUint8 {
-		protocol.EncodeQuerySQLV1(&c.request, uint64(c.id), query, args)
+		protocol.EncodeQuerySQLV1(&c.request, uint64(c.id), sql, args)
 	} else {
-		protocol.EncodeQuerySQLV0(&c.request, uint64(c.id), query, args)
+		protocol.EncodeQuerySQLV0(&c.request, uint64(c.id), sql, args)
 	}
 
-	var start time.Time
-	if c.tracing != client.LogNone {
-		start = time.Now()
+	var labels []string
+	if c.profile {
+		labels = profilerLabels(c.database, query)
 	}
-	err := c.protocol.Call(ctx, &c.request, &c.response)
+
+	kind := classifyStatement(query)
+	start := time.Now()
+	err := c.active.call(ctx, labels, query, c.protocol, &c.request, &c.response)
+	c.stats.query(kind, time.Since(start))
 	if c.tracing != client.LogNone {
-		c.log(c.tracing, "%.3fs request query: %q", time.Since(start).Seconds(), query)
+		logRequest(c.log, c.tracing, "query", "%.3fs request query: %q", time.Since(start).Seconds(), query)
+	}
+	if c.audit != nil {
+		audit(ctx, c.audit, c.protocol, c.database, query, args, start, err)
 	}
 	if err != nil {
-		return nil, driverError(c.log, err)
+		cancel()
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
 	var rows protocol.Rows
 	rows, err = protocol.DecodeRows(&c.response)
 	if err != nil {
-		return nil, driverError(c.log, err)
+		cancel()
+		return nil, c.stats.driverError(c.log, c.protocol, err)
 	}
 
 	return &Rows{
@@ -477,6 +1159,10 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 		protocol: c.protocol,
 		rows:     rows,
 		log:      c.log,
+		cancel:   cancel,
+		stats:    c.stats,
+		format:   c.timeFormat,
+		location: c.timeLocation,
 	}, nil
 }
 
@@ -495,6 +1181,45 @@ func (c *Conn) Close() error {
 	return c.protocol.Close()
 }
 
+// Ping checks that the node this connection is connected to is alive and is
+// still the leader, returning driver.ErrBadConn if not.
+func (c *Conn) Ping(ctx context.Context) error {
+	protocol.EncodeLeader(&c.request)
+
+	if err := c.protocol.Call(ctx, &c.request, &c.response); err != nil {
+		return driverError(c.log, errors.Wrap(err, "failed to send Leader request"))
+	}
+
+	_, leader, err := protocol.DecodeNodeCompat(c.protocol, &c.response)
+	if err != nil {
+		return driverError(c.log, errors.Wrap(err, "failed to parse Node response"))
+	}
+
+	if _, address := c.protocol.Node(); address != "" && leader != address {
+		c.log(client.LogDebug, "leadership lost (leader is now %q)", leader)
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+// ResetSession is called by the sql package prior to executing a query on the
+// connection if the connection has been used before. If the driver was
+// created with WithIdlePing and the connection has been idle for too long, it
+// gets pinged and driver.ErrBadConn is returned if the ping fails.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if c.active.broken() || c.protocol.Broken() {
+		return driver.ErrBadConn
+	}
+	if c.idlePing == 0 || c.protocol.Idle() < c.idlePing {
+		return nil
+	}
+	if err := c.Ping(ctx); err != nil {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
 // BeginTx starts and returns a new transaction.  If the context is canceled by
 // the user the sql package will call Tx.Rollback before discarding and closing
 // the connection.
@@ -508,7 +1233,16 @@ func (c *Conn) Close() error {
 // true to either set the read-only transaction property if supported or return
 // an error if it is not supported.
 func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	// Count the transaction before checking whether transactions are
+	// paused, so that whoever paused them and waits for the count to drop
+	// to zero can't miss it.
+	atomic.AddInt64(&c.stats.transactions, 1)
+	if atomic.LoadInt32(c.paused) != 0 {
+		atomic.AddInt64(&c.stats.transactions, -1)
+		return nil, ErrTransactionsPaused
+	}
 	if _, err := c.ExecContext(ctx, "BEGIN", nil); err != nil {
+		atomic.AddInt64(&c.stats.transactions, -1)
 		return nil, err
 	}
 
@@ -544,6 +1278,7 @@ type Tx struct {
 // Commit the transaction.
 func (tx *Tx) Commit() error {
 	ctx := context.Background()
+	defer atomic.AddInt64(&tx.conn.stats.transactions, -1)
 
 	if _, err := tx.conn.ExecContext(ctx, "COMMIT", nil); err != nil {
 		return driverError(tx.log, err)
@@ -555,6 +1290,7 @@ func (tx *Tx) Commit() error {
 // Rollback the transaction.
 func (tx *Tx) Rollback() error {
 	ctx := context.Background()
+	defer atomic.AddInt64(&tx.conn.stats.transactions, -1)
 
 	if _, err := tx.conn.ExecContext(ctx, "ROLLBACK", nil); err != nil {
 		return driverError(tx.log, err)
@@ -566,15 +1302,24 @@ func (tx *Tx) Rollback() error {
 // Stmt is a prepared statement. It is bound to a Conn and not
 // used by multiple goroutines concurrently.
 type Stmt struct {
-	protocol *protocol.Protocol
-	request  *protocol.Message
-	response *protocol.Message
-	db       uint32
-	id       uint32
-	params   uint64
-	log      client.LogFunc
-	sql      string // Prepared SQL, only set when tracing
-	tracing  client.LogLevel
+	protocol     *protocol.Protocol
+	request      *protocol.Message
+	response     *protocol.Message
+	db           uint32
+	id           uint32
+	params       uint64
+	log          client.LogFunc
+	sql          string // Prepared SQL
+	tracing      client.LogLevel
+	queryTimeout time.Duration
+	stats        *stats
+	timeFormat   TimeFormat
+	timeLocation *time.Location
+	kind         StatementKind
+	labels       []string // pprof labels, if enabled.
+	audit        AuditSink
+	database     string
+	active       *activeConn
 }
 
 // Close closes the statement.
@@ -584,11 +1329,11 @@ func (s *Stmt) Close() error {
 	ctx := context.Background()
 
 	if err := s.protocol.Call(ctx, s.request, s.response); err != nil {
-		return driverError(s.log, err)
+		return s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	if err := protocol.DecodeEmpty(s.response); err != nil {
-		return driverError(s.log, err)
+		return s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	return nil
@@ -606,6 +1351,10 @@ func (s *Stmt) NumInput() int {
 func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	ctx, span := tracing.Start(ctx, "dqlite.driver.Stmt.ExecContext", s.sql)
 	defer span.End()
+	traceNode(span, s.protocol)
+
+	ctx, cancel := withQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
 
 	if int64(len(args)) > math.MaxUint32 {
 		return nil, driverError(s.log, fmt.Errorf("too many parameters (%d)", len(args)))
@@ -615,22 +1364,23 @@ func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 		protocol.EncodeExecV0(s.request, s.db, s.id, args)
 	}
 
-	var start time.Time
+	start := time.Now()
+	err := s.active.call(ctx, s.labels, s.sql, s.protocol, s.request, s.response)
+	s.stats.query(s.kind, time.Since(start))
 	if s.tracing != client.LogNone {
-		start = time.Now()
+		logRequest(s.log, s.tracing, "exec", "%.3fs request prepared: %q", time.Since(start).Seconds(), s.sql)
 	}
-	err := s.protocol.Call(ctx, s.request, s.response)
-	if s.tracing != client.LogNone {
-		s.log(s.tracing, "%.3fs request prepared: %q", time.Since(start).Seconds(), s.sql)
+	if s.audit != nil {
+		audit(ctx, s.audit, s.protocol, s.database, s.sql, args, start, err)
 	}
 	if err != nil {
-		return nil, driverError(s.log, err)
+		return nil, s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	var result protocol.Result
 	result, err = protocol.DecodeResult(s.response)
 	if err != nil {
-		return nil, driverError(s.log, err)
+		return nil, s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	return &Result{result: result}, nil
@@ -648,8 +1398,14 @@ func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
 func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
 	ctx, span := tracing.Start(ctx, "dqlite.driver.Stmt.QueryContext", s.sql)
 	defer span.End()
+	traceNode(span, s.protocol)
+
+	// The context must outlive this call, since it's used by the returned
+	// Rows object, so it gets cancelled only on failure or by Rows.Close().
+	ctx, cancel := withQueryTimeout(ctx, s.queryTimeout)
 
 	if int64(len(args)) > math.MaxUint32 {
+		cancel()
 		return nil, driverError(s.log, fmt.Errorf("too many parameters (%d)", len(args)))
 	} else if len(args) > math.MaxUint8 {
 		protocol.EncodeQueryV1(s.request, s.db, s.id, args)
@@ -657,22 +1413,25 @@ func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 		protocol.EncodeQueryV0(s.request, s.db, s.id, args)
 	}
 
-	var start time.Time
+	start := time.Now()
+	err := s.active.call(ctx, s.labels, s.sql, s.protocol, s.request, s.response)
+	s.stats.query(s.kind, time.Since(start))
 	if s.tracing != client.LogNone {
-		start = time.Now()
+		logRequest(s.log, s.tracing, "query", "%.3fs request prepared: %q", time.Since(start).Seconds(), s.sql)
 	}
-	err := s.protocol.Call(ctx, s.request, s.response)
-	if s.tracing != client.LogNone {
-		s.log(s.tracing, "%.3fs request prepared: %q", time.Since(start).Seconds(), s.sql)
+	if s.audit != nil {
+		audit(ctx, s.audit, s.protocol, s.database, s.sql, args, start, err)
 	}
 	if err != nil {
-		return nil, driverError(s.log, err)
+		cancel()
+		return nil, s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	var rows protocol.Rows
 	rows, err = protocol.DecodeRows(s.response)
 	if err != nil {
-		return nil, driverError(s.log, err)
+		cancel()
+		return nil, s.stats.driverError(s.log, s.protocol, err)
 	}
 
 	return &Rows{
@@ -682,6 +1441,10 @@ func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 		protocol: s.protocol,
 		rows:     rows,
 		log:      s.log,
+		cancel:   cancel,
+		stats:    s.stats,
+		format:   s.timeFormat,
+		location: s.timeLocation,
 	}, nil
 }
 
@@ -718,6 +1481,10 @@ type Rows struct {
 	consumed bool
 	types    []string
 	log      client.LogFunc
+	cancel   context.CancelFunc // Releases the query timeout, if any
+	stats    *stats
+	format   TimeFormat     // Encoding of timestamps
+	location *time.Location // Location of decoded timestamps, if set
 }
 
 // Columns returns the names of the columns. The number of
@@ -730,6 +1497,8 @@ func (r *Rows) Columns() []string {
 
 // Close closes the rows iterator.
 func (r *Rows) Close() error {
+	defer r.cancel()
+
 	err := r.rows.Close()
 
 	// If we consumed the whole result set, there's nothing to do as
@@ -746,7 +1515,7 @@ func (r *Rows) Close() error {
 	// Let's issue an interrupt request and wait until we get an empty
 	// response, signalling that the query was interrupted.
 	if err := r.protocol.Interrupt(r.ctx, r.request, r.response); err != nil {
-		return driverError(r.log, err)
+		return r.stats.driverError(r.log, r.protocol, err)
 	}
 
 	return nil
@@ -758,22 +1527,35 @@ func (r *Rows) Close() error {
 //
 // Next should return io.EOF when there are no more rows.
 func (r *Rows) Next(dest []driver.Value) error {
-	err := r.rows.Next(dest)
+	err := r.rows.NextNoCopy(dest)
 
 	if err == protocol.ErrRowsPart {
 		r.rows.Close()
 		if err := r.protocol.More(r.ctx, r.response); err != nil {
-			return driverError(r.log, err)
+			return r.stats.driverError(r.log, r.protocol, err)
 		}
-		rows, err := protocol.DecodeRows(r.response)
-		if err != nil {
-			return driverError(r.log, err)
+		rows, decodeErr := protocol.DecodeRows(r.response)
+		if decodeErr != nil {
+			return r.stats.driverError(r.log, r.protocol, decodeErr)
 		}
 		r.rows = rows
-		return r.rows.Next(dest)
+		err = r.rows.NextNoCopy(dest)
 	}
 
-	if err == io.EOF {
+	switch err {
+	case nil:
+		atomic.AddInt64(&r.stats.rowsFetched, 1)
+		if r.format == TimeFormatJulianDay {
+			decodeJulianDays(dest, r.rows.RowTypes())
+		}
+		if r.location != nil {
+			for i, value := range dest {
+				if t, ok := value.(time.Time); ok {
+					dest[i] = t.In(r.location)
+				}
+			}
+		}
+	case io.EOF:
 		r.consumed = true
 	}
 
@@ -824,6 +1606,12 @@ func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
 	return namedValues
 }
 
+// Log a message about a request of the given type, attaching the type as a
+// field.
+func logRequest(log client.LogFunc, level client.LogLevel, request string, format string, a ...interface{}) {
+	logging.WithFields(log, logging.Field{Key: "request", Value: request})(level, format, a...)
+}
+
 type unwrappable interface {
 	Unwrap() error
 }
@@ -852,7 +1640,7 @@ func driverError(log client.LogFunc, err error) error {
 			fallthrough
 		case ErrIoErrLeadershipLost:
 			log(client.LogDebug, "leadership lost (%d - %s)", err.Code, err.Description)
-			return driver.ErrBadConn
+			return notLeaderError(ErrNotLeader{})
 		case errNotFound:
 			log(client.LogDebug, "not found - potentially after leadership loss (%d - %s)", err.Code, err.Description)
 			return driver.ErrBadConn
@@ -865,10 +1653,7 @@ func driverError(log client.LogFunc, err error) error {
 				log(client.LogWarn, "unexpected error code (%d - %s)", err.Code, err.Description)
 				return driver.ErrBadConn
 			}
-			return Error{
-				Code:    int(err.Code),
-				Message: err.Description,
-			}
+			return protocol.NewError(err.Code, err.Description)
 		}
 	default:
 		// When using a TLS connection, the underlying error might get
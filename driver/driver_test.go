@@ -17,11 +17,13 @@ package driver_test
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	dqlite "github.com/canonical/go-dqlite"
 	"github.com/canonical/go-dqlite/client"
@@ -648,7 +650,320 @@ func Test_DescribeLastEntry(t *testing.T) {
 	assert.Equal(t, info.Term, uint64(1))
 }
 
-func newDriver(t *testing.T) (*dqlitedriver.Driver, func()) {
+func TestConn_QueryTimeout(t *testing.T) {
+	drv, cleanup := newDriver(t)
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.ExecerContext)
+
+	ctx := dqlitedriver.WithQueryTimeout(context.Background(), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	_, err = execer.ExecContext(ctx, "CREATE TABLE test (n INT)", nil)
+	assert.Error(t, err)
+
+	require.NoError(t, conn.Close())
+}
+
+func TestDriver_Stats(t *testing.T) {
+	drv, cleanup := newDriver(t)
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.Execer)
+
+	_, err = execer.Exec("CREATE TABLE test (n INT)", nil)
+	require.NoError(t, err)
+
+	_, err = execer.Exec("INSERT INTO test(n) VALUES(1)", nil)
+	require.NoError(t, err)
+
+	queryer := conn.(driver.Queryer)
+
+	rows, err := queryer.Query("SELECT n FROM test", nil)
+	require.NoError(t, err)
+
+	values := make([]driver.Value, 1)
+	require.NoError(t, rows.Next(values))
+	require.NoError(t, rows.Close())
+
+	stats := drv.Stats()
+	assert.Equal(t, int64(3), stats.Queries)
+	assert.Equal(t, int64(1), stats.RowsFetched)
+	assert.Equal(t, int64(1), stats.Connections)
+	assert.Equal(t, int64(0), stats.Reconnections)
+	assert.Equal(t, int64(0), stats.Retries)
+	assert.True(t, stats.AverageLatency > 0)
+	assert.Equal(t, int64(1), stats.Latencies[dqlitedriver.StatementDDL].Count)
+	assert.Equal(t, int64(1), stats.Latencies[dqlitedriver.StatementInsert].Count)
+	assert.Equal(t, int64(1), stats.Latencies[dqlitedriver.StatementSelect].Count)
+	assert.Equal(t, int64(0), stats.Latencies[dqlitedriver.StatementTxn].Count)
+
+	require.NoError(t, conn.Close())
+}
+
+func TestConn_TimeFormat(t *testing.T) {
+	drv, cleanup := newDriver(t,
+		dqlitedriver.WithTimeFormat(dqlitedriver.TimeFormatUnix),
+		dqlitedriver.WithTimeLocation(time.UTC))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.ExecerContext)
+	ctx := context.Background()
+
+	_, err = execer.ExecContext(ctx, "CREATE TABLE test (t DATETIME)", nil)
+	require.NoError(t, err)
+
+	now := time.Unix(time.Now().Unix(), 0)
+	arg := driver.NamedValue{Ordinal: 1, Value: now}
+	require.NoError(t, conn.(driver.NamedValueChecker).CheckNamedValue(&arg))
+	assert.Equal(t, now.Unix(), arg.Value)
+
+	_, err = execer.ExecContext(ctx, "INSERT INTO test(t) VALUES(?)", []driver.NamedValue{arg})
+	require.NoError(t, err)
+
+	rows, err := conn.(driver.Queryer).Query("SELECT t FROM test", nil)
+	require.NoError(t, err)
+
+	values := make([]driver.Value, 1)
+	require.NoError(t, rows.Next(values))
+	require.NoError(t, rows.Close())
+
+	decoded, ok := values[0].(time.Time)
+	require.True(t, ok)
+	assert.True(t, now.Equal(decoded))
+	assert.Equal(t, time.UTC, decoded.Location())
+
+	require.NoError(t, conn.Close())
+}
+
+func TestConn_MaxDatabaseSize(t *testing.T) {
+	drv, cleanup := newDriver(t, dqlitedriver.WithMaxDatabaseSize(4*4096))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	// Setting the limit doesn't count as a query.
+	assert.Equal(t, int64(0), drv.Stats().Queries)
+
+	execer := conn.(driver.ExecerContext)
+	ctx := context.Background()
+
+	_, err = execer.ExecContext(ctx, "CREATE TABLE test (data BLOB)", nil)
+	require.NoError(t, err)
+
+	arg := driver.NamedValue{Ordinal: 1, Value: make([]byte, 4096)}
+	for i := 0; i < 4; i++ {
+		_, err = execer.ExecContext(ctx, "INSERT INTO test(data) VALUES(?)", []driver.NamedValue{arg})
+		if err != nil {
+			break
+		}
+	}
+	require.Error(t, err)
+	dqliteErr, ok := err.(dqlitedriver.Error)
+	require.True(t, ok, "unexpected error %v", err)
+	assert.Equal(t, dqlitedriver.ErrFull, dqliteErr.Code)
+
+	require.NoError(t, conn.Close())
+}
+
+func TestConn_PragmaParams(t *testing.T) {
+	records := 0
+	sink := dqlitedriver.AuditFunc(func(ctx context.Context, record dqlitedriver.AuditRecord) {
+		records++
+	})
+	drv, cleanup := newDriver(t, dqlitedriver.WithAuditSink(sink))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db?_foreign_keys=on&_cache_size=-1000")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Setting the PRAGMAs is neither audited nor counted as a query.
+	assert.Equal(t, 0, records)
+	assert.Equal(t, int64(0), drv.Stats().Queries)
+
+	queryer := conn.(driver.QueryerContext)
+	values := make([]driver.Value, 1)
+
+	rows, err := queryer.QueryContext(context.Background(), "PRAGMA foreign_keys", nil)
+	require.NoError(t, err)
+	require.NoError(t, rows.Next(values))
+	require.NoError(t, rows.Close())
+	assert.Equal(t, int64(1), values[0])
+
+	rows, err = queryer.QueryContext(context.Background(), "PRAGMA cache_size", nil)
+	require.NoError(t, err)
+	require.NoError(t, rows.Next(values))
+	require.NoError(t, rows.Close())
+	assert.Equal(t, int64(-1000), values[0])
+}
+
+func TestDriver_OpenInvalidPragmaParams(t *testing.T) {
+	drv, err := dqlitedriver.New(client.NewInmemNodeStore())
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"test.db?_foreign_keys=on;DROP TABLE x",
+		"test.db?_foreign%20keys=on",
+		"test.db?_cache_size=",
+	} {
+		_, err := drv.OpenConnector(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDriver_Interrupt(t *testing.T) {
+	drv, cleanup := newDriver(t)
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	// A query that runs for a long time before returning its only row.
+	query := `
+WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM c WHERE n < 1000000000)
+SELECT COUNT(*) FROM c`
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := conn.(driver.QueryerContext).QueryContext(context.Background(), query, nil)
+		errs <- err
+	}()
+
+	var statements []dqlitedriver.ActiveStatement
+	for i := 0; i < 100 && len(statements) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		statements = drv.ActiveStatements()
+	}
+	require.Len(t, statements, 1)
+	assert.Equal(t, "test.db", statements[0].Database)
+	assert.Equal(t, dqlitedriver.QueryDigest(query), statements[0].Digest)
+
+	require.NoError(t, drv.Interrupt(statements[0].ID))
+	assert.Equal(t, dqlitedriver.ErrInterrupted, <-errs)
+	assert.Empty(t, drv.ActiveStatements())
+	assert.Error(t, drv.Interrupt(statements[0].ID))
+
+	assert.Equal(t, driver.ErrBadConn, conn.(driver.SessionResetter).ResetSession(context.Background()))
+	conn.Close()
+}
+
+func TestConn_Ping(t *testing.T) {
+	drv, cleanup := newDriver(t)
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	pinger := conn.(driver.Pinger)
+	require.NoError(t, pinger.Ping(context.Background()))
+
+	require.NoError(t, conn.Close())
+}
+
+func TestConn_IdlePing(t *testing.T) {
+	drv, cleanup := newDriver(t, dqlitedriver.WithIdlePing(time.Millisecond))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	resetter := conn.(driver.SessionResetter)
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, resetter.ResetSession(context.Background()))
+
+	require.NoError(t, conn.Close())
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, driver.ErrBadConn, resetter.ResetSession(context.Background()))
+}
+
+func TestDriver_Audit(t *testing.T) {
+	records := []dqlitedriver.AuditRecord{}
+	sink := dqlitedriver.AuditFunc(func(ctx context.Context, record dqlitedriver.AuditRecord) {
+		records = append(records, record)
+	})
+	drv, cleanup := newDriver(t, dqlitedriver.WithAuditSink(sink))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.ExecerContext)
+	ctx := dqlitedriver.WithAuditIdentity(context.Background(), "alice")
+
+	_, err = execer.ExecContext(ctx, "CREATE TABLE test (n INT)", nil)
+	require.NoError(t, err)
+
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}
+	_, err = execer.ExecContext(ctx, "INSERT INTO test(n) VALUES(?)", args)
+	require.NoError(t, err)
+
+	rows, err := conn.(driver.QueryerContext).QueryContext(ctx, "SELECT n FROM test", nil)
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+
+	require.Len(t, records, 2)
+	assert.Equal(t, dqlitedriver.StatementDDL, records[0].Kind)
+	assert.Equal(t, "INSERT INTO test(n) VALUES(?)", records[1].Statement)
+	assert.Equal(t, "alice", records[1].Identity)
+	assert.Equal(t, "test.db", records[1].Database)
+	assert.Equal(t, "@1", records[1].Node)
+	assert.Len(t, records[1].Digest, 64)
+	assert.NoError(t, records[1].Err)
+
+	require.NoError(t, conn.Close())
+}
+
+// Writes are audited even when they follow a read-only statement or a common
+// table expression.
+func TestDriver_AuditHiddenWrites(t *testing.T) {
+	records := []dqlitedriver.AuditRecord{}
+	sink := dqlitedriver.AuditFunc(func(ctx context.Context, record dqlitedriver.AuditRecord) {
+		records = append(records, record)
+	})
+	drv, cleanup := newDriver(t, dqlitedriver.WithAuditSink(sink))
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.ExecerContext)
+	_, err = execer.ExecContext(context.Background(), "CREATE TABLE test (n INT)", nil)
+	require.NoError(t, err)
+
+	queries := []string{
+		"WITH x AS (SELECT 1) DELETE FROM test",
+		"SELECT 1; DELETE FROM test",
+		"BEGIN; INSERT INTO test(n) VALUES(1); COMMIT",
+	}
+	for _, query := range queries {
+		_, err = execer.ExecContext(context.Background(), query, nil)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, records, 4)
+	for i, query := range queries {
+		assert.Equal(t, query, records[i+1].Statement)
+	}
+	assert.Equal(t, dqlitedriver.StatementDelete, records[1].Kind)
+	assert.Equal(t, dqlitedriver.StatementDelete, records[2].Kind)
+	assert.Equal(t, dqlitedriver.StatementInsert, records[3].Kind)
+
+	require.NoError(t, conn.Close())
+}
+
+func newDriver(t *testing.T, options ...dqlitedriver.Option) (*dqlitedriver.Driver, func()) {
 	t.Helper()
 
 	dir, dirCleanup := newDir(t)
@@ -658,7 +973,8 @@ func newDriver(t *testing.T) (*dqlitedriver.Driver, func()) {
 
 	log := logging.Test(t)
 
-	driver, err := dqlitedriver.New(store, dqlitedriver.WithLogFunc(log))
+	options = append([]dqlitedriver.Option{dqlitedriver.WithLogFunc(log)}, options...)
+	driver, err := dqlitedriver.New(store, options...)
 	require.NoError(t, err)
 
 	cleanup := func() {
@@ -714,3 +1030,30 @@ func newDir(t *testing.T) (string, func()) {
 
 	return dir, cleanup
 }
+
+// ATTACH and DETACH are rejected wherever they appear in the SQL text, but
+// not when they're only mentioned in literals or comments.
+func TestConn_Attach(t *testing.T) {
+	drv, cleanup := newDriver(t)
+	defer cleanup()
+
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+
+	execer := conn.(driver.ExecerContext)
+
+	for _, query := range []string{
+		"ATTACH DATABASE 'other' AS other",
+		"SELECT 1; ATTACH DATABASE 'other' AS other",
+		"SELECT ';'; /* ; */ DETACH DATABASE other",
+		"CREATE TABLE test (n INT);\n-- comment\nattach 'other' AS other",
+	} {
+		_, err = execer.ExecContext(context.Background(), query, nil)
+		assert.True(t, errors.Is(err, dqlitedriver.ErrAttachNotSupported), query)
+	}
+
+	_, err = execer.ExecContext(context.Background(), "CREATE TABLE test (s TEXT); INSERT INTO test VALUES('; ATTACH') -- ; DETACH", nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, conn.Close())
+}
@@ -3,6 +3,7 @@ package driver_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -95,10 +96,14 @@ func TestIntegration_ConstraintError(t *testing.T) {
 	_, err = db.Exec("INSERT INTO test (n) VALUES (1)")
 	if err, ok := err.(driver.Error); ok {
 		assert.Equal(t, SQLITE_CONSTRAINT_UNIQUE, err.Code)
+		assert.Equal(t, driver.ErrConstraint, err.PrimaryCode())
 		assert.Equal(t, "UNIQUE constraint failed: test.n", err.Message)
 	} else {
 		t.Fatalf("expected diver error, got %+v", err)
 	}
+	assert.True(t, errors.Is(err, driver.Error{Code: driver.ErrConstraint}))
+	assert.True(t, errors.Is(err, driver.Error{Code: SQLITE_CONSTRAINT_UNIQUE}))
+	assert.False(t, errors.Is(err, driver.Error{Code: driver.ErrBusy}))
 }
 
 func TestIntegration_ExecBindError(t *testing.T) {
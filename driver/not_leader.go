@@ -0,0 +1,10 @@
+//go:build go1.18
+// +build go1.18
+
+package driver
+
+// Return the error to use when leadership is lost. Since Go 1.18 database/sql
+// checks for driver.ErrBadConn with errors.Is, which ErrNotLeader matches.
+func notLeaderError(err ErrNotLeader) error {
+	return err
+}
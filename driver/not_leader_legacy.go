@@ -0,0 +1,12 @@
+//go:build !go1.18
+// +build !go1.18
+
+package driver
+
+import "database/sql/driver"
+
+// Return the error to use when leadership is lost. Before Go 1.18
+// database/sql compares errors with driver.ErrBadConn directly.
+func notLeaderError(err ErrNotLeader) error {
+	return driver.ErrBadConn
+}
@@ -0,0 +1,51 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/pprof"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// Keys of the pprof labels set when WithProfilerLabels is used.
+const (
+	ProfilerLabelDatabase = "dqlite_db"
+	ProfilerLabelQuery    = "dqlite_query"
+)
+
+// QueryDigest returns the digest of the given statement text, as used for the
+// ProfilerLabelQuery pprof label.
+func QueryDigest(query string) string {
+	h := fnv.New64a()
+	h.Write([]byte(query))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Return the pprof labels identifying the given query against the given
+// database.
+func profilerLabels(database, query string) []string {
+	return []string{ProfilerLabelDatabase, database, ProfilerLabelQuery, QueryDigest(query)}
+}
+
+// Perform the given RPC, setting the given pprof labels on the calling
+// goroutine for its duration, unless they are nil.
+func callWithLabels(ctx context.Context, labels []string, p *protocol.Protocol, request, response *protocol.Message) error {
+	return doWithLabels(ctx, labels, func(ctx context.Context) error {
+		return p.Call(ctx, request, response)
+	})
+}
+
+// Call the given function, setting the given pprof labels on the calling
+// goroutine and on the context passed to the function, unless they are nil.
+func doWithLabels(ctx context.Context, labels []string, f func(context.Context) error) error {
+	if labels == nil {
+		return f(ctx)
+	}
+	var err error
+	pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+		err = f(ctx)
+	})
+	return err
+}
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryDigest(t *testing.T) {
+	assert.Equal(t, "cbf29ce484222325", QueryDigest("")) // FNV-1a offset basis.
+	assert.Equal(t, QueryDigest("SELECT 1"), QueryDigest("SELECT 1"))
+	assert.NotEqual(t, QueryDigest("SELECT 1"), QueryDigest("SELECT 2"))
+	assert.Len(t, QueryDigest("SELECT 1"), 16)
+}
+
+func TestDoWithLabels(t *testing.T) {
+	labels := profilerLabels("test.db", "SELECT 1")
+	err := doWithLabels(context.Background(), labels, func(ctx context.Context) error {
+		database, _ := pprof.Label(ctx, ProfilerLabelDatabase)
+		assert.Equal(t, "test.db", database)
+		query, _ := pprof.Label(ctx, ProfilerLabelQuery)
+		assert.Equal(t, QueryDigest("SELECT 1"), query)
+		return errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+}
+
+// No labels are set when profiling is disabled.
+func TestDoWithLabels_Disabled(t *testing.T) {
+	err := doWithLabels(context.Background(), nil, func(ctx context.Context) error {
+		_, ok := pprof.Label(ctx, ProfilerLabelDatabase)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,212 @@
+package driver
+
+import (
+	"strings"
+	"unicode"
+)
+
+// StatementKind classifies SQL statements by their effect, in order to break
+// down driver statistics.
+type StatementKind int
+
+// Available statement kinds.
+const (
+	StatementOther  StatementKind = iota // Anything else, e.g. PRAGMA or VACUUM.
+	StatementSelect                      // SELECT and VALUES, possibly preceded by WITH.
+	StatementInsert                      // INSERT and REPLACE.
+	StatementUpdate                      // UPDATE.
+	StatementDelete                      // DELETE.
+	StatementDDL                         // CREATE, DROP and ALTER.
+	StatementTxn                         // Transaction control, e.g. BEGIN or COMMIT.
+
+	statementKinds = iota
+)
+
+func (k StatementKind) String() string {
+	switch k {
+	case StatementSelect:
+		return "select"
+	case StatementInsert:
+		return "insert"
+	case StatementUpdate:
+		return "update"
+	case StatementDelete:
+		return "delete"
+	case StatementDDL:
+		return "ddl"
+	case StatementTxn:
+		return "txn"
+	default:
+		return "other"
+	}
+}
+
+// Return the kind of the given statement, based on its first keyword, or on
+// its main verb for statements starting with common table expressions. In
+// case of multiple statements, only the first one is considered.
+func classifyStatement(query string) StatementKind {
+	keyword := strings.ToUpper(firstKeyword(query))
+	if keyword == "WITH" {
+		keyword = withVerb(splitStatements(query)[0])
+	}
+	switch keyword {
+	case "SELECT", "VALUES":
+		return StatementSelect
+	case "INSERT", "REPLACE":
+		return StatementInsert
+	case "UPDATE":
+		return StatementUpdate
+	case "DELETE":
+		return StatementDelete
+	case "CREATE", "DROP", "ALTER":
+		return StatementDDL
+	case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return StatementTxn
+	default:
+		return StatementOther
+	}
+}
+
+// Return the kind of the first of the given statements that may modify the
+// database, that is whose kind is not StatementSelect or StatementTxn, and
+// false if they are all read-only.
+func writeKind(query string) (StatementKind, bool) {
+	for _, stmt := range splitStatements(query) {
+		if firstKeyword(stmt) == "" {
+			continue // Empty statement or only comments.
+		}
+		switch kind := classifyStatement(stmt); kind {
+		case StatementSelect, StatementTxn:
+		default:
+			return kind, true
+		}
+	}
+	return StatementOther, false
+}
+
+// Return the main verb of the given statement starting with WITH, which is
+// the first verb found outside of parentheses, since common table expressions
+// are parenthesized. It returns an empty string if there's none.
+func withVerb(stmt string) string {
+	depth := 0
+	for i := 0; i < len(stmt); {
+		if j := skipQuoted(stmt, i); j > i {
+			i = j
+			continue
+		}
+		switch c := stmt[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case isWordByte(c):
+			j := i
+			for j < len(stmt) && isWordByte(stmt[j]) {
+				j++
+			}
+			if depth == 0 {
+				switch word := strings.ToUpper(stmt[i:j]); word {
+				case "SELECT", "VALUES", "INSERT", "REPLACE", "UPDATE", "DELETE":
+					return word
+				}
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	return ""
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Return whether any of the given statements attaches or detaches a database.
+func isAttach(query string) bool {
+	for _, stmt := range splitStatements(query) {
+		switch strings.ToUpper(firstKeyword(stmt)) {
+		case "ATTACH", "DETACH":
+			return true
+		}
+	}
+	return false
+}
+
+// Split the given query into its statements, at semicolons that are not part
+// of a string literal, quoted identifier or comment.
+func splitStatements(query string) []string {
+	stmts := []string{}
+	start := 0
+	for i := 0; i < len(query); {
+		if j := skipQuoted(query, i); j > i {
+			i = j
+			continue
+		}
+		if query[i] == ';' {
+			stmts = append(stmts, query[start:i])
+			start = i + 1
+		}
+		i++
+	}
+	if start < len(query) || len(stmts) == 0 {
+		stmts = append(stmts, query[start:])
+	}
+	return stmts
+}
+
+// Return the index following the string literal, quoted identifier or comment
+// starting at the given index of the query, or the index itself if there's
+// none there. Unterminated ones extend to the end of the query.
+func skipQuoted(query string, i int) int {
+	var start int
+	var end string
+	switch c := query[i]; {
+	case c == '\'' || c == '"' || c == '`':
+		start, end = i+1, query[i:i+1]
+	case c == '[':
+		start, end = i+1, "]"
+	case strings.HasPrefix(query[i:], "--"):
+		start, end = i+2, "\n"
+	case strings.HasPrefix(query[i:], "/*"):
+		start, end = i+2, "*/"
+	default:
+		return i
+	}
+	j := strings.Index(query[start:], end)
+	if j < 0 {
+		return len(query)
+	}
+	return start + j + len(end)
+}
+
+// Return the first word of the given query, skipping leading white space and
+// comments.
+func firstKeyword(query string) string {
+	for {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			i := strings.IndexByte(query, '\n')
+			if i < 0 {
+				return ""
+			}
+			query = query[i+1:]
+		case strings.HasPrefix(query, "/*"):
+			i := strings.Index(query, "*/")
+			if i < 0 {
+				return ""
+			}
+			query = query[i+2:]
+		default:
+			end := strings.IndexFunc(query, func(r rune) bool {
+				return !unicode.IsLetter(r)
+			})
+			if end < 0 {
+				return query
+			}
+			return query[:end]
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	cases := []struct {
+		query string
+		kind  StatementKind
+	}{
+		{"SELECT 1", StatementSelect},
+		{"  select 1", StatementSelect},
+		{"VALUES(1)", StatementSelect},
+		{"INSERT INTO test VALUES(1)", StatementInsert},
+		{"REPLACE INTO test VALUES(1)", StatementInsert},
+		{"UPDATE test SET n = 1", StatementUpdate},
+		{"DELETE FROM test", StatementDelete},
+		{"CREATE TABLE test (n INT)", StatementDDL},
+		{"DROP TABLE test", StatementDDL},
+		{"ALTER TABLE test ADD COLUMN m INT", StatementDDL},
+		{"BEGIN", StatementTxn},
+		{"COMMIT", StatementTxn},
+		{"ROLLBACK TO foo", StatementTxn},
+		{"SAVEPOINT foo", StatementTxn},
+		{"PRAGMA foreign_keys = ON", StatementOther},
+		{"", StatementOther},
+		{"-- comment\nDELETE FROM test", StatementDelete},
+		{"/* INSERT */ SELECT 1", StatementSelect},
+		{"/* unterminated", StatementOther},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", StatementSelect},
+		{"WITH x AS (SELECT 1) DELETE FROM test", StatementDelete},
+		{"WITH x AS (SELECT ')') UPDATE test SET n = 1", StatementUpdate},
+		{"WITH RECURSIVE x(n) AS (VALUES(1) UNION SELECT n+1 FROM x) INSERT INTO test SELECT n FROM x", StatementInsert},
+		{"SELECT 1; DELETE FROM test", StatementSelect},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			assert.Equal(t, c.kind, classifyStatement(c.query))
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		query string
+		stmts []string
+	}{
+		{"", []string{""}},
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1;", []string{"SELECT 1"}},
+		{"SELECT 1; SELECT 2", []string{"SELECT 1", " SELECT 2"}},
+		{"SELECT ';'; SELECT 2", []string{"SELECT ';'", " SELECT 2"}},
+		{"SELECT 'it''s;'; SELECT 2", []string{"SELECT 'it''s;'", " SELECT 2"}},
+		{`SELECT "a;b", [c;d], ` + "`e;f`" + `; SELECT 2`, []string{`SELECT "a;b", [c;d], ` + "`e;f`", " SELECT 2"}},
+		{"SELECT 1 -- ;\n; SELECT 2", []string{"SELECT 1 -- ;\n", " SELECT 2"}},
+		{"SELECT 1 /* ; */; SELECT 2", []string{"SELECT 1 /* ; */", " SELECT 2"}},
+		{"SELECT 'unterminated;", []string{"SELECT 'unterminated;"}},
+		{"SELECT 1 -- ;", []string{"SELECT 1 -- ;"}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			assert.Equal(t, c.stmts, splitStatements(c.query))
+		})
+	}
+}
+
+func TestFirstKeyword(t *testing.T) {
+	cases := []struct {
+		query   string
+		keyword string
+	}{
+		{"SELECT 1", "SELECT"},
+		{"\t\n select(1)", "select"},
+		{"-- comment\nINSERT INTO test", "INSERT"},
+		{"/* comment */ /* another */UPDATE test", "UPDATE"},
+		{"-- only a comment", ""},
+		{"/* unterminated SELECT", ""},
+		{"   ", ""},
+		{"PRAGMA", "PRAGMA"},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			assert.Equal(t, c.keyword, firstKeyword(c.query))
+		})
+	}
+}
+
+func TestWriteKind(t *testing.T) {
+	cases := []struct {
+		query string
+		kind  StatementKind
+		write bool
+	}{
+		{"SELECT * FROM test", StatementOther, false},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", StatementOther, false},
+		{"BEGIN; SELECT 1; COMMIT", StatementOther, false},
+		{"SELECT ';DELETE FROM test'", StatementOther, false},
+		{"SELECT 1; -- DELETE FROM test", StatementOther, false},
+		{"INSERT INTO test VALUES(1)", StatementInsert, true},
+		{"WITH x AS (SELECT 1) DELETE FROM test", StatementDelete, true},
+		{"WITH x(n) AS (VALUES(1)) INSERT INTO test SELECT n FROM x", StatementInsert, true},
+		{"WITH \"select\" AS (SELECT 1) UPDATE test SET n = 1", StatementUpdate, true},
+		{"SELECT 1; DELETE FROM test", StatementDelete, true},
+		{"BEGIN; INSERT INTO test VALUES(1); COMMIT", StatementInsert, true},
+		{"SELECT 1; /* ; */ PRAGMA foo = 1", StatementOther, true},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			kind, write := writeKind(c.query)
+			assert.Equal(t, c.write, write)
+			assert.Equal(t, c.kind, kind)
+		})
+	}
+}
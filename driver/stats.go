@@ -0,0 +1,180 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// Stats holds counters about the activity of a Driver.
+type Stats struct {
+	Queries        int64         // Number of statements executed.
+	RowsFetched    int64         // Number of rows fetched from query results.
+	Retries        int64         // Number of retried attempts to find the leader.
+	Connections    int64         // Number of connections established with the leader.
+	Reconnections  int64         // Number of connections dropped because of network errors or leadership loss.
+	Transactions   int64         // Number of transactions currently in progress.
+	AverageLatency time.Duration // Average round-trip time of executed statements.
+
+	// Distribution of round-trip times of executed statements, by kind.
+	Latencies map[StatementKind]Histogram
+}
+
+// LatencyBuckets are the upper bounds of the buckets of latency histograms.
+var LatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram holds the distribution of statement round-trip times.
+type Histogram struct {
+	Count int64         // Number of observed statements.
+	Sum   time.Duration // Total round-trip time of observed statements.
+
+	// Number of statements whose round-trip time falls in each bucket.
+	// Buckets[i] counts latencies greater than LatencyBuckets[i-1] and less
+	// than or equal to LatencyBuckets[i], while the last element counts
+	// latencies greater than the last bound.
+	Buckets []int64
+}
+
+// Counters updated by connections, statements and rows of a driver. Fields
+// must be accessed atomically and are kept at the top of the struct in order
+// to be 64-bit aligned.
+type stats struct {
+	queries       int64
+	rowsFetched   int64
+	retries       int64
+	connections   int64
+	reconnections int64
+	latency       int64 // Total latency of executed statements, in nanoseconds.
+	transactions  int64 // Transactions in progress.
+	histograms    [statementKinds]histogram
+
+	observer Observer // Optional observer, set once at creation time.
+}
+
+// Latency histogram of a single statement kind, with atomically accessed
+// fields.
+type histogram struct {
+	count   int64
+	sum     int64 // In nanoseconds.
+	buckets [len(LatencyBuckets) + 1]int64
+}
+
+// Record the given latency.
+func (h *histogram) observe(latency time.Duration) {
+	i := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return latency <= LatencyBuckets[i]
+	})
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(latency))
+	atomic.AddInt64(&h.buckets[i], 1)
+}
+
+// Return a snapshot of the histogram.
+func (h *histogram) snapshot() Histogram {
+	histogram := Histogram{
+		Count:   atomic.LoadInt64(&h.count),
+		Sum:     time.Duration(atomic.LoadInt64(&h.sum)),
+		Buckets: make([]int64, len(h.buckets)),
+	}
+	for i := range h.buckets {
+		histogram.Buckets[i] = atomic.LoadInt64(&h.buckets[i])
+	}
+	return histogram
+}
+
+// Observer is notified about the activity of a Driver, for example in order
+// to export metrics. Its methods are called synchronously and must not block.
+type Observer interface {
+	// ObserveQuery is called after each statement is executed, with its
+	// kind and round-trip time.
+	ObserveQuery(kind StatementKind, latency time.Duration)
+
+	// ObserveError is called with each error returned by the driver. The
+	// error is either driver.ErrBadConn or an Error carrying a SQLite
+	// error code.
+	ObserveError(err error)
+
+	// ObserveConnection is called each time a connection with the leader
+	// is established.
+	ObserveConnection()
+}
+
+// Record the execution of a statement of the given kind with the given
+// round-trip time.
+func (s *stats) query(kind StatementKind, latency time.Duration) {
+	atomic.AddInt64(&s.queries, 1)
+	atomic.AddInt64(&s.latency, int64(latency))
+	s.histograms[kind].observe(latency)
+	if s.observer != nil {
+		s.observer.ObserveQuery(kind, latency)
+	}
+}
+
+// Record a new connection with the leader.
+func (s *stats) connected() {
+	atomic.AddInt64(&s.connections, 1)
+	if s.observer != nil {
+		s.observer.ObserveConnection()
+	}
+}
+
+// Convert the given error, returned by a request sent over the given
+// protocol, using driverError and count the connection as lost if it's no
+// longer usable.
+//
+// If the node is not the leader anymore, the next connection attempt is made
+// to start by asking it who the current leader is. Nothing is sent to the
+// node here, so that the error is returned right away.
+func (s *stats) driverError(log client.LogFunc, p *protocol.Protocol, err error) error {
+	if e, ok := errors.Cause(err).(protocol.ErrRequest); ok && e.NotLeader() {
+		log(client.LogDebug, "leadership lost (%d - %s)", e.Code, e.Description)
+		err = notLeaderError(ErrNotLeader{LeaderAddress: p.LostLeadership()})
+	} else {
+		err = driverError(log, err)
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		atomic.AddInt64(&s.reconnections, 1)
+	}
+	if s.observer != nil {
+		s.observer.ObserveError(err)
+	}
+	return err
+}
+
+// Return a snapshot of the current counters.
+func (s *stats) snapshot() Stats {
+	stats := Stats{
+		Queries:       atomic.LoadInt64(&s.queries),
+		RowsFetched:   atomic.LoadInt64(&s.rowsFetched),
+		Retries:       atomic.LoadInt64(&s.retries),
+		Connections:   atomic.LoadInt64(&s.connections),
+		Reconnections: atomic.LoadInt64(&s.reconnections),
+		Transactions:  atomic.LoadInt64(&s.transactions),
+		Latencies:     make(map[StatementKind]Histogram, statementKinds),
+	}
+	for kind := range s.histograms {
+		stats.Latencies[StatementKind(kind)] = s.histograms[kind].snapshot()
+	}
+	if stats.Queries > 0 {
+		stats.AverageLatency = time.Duration(atomic.LoadInt64(&s.latency) / stats.Queries)
+	}
+	return stats
+}
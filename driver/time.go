@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"math"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// TimeFormat controls how time.Time statement parameters are stored.
+type TimeFormat int
+
+// Available time formats.
+const (
+	// TimeFormatISO8601 stores timestamps as text in the
+	// "2006-01-02 15:04:05.999999999-07:00" format. This is the default.
+	TimeFormatISO8601 TimeFormat = iota
+
+	// TimeFormatRFC3339 stores timestamps as RFC 3339 text, with
+	// nanoseconds precision.
+	TimeFormatRFC3339
+
+	// TimeFormatUnix stores timestamps as the integer number of seconds
+	// elapsed since the Unix epoch.
+	TimeFormatUnix
+
+	// TimeFormatJulianDay stores timestamps as a floating point Julian day
+	// number, as returned by SQLite's julianday() function.
+	TimeFormatJulianDay
+)
+
+// Julian day number of the Unix epoch.
+const julianDayUnixEpoch = 2440587.5
+
+// Number of seconds in a Julian day.
+const secondsPerDay = 24 * 60 * 60
+
+// Encode the given timestamp according to the given format. Values stored as
+// ISO8601 are left untouched, since that's the native encoding of the wire
+// protocol.
+func encodeTime(t time.Time, format TimeFormat) driver.Value {
+	switch format {
+	case TimeFormatRFC3339:
+		return t.Format(time.RFC3339Nano)
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatJulianDay:
+		// Use seconds and nanoseconds separately, since UnixNano overflows
+		// for dates outside of years 1678 to 2262.
+		seconds := float64(t.Unix()) + float64(t.Nanosecond())/1e9
+		return seconds/secondsPerDay + julianDayUnixEpoch
+	default:
+		return t
+	}
+}
+
+// Convert the given Julian day number to a timestamp in UTC, rounded to the
+// millisecond, which is the precision of SQLite's date and time functions.
+func julianDayToTime(day float64) time.Time {
+	ms := int64(math.Round((day - julianDayUnixEpoch) * secondsPerDay * 1000))
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+}
+
+// Decode the Julian day numbers found in timestamp columns of the given row,
+// whose value types are given. Integer values are sent as Unix times, and
+// already decoded as such, while fractional ones are sent as text and decoded
+// as float64.
+func decodeJulianDays(dest []driver.Value, types []uint8) {
+	for i, value := range dest {
+		switch types[i] {
+		case protocol.UnixTime:
+			if t, ok := value.(time.Time); ok {
+				dest[i] = julianDayToTime(float64(t.Unix()))
+			}
+		case protocol.ISO8601:
+			if day, ok := value.(float64); ok {
+				dest[i] = julianDayToTime(day)
+			}
+		}
+	}
+}
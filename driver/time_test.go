@@ -0,0 +1,55 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+var julianDayCases = []struct {
+	time time.Time
+	day  float64
+}{
+	{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 2440587.5},
+	{time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC), 2451545.0},
+	{time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC), 2460385.25},
+	// Out of the range that UnixNano can represent.
+	{time.Date(1582, 10, 15, 0, 0, 0, 0, time.UTC), 2299160.5},
+	{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), 2816787.5},
+}
+
+func TestEncodeTime_JulianDay(t *testing.T) {
+	for _, c := range julianDayCases {
+		t.Run(c.time.String(), func(t *testing.T) {
+			day := encodeTime(c.time, TimeFormatJulianDay)
+			assert.InDelta(t, c.day, day, 1e-6)
+		})
+	}
+}
+
+func TestJulianDayToTime(t *testing.T) {
+	for _, c := range julianDayCases {
+		t.Run(c.time.String(), func(t *testing.T) {
+			assert.Equal(t, c.time, julianDayToTime(c.day))
+		})
+	}
+}
+
+// Integer day numbers arrive as Unix times and fractional ones as numbers
+// sent in place of ISO8601 text. Other values are left alone.
+func TestDecodeJulianDays(t *testing.T) {
+	dest := []driver.Value{time.Unix(2451545, 0), 2460385.25, 2460385.25, int64(2451545), "text", nil}
+	types := []uint8{protocol.UnixTime, protocol.ISO8601, protocol.Float, protocol.Integer, protocol.ISO8601, protocol.ISO8601}
+	decodeJulianDays(dest, types)
+	assert.Equal(t, []driver.Value{
+		time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC),
+		2460385.25,
+		int64(2451545),
+		"text",
+		nil,
+	}, dest)
+}
@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/canonical/go-dqlite/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+// Span propagating a fixed trace context.
+type propagatingSpan string
+
+func (s propagatingSpan) End() {}
+
+func (s propagatingSpan) TraceParent() string { return string(s) }
+
+func TestWithTraceParent(t *testing.T) {
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	query := withTraceParent(propagatingSpan(parent), "SELECT 1")
+	assert.Equal(t, "/*traceparent='"+parent+"'*/ SELECT 1", query)
+
+	// The comment doesn't change how the statement is classified.
+	assert.Equal(t, StatementSelect, classifyStatement(query))
+}
+
+// Spans without a valid trace context to propagate, and spans that can't
+// propagate it, leave the query untouched.
+func TestWithTraceParent_None(t *testing.T) {
+	assert.Equal(t, "SELECT 1", withTraceParent(propagatingSpan(""), "SELECT 1"))
+
+	_, span := tracing.Start(context.Background(), "query", "SELECT 1")
+	assert.Equal(t, "SELECT 1", withTraceParent(span, "SELECT 1"))
+}
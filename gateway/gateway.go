@@ -0,0 +1,346 @@
+// Package gateway exposes dqlite databases over a minimal HTTP/JSON API, so
+// that services not written in Go, and debugging tools such as curl, can query
+// a cluster without linking the driver.
+//
+// The API consists of two endpoints:
+//
+//	POST /db/{name}/query
+//	POST /db/{name}/exec
+//
+// Both take a JSON body holding the statement and its positional arguments:
+//
+//	{"sql": "SELECT id, name FROM users WHERE id > ?", "args": [10]}
+//
+// The query endpoint returns the resulting rows:
+//
+//	{"columns": ["id", "name"], "rows": [[11, "alice"], [12, "bob"]]}
+//
+// while the exec endpoint returns the effects of the statement:
+//
+//	{"last_insert_id": 12, "rows_affected": 1}
+//
+// Errors are reported with a non-2xx status and a body like:
+//
+//	{"error": "no such table: users", "code": 1, "extended_code": 1}
+//
+// where the codes are the SQLite result codes, if any.
+//
+// The gateway does not perform any authentication or authorization: it should
+// only be exposed to trusted networks, or wrapped by a handler that takes
+// care of it.
+package gateway
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/driver"
+	"github.com/pkg/errors"
+)
+
+// Gateway is an http.Handler serving the gateway API.
+type Gateway struct {
+	driver  *driver.Driver
+	options *options
+
+	mu  sync.Mutex
+	dbs map[string]*sql.DB // Handles of the databases queried so far.
+}
+
+// New creates a new gateway, which will find the leader of the cluster using
+// the given store.
+func New(store client.NodeStore, options ...Option) (*Gateway, error) {
+	o := defaultOptions()
+	for _, option := range options {
+		option(o)
+	}
+	if len(o.Databases) == 0 {
+		return nil, errors.New("no database configured, see WithDatabases")
+	}
+
+	drv, err := driver.New(store, driver.WithDialFunc(o.DialFunc), driver.WithLogFunc(o.Log))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{
+		driver:  drv,
+		options: o,
+		dbs:     map[string]*sql.DB{},
+	}
+
+	return g, nil
+}
+
+// Close releases all database connections held by the gateway.
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var err error
+	for name, db := range g.dbs {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(g.dbs, name)
+	}
+
+	return err
+}
+
+// Request is the body of requests sent to the query and exec endpoints.
+type Request struct {
+	SQL  string        `json:"sql"`
+	Args []interface{} `json:"args,omitempty"`
+}
+
+// QueryResult is the body of successful responses of the query endpoint.
+//
+// Values are encoded as JSON numbers, strings or null, except for blobs, which
+// are encoded as base64 strings.
+type QueryResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ExecResult is the body of successful responses of the exec endpoint.
+type ExecResult struct {
+	LastInsertID int64 `json:"last_insert_id"`
+	RowsAffected int64 `json:"rows_affected"`
+}
+
+// Error is the body of failed responses.
+type Error struct {
+	Message      string `json:"error"`
+	Code         int    `json:"code,omitempty"`          // SQLite primary result code, if any.
+	ExtendedCode int    `json:"extended_code,omitempty"` // SQLite extended result code, if any.
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, Error{Message: "not found"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, Error{Message: "method not allowed"})
+		return
+	}
+	if !g.allowed(name) {
+		writeError(w, http.StatusNotFound, Error{Message: fmt.Sprintf("unknown database %q", name)})
+		return
+	}
+
+	request, err := decodeRequest(http.MaxBytesReader(w, r.Body, g.options.MaxRequestSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, Error{Message: err.Error()})
+		return
+	}
+
+	ctx := r.Context()
+	if g.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.options.Timeout)
+		defer cancel()
+	}
+
+	db := g.db(name)
+
+	var result interface{}
+	switch action {
+	case "query":
+		result, err = g.query(ctx, db, request)
+	case "exec":
+		result, err = exec(ctx, db, request)
+	}
+	if err != nil {
+		g.options.Log(client.LogDebug, "gateway: %s on %s failed: %v", action, name, err)
+		status, body := errorResponse(err)
+		writeError(w, status, body)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Return whether the database with the given name can be accessed.
+func (g *Gateway) allowed(name string) bool {
+	for _, database := range g.options.Databases {
+		if database == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the handle of the database with the given name, creating it if
+// needed. Since names are checked against the configured databases, there's
+// at most one handle per configured database.
+func (g *Gateway) db(name string) *sql.DB {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	db, ok := g.dbs[name]
+	if !ok {
+		connector, _ := g.driver.OpenConnector(name) // Names are validated by parsePath.
+		db = sql.OpenDB(connector)
+		g.dbs[name] = db
+	}
+
+	return db
+}
+
+// Run the given request as a query and collect the resulting rows.
+func (g *Gateway) query(ctx context.Context, db *sql.DB, request *Request) (*QueryResult, error) {
+	rows, err := db.QueryContext(ctx, request.SQL, request.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if g.options.MaxRows > 0 && len(result.Rows) == g.options.MaxRows {
+			return nil, errTooManyRows
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Run the given request as a statement not returning rows.
+func exec(ctx context.Context, db *sql.DB, request *Request) (*ExecResult, error) {
+	r, err := db.ExecContext(ctx, request.SQL, request.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExecResult{}
+	if result.LastInsertID, err = r.LastInsertId(); err != nil {
+		return nil, err
+	}
+	if result.RowsAffected, err = r.RowsAffected(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+var errTooManyRows = errors.New("too many rows")
+
+// Split the given URL path into a database name and an action, which must be
+// either "query" or "exec".
+func parsePath(path string) (string, string, bool) {
+	if !strings.HasPrefix(path, "/db/") {
+		return "", "", false
+	}
+	parts := strings.Split(path[len("/db/"):], "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	name, action := parts[0], parts[1]
+
+	// Reject names that the driver would interpret as carrying query
+	// parameters.
+	if name == "" || strings.ContainsAny(name, "?#") {
+		return "", "", false
+	}
+	if action != "query" && action != "exec" {
+		return "", "", false
+	}
+
+	return name, action, true
+}
+
+// Decode a request body. Numbers without a fractional part are passed to
+// dqlite as integers.
+func decodeRequest(body io.Reader) (*Request, error) {
+	request := &Request{}
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if err := decoder.Decode(request); err != nil {
+		return nil, errors.Wrap(err, "invalid request body")
+	}
+	if request.SQL == "" {
+		return nil, errors.New("missing sql")
+	}
+
+	for i, arg := range request.Args {
+		switch arg := arg.(type) {
+		case json.Number:
+			if n, err := arg.Int64(); err == nil {
+				request.Args[i] = n
+			} else if f, err := arg.Float64(); err == nil {
+				request.Args[i] = f
+			} else {
+				return nil, errors.Errorf("invalid number %s in argument %d", arg, i+1)
+			}
+		case nil, string, bool:
+		default:
+			return nil, errors.Errorf("unsupported value for argument %d", i+1)
+		}
+	}
+
+	return request, nil
+}
+
+// Map an error returned by the driver to a response status and body.
+func errorResponse(err error) (int, Error) {
+	body := Error{Message: err.Error()}
+
+	var dqliteErr driver.Error
+	switch {
+	case err == errTooManyRows:
+		return http.StatusRequestEntityTooLarge, body
+	case errors.As(err, &dqliteErr):
+		body.Message = dqliteErr.Message
+		body.Code = dqliteErr.PrimaryCode()
+		body.ExtendedCode = dqliteErr.Code
+		if dqliteErr.PrimaryCode() == driver.ErrBusy {
+			return http.StatusServiceUnavailable, body
+		}
+		return http.StatusBadRequest, body
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, body
+	case errors.Cause(err) == driver.ErrNoAvailableLeader:
+		return http.StatusServiceUnavailable, body
+	default:
+		return http.StatusInternalServerError, body
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, body Error) {
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
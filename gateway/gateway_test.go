@@ -0,0 +1,135 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	dqlite "github.com/canonical/go-dqlite"
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/gateway"
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway_QueryAndExec(t *testing.T) {
+	g, cleanup := newGateway(t)
+	defer cleanup()
+
+	status, body := post(t, g, "/db/test.db/exec", `{"sql": "CREATE TABLE test (n INT, s TEXT)"}`)
+	require.Equal(t, http.StatusOK, status, body)
+
+	status, body = post(t, g, "/db/test.db/exec", `{"sql": "INSERT INTO test(n, s) VALUES(?, ?)", "args": [123, "hello"]}`)
+	require.Equal(t, http.StatusOK, status, body)
+
+	exec := gateway.ExecResult{}
+	require.NoError(t, json.Unmarshal([]byte(body), &exec))
+	assert.Equal(t, int64(1), exec.LastInsertID)
+	assert.Equal(t, int64(1), exec.RowsAffected)
+
+	status, body = post(t, g, "/db/test.db/query", `{"sql": "SELECT n, s FROM test WHERE n = ?", "args": [123]}`)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `{"columns": ["n", "s"], "rows": [[123, "hello"]]}`, body)
+}
+
+func TestGateway_SQLError(t *testing.T) {
+	g, cleanup := newGateway(t)
+	defer cleanup()
+
+	status, body := post(t, g, "/db/test.db/query", `{"sql": "SELECT * FROM missing"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.JSONEq(t, `{"error": "no such table: missing", "code": 1, "extended_code": 1}`, body)
+}
+
+func TestGateway_MaxRows(t *testing.T) {
+	g, cleanup := newGateway(t, gateway.WithMaxRows(1))
+	defer cleanup()
+
+	status, _ := post(t, g, "/db/test.db/query", `{"sql": "SELECT 1 UNION SELECT 2"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestGateway_BadRequests(t *testing.T) {
+	store := client.NewInmemNodeStore()
+	g, err := gateway.New(store, gateway.WithDatabases("test.db"))
+	require.NoError(t, err)
+	defer g.Close()
+
+	cases := []struct {
+		title  string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown path", http.MethodPost, "/foo", `{"sql": "SELECT 1"}`, http.StatusNotFound},
+		{"unknown action", http.MethodPost, "/db/test.db/drop", `{"sql": "SELECT 1"}`, http.StatusNotFound},
+		{"wrong method", http.MethodGet, "/db/test.db/query", "", http.StatusMethodNotAllowed},
+		{"unknown database", http.MethodPost, "/db/other.db/query", `{"sql": "SELECT 1"}`, http.StatusNotFound},
+		{"malformed body", http.MethodPost, "/db/test.db/query", `{"sql":`, http.StatusBadRequest},
+		{"missing sql", http.MethodPost, "/db/test.db/query", `{}`, http.StatusBadRequest},
+		{"unsupported argument", http.MethodPost, "/db/test.db/query", `{"sql": "SELECT ?", "args": [[1]]}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			request := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			recorder := httptest.NewRecorder()
+			g.ServeHTTP(recorder, request)
+			assert.Equal(t, c.status, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestGateway_NoDatabases(t *testing.T) {
+	store := client.NewInmemNodeStore()
+	_, err := gateway.New(store)
+	assert.EqualError(t, err, "no database configured, see WithDatabases")
+}
+
+// Send a request to the given gateway, returning the response status and body.
+func post(t *testing.T, g *gateway.Gateway, path, body string) (int, string) {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	g.ServeHTTP(recorder, request)
+
+	return recorder.Code, recorder.Body.String()
+}
+
+func newGateway(t *testing.T, options ...gateway.Option) (*gateway.Gateway, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dqlite-gateway-test-")
+	require.NoError(t, err)
+
+	node, err := dqlite.New(uint64(1), "@1", dir, dqlite.WithBindAddress("@1"))
+	require.NoError(t, err)
+	require.NoError(t, node.Start())
+
+	store := client.NewInmemNodeStore()
+	require.NoError(t, store.Set(context.Background(), []client.NodeInfo{{Address: "@1"}}))
+
+	options = append([]gateway.Option{
+		gateway.WithLogFunc(logging.Test(t)),
+		gateway.WithDatabases("test.db"),
+	}, options...)
+	g, err := gateway.New(store, options...)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		require.NoError(t, g.Close())
+		require.NoError(t, node.Close())
+		require.NoError(t, os.RemoveAll(dir))
+	}
+
+	return g, cleanup
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Option can be used to tweak gateway parameters.
+type Option func(*options)
+
+// WithDialFunc sets a custom dial function for connecting to dqlite nodes.
+func WithDialFunc(dial client.DialFunc) Option {
+	return func(options *options) {
+		options.DialFunc = dial
+	}
+}
+
+// WithLogFunc sets a custom logging function.
+func WithLogFunc(log client.LogFunc) Option {
+	return func(options *options) {
+		options.Log = log
+	}
+}
+
+// WithDatabases sets the databases that can be accessed through the gateway.
+// Requests against other databases fail with status 404.
+//
+// This option is required: since dqlite creates databases when they are first
+// opened, letting clients pick any name would let them create an unbounded
+// number of databases.
+func WithDatabases(names ...string) Option {
+	return func(options *options) {
+		options.Databases = append([]string{}, names...)
+	}
+}
+
+// WithMaxRows sets the maximum number of rows that a query can return. Queries
+// returning more rows fail with status 413. The default is 10000, and zero
+// means no limit.
+func WithMaxRows(n int) Option {
+	return func(options *options) {
+		options.MaxRows = n
+	}
+}
+
+// WithMaxRequestSize sets the maximum size of request bodies, in bytes. The
+// default is 1MiB.
+func WithMaxRequestSize(bytes int64) Option {
+	return func(options *options) {
+		options.MaxRequestSize = bytes
+	}
+}
+
+// WithTimeout sets the maximum time a request can take. The default is 30
+// seconds, and zero means no timeout other than the one of the HTTP request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.Timeout = timeout
+	}
+}
+
+type options struct {
+	DialFunc       client.DialFunc
+	Log            client.LogFunc
+	Databases      []string
+	MaxRows        int
+	MaxRequestSize int64
+	Timeout        time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		DialFunc:       client.DefaultDialFunc,
+		Log:            client.DefaultLogFunc,
+		MaxRows:        10000,
+		MaxRequestSize: 1 << 20,
+		Timeout:        30 * time.Second,
+	}
+}
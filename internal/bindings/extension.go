@@ -0,0 +1,64 @@
+// +build !nosqlite3,!nocgo
+
+package bindings
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <stdlib.h>
+#include <dlfcn.h>
+#include <sqlite3.h>
+
+static int registerExtension(void *entryPoint)
+{
+	return sqlite3_auto_extension((void (*)(void))entryPoint);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// LoadExtension loads the SQLite extension in the shared library at the given
+// path, which will be initialized on all SQLite connections opened afterwards
+// in this process. If entryPoint is empty, it's derived from the file name
+// like SQLite does, see ExtensionEntryPoint.
+//
+// The library is never unloaded.
+func LoadExtension(path string, entryPoint string) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	handle := C.dlopen(cpath, C.RTLD_NOW)
+	if handle == nil {
+		return fmt.Errorf("%s", C.GoString(C.dlerror()))
+	}
+
+	entryPoints := []string{entryPoint}
+	if entryPoint == "" {
+		entryPoints = []string{ExtensionEntryPoint(path), "sqlite3_extension_init"}
+	}
+
+	var symbol unsafe.Pointer
+	for _, name := range entryPoints {
+		cname := C.CString(name)
+		symbol = C.dlsym(handle, cname)
+		C.free(unsafe.Pointer(cname))
+		if symbol != nil {
+			break
+		}
+	}
+	if symbol == nil {
+		return fmt.Errorf("%s: no entry point %s found", path, entryPoints[0])
+	}
+
+	if rc := C.registerExtension(symbol); rc != 0 {
+		return protocol.NewError(uint64(rc), C.GoString(C.sqlite3_errstr(rc)))
+	}
+
+	return nil
+}
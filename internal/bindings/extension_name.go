@@ -0,0 +1,32 @@
+package bindings
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ExtensionEntryPoint returns the name of the initialization function that
+// SQLite looks for in the extension at the given path: "sqlite3_X_init", where
+// X is the file name without any "lib" prefix and without extensions, keeping
+// only letters, in lower case.
+func ExtensionEntryPoint(path string) string {
+	name := filepath.Base(path)
+	if len(name) >= 3 && strings.EqualFold(name[:3], "lib") {
+		name = name[3:]
+	}
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		name = name[:i]
+	}
+
+	var b strings.Builder
+	b.WriteString("sqlite3_")
+	for _, c := range name {
+		if c < unicode.MaxASCII && unicode.IsLetter(c) {
+			b.WriteRune(unicode.ToLower(c))
+		}
+	}
+	b.WriteString("_init")
+
+	return b.String()
+}
@@ -0,0 +1,21 @@
+package bindings_test
+
+import (
+	"testing"
+
+	"github.com/canonical/go-dqlite/internal/bindings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtensionEntryPoint(t *testing.T) {
+	cases := map[string]string{
+		"/usr/lib/fts5.so":       "sqlite3_fts_init", // Digits are dropped.
+		"spellfix.so":            "sqlite3_spellfix_init",
+		"libSqliteIcu.so.1":      "sqlite3_sqliteicu_init",
+		"/ext/json1":             "sqlite3_json_init",
+		"/opt/lib_vec-0.1.dylib": "sqlite3_vec_init",
+	}
+	for path, entryPoint := range cases {
+		assert.Equal(t, entryPoint, bindings.ExtensionEntryPoint(path), path)
+	}
+}
@@ -0,0 +1,285 @@
+// +build !nosqlite3,!nocgo
+
+package bindings
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+#include <sqlite3.h>
+
+// Implemented in Go, see function_export.go.
+void goDqliteScalar(sqlite3_context *ctx, int argc, sqlite3_value **argv);
+void goDqliteStep(sqlite3_context *ctx, int argc, sqlite3_value **argv);
+void goDqliteFinal(sqlite3_context *ctx);
+int goDqliteAutoExtension(sqlite3 *db, char **err, void *api);
+
+static int createFunction(sqlite3 *db, const char *name, int nargs, uintptr_t handle, int aggregate)
+{
+	int flags = SQLITE_UTF8 | SQLITE_DETERMINISTIC;
+	if (aggregate) {
+		return sqlite3_create_function_v2(db, name, nargs, flags, (void *)handle,
+						  NULL, goDqliteStep, goDqliteFinal, NULL);
+	}
+	return sqlite3_create_function_v2(db, name, nargs, flags, (void *)handle,
+					  goDqliteScalar, NULL, NULL, NULL);
+}
+
+static int registerAutoExtension()
+{
+	return sqlite3_auto_extension((void (*)(void))goDqliteAutoExtension);
+}
+
+static uintptr_t functionHandle(sqlite3_context *ctx)
+{
+	return (uintptr_t)sqlite3_user_data(ctx);
+}
+
+static uintptr_t *aggregateHandle(sqlite3_context *ctx, int create)
+{
+	return sqlite3_aggregate_context(ctx, create ? sizeof(uintptr_t) : 0);
+}
+
+static sqlite3_value *functionArg(sqlite3_value **argv, int i)
+{
+	return argv[i];
+}
+
+static void resultText(sqlite3_context *ctx, const char *text, int n)
+{
+	sqlite3_result_text(ctx, text, n, SQLITE_TRANSIENT);
+}
+
+static void resultBlob(sqlite3_context *ctx, const void *blob, int n)
+{
+	sqlite3_result_blob(ctx, blob, n, SQLITE_TRANSIENT);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// ScalarFunc implements a custom SQL scalar function.
+type ScalarFunc func(args []interface{}) (interface{}, error)
+
+// Aggregate accumulates the rows of a group for a custom SQL aggregate
+// function.
+type Aggregate interface {
+	Step(args []interface{}) error
+	Final() (interface{}, error)
+}
+
+// A custom SQL function, either scalar or aggregate.
+type function struct {
+	name      string
+	nargs     int
+	scalar    ScalarFunc
+	aggregate func() Aggregate
+}
+
+// Registry of custom SQL functions. Their handles are their index in the list
+// plus one, since functions are never removed.
+var functions = struct {
+	sync.Mutex
+	list       []*function
+	registered bool // Whether the auto-extension was installed.
+}{}
+
+// Aggregates being computed, indexed by the handle stored in the aggregate
+// context of their SQLite function call.
+var aggregates = struct {
+	sync.Mutex
+	instances map[C.uintptr_t]Aggregate
+	next      C.uintptr_t
+}{instances: map[C.uintptr_t]Aggregate{}}
+
+// RegisterFunction registers a custom SQL function, which will be available
+// on all SQLite connections opened afterwards in this process. Exactly one of
+// scalar and aggregate must be non-nil. A function registered again with the
+// same name and number of arguments replaces the previous one.
+func RegisterFunction(name string, nargs int, scalar ScalarFunc, aggregate func() Aggregate) error {
+	if name == "" {
+		return fmt.Errorf("empty function name")
+	}
+	if nargs < -1 || nargs > 127 {
+		return fmt.Errorf("invalid number of arguments %d", nargs)
+	}
+	if (scalar == nil) == (aggregate == nil) {
+		return fmt.Errorf("function %s must be either scalar or aggregate", name)
+	}
+
+	functions.Lock()
+	defer functions.Unlock()
+
+	if !functions.registered {
+		if rc := C.registerAutoExtension(); rc != 0 {
+			return protocol.NewError(uint64(rc), C.GoString(C.sqlite3_errstr(rc)))
+		}
+		functions.registered = true
+	}
+
+	f := &function{name: name, nargs: nargs, scalar: scalar, aggregate: aggregate}
+	for i, other := range functions.list {
+		if other.name == name && other.nargs == nargs {
+			functions.list[i] = f
+			return nil
+		}
+	}
+	functions.list = append(functions.list, f)
+
+	return nil
+}
+
+// Create all registered functions on the given connection.
+func createFunctions(db *C.sqlite3) C.int {
+	functions.Lock()
+	defer functions.Unlock()
+
+	for i, f := range functions.list {
+		name := C.CString(f.name)
+		rc := C.createFunction(db, name, C.int(f.nargs), C.uintptr_t(i+1), boolToInt(f.aggregate != nil))
+		C.free(unsafe.Pointer(name))
+		if rc != C.SQLITE_OK {
+			return rc
+		}
+	}
+
+	return C.SQLITE_OK
+}
+
+// Return the function invoked by the given SQLite call.
+func lookupFunction(ctx *C.sqlite3_context) *function {
+	functions.Lock()
+	defer functions.Unlock()
+	return functions.list[C.functionHandle(ctx)-1]
+}
+
+func callScalar(ctx *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	defer recoverResult(ctx)
+	f := lookupFunction(ctx)
+	value, err := f.scalar(functionArgs(argc, argv))
+	setResult(ctx, value, err)
+}
+
+func callStep(ctx *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	defer recoverResult(ctx)
+	handle := C.aggregateHandle(ctx, 1)
+	if handle == nil {
+		C.sqlite3_result_error_nomem(ctx)
+		return
+	}
+
+	aggregates.Lock()
+	if *handle == 0 {
+		aggregates.next++
+		*handle = aggregates.next
+		aggregates.instances[*handle] = lookupFunction(ctx).aggregate()
+	}
+	aggregate := aggregates.instances[*handle]
+	aggregates.Unlock()
+
+	if err := aggregate.Step(functionArgs(argc, argv)); err != nil {
+		setResult(ctx, nil, err)
+	}
+}
+
+func callFinal(ctx *C.sqlite3_context) {
+	defer recoverResult(ctx)
+
+	// If the group had no rows, no aggregate was created by callStep.
+	var aggregate Aggregate
+	handle := C.aggregateHandle(ctx, 0)
+	if handle != nil && *handle != 0 {
+		aggregates.Lock()
+		aggregate = aggregates.instances[*handle]
+		delete(aggregates.instances, *handle)
+		aggregates.Unlock()
+	} else {
+		aggregate = lookupFunction(ctx).aggregate()
+	}
+
+	value, err := aggregate.Final()
+	setResult(ctx, value, err)
+}
+
+// Convert the arguments of a SQLite function call to Go values.
+func functionArgs(argc C.int, argv **C.sqlite3_value) []interface{} {
+	args := make([]interface{}, int(argc))
+	for i := range args {
+		value := C.functionArg(argv, C.int(i))
+		switch C.sqlite3_value_type(value) {
+		case C.SQLITE_INTEGER:
+			args[i] = int64(C.sqlite3_value_int64(value))
+		case C.SQLITE_FLOAT:
+			args[i] = float64(C.sqlite3_value_double(value))
+		case C.SQLITE_TEXT:
+			text := C.sqlite3_value_text(value)
+			args[i] = C.GoStringN((*C.char)(unsafe.Pointer(text)), C.sqlite3_value_bytes(value))
+		case C.SQLITE_BLOB:
+			blob := C.sqlite3_value_blob(value)
+			args[i] = C.GoBytes(blob, C.sqlite3_value_bytes(value))
+		default:
+			args[i] = nil
+		}
+	}
+	return args
+}
+
+// Set the result of a SQLite function call.
+func setResult(ctx *C.sqlite3_context, value interface{}, err error) {
+	if err != nil {
+		setError(ctx, err.Error())
+		return
+	}
+
+	switch value := value.(type) {
+	case nil:
+		C.sqlite3_result_null(ctx)
+	case int64:
+		C.sqlite3_result_int64(ctx, C.sqlite3_int64(value))
+	case int:
+		C.sqlite3_result_int64(ctx, C.sqlite3_int64(value))
+	case bool:
+		C.sqlite3_result_int64(ctx, C.sqlite3_int64(boolToInt(value)))
+	case float64:
+		C.sqlite3_result_double(ctx, C.double(value))
+	case string:
+		text := C.CString(value)
+		defer C.free(unsafe.Pointer(text))
+		C.resultText(ctx, text, C.int(len(value)))
+	case []byte:
+		if len(value) == 0 {
+			C.sqlite3_result_zeroblob(ctx, 0)
+			return
+		}
+		C.resultBlob(ctx, unsafe.Pointer(&value[0]), C.int(len(value)))
+	default:
+		setError(ctx, fmt.Sprintf("unsupported result type %T", value))
+	}
+}
+
+func setError(ctx *C.sqlite3_context, message string) {
+	msg := C.CString(message)
+	defer C.free(unsafe.Pointer(msg))
+	C.sqlite3_result_error(ctx, msg, -1)
+}
+
+// Turn a panic in a Go function into an SQL error, since it can't unwind
+// through the C stack.
+func recoverResult(ctx *C.sqlite3_context) {
+	if r := recover(); r != nil {
+		setError(ctx, fmt.Sprintf("panic: %v", r))
+	}
+}
+
+func boolToInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
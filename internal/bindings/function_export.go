@@ -0,0 +1,35 @@
+// +build !nosqlite3,!nocgo
+
+package bindings
+
+/*
+#include <sqlite3.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+// Callbacks invoked by SQLite. They live in their own file since the preamble
+// of a file with exported functions can't contain C definitions.
+
+//export goDqliteAutoExtension
+func goDqliteAutoExtension(db *C.sqlite3, err **C.char, api unsafe.Pointer) C.int {
+	return createFunctions(db)
+}
+
+//export goDqliteScalar
+func goDqliteScalar(ctx *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	callScalar(ctx, argc, argv)
+}
+
+//export goDqliteStep
+func goDqliteStep(ctx *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	callStep(ctx, argc, argv)
+}
+
+//export goDqliteFinal
+func goDqliteFinal(ctx *C.sqlite3_context) {
+	callFinal(ctx)
+}
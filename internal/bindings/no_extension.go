@@ -0,0 +1,13 @@
+// +build nosqlite3 nocgo
+
+package bindings
+
+import (
+	"fmt"
+)
+
+// LoadExtension always fails, since SQLite extensions are loaded through
+// cgo.
+func LoadExtension(path string, entryPoint string) error {
+	return fmt.Errorf("SQLite extensions require cgo and SQLite (built with the nocgo or nosqlite3 tag)")
+}
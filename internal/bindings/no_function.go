@@ -0,0 +1,23 @@
+// +build nosqlite3 nocgo
+
+package bindings
+
+import (
+	"fmt"
+)
+
+// ScalarFunc implements a custom SQL scalar function.
+type ScalarFunc func(args []interface{}) (interface{}, error)
+
+// Aggregate accumulates the rows of a group for a custom SQL aggregate
+// function.
+type Aggregate interface {
+	Step(args []interface{}) error
+	Final() (interface{}, error)
+}
+
+// RegisterFunction always fails, since custom SQL functions are registered
+// with SQLite through cgo.
+func RegisterFunction(name string, nargs int, scalar ScalarFunc, aggregate func() Aggregate) error {
+	return fmt.Errorf("custom SQL functions require cgo and SQLite (built with the nocgo or nosqlite3 tag)")
+}
@@ -0,0 +1,96 @@
+// +build nocgo
+
+package bindings
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+)
+
+// ErrNoCgo is returned by all functions that need libdqlite when go-dqlite is
+// built with the nocgo tag.
+var ErrNoCgo = fmt.Errorf("dqlite node support requires cgo (built with the nocgo tag)")
+
+type Node struct{}
+
+type SnapshotParams struct {
+	Threshold uint64
+	Trailing  uint64
+}
+
+// NewNode always fails, since running a node requires libdqlite.
+func NewNode(ctx context.Context, id uint64, address string, dir string) (*Node, error) {
+	return nil, ErrNoCgo
+}
+
+func (s *Node) SetDialFunc(dial protocol.DialFunc) error {
+	return ErrNoCgo
+}
+
+func (s *Node) SetBindAddress(address string) error {
+	return ErrNoCgo
+}
+
+func (s *Node) SetNetworkLatency(nanoseconds uint64) error {
+	return ErrNoCgo
+}
+
+func (s *Node) SetSnapshotParams(params SnapshotParams) error {
+	return ErrNoCgo
+}
+
+func (s *Node) SetFailureDomain(code uint64) error {
+	return ErrNoCgo
+}
+
+func (s *Node) EnableDiskMode() error {
+	return ErrNoCgo
+}
+
+func (s *Node) SetAutoRecovery(on bool) error {
+	return ErrNoCgo
+}
+
+func (s *Node) GetBindAddress() string {
+	return ""
+}
+
+func (s *Node) Start() error {
+	return ErrNoCgo
+}
+
+func (s *Node) Stop() error {
+	return ErrNoCgo
+}
+
+func (s *Node) Close() {
+}
+
+func (s *Node) Recover(cluster []protocol.NodeInfo) error {
+	return ErrNoCgo
+}
+
+func (s *Node) RecoverExt(cluster []protocol.NodeInfo) error {
+	return ErrNoCgo
+}
+
+func (s *Node) DescribeLastEntry() (uint64, uint64, error) {
+	return 0, 0, ErrNoCgo
+}
+
+// GenerateID generates a unique ID for a server, hashing its address along
+// with the current time like libdqlite does.
+func GenerateID(address string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(address))
+	h.Write([]byte(strconv.FormatInt(time.Now().UnixNano(), 10)))
+	if id := h.Sum64(); id != 0 {
+		return id
+	}
+	return 1 // Zero is not a valid node ID.
+}
@@ -1,4 +1,4 @@
-// +build !nosqlite3
+// +build !nosqlite3,!nocgo
 
 package bindings
 
@@ -25,14 +25,14 @@ import "C"
 
 func ConfigSingleThread() error {
 	if rc := C.sqlite3ConfigSingleThread(); rc != 0 {
-		return protocol.Error{Message: C.GoString(C.sqlite3_errstr(rc)), Code: int(rc)}
+		return protocol.NewError(uint64(rc), C.GoString(C.sqlite3_errstr(rc)))
 	}
 	return nil
 }
 
 func ConfigMultiThread() error {
 	if rc := C.sqlite3ConfigMultiThread(); rc != 0 {
-		return protocol.Error{Message: C.GoString(C.sqlite3_errstr(rc)), Code: int(rc)}
+		return protocol.NewError(uint64(rc), C.GoString(C.sqlite3_errstr(rc)))
 	}
 	return nil
 }
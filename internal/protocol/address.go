@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port used by NormalizeAddress when an address doesn't
+// specify one.
+const DefaultPort = "9000"
+
+// NormalizeAddress turns the given node address into a canonical "host:port"
+// form that can be dialed:
+//
+//   - IPv6 literals are enclosed in brackets, so "::1" and "[::1]" both
+//     become "[::1]:9000";
+//   - the default port is added to addresses without one;
+//   - IP addresses are printed in their canonical form, preserving any zone.
+//
+// Host names are left untouched, and are resolved at dial time. Abstract Unix
+// socket addresses (starting with "@") are returned unchanged.
+//
+// Note that a bare IPv6 literal is always assumed not to contain a port, so
+// an explicit port requires brackets, as in "[fe80::1]:9001".
+func NormalizeAddress(address string) (string, error) {
+	if address == "" {
+		return "", fmt.Errorf("empty address")
+	}
+	if strings.HasPrefix(address, "@") {
+		return address, nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// Either the port is missing, or this is a bare IPv6 literal.
+		host = address
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		if strings.ContainsAny(host, "[]") {
+			return "", fmt.Errorf("invalid address %q", address)
+		}
+		port = DefaultPort
+	}
+
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("invalid port in address %q", address)
+	}
+
+	zone := ""
+	if i := strings.LastIndex(host, "%"); i != -1 {
+		host, zone = host[:i], host[i:]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	} else if zone != "" {
+		return "", fmt.Errorf("invalid address %q: zone on a host name", address)
+	}
+
+	return net.JoinHostPort(host+zone, port), nil
+}
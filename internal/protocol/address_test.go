@@ -0,0 +1,54 @@
+package protocol_test
+
+import (
+	"testing"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	cases := []struct {
+		address    string
+		normalized string
+	}{
+		{"127.0.0.1:9001", "127.0.0.1:9001"},
+		{"127.0.0.1", "127.0.0.1:9000"},
+		{"localhost", "localhost:9000"},
+		{"node-1.example.com:9001", "node-1.example.com:9001"},
+		{"::1", "[::1]:9000"},
+		{"[::1]", "[::1]:9000"},
+		{"[::1]:9001", "[::1]:9001"},
+		{"2001:DB8:0:0::1", "[2001:db8::1]:9000"},
+		{"[fe80::1%eth0]:9001", "[fe80::1%eth0]:9001"},
+		{"fe80::1%eth0", "[fe80::1%eth0]:9000"},
+		{"@dqlite-1", "@dqlite-1"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.address, func(t *testing.T) {
+			normalized, err := protocol.NormalizeAddress(c.address)
+			require.NoError(t, err)
+			assert.Equal(t, c.normalized, normalized)
+		})
+	}
+}
+
+func TestNormalizeAddress_Invalid(t *testing.T) {
+	cases := []string{
+		"",
+		"127.0.0.1:abc",
+		"127.0.0.1:0",
+		"127.0.0.1:65536",
+		"[::1",
+		"host%eth0",
+	}
+	for _, address := range cases {
+		address := address
+		t.Run(address, func(t *testing.T) {
+			_, err := protocol.NormalizeAddress(address)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuthMagic starts an authentication request, which clients send before the
+// protocol handshake when connecting to nodes requiring a token.
+//
+// The request is followed by the length of the token as 32-bit little endian
+// integer and by the token itself. The node replies with a single byte, which
+// is zero if the token was accepted.
+const AuthMagic = uint64(0x68747561656c7164) // "dqleauth" in little endian
+
+// MaxAuthTokenSize is the maximum size of an authentication token.
+const MaxAuthTokenSize = 4096
+
+// ErrAuthFailed is returned by Authenticate when the node rejects the token.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// Authenticate sends the given token over the given connection and waits for
+// the node to accept it.
+func Authenticate(ctx context.Context, conn net.Conn, token string) error {
+	if len(token) > MaxAuthTokenSize {
+		return errors.Errorf("token exceeds %d bytes", MaxAuthTokenSize)
+	}
+
+	// Honor the ctx deadline, if present.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	buf := make([]byte, 12+len(token))
+	binary.LittleEndian.PutUint64(buf, AuthMagic)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(len(token)))
+	copy(buf[12:], token)
+
+	if _, err := conn.Write(buf); err != nil {
+		return errors.Wrap(err, "write token")
+	}
+
+	result := make([]byte, 1)
+	if _, err := io.ReadFull(conn, result); err != nil {
+		return errors.Wrap(err, "read authentication result")
+	}
+	if result[0] != 0 {
+		return ErrAuthFailed
+	}
+
+	return nil
+}
+
+// ReadAuthToken reads the authentication request sent by Authenticate.
+func ReadAuthToken(conn net.Conn) (string, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", errors.Wrap(err, "read token header")
+	}
+	if binary.LittleEndian.Uint64(header) != AuthMagic {
+		return "", errors.New("missing token")
+	}
+
+	size := binary.LittleEndian.Uint32(header[8:])
+	if size > MaxAuthTokenSize {
+		return "", errors.Errorf("token exceeds %d bytes", MaxAuthTokenSize)
+	}
+
+	token := make([]byte, size)
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return "", errors.Wrap(err, "read token")
+	}
+
+	return string(token), nil
+}
+
+// WriteAuthResult replies to an authentication request, accepting the token
+// if ok is true.
+func WriteAuthResult(conn net.Conn, ok bool) error {
+	result := []byte{1}
+	if ok {
+		result[0] = 0
+	}
+	_, err := conn.Write(result)
+	return err
+}
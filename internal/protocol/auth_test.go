@@ -0,0 +1,56 @@
+package protocol_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	cases := []struct {
+		title string
+		token string
+		valid bool
+	}{
+		{"accepted", "secret", true},
+		{"rejected", "wrong", false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			tokens := make(chan string, 1)
+			go func() {
+				token, err := protocol.ReadAuthToken(server)
+				tokens <- token
+				protocol.WriteAuthResult(server, err == nil && token == "secret")
+			}()
+
+			err := protocol.Authenticate(context.Background(), client, c.token)
+			assert.Equal(t, c.token, <-tokens)
+			if c.valid {
+				require.NoError(t, err)
+			} else {
+				assert.Equal(t, protocol.ErrAuthFailed, err)
+			}
+		})
+	}
+}
+
+func TestReadAuthToken_Missing(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go client.Write(make([]byte, 12))
+
+	_, err := protocol.ReadAuthToken(server)
+	assert.EqualError(t, err, "missing token")
+}
@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker keeps track of the servers that repeatedly failed connection
+// attempts, so that connectors stop trying them for a while instead of waiting
+// for their dial or handshake to fail over and over.
+//
+// After the given number of consecutive failures the breaker of a server
+// opens, and the server is skipped until the cooldown period has elapsed.
+// Then a single attempt is let through: if it succeeds the breaker closes,
+// otherwise it opens again for another cooldown period.
+//
+// It's safe for concurrent use, and can be shared by several connectors.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu      sync.Mutex
+	servers map[string]*breakerState
+}
+
+// Failure tracking for a single server.
+type breakerState struct {
+	failures int       // Number of consecutive failures.
+	opened   time.Time // When the breaker last opened.
+	probing  bool      // Whether a trial attempt is in progress.
+}
+
+// NewCircuitBreaker returns a circuit breaker opening after the given number
+// of consecutive failures, for the given amount of time.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		servers:   map[string]*breakerState{},
+	}
+}
+
+// Return true if an attempt to connect to the given server can be made. If
+// the attempt is the trial one after the cooldown period, no other attempt is
+// allowed until the outcome is reported.
+func (b *CircuitBreaker) allow(address string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.servers[address]
+	if !ok || state.failures < b.threshold {
+		return true
+	}
+	if state.probing || time.Since(state.opened) < b.cooldown {
+		return false
+	}
+	state.probing = true
+	return true
+}
+
+// Report that an attempt to connect to the given server succeeded.
+func (b *CircuitBreaker) success(address string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.servers, address)
+}
+
+// Report that an attempt to connect to the given server failed.
+func (b *CircuitBreaker) failure(address string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.servers[address]
+	if !ok {
+		state = &breakerState{}
+		b.servers[address] = state
+	}
+	state.failures++
+	state.probing = false
+	if state.failures >= b.threshold {
+		state.opened = time.Now()
+	}
+}
+
+// Report that an attempt to connect to the given server was abandoned before
+// its outcome was known, for example because the leader was found through
+// another server.
+func (b *CircuitBreaker) release(address string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state, ok := b.servers[address]; ok {
+		state.probing = false
+	}
+}
+
+// RetryBudget caps the number of connection retries made within a time
+// window, across all the connectors sharing it. Once the budget is spent,
+// connectors fail with ErrNoAvailableLeader instead of backing off and
+// retrying, until the window is over. The first attempt of each connection
+// is not counted.
+//
+// It's safe for concurrent use.
+type RetryBudget struct {
+	retries int
+	window  time.Duration
+
+	mu    sync.Mutex
+	start time.Time // Beginning of the current window.
+	spent int       // Retries made in the current window.
+}
+
+// NewRetryBudget returns a budget allowing the given number of retries within
+// each time window of the given length.
+func NewRetryBudget(retries int, window time.Duration) *RetryBudget {
+	return &RetryBudget{
+		retries: retries,
+		window:  window,
+	}
+}
+
+// Spend one retry, returning false if there's none left in the current
+// window.
+func (b *RetryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.start) >= b.window {
+		b.start = now
+		b.spent = 0
+	}
+	if b.spent >= b.retries {
+		return false
+	}
+	b.spent++
+	return true
+}
+
+var errCircuitOpen = fmt.Errorf("circuit breaker open")
@@ -6,11 +6,19 @@ import (
 
 // Config holds various configuration parameters for a dqlite client.
 type Config struct {
-	Dial                  DialFunc      // Network dialer.
-	DialTimeout           time.Duration // Timeout for establishing a network connection .
-	AttemptTimeout        time.Duration // Timeout for each individual attempt to probe a server's leadership.
-	BackoffFactor         time.Duration // Exponential backoff factor for retries.
-	BackoffCap            time.Duration // Maximum connection retry backoff value,
-	RetryLimit            uint          // Maximum number of retries, or 0 for unlimited.
-	ConcurrentLeaderConns int64         // Maximum number of concurrent connections to other cluster members while probing for leadership.
+	Dial                  DialFunc            // Network dialer.
+	DialTimeout           time.Duration       // Timeout for establishing a network connection .
+	HandshakeTimeout      time.Duration       // Timeout for the handshake and leadership check once connected, or 0 for AttemptTimeout only.
+	AttemptTimeout        time.Duration       // Timeout for each individual attempt to probe a server's leadership.
+	ConnectTimeout        time.Duration       // Overall timeout for finding the leader, or 0 for no timeout.
+	BackoffFactor         time.Duration       // Exponential backoff factor for retries.
+	BackoffCap            time.Duration       // Maximum connection retry backoff value,
+	RetryLimit            uint                // Maximum number of retries, or 0 for unlimited.
+	ConcurrentLeaderConns int64               // Maximum number of concurrent connections to other cluster members while probing for leadership.
+	Retries               *int64              // If not nil, incremented atomically every time a connection attempt is retried.
+	LeaderHint            *LeaderHint         // If not nil, address of the leader to try before probing all servers.
+	MaxMessageSize        uint64              // Maximum size of message bodies, or 0 for no limit.
+	PreferredNodes        func(NodeInfo) bool // If not nil, servers to probe before the others.
+	CircuitBreaker        *CircuitBreaker     // If not nil, used to skip servers that keep failing.
+	RetryBudget           *RetryBudget        // If not nil, limits the number of retries across connectors.
 }
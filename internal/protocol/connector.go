@@ -8,6 +8,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Rican7/retry"
@@ -76,7 +77,32 @@ func NewConnector(id uint64, store NodeStore, config Config, log logging.Func) *
 func (c *Connector) Connect(ctx context.Context) (*Protocol, error) {
 	var protocol *Protocol
 
-	strategies := makeRetryStrategies(c.config.BackoffFactor, c.config.BackoffCap, c.config.RetryLimit)
+	if c.config.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.ConnectTimeout)
+		defer cancel()
+	}
+
+	// If the store can push changes, cut the backoff delay short when
+	// that happens.
+	var changes <-chan []NodeInfo
+	if watcher, ok := c.store.(NodeStoreWatcher); ok {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		changes = watcher.Watch(watchCtx)
+	}
+
+	// Stop retrying right away if the retry budget is spent, without
+	// waiting for the backoff delay.
+	budget := func(attempt uint) bool {
+		if attempt == 0 || c.config.RetryBudget.take() {
+			return true
+		}
+		c.log(logging.Warn, "retry budget exhausted")
+		return false
+	}
+
+	strategies := makeRetryStrategies(c.config.BackoffFactor, c.config.BackoffCap, c.config.RetryLimit, budget, changes)
 
 	// The retry strategy should be configured to retry indefinitely, until
 	// the given context is done.
@@ -93,6 +119,15 @@ func (c *Connector) Connect(ctx context.Context) (*Protocol, error) {
 		default:
 		}
 
+		if attempt > 1 && c.config.Retries != nil {
+			atomic.AddInt64(c.config.Retries, 1)
+		}
+
+		protocol = c.connectAttemptHint(ctx, log)
+		if protocol != nil {
+			return nil
+		}
+
 		var err error
 		protocol, err = c.connectAttemptAll(ctx, log)
 		if err != nil {
@@ -104,7 +139,7 @@ func (c *Connector) Connect(ctx context.Context) (*Protocol, error) {
 
 	if err != nil {
 		// We exhausted the number of retries allowed by the configured
-		// strategy.
+		// strategy, or the retry budget.
 		return nil, ErrNoAvailableLeader
 	}
 
@@ -122,14 +157,86 @@ func (c *Connector) Connect(ctx context.Context) (*Protocol, error) {
 	return protocol, nil
 }
 
+// Make a single attempt to establish a connection to the leader hinted by the
+// last node that lost leadership, if any, without probing all servers. The
+// hint is either the address of the new leader or the address of that node,
+// which is then asked who the leader is. The hint is cleared if that fails.
+func (c *Connector) connectAttemptHint(ctx context.Context, log logging.Func) *Protocol {
+	address := c.config.LeaderHint.get()
+	if address == "" {
+		return nil
+	}
+
+	log = func(l logging.Level, format string, a ...interface{}) {
+		format = fmt.Sprintf("server %s: ", address) + format
+		log(l, format, a...)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, c.config.AttemptTimeout)
+	defer cancel()
+
+	protocol, leader, err := c.connectAttemptOne(ctx, attemptCtx, address, log)
+	if err != nil {
+		log(logging.Debug, "hinted leader unavailable err=%v", err)
+		c.config.LeaderHint.clear(address)
+		return nil
+	}
+	if protocol == nil && leader != "" {
+		// The hinted node lost leadership, but knows the new leader.
+		log(logging.Debug, "connect to leader %s reported by hinted node", leader)
+		protocol, _, err = c.connectAttemptOne(ctx, attemptCtx, leader, log)
+		if err != nil {
+			log(logging.Debug, "reported leader unavailable err=%v", err)
+		}
+	}
+	if protocol == nil {
+		log(logging.Debug, "hinted leader is not the leader")
+		c.config.LeaderHint.clear(address)
+		return nil
+	}
+	if leader != "" {
+		c.config.LeaderHint.Set(leader)
+	}
+	log(logging.Debug, "connected to hinted leader")
+	return protocol
+}
+
 // Make a single attempt to establish a connection to the leader server trying
 // all addresses available in the store.
+//
+// If preferred nodes are configured, they are probed first, and the others
+// only if none of them could lead to the leader.
 func (c *Connector) connectAttemptAll(ctx context.Context, log logging.Func) (*Protocol, error) {
 	servers, err := c.store.Get(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "get servers")
 	}
 
+	if c.config.PreferredNodes != nil {
+		var preferred, others []NodeInfo
+		for _, server := range servers {
+			if c.config.PreferredNodes(server) {
+				preferred = append(preferred, server)
+			} else {
+				others = append(others, server)
+			}
+		}
+		if len(preferred) > 0 && len(others) > 0 {
+			protocol, err := c.connectAttemptServers(ctx, preferred, log)
+			if err != ErrNoAvailableLeader {
+				return protocol, err
+			}
+			log(logging.Debug, "no leader found through preferred nodes")
+			servers = others
+		}
+	}
+
+	return c.connectAttemptServers(ctx, servers, log)
+}
+
+// Make a single attempt to establish a connection to the leader server trying
+// the given servers concurrently.
+func (c *Connector) connectAttemptServers(ctx context.Context, servers []NodeInfo, log logging.Func) (*Protocol, error) {
 	// Sort servers by Role, from low to high.
 	sort.Slice(servers, func(i, j int) bool {
 		return servers[i].Role < servers[j].Role
@@ -262,6 +369,61 @@ func Handshake(ctx context.Context, conn net.Conn, version uint64) (*Protocol, e
 	return newProtocol(version, conn), nil
 }
 
+// LeaderHint holds the address of the leader as reported by a node that lost
+// leadership, or of that node if it was not asked, so that the next
+// connection attempt can try it first instead of probing all servers in the
+// store.
+//
+// It's safe for concurrent use, and the zero value holds no address.
+type LeaderHint struct {
+	mu      sync.Mutex
+	address string
+	lost    bool // Whether address is of a node that lost leadership.
+}
+
+// Set records the address of the current leader. An empty address clears
+// the hint.
+func (h *LeaderHint) Set(address string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.address = address
+	h.lost = false
+}
+
+// Record that the node with the given address lost leadership, unless the
+// address of another node was reported as the current leader, in which case
+// that address is returned.
+func (h *LeaderHint) lostBy(address string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.address != "" && h.address != address && !h.lost {
+		return h.address
+	}
+	h.address = address
+	h.lost = true
+	return ""
+}
+
+// Return the recorded address, if any.
+func (h *LeaderHint) get() string {
+	if h == nil {
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.address
+}
+
+// Clear the recorded address, unless it was changed to something else than
+// the given address in the meantime.
+func (h *LeaderHint) clear(address string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.address == address {
+		h.address = ""
+	}
+}
+
 // Connect to the given dqlite server and check if it's the leader.
 //
 // dialCtx is used for net.Dial; ctx is used for all other requests.
@@ -272,11 +434,39 @@ func Handshake(ctx context.Context, conn net.Conn, version uint64) (*Protocol, e
 // - Target not leader and no leader known:  -> nil, "", nil
 // - Target not leader and leader known:     -> nil, leader, nil
 // - Target is the leader:                   -> server, "", nil
+//
+// If a circuit breaker is configured and open for the server, no connection
+// is attempted and errCircuitOpen is returned.
 func (c *Connector) connectAttemptOne(
 	dialCtx context.Context,
 	ctx context.Context,
 	address string,
 	log logging.Func,
+) (*Protocol, string, error) {
+	if !c.config.CircuitBreaker.allow(address) {
+		return nil, "", errCircuitOpen
+	}
+
+	protocol, leader, err := c.connectAttemptServer(dialCtx, ctx, address, log)
+	switch {
+	case err == nil:
+		c.config.CircuitBreaker.success(address)
+	case ctx.Err() == context.Canceled:
+		// The attempt was cut short, the server is not to blame.
+		c.config.CircuitBreaker.release(address)
+	default:
+		c.config.CircuitBreaker.failure(address)
+	}
+
+	return protocol, leader, err
+}
+
+// Implement connectAttemptOne, regardless of the circuit breaker.
+func (c *Connector) connectAttemptServer(
+	dialCtx context.Context,
+	ctx context.Context,
+	address string,
+	log logging.Func,
 ) (*Protocol, string, error) {
 	dialCtx, cancel := context.WithTimeout(dialCtx, c.config.DialTimeout)
 	defer cancel()
@@ -287,6 +477,12 @@ func (c *Connector) connectAttemptOne(
 		return nil, "", errors.Wrap(err, "dial")
 	}
 
+	if c.config.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.HandshakeTimeout)
+		defer cancel()
+	}
+
 	version := VersionOne
 	protocol, err := Handshake(ctx, conn, version)
 	if err == errBadProtocol {
@@ -319,7 +515,7 @@ func (c *Connector) connectAttemptOne(
 		return nil, "", err
 	}
 
-	_, leader, err := DecodeNodeCompat(protocol, &response)
+	id, leader, err := DecodeNodeCompat(protocol, &response)
 	if err != nil {
 		protocol.Close()
 		return nil, "", err
@@ -352,6 +548,11 @@ func (c *Connector) connectAttemptOne(
 		// protocol.heartbeatTimeout = time.Duration(heartbeatTimeout) * time.Millisecond
 		// go protocol.heartbeat()
 
+		protocol.id = id
+		protocol.address = address
+		protocol.hint = c.config.LeaderHint
+		protocol.maxSize = c.config.MaxMessageSize
+
 		return protocol, "", nil
 	default:
 		// This server claims to know who the current leader is.
@@ -362,7 +563,9 @@ func (c *Connector) connectAttemptOne(
 
 // Return a retry strategy with exponential backoff, capped at the given amount
 // of time and possibly with a maximum number of retries.
-func makeRetryStrategies(factor, cap time.Duration, limit uint) []strategy.Strategy {
+// The budget strategy is checked before the backoff delay.
+// If changes is not nil, receiving from it interrupts the backoff delay.
+func makeRetryStrategies(factor, cap time.Duration, limit uint, budget strategy.Strategy, changes <-chan []NodeInfo) []strategy.Strategy {
 	limit += 1 // Fix for change in behavior: https://github.com/Rican7/retry/pull/12
 	backoff := backoff.BinaryExponential(factor)
 
@@ -372,6 +575,8 @@ func makeRetryStrategies(factor, cap time.Duration, limit uint) []strategy.Strat
 		strategies = append(strategies, strategy.Limit(limit))
 	}
 
+	strategies = append(strategies, budget)
+
 	strategies = append(strategies,
 		func(attempt uint) bool {
 			if attempt > 0 {
@@ -380,7 +585,15 @@ func makeRetryStrategies(factor, cap time.Duration, limit uint) []strategy.Strat
 				if duration > cap || duration <= 0 {
 					duration = cap
 				}
-				time.Sleep(duration)
+				select {
+				case <-time.After(duration):
+				case _, ok := <-changes:
+					if !ok {
+						// The store stopped pushing changes.
+						changes = nil
+						time.Sleep(duration)
+					}
+				}
 			}
 
 			return true
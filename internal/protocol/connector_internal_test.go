@@ -0,0 +1,29 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A node losing leadership reports the leader recorded in the hint, if any.
+func TestLeaderHint_LostBy(t *testing.T) {
+	hint := &LeaderHint{}
+
+	assert.Equal(t, "", hint.lostBy("@1"))
+	assert.Equal(t, "@1", hint.get())
+
+	// Another node lost leadership, but the leader is still unknown.
+	assert.Equal(t, "", hint.lostBy("@2"))
+	assert.Equal(t, "@2", hint.get())
+
+	hint.Set("@3")
+	assert.Equal(t, "@3", hint.lostBy("@1"))
+	assert.Equal(t, "@3", hint.get())
+
+	// The recorded leader itself lost leadership.
+	assert.Equal(t, "", hint.lostBy("@3"))
+	assert.Equal(t, "@3", hint.get())
+	assert.Equal(t, "", hint.lostBy("@1"))
+	assert.Equal(t, "@1", hint.get())
+}
@@ -39,18 +39,47 @@ func TestConnector_Success(t *testing.T) {
 	})
 }
 
+// The leader hint is tried before the servers in the store.
+func TestConnector_LeaderHint(t *testing.T) {
+	address, cleanup := newNode(t, 0)
+	defer cleanup()
+
+	store := newStore(t, []string{"@test-123"})
+
+	hint := &protocol.LeaderHint{}
+	hint.Set(address)
+
+	log, check := newLogFunc(t)
+	connector := protocol.NewConnector(0, store, protocol.Config{LeaderHint: hint}, log)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	client, err := connector.Connect(ctx)
+	require.NoError(t, err)
+
+	assert.NoError(t, client.Close())
+
+	check([]string{
+		"DEBUG: attempt 1: server @test-0: connected to hinted leader",
+	})
+}
+
 // The network connection can't be established within the specified number of
 // attempts.
 func TestConnector_LimitRetries(t *testing.T) {
 	store := newStore(t, []string{"@test-123"})
+	retries := int64(0)
 	config := protocol.Config{
 		RetryLimit: 2,
+		Retries:    &retries,
 	}
 	log, check := newLogFunc(t)
 	connector := protocol.NewConnector(0, store, config, log)
 
 	_, err := connector.Connect(context.Background())
 	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+	assert.Equal(t, int64(2), retries)
 
 	check([]string{
 		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
@@ -59,6 +88,152 @@ func TestConnector_LimitRetries(t *testing.T) {
 	})
 }
 
+// Preferred nodes are probed before the others.
+func TestConnector_PreferredNodes(t *testing.T) {
+	store := newStore(t, []string{"@test-124", "@test-123"})
+	config := protocol.Config{
+		RetryLimit: 1,
+		PreferredNodes: func(node protocol.NodeInfo) bool {
+			return node.Address == "@test-123"
+		},
+	}
+	log, check := newLogFunc(t)
+	connector := protocol.NewConnector(0, store, config, log)
+
+	_, err := connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+
+	check([]string{
+		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"DEBUG: attempt 1: no leader found through preferred nodes",
+		"WARN: attempt 1: server @test-124: dial: dial unix @test-124: connect: connection refused",
+		"WARN: attempt 2: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"DEBUG: attempt 2: no leader found through preferred nodes",
+		"WARN: attempt 2: server @test-124: dial: dial unix @test-124: connect: connection refused",
+	})
+}
+
+// A server that keeps failing is skipped once its circuit breaker opens.
+func TestConnector_CircuitBreaker(t *testing.T) {
+	store := newStore(t, []string{"@test-123"})
+	config := protocol.Config{
+		RetryLimit:     2,
+		CircuitBreaker: protocol.NewCircuitBreaker(2, time.Minute),
+	}
+	log, check := newLogFunc(t)
+	connector := protocol.NewConnector(0, store, config, log)
+
+	_, err := connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+
+	check([]string{
+		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: attempt 2: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: attempt 3: server @test-123: circuit breaker open",
+	})
+}
+
+// The circuit breaker lets a new attempt through after the cooldown period.
+func TestConnector_CircuitBreakerCooldown(t *testing.T) {
+	store := newStore(t, []string{"@test-123"})
+	config := protocol.Config{
+		RetryLimit:     2,
+		BackoffFactor:  100 * time.Millisecond,
+		CircuitBreaker: protocol.NewCircuitBreaker(1, 400*time.Millisecond),
+	}
+	log, check := newLogFunc(t)
+	connector := protocol.NewConnector(0, store, config, log)
+
+	_, err := connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+
+	check([]string{
+		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: attempt 2: server @test-123: circuit breaker open",
+		"WARN: attempt 3: server @test-123: dial: dial unix @test-123: connect: connection refused",
+	})
+}
+
+// Connectors sharing a retry budget stop retrying once it's spent.
+func TestConnector_RetryBudget(t *testing.T) {
+	store := newStore(t, []string{"@test-123"})
+	config := protocol.Config{
+		RetryBudget: protocol.NewRetryBudget(1, time.Minute),
+	}
+	log, check := newLogFunc(t)
+	connector := protocol.NewConnector(0, store, config, log)
+
+	_, err := connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+
+	check([]string{
+		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: attempt 2: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: retry budget exhausted",
+	})
+
+	log, check = newLogFunc(t)
+	connector = protocol.NewConnector(0, store, config, log)
+
+	_, err = connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+
+	check([]string{
+		"WARN: attempt 1: server @test-123: dial: dial unix @test-123: connect: connection refused",
+		"WARN: retry budget exhausted",
+	})
+}
+
+// A server accepting connections but not responding is given up on after the
+// handshake timeout, well before the attempt timeout.
+func TestConnector_HandshakeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conns := []net.Conn{}
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	store := newStore(t, []string{listener.Addr().String()})
+	config := protocol.Config{
+		HandshakeTimeout: 100 * time.Millisecond,
+		RetryLimit:       1,
+	}
+	connector := protocol.NewConnector(0, store, config, logging.Test(t))
+
+	start := time.Now()
+	_, err = connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+// Retries stop once the connect timeout expires.
+func TestConnector_ConnectTimeout(t *testing.T) {
+	store := newStore(t, []string{"@test-123"})
+	config := protocol.Config{
+		ConnectTimeout: 300 * time.Millisecond,
+	}
+	connector := protocol.NewConnector(0, store, config, logging.Test(t))
+
+	start := time.Now()
+	_, err := connector.Connect(context.Background())
+	assert.Equal(t, protocol.ErrNoAvailableLeader, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
 // The network connection can't be established because of a connection timeout.
 func TestConnector_DialTimeout(t *testing.T) {
 	store := newStore(t, []string{"8.8.8.8:9000"})
@@ -93,6 +268,36 @@ func TestConnector_EmptyNodeStore(t *testing.T) {
 	check([]string{})
 }
 
+// The backoff delay is cut short when the store pushes a change.
+func TestConnector_StoreWatch(t *testing.T) {
+	address, cleanup := newNode(t, 0)
+	defer cleanup()
+
+	store := &watchStore{
+		InmemNodeStore: protocol.NewInmemNodeStore(),
+		changes:        make(chan []protocol.NodeInfo),
+	}
+
+	log, _ := newLogFunc(t)
+	config := protocol.Config{BackoffFactor: time.Minute, BackoffCap: time.Minute}
+	connector := protocol.NewConnector(0, store, config, log)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		servers := []protocol.NodeInfo{{ID: 1, Address: address}}
+		store.Set(context.Background(), servers)
+		store.changes <- servers
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := connector.Connect(ctx)
+	require.NoError(t, err)
+
+	assert.NoError(t, client.Close())
+}
+
 // Connection failed because the context was canceled.
 func TestConnector_ContextCanceled(t *testing.T) {
 	store := newStore(t, []string{"1.2.3.4:666"})
@@ -308,6 +513,16 @@ func newLogFunc(t *testing.T) (logging.Func, func([]string)) {
 	return log, check
 }
 
+// In-memory server store pushing changes sent to its channel.
+type watchStore struct {
+	*protocol.InmemNodeStore
+	changes chan []protocol.NodeInfo
+}
+
+func (s *watchStore) Watch(ctx context.Context) <-chan []protocol.NodeInfo {
+	return s.changes
+}
+
 // Create a new in-memory server store populated with the given addresses.
 func newStore(t *testing.T, addresses []string) protocol.NodeStore {
 	t.Helper()
@@ -7,10 +7,19 @@ import (
 )
 
 // Dial function handling plain TCP and Unix socket endpoints.
+//
+// TCP addresses are normalized with NormalizeAddress first, so bare IPv6
+// literals and addresses without a port are accepted.
 func Dial(ctx context.Context, address string) (net.Conn, error) {
 	family := "tcp"
 	if strings.HasPrefix(address, "@") {
 		family = "unix"
+	} else {
+		normalized, err := NormalizeAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		address = normalized
 	}
 	dialer := net.Dialer{}
 	return dialer.DialContext(ctx, family, address)
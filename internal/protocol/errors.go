@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"database/sql/driver"
 	"fmt"
 )
 
@@ -14,6 +15,17 @@ var (
 	errMessageEOF        = fmt.Errorf("message eof")
 )
 
+// ErrMessageTooLarge is returned when the body of a request or of a response
+// exceeds the maximum message size set on the connection.
+type ErrMessageTooLarge struct {
+	Size uint64 // Size of the message body, in bytes.
+	Max  uint64 // Maximum allowed size, in bytes.
+}
+
+func (e ErrMessageTooLarge) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the maximum size of %d bytes", e.Size, e.Max)
+}
+
 // ErrRequest is returned in case of request failure.
 type ErrRequest struct {
 	Code        uint64
@@ -24,16 +36,83 @@ func (e ErrRequest) Error() string {
 	return fmt.Sprintf("%s (%d)", e.Description, e.Code)
 }
 
+// Extended error codes returned by nodes that are not the leader or that lost
+// leadership while processing a request.
+const (
+	errIoErrNotLeader            = 10 | (40 << 8)
+	errIoErrLeadershipLost       = 10 | (41 << 8)
+	errIoErrNotLeaderLegacy      = 10 | (32 << 8)
+	errIoErrLeadershipLostLegacy = 10 | (33 << 8)
+)
+
+// NotLeader returns true if the request failed because the node is not the
+// leader or lost leadership.
+func (e ErrRequest) NotLeader() bool {
+	switch e.Code {
+	case errIoErrNotLeader, errIoErrLeadershipLost, errIoErrNotLeaderLegacy, errIoErrLeadershipLostLegacy:
+		return true
+	}
+	return false
+}
+
+// ErrNotLeader is returned when a request that must be served by the leader
+// was sent to a node that is not the leader, or lost leadership.
+type ErrNotLeader struct {
+	LeaderAddress string // Address of the current leader, if known.
+}
+
+func (e ErrNotLeader) Error() string {
+	if e.LeaderAddress == "" {
+		return "node is not the leader"
+	}
+	return fmt.Sprintf("node is not the leader, current leader is %s", e.LeaderAddress)
+}
+
+// Is makes ErrNotLeader match driver.ErrBadConn, so database/sql discards
+// the connection and retries with a new one, which gets established with the
+// new leader.
+func (e ErrNotLeader) Is(target error) bool {
+	return target == driver.ErrBadConn
+}
+
 // ErrRowsPart is returned when the first batch of a multi-response result
 // batch is done.
 var ErrRowsPart = fmt.Errorf("not all rows were returned in this response")
 
 // Error holds information about a SQLite error.
 type Error struct {
-	Code    int
+	Code    int // Result code, possibly an extended one such as SQLITE_CONSTRAINT_UNIQUE.
 	Message string
 }
 
+// NewError returns an Error with the given result code.
+func NewError(code uint64, message string) Error {
+	return Error{
+		Code:    int(code),
+		Message: message,
+	}
+}
+
 func (e Error) Error() string {
 	return e.Message
 }
+
+// PrimaryCode returns the primary result code of the error, such as
+// SQLITE_CONSTRAINT for SQLITE_CONSTRAINT_UNIQUE.
+func (e Error) PrimaryCode() int {
+	return e.Code & 0xff
+}
+
+// Is matches target if it's an Error with the same code or, if the target's
+// code is a primary one, with the same primary code. This allows checking
+// errors with errors.Is(err, Error{Code: SQLITE_CONSTRAINT}).
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	if !ok {
+		return false
+	}
+	if t.Code == t.PrimaryCode() {
+		return e.PrimaryCode() == t.Code
+	}
+	return e.Code == t.Code
+}
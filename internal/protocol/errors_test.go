@@ -0,0 +1,30 @@
+package protocol_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/canonical/go-dqlite/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	err := protocol.NewError(2067, "UNIQUE constraint failed: test.n")
+
+	assert.Equal(t, 2067, err.Code)
+	assert.Equal(t, 19, err.PrimaryCode())
+	assert.True(t, errors.Is(err, protocol.Error{Code: 19}))
+	assert.True(t, errors.Is(err, protocol.Error{Code: 2067}))
+	assert.False(t, errors.Is(err, protocol.Error{Code: 1555}))
+	assert.False(t, errors.Is(err, protocol.Error{Code: 5}))
+}
+
+func TestErrNotLeader_Is(t *testing.T) {
+	var err error = protocol.ErrNotLeader{LeaderAddress: "127.0.0.1:9001"}
+
+	var notLeader protocol.ErrNotLeader
+	assert.True(t, errors.As(err, &notLeader))
+	assert.Equal(t, "127.0.0.1:9001", notLeader.LeaderAddress)
+	assert.True(t, errors.Is(err, driver.ErrBadConn))
+}
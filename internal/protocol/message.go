@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -301,9 +302,10 @@ func (m *Message) getHeader() (uint8, uint8) {
 func (m *Message) getString() string {
 	b := m.bufferForGet()
 
-	index := bytes.IndexByte(b.Bytes[b.Offset:], 0)
+	size := int(m.words * messageWordSize)
+	index := bytes.IndexByte(b.Bytes[b.Offset:size], 0)
 	if index == -1 {
-		panic("no string found")
+		panic(malformedError{fmt.Errorf("no string found")})
 	}
 	s := string(b.Bytes[b.Offset : b.Offset+index])
 
@@ -320,16 +322,26 @@ func (m *Message) getString() string {
 }
 
 func (m *Message) getBlob() []byte {
+	ref := m.getBlobRef()
+	data := make([]byte, len(ref))
+	copy(data, ref)
+	return data
+}
+
+// Return a blob pointing directly into the message body, which is only valid
+// until the message gets reused.
+func (m *Message) getBlobRef() []byte {
 	size := m.getUint64()
-	data := make([]byte, size)
-	b := m.bufferForGet()
+	m.need(size)
+	b := &m.body
 	defer b.Advance(int(alignUp(size, messageWordSize)))
-	copy(data, b.Bytes[b.Offset:])
-	return data
+	end := b.Offset + int(size)
+	return b.Bytes[b.Offset:end:end]
 }
 
 // Read a byte from the message body.
 func (m *Message) getUint8() uint8 {
+	m.need(1)
 	b := m.bufferForGet()
 	defer b.Advance(1)
 
@@ -338,6 +350,7 @@ func (m *Message) getUint8() uint8 {
 
 // Read a 2-byte word from the message body.
 func (m *Message) getUint16() uint16 {
+	m.need(2)
 	b := m.bufferForGet()
 	defer b.Advance(2)
 
@@ -346,6 +359,7 @@ func (m *Message) getUint16() uint16 {
 
 // Read a 4-byte word from the message body.
 func (m *Message) getUint32() uint32 {
+	m.need(4)
 	b := m.bufferForGet()
 	defer b.Advance(4)
 
@@ -354,6 +368,7 @@ func (m *Message) getUint32() uint32 {
 
 // Read reads an 8-byte word from the message body.
 func (m *Message) getUint64() uint64 {
+	m.need(8)
 	b := m.bufferForGet()
 	defer b.Advance(8)
 
@@ -362,6 +377,7 @@ func (m *Message) getUint64() uint64 {
 
 // Read a signed 8-byte word from the message body.
 func (m *Message) getInt64() int64 {
+	m.need(8)
 	b := m.bufferForGet()
 	defer b.Advance(8)
 
@@ -370,6 +386,7 @@ func (m *Message) getInt64() int64 {
 
 // Read a floating point number from the message body.
 func (m *Message) getFloat64() float64 {
+	m.need(8)
 	b := m.bufferForGet()
 	defer b.Advance(8)
 
@@ -379,6 +396,8 @@ func (m *Message) getFloat64() float64 {
 // Decode a list of server objects from the message body.
 func (m *Message) getNodes() Nodes {
 	n := m.getUint64()
+	// Each server takes at least three words.
+	m.needEach(n, 3*messageWordSize)
 	servers := make(Nodes, n)
 
 	for i := 0; i < int(n); i++ {
@@ -400,8 +419,11 @@ func (m *Message) getResult() Result {
 
 // Decode a query result set object from the message body.
 func (m *Message) getRows() Rows {
-	// Read the column count and column names.
-	columns := make([]string, m.getUint64())
+	// Read the column count and column names, each taking at least one
+	// word.
+	n := m.getUint64()
+	m.needEach(n, messageWordSize)
+	columns := make([]string, n)
 
 	for i := range columns {
 		columns[i] = m.getString()
@@ -429,20 +451,55 @@ func (m *Message) hasBeenConsumed() bool {
 
 func (m *Message) lastByte() byte {
 	size := int(m.words * messageWordSize)
+	if size == 0 {
+		return 0
+	}
 	return m.body.Bytes[size-1]
 }
 
 func (m *Message) bufferForGet() *buffer {
 	size := int(m.words * messageWordSize)
 	// The static body has been exahusted, use the dynamic one.
-	if m.body.Offset == size {
-		err := fmt.Errorf("short message: type=%d words=%d off=%d", m.mtype, m.words, m.body.Offset)
-		panic(err)
+	if m.body.Offset >= size {
+		panic(malformedError{fmt.Errorf("short message: type=%d words=%d off=%d", m.mtype, m.words, m.body.Offset)})
 	}
 
 	return &m.body
 }
 
+// Check that the message body has at least n more bytes to read.
+func (m *Message) need(n uint64) {
+	m.needEach(n, 1)
+}
+
+// Check that the message body has enough bytes left to read n items, each
+// taking at least the given size.
+func (m *Message) needEach(n uint64, size uint64) {
+	total := uint64(m.words) * messageWordSize
+	offset := uint64(m.body.Offset)
+	if offset > total || n > (total-offset)/size {
+		panic(malformedError{fmt.Errorf("short message: type=%d words=%d off=%d need=%dx%d", m.mtype, m.words, m.body.Offset, n, size)})
+	}
+}
+
+// Error raised as panic by the functions reading the message body when the
+// message is malformed, and turned back into an error by recoverMalformed.
+type malformedError struct {
+	error
+}
+
+// Turn a panic caused by a malformed message into an error assigned to err.
+// It must be deferred by functions decoding messages.
+func recoverMalformed(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(malformedError)
+		if !ok {
+			panic(r)
+		}
+		*err = e.error
+	}
+}
+
 // Result holds the result of a statement.
 type Result struct {
 	LastInsertID uint64
@@ -491,7 +548,7 @@ func (r *Rows) columnTypes(save bool) ([]uint8, error) {
 		if slot == 0xee {
 			// More rows are available.
 			if save {
-				r.message.bufferForGet().Advance(-(i + 1))
+				r.message.body.Advance(-(i + 1))
 			}
 			return r.types, ErrRowsPart
 		}
@@ -499,7 +556,7 @@ func (r *Rows) columnTypes(save bool) ([]uint8, error) {
 		if slot == 0xff {
 			// Rows EOF marker
 			if save {
-				r.message.bufferForGet().Advance(-(i + 1))
+				r.message.body.Advance(-(i + 1))
 			}
 			return r.types, io.EOF
 		}
@@ -521,13 +578,35 @@ func (r *Rows) columnTypes(save bool) ([]uint8, error) {
 		r.types[index] = slot >> 4
 	}
 	if save {
-		r.message.bufferForGet().Advance(-headerSize)
+		r.message.body.Advance(-headerSize)
 	}
 	return r.types, nil
 }
 
+// RowTypes returns the types of the values of the row last returned by Next,
+// which tell apart the values of timestamp columns.
+func (r *Rows) RowTypes() []uint8 {
+	return r.types
+}
+
 // Next returns the next row in the result set.
 func (r *Rows) Next(dest []driver.Value) error {
+	return r.next(dest, true)
+}
+
+// NextNoCopy is like Next, but BLOB values point directly into the underlying
+// message instead of being copied, so they are only valid until the message
+// is reused, for example to fetch the next batch of rows.
+//
+// This matches the contract of driver.Rows.Next, and saves an allocation per
+// value when scanning into []byte or sql.RawBytes.
+func (r *Rows) NextNoCopy(dest []driver.Value) error {
+	return r.next(dest, false)
+}
+
+func (r *Rows) next(dest []driver.Value, copyBlobs bool) (err error) {
+	defer recoverMalformed(&err)
+
 	types, err := r.columnTypes(false)
 	if err != nil {
 		return err
@@ -540,7 +619,11 @@ func (r *Rows) Next(dest []driver.Value) error {
 		case Float:
 			dest[i] = r.message.getFloat64()
 		case Blob:
-			dest[i] = r.message.getBlob()
+			if copyBlobs {
+				dest[i] = r.message.getBlob()
+			} else {
+				dest[i] = r.message.getBlobRef()
+			}
 		case Text:
 			dest[i] = r.message.getString()
 		case Null:
@@ -566,14 +649,21 @@ func (r *Rows) Next(dest []driver.Value) error {
 				}
 			}
 			if err != nil {
-				return err
+				// Numbers stored in timestamp columns, like Julian
+				// day numbers, are sent as text too.
+				number, parseErr := strconv.ParseFloat(value, 64)
+				if parseErr != nil {
+					return err
+				}
+				dest[i] = number
+				break
 			}
 
 			dest[i] = t
 		case Boolean:
 			dest[i] = r.message.getInt64() != 0
 		default:
-			panic("unknown data type")
+			return fmt.Errorf("unknown data type: %d", types[i])
 		}
 	}
 
@@ -604,22 +694,37 @@ func (r *Rows) Close() error {
 type Files struct {
 	n       uint64
 	message *Message
+	err     error
 }
 
-func (f *Files) Next() (string, []byte) {
-	if f.n == 0 {
+// Next returns the name and content of the next file, or an empty name if
+// there are no more files or the message is malformed, see Err.
+func (f *Files) Next() (name string, data []byte) {
+	if f.n == 0 || f.err != nil {
 		return "", nil
 	}
+	defer func() {
+		if f.err != nil {
+			name, data = "", nil
+		}
+	}()
+	defer recoverMalformed(&f.err)
 	f.n--
-	name := f.message.getString()
+	name = f.message.getString()
 	length := f.message.getUint64()
-	data := make([]byte, length)
+	f.message.need(length)
+	data = make([]byte, length)
 	for i := 0; i < int(length); i++ {
 		data[i] = f.message.getUint8()
 	}
 	return name, data
 }
 
+// Err returns the error hit by Next if the message is malformed.
+func (f *Files) Err() error {
+	return f.err
+}
+
 func (f *Files) Close() {
 	f.message.reset()
 }
@@ -646,7 +751,9 @@ var iso8601Formats = []string{
 }
 
 // ColumnTypes returns the column types for the the result set.
-func (r *Rows) ColumnTypes() ([]string, error) {
+func (r *Rows) ColumnTypes() (_ []string, err error) {
+	defer recoverMalformed(&err)
+
 	types, err := r.columnTypes(true)
 	kinds := make([]string, len(types))
 
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"testing"
 	"time"
@@ -302,6 +303,28 @@ func TestMessage_getBlob(t *testing.T) {
 	}
 }
 
+func TestMessage_getBlobRef(t *testing.T) {
+	message := Message{}
+	message.Init(64)
+
+	message.putBlob([]byte{1, 2, 3, 4, 5})
+	message.putHeader(0, 0)
+
+	message.Rewind()
+
+	bytes := message.getBlobRef()
+
+	_, offset := message.Body()
+
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, bytes)
+	assert.Equal(t, 5, cap(bytes))
+	assert.Equal(t, 16, offset)
+
+	// The blob shares the message body.
+	message.body.Bytes[8] = 9
+	assert.Equal(t, byte(9), bytes[0])
+}
+
 func BenchmarkMessage_getBlob(b *testing.B) {
 	makeBlob := func(size int) []byte {
 		blob := make([]byte, size)
@@ -327,6 +350,24 @@ func BenchmarkMessage_getBlob(b *testing.B) {
 	}
 }
 
+func BenchmarkMessage_getBlobRef(b *testing.B) {
+	for _, size := range []int{16, 64, 256, 1024, 4096, 8096} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			message := Message{}
+			message.Init(size + 16)
+
+			message.putBlob(make([]byte, size))
+			message.putHeader(0, 0)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				message.Rewind()
+				_ = message.getBlobRef()
+			}
+		})
+	}
+}
+
 // The overflowing string ends exactly at word boundary.
 func TestMessage_getString_Overflow_WordBoundary(t *testing.T) {
 	message := Message{}
@@ -347,3 +388,26 @@ func TestMessage_getString_Overflow_WordBoundary(t *testing.T) {
 
 	assert.Equal(t, 32, message.body.Offset)
 }
+
+// Numbers stored in timestamp columns are sent as text and decoded as float64.
+func TestRows_NextNumericTimestamp(t *testing.T) {
+	message := Message{}
+	message.Init(64)
+
+	message.putUint8(ISO8601 | ISO8601<<4)
+	message.putUint8(0)
+	message.putUint32(0)
+	message.putUint16(0)
+	message.putString("2460385.25")
+	message.putString("2024-03-15 18:00:00")
+	message.putHeader(0, 0)
+	message.Rewind()
+
+	rows := Rows{Columns: []string{"a", "b"}, message: &message}
+	dest := make([]driver.Value, 2)
+	require.NoError(t, rows.Next(dest))
+
+	assert.Equal(t, 2460385.25, dest[0])
+	assert.Equal(t, time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC), dest[1])
+	assert.Equal(t, []uint8{ISO8601, ISO8601}, rows.RowTypes())
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,11 +14,16 @@ import (
 
 // Protocol sends and receive the dqlite message on the wire.
 type Protocol struct {
+	used    int64         // Time of the last request, in Unix nanoseconds (first for atomic alignment).
 	version uint64        // Protocol version
 	conn    net.Conn      // Underlying network connection.
 	closeCh chan struct{} // Stops the heartbeat when the connection gets closed
 	mu      sync.Mutex    // Serialize requests
 	netErr  error         // A network error occurred
+	id      uint64        // ID of the connected node, if known.
+	address string        // Address of the connected node, if known.
+	hint    *LeaderHint   // Updated when the node reports a new leader.
+	maxSize uint64        // Maximum size of message bodies, or 0 for no limit.
 }
 
 func newProtocol(version uint64, conn net.Conn) *Protocol {
@@ -25,11 +31,95 @@ func newProtocol(version uint64, conn net.Conn) *Protocol {
 		version: version,
 		conn:    conn,
 		closeCh: make(chan struct{}),
+		used:    time.Now().UnixNano(),
 	}
 
 	return protocol
 }
 
+// Idle returns how long ago the last request was sent over this protocol, or
+// the connection was established if no request was sent yet.
+func (p *Protocol) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&p.used)))
+}
+
+// SetMaxMessageSize sets the maximum size in bytes of the body of the messages
+// sent and received over this protocol, or 0 for no limit.
+//
+// Sending a larger request fails with ErrMessageTooLarge without affecting
+// the connection, while receiving a larger response fails with
+// ErrMessageTooLarge and breaks the connection, since the rest of the response
+// can't be skipped reliably.
+func (p *Protocol) SetMaxMessageSize(size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxSize = size
+}
+
+// Broken returns true if a previous request failed in a way that left the
+// connection unusable.
+func (p *Protocol) Broken() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.netErr != nil
+}
+
+// Node returns the ID and address of the node this protocol is connected to,
+// if known.
+func (p *Protocol) Node() (uint64, string) {
+	return p.id, p.address
+}
+
+// NotLeader asks the node for the current leader, after a request failed
+// because the node is not the leader anymore.
+//
+// It returns an ErrNotLeader error holding the address of the leader, if the
+// node knows it, along with the error hit while asking, if any. The address
+// is also recorded in the leader hint of the connector that created this
+// protocol, so the next connection gets established with the leader directly.
+func (p *Protocol) NotLeader(ctx context.Context) (ErrNotLeader, error) {
+	request := Message{}
+	request.Init(16)
+	response := Message{}
+	response.Init(512)
+
+	EncodeLeader(&request)
+
+	if err := p.Call(ctx, &request, &response); err != nil {
+		return ErrNotLeader{}, err
+	}
+	_, address, err := DecodeNodeCompat(p, &response)
+	if err != nil {
+		return ErrNotLeader{}, err
+	}
+
+	if address == p.address {
+		// The node thinks it's still the leader, so the hint would be
+		// stale.
+		address = ""
+	}
+	if p.hint != nil {
+		p.hint.Set(address)
+	}
+
+	return ErrNotLeader{LeaderAddress: address}, nil
+}
+
+// LostLeadership records, after a request failed because the node is not the
+// leader anymore, that the next connection attempt of the connector that
+// created this protocol should start by asking this node who the current
+// leader is. No request is sent.
+//
+// If another node was already recorded as the leader, for example because
+// another connection asked, the hint is left alone and the address of that
+// node is returned.
+func (p *Protocol) LostLeadership() string {
+	if p.hint == nil || p.address == "" {
+		return ""
+	}
+	return p.hint.lostBy(p.address)
+}
+
 // Call invokes a dqlite RPC, sending a request message and receiving a
 // response message.
 func (p *Protocol) Call(ctx context.Context, request, response *Message) (err error) {
@@ -63,6 +153,8 @@ func (p *Protocol) Call(ctx context.Context, request, response *Message) (err er
 
 	desc := requestDesc(request.mtype)
 
+	atomic.StoreInt64(&p.used, time.Now().UnixNano())
+
 	if err = p.send(request); err != nil {
 		return errors.Wrapf(err, "call %s (budget %s): send", desc, budget)
 	}
@@ -114,6 +206,13 @@ func (p *Protocol) Interrupt(ctx context.Context, request *Message, response *Me
 	return nil
 }
 
+// Abort closes the underlying network connection, making the request in
+// flight, if any, fail without waiting for the response. The protocol can't
+// be used anymore, but must still be closed with Close.
+func (p *Protocol) Abort() error {
+	return p.conn.Close()
+}
+
 // Close the client connection.
 func (p *Protocol) Close() error {
 	close(p.closeCh)
@@ -121,6 +220,10 @@ func (p *Protocol) Close() error {
 }
 
 func (p *Protocol) send(req *Message) error {
+	if size := uint64(req.body.Offset); p.maxSize > 0 && size > p.maxSize {
+		return ErrMessageTooLarge{Size: size, Max: p.maxSize}
+	}
+
 	if err := p.sendHeader(req); err != nil {
 		return errors.Wrap(err, "header")
 	}
@@ -189,6 +292,12 @@ func (p *Protocol) recvHeader(res *Message) error {
 func (p *Protocol) recvBody(res *Message) error {
 	n := int(res.words) * messageWordSize
 
+	if size := uint64(n); p.maxSize > 0 && size > p.maxSize {
+		err := ErrMessageTooLarge{Size: size, Max: p.maxSize}
+		p.netErr = err
+		return err
+	}
+
 	for n > len(res.body.Bytes) {
 		// Grow message buffer.
 		bytes := make([]byte, len(res.body.Bytes)*2)
@@ -306,3 +415,14 @@ func DecodeNodeCompat(protocol *Protocol, response *Message) (uint64, string, er
 	}
 	return DecodeNode(response)
 }
+
+// DecodeError returns the error carried by the given response if it's a
+// failure response, or nil otherwise, in which case the response is left
+// untouched.
+func DecodeError(response *Message) error {
+	if mtype, _ := response.getHeader(); mtype != ResponseFailure {
+		return nil
+	}
+	_, _, err := DecodeFailure(response)
+	return err
+}
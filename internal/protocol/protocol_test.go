@@ -2,11 +2,16 @@ package protocol_test
 
 import (
 	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/canonical/go-dqlite/internal/protocol"
 	"github.com/canonical/go-dqlite/logging"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -187,3 +192,49 @@ func newMessagePair(size1, size2 int) (protocol.Message, protocol.Message) {
 
 	return message1, message2
 }
+
+func TestProtocol_MaxMessageSize(t *testing.T) {
+	conn, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		// Read the handshake and the request, then reply with a header
+		// announcing a 1024 bytes body.
+		buf := make([]byte, 8+8+8)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			return
+		}
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint32(header, 1024/8)
+		server.Write(header)
+	}()
+
+	ctx := context.Background()
+	p, err := protocol.Handshake(ctx, conn, protocol.VersionOne)
+	require.NoError(t, err)
+	defer p.Close()
+
+	p.SetMaxMessageSize(512)
+
+	// Requests exceeding the limit are not sent.
+	request := protocol.Message{}
+	request.Init(4096)
+	response := protocol.Message{}
+	response.Init(4096)
+	protocol.EncodeExecSQLV0(&request, 0, strings.Repeat("x", 1024), nil)
+
+	_, size := request.Body()
+	err = p.Call(ctx, &request, &response)
+	require.Error(t, err)
+	assert.Equal(t, protocol.ErrMessageTooLarge{Size: uint64(size), Max: 512}, errors.Cause(err))
+	assert.False(t, p.Broken())
+
+	// Responses exceeding the limit break the connection.
+	request.Init(4096)
+	protocol.EncodeLeader(&request)
+
+	err = p.Call(ctx, &request, &response)
+	require.Error(t, err)
+	assert.Equal(t, protocol.ErrMessageTooLarge{Size: 1024, Max: 512}, errors.Cause(err))
+	assert.True(t, p.Broken())
+}
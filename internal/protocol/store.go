@@ -44,6 +44,19 @@ type NodeStore interface {
 	Set(context.Context, []NodeInfo) error
 }
 
+// NodeStoreWatcher is an optional interface that a NodeStore can implement if
+// it learns about changes of the cluster servers from an external source, for
+// example a configuration service.
+//
+// When connecting, the connector watches the store and retries right away
+// when a change is pushed, instead of waiting for the backoff delay after a
+// failed attempt.
+type NodeStoreWatcher interface {
+	// Watch returns a channel receiving the new list of servers every
+	// time it changes, until the given context is done.
+	Watch(context.Context) <-chan []NodeInfo
+}
+
 // InmemNodeStore keeps the list of servers in memory.
 type InmemNodeStore struct {
 	mu      sync.RWMutex
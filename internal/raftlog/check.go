@@ -0,0 +1,174 @@
+package raftlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Report describes the problems found by Check.
+type Report struct {
+	// Problems found, in the order they were found. Empty if the directory
+	// is healthy.
+	Problems []Problem
+
+	// Tail is set if the log is damaged. The log can then be repaired by
+	// dropping everything from the first damaged batch on, see Truncate.
+	Tail *Tail
+}
+
+// Problem describes a damaged file.
+type Problem struct {
+	File        string // Base name of the file.
+	Description string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.File, p.Description)
+}
+
+// Tail is the damaged part of the log.
+type Tail struct {
+	Segment Segment   // First damaged segment.
+	Offset  int64     // End of the valid data in the segment.
+	Entries int       // Number of valid entries in the segment.
+	Dropped []Segment // Segments following the damaged one.
+}
+
+// Check validates the raft files in the given directory: it decodes the
+// metadata files, the snapshot metadata files and every batch of every
+// segment, verifying their checksums, and makes sure that the closed segments
+// hold the entries their names advertise, without gaps.
+//
+// The node must not be running.
+func Check(dir string) (*Report, error) {
+	report := &Report{}
+
+	if _, err := ReadMetadata(dir); err != nil {
+		report.Problems = append(report.Problems, Problem{File: "metadata", Description: err.Error()})
+	}
+
+	segments, snapshots, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Err != nil {
+			problem := Problem{File: filepath.Base(snapshot.Path) + ".meta", Description: snapshot.Err.Error()}
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	next := uint64(0) // Index expected for the next closed segment.
+	for i, segment := range segments {
+		name := filepath.Base(segment.Path)
+		damaged := func(offset int64, entries int, description string) {
+			report.Problems = append(report.Problems, Problem{File: name, Description: description})
+			if report.Tail == nil {
+				report.Tail = &Tail{
+					Segment: segment,
+					Offset:  offset,
+					Entries: entries,
+					Dropped: segments[i+1:],
+				}
+			}
+		}
+
+		if !segment.Open {
+			if next != 0 && segment.FirstIndex != next {
+				damaged(0, 0, fmt.Sprintf("expected first index %d", next))
+			}
+			next = segment.LastIndex + 1
+		}
+
+		entries, end, err := ReadSegment(segment.Path)
+		if err != nil {
+			damaged(end, len(entries), err.Error())
+			continue
+		}
+		if segment.Open {
+			continue
+		}
+		expected := segment.LastIndex - segment.FirstIndex + 1
+		if uint64(len(entries)) < expected {
+			damaged(end, len(entries), fmt.Sprintf("truncated: %d entries instead of %d", len(entries), expected))
+		} else if uint64(len(entries)) > expected {
+			report.Problems = append(report.Problems, Problem{
+				File:        name,
+				Description: fmt.Sprintf("%d entries instead of %d", len(entries), expected),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Truncate drops the given damaged tail of the log in the given directory.
+//
+// The damaged segment is cut at the end of its valid data: an open segment is
+// zero-filled from there, and a closed segment is truncated and renamed after
+// its new last index, or removed if no valid entry is left. All following
+// segments are removed.
+func Truncate(dir string, tail *Tail) error {
+	segment := tail.Segment
+
+	switch {
+	case segment.Open:
+		if err := zeroFill(segment.Path, tail.Offset); err != nil {
+			return err
+		}
+	case tail.Entries == 0:
+		if err := os.Remove(segment.Path); err != nil {
+			return err
+		}
+	default:
+		if err := os.Truncate(segment.Path, tail.Offset); err != nil {
+			return err
+		}
+		last := segment.FirstIndex + uint64(tail.Entries) - 1
+		name := fmt.Sprintf("%016d-%016d", segment.FirstIndex, last)
+		if err := os.Rename(segment.Path, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	for _, dropped := range tail.Dropped {
+		if err := os.Remove(dropped.Path); err != nil {
+			return err
+		}
+	}
+
+	return syncDir(dir)
+}
+
+// Overwrite the content of the given file with zeros, from the given offset
+// to the end.
+func zeroFill(path string, offset int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if size := info.Size() - offset; size > 0 {
+		if _, err := file.WriteAt(make([]byte, size), offset); err != nil {
+			return err
+		}
+	}
+
+	return file.Sync()
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
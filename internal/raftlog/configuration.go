@@ -0,0 +1,75 @@
+package raftlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Role is the role of a server in a raft configuration.
+type Role uint8
+
+// Raft roles. Note that they are numbered differently than client.NodeRole.
+const (
+	StandBy Role = 0
+	Voter   Role = 1
+	Spare   Role = 2
+)
+
+func (r Role) String() string {
+	switch r {
+	case StandBy:
+		return "stand-by"
+	case Voter:
+		return "voter"
+	case Spare:
+		return "spare"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(r))
+	}
+}
+
+// Server is a member of a raft configuration.
+type Server struct {
+	ID      uint64
+	Address string
+	Role    Role
+}
+
+// DecodeConfiguration decodes a cluster configuration, as stored in the data
+// of Change entries and in snapshot metadata.
+//
+// The encoding is a format byte, the number of servers and, for each server,
+// its ID, its NULL-terminated address and its role.
+func DecodeConfiguration(data []byte) ([]Server, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("configuration too short: %d bytes", len(data))
+	}
+	if data[0] != diskFormat {
+		return nil, fmt.Errorf("unsupported configuration format %d", data[0])
+	}
+	n := binary.LittleEndian.Uint64(data[1:])
+	data = data[9:]
+
+	if n > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid number of servers %d", n)
+	}
+	servers := make([]Server, n)
+	for i := range servers {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated server %d", i)
+		}
+		servers[i].ID = binary.LittleEndian.Uint64(data)
+		data = data[8:]
+
+		end := bytes.IndexByte(data, 0)
+		if end == -1 || end+1 >= len(data) {
+			return nil, fmt.Errorf("truncated server %d", i)
+		}
+		servers[i].Address = string(data[:end])
+		servers[i].Role = Role(data[end+1])
+		data = data[end+2:]
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,33 @@
+package raftlog
+
+// Checksums of batches and snapshot metadata are computed by the raft engine
+// with the CRC-32 of libiberty: polynomial 0x04c11db7, processed most
+// significant bit first, with an initial value of zero and no final XOR. This
+// is not the IEEE CRC-32 of hash/crc32, which is bit-reflected, starts at
+// 0xffffffff and is inverted at the end.
+var crcTable = makeCRCTable(0x04c11db7)
+
+func makeCRCTable(poly uint32) *[256]uint32 {
+	table := new([256]uint32)
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// Update the given checksum with the bytes in the given buffer. The checksum
+// of a buffer is obtained by passing an initial value of zero.
+func crc32(crc uint32, buf []byte) uint32 {
+	for _, b := range buf {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
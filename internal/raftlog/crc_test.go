@@ -0,0 +1,15 @@
+package raftlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The CRC-32/POSIX check value of "123456789" is 0x765e7680. The raft engine
+// uses the same CRC without the final XOR.
+func TestCRC32(t *testing.T) {
+	assert.Equal(t, uint32(0x765e7680^0xffffffff), crc32(0, []byte("123456789")))
+	assert.Equal(t, crc32(0, []byte("123456789")), crc32(crc32(0, []byte("1234")), []byte("56789")))
+	assert.Equal(t, uint32(0), crc32(0, nil))
+}
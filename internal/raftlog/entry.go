@@ -0,0 +1,139 @@
+package raftlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+// EntryType is the type of a log entry.
+type EntryType uint8
+
+// Types of log entries.
+const (
+	Command EntryType = 1 // Database changes applied by dqlite.
+	Barrier EntryType = 2 // Internal entry with no content.
+	Change  EntryType = 3 // Cluster configuration change.
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case Command:
+		return "command"
+	case Barrier:
+		return "barrier"
+	case Change:
+		return "change"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// Entry is a log entry.
+type Entry struct {
+	Term uint64
+	Type EntryType
+	Data []byte
+}
+
+// ReadSegment reads the entries of the segment at the given path.
+//
+// If the segment is damaged, the entries of the batches preceding the damage
+// are returned along with an error describing it. The returned offset is
+// always the end of the last valid batch.
+//
+// Open segments are preallocated and zero-filled, so reading one stops at the
+// first batch made of zeros.
+func ReadSegment(path string) ([]Entry, int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("segment too short: %d bytes", len(data))
+	}
+	format := binary.LittleEndian.Uint64(data)
+	if format == 0 && isZero(data) {
+		return nil, 0, nil // Open segment that was never written.
+	}
+	if format != diskFormat {
+		return nil, 0, fmt.Errorf("unsupported format %d", format)
+	}
+
+	var entries []Entry
+	offset := 8
+	for offset < len(data) {
+		batch, size, err := decodeBatch(data[offset:])
+		if err != nil {
+			return entries, int64(offset), fmt.Errorf("batch at offset %d: %w", offset, err)
+		}
+		if size == 0 {
+			break
+		}
+		entries = append(entries, batch...)
+		offset += size
+	}
+
+	return entries, int64(offset), nil
+}
+
+// Decode the batch at the beginning of the given buffer, returning its entries
+// and its size, which is zero if the batch is made of zeros.
+//
+// A batch starts with the checksums of its header and of its data, followed by
+// the header, made of the number of entries and, for each entry, its term,
+// type and size. The data of the entries comes next, each padded to 8 bytes.
+func decodeBatch(buf []byte) ([]Entry, int, error) {
+	if len(buf) < 16 {
+		if isZero(buf) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("truncated preamble")
+	}
+	headerChecksum := binary.LittleEndian.Uint32(buf)
+	dataChecksum := binary.LittleEndian.Uint32(buf[4:])
+	n := binary.LittleEndian.Uint64(buf[8:])
+	if headerChecksum == 0 && dataChecksum == 0 && n == 0 {
+		return nil, 0, nil
+	}
+
+	if n == 0 || n > uint64(len(buf)-16)/16 {
+		return nil, 0, fmt.Errorf("invalid number of entries %d", n)
+	}
+	headerSize := 8 + 16*int(n)
+	header := buf[8 : 8+headerSize]
+	if crc32(0, header) != headerChecksum {
+		return nil, 0, fmt.Errorf("header checksum mismatch")
+	}
+
+	entries := make([]Entry, n)
+	offset := 8 + headerSize
+	crc := uint32(0)
+	for i := range entries {
+		h := header[8+16*i:]
+		entries[i].Term = binary.LittleEndian.Uint64(h)
+		entries[i].Type = EntryType(h[8])
+		size := int(binary.LittleEndian.Uint32(h[12:]))
+		padded := (size + 7) &^ 7
+		if offset+padded > len(buf) {
+			return nil, 0, fmt.Errorf("truncated data of entry %d", i)
+		}
+		entries[i].Data = buf[offset : offset+size]
+		crc = crc32(crc, buf[offset:offset+padded])
+		offset += padded
+	}
+	if crc != dataChecksum {
+		return nil, 0, fmt.Errorf("data checksum mismatch")
+	}
+
+	return entries, offset, nil
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
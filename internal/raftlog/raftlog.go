@@ -0,0 +1,178 @@
+// Package raftlog reads the files that the raft engine of a dqlite node keeps
+// in its data directory, without starting the node.
+//
+// The directory holds:
+//
+//   - two metadata files, "metadata1" and "metadata2", with the current term
+//     and vote of the node;
+//   - closed segments, named "<first index>-<last index>", and open segments,
+//     named "open-<counter>", holding batches of log entries;
+//   - snapshots, named "snapshot-<term>-<index>-<timestamp>", each with a
+//     ".meta" file holding the cluster configuration at the time of the
+//     snapshot.
+//
+// All integers are encoded in little endian.
+package raftlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Version of the on-disk format supported by this package.
+const diskFormat = 1
+
+// Metadata holds the content of the most recent metadata file.
+type Metadata struct {
+	Version  uint64 // Incremented every time the metadata is written.
+	Term     uint64 // Current term of the node.
+	VotedFor uint64 // ID of the node voted for in the current term, if any.
+}
+
+// ReadMetadata reads the most recent of the two metadata files in the given
+// directory. It returns nil if there is no metadata yet.
+func ReadMetadata(dir string) (*Metadata, error) {
+	var metadata *Metadata
+	for _, name := range []string{"metadata1", "metadata2"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if len(data) != 32 {
+			return nil, fmt.Errorf("%s: unexpected size %d", name, len(data))
+		}
+		if format := binary.LittleEndian.Uint64(data); format != diskFormat {
+			return nil, fmt.Errorf("%s: unsupported format %d", name, format)
+		}
+		m := &Metadata{
+			Version:  binary.LittleEndian.Uint64(data[8:]),
+			Term:     binary.LittleEndian.Uint64(data[16:]),
+			VotedFor: binary.LittleEndian.Uint64(data[24:]),
+		}
+		if metadata == nil || m.Version > metadata.Version {
+			metadata = m
+		}
+	}
+	return metadata, nil
+}
+
+// Segment describes a segment file.
+type Segment struct {
+	Path       string
+	Size       int64
+	Open       bool   // Whether the segment is still being written.
+	Counter    uint64 // Counter of an open segment.
+	FirstIndex uint64 // Index of the first entry of a closed segment.
+	LastIndex  uint64 // Index of the last entry of a closed segment.
+}
+
+// Snapshot describes a snapshot and the content of its metadata file.
+type Snapshot struct {
+	Path               string // Path of the snapshot data, without ".meta".
+	Size               int64  // Size of the snapshot data.
+	Term               uint64
+	Index              uint64
+	Timestamp          uint64 // Milliseconds since the epoch.
+	ConfigurationIndex uint64
+	Configuration      []Server
+	Err                error // Set if the metadata file is damaged.
+}
+
+// List returns the segments in the given directory, closed ones first in index
+// order followed by open ones in counter order, and the snapshots in the
+// directory, in index order. Snapshots whose metadata file can't be read have
+// their Err field set.
+func List(dir string) ([]Segment, []Snapshot, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var segments []Segment
+	var snapshots []Snapshot
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(dir, name)
+		switch {
+		case strings.HasPrefix(name, "open-"):
+			segment := Segment{Path: path, Size: file.Size(), Open: true}
+			if _, err := fmt.Sscanf(name, "open-%d", &segment.Counter); err != nil {
+				continue
+			}
+			segments = append(segments, segment)
+		case strings.HasPrefix(name, "snapshot-") && !strings.HasSuffix(name, ".meta"):
+			snapshot := Snapshot{Path: path, Size: file.Size()}
+			_, err := fmt.Sscanf(name, "snapshot-%d-%d-%d", &snapshot.Term, &snapshot.Index, &snapshot.Timestamp)
+			if err != nil {
+				continue
+			}
+			snapshot.Err = readSnapshotMeta(&snapshot)
+			snapshots = append(snapshots, snapshot)
+		default:
+			segment := Segment{Path: path, Size: file.Size()}
+			_, err := fmt.Sscanf(name, "%d-%d", &segment.FirstIndex, &segment.LastIndex)
+			if err != nil || len(name) != 33 {
+				continue
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool {
+		a, b := segments[i], segments[j]
+		if a.Open != b.Open {
+			return !a.Open
+		}
+		if a.Open {
+			return a.Counter < b.Counter
+		}
+		return a.FirstIndex < b.FirstIndex
+	})
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Index < snapshots[j].Index
+	})
+
+	return segments, snapshots, nil
+}
+
+// Read the metadata file of the given snapshot.
+func readSnapshotMeta(snapshot *Snapshot) error {
+	path := snapshot.Path + ".meta"
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) < 32 {
+		return fmt.Errorf("%s: unexpected size %d", path, len(data))
+	}
+	if format := binary.LittleEndian.Uint64(data); format != diskFormat {
+		return fmt.Errorf("%s: unsupported format %d", path, format)
+	}
+	checksum := binary.LittleEndian.Uint64(data[8:])
+	snapshot.ConfigurationIndex = binary.LittleEndian.Uint64(data[16:])
+	size := binary.LittleEndian.Uint64(data[24:])
+	if size != uint64(len(data)-32) {
+		return fmt.Errorf("%s: configuration size %d doesn't match file size", path, size)
+	}
+	if crc := crc32(0, data[16:]); uint64(crc) != checksum {
+		return fmt.Errorf("%s: checksum mismatch", path)
+	}
+
+	snapshot.Configuration, err = DecodeConfiguration(data[32:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
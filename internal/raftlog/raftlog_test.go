@@ -0,0 +1,393 @@
+package raftlog_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/canonical/go-dqlite/internal/raftlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMetadata(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	metadata, err := raftlog.ReadMetadata(dir)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	writeFile(t, dir, "metadata1", encodeMetadata(3, 2, 1))
+	writeFile(t, dir, "metadata2", encodeMetadata(4, 3, 0))
+
+	metadata, err = raftlog.ReadMetadata(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &raftlog.Metadata{Version: 4, Term: 3, VotedFor: 0}, metadata)
+}
+
+func TestList(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	servers := []raftlog.Server{
+		{ID: 1, Address: "127.0.0.1:9001", Role: raftlog.Voter},
+		{ID: 2, Address: "127.0.0.1:9002", Role: raftlog.Spare},
+	}
+	configuration := encodeConfiguration(servers)
+	meta := make([]byte, 32)
+	binary.LittleEndian.PutUint64(meta, 1)
+	binary.LittleEndian.PutUint64(meta[16:], 5)
+	binary.LittleEndian.PutUint64(meta[24:], uint64(len(configuration)))
+	meta = append(meta, configuration...)
+	binary.LittleEndian.PutUint64(meta[8:], uint64(checksum(meta[16:])))
+
+	writeFile(t, dir, "snapshot-2-10-1000", []byte("data"))
+	writeFile(t, dir, "snapshot-2-10-1000.meta", meta)
+	writeFile(t, dir, "open-2", make([]byte, 64))
+	writeFile(t, dir, "open-1", make([]byte, 64))
+	writeFile(t, dir, "0000000000000004-0000000000000006", []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	writeFile(t, dir, "0000000000000001-0000000000000003", []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	writeFile(t, dir, "info.yaml", []byte("ID: 1\n"))
+
+	segments, snapshots, err := raftlog.List(dir)
+	require.NoError(t, err)
+
+	require.Len(t, segments, 4)
+	assert.Equal(t, uint64(1), segments[0].FirstIndex)
+	assert.Equal(t, uint64(6), segments[1].LastIndex)
+	assert.Equal(t, uint64(1), segments[2].Counter)
+	assert.True(t, segments[3].Open)
+
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, uint64(10), snapshots[0].Index)
+	assert.Equal(t, uint64(5), snapshots[0].ConfigurationIndex)
+	assert.Equal(t, servers, snapshots[0].Configuration)
+}
+
+func TestReadSegment(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	servers := []raftlog.Server{{ID: 1, Address: "1", Role: raftlog.Voter}}
+	first := encodeBatch(
+		raftlog.Entry{Term: 1, Type: raftlog.Change, Data: encodeConfiguration(servers)},
+		raftlog.Entry{Term: 1, Type: raftlog.Barrier, Data: make([]byte, 8)},
+	)
+	second := encodeBatch(raftlog.Entry{Term: 2, Type: raftlog.Command, Data: make([]byte, 16)})
+
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	data = append(data, first...)
+	data = append(data, second...)
+	data = append(data, make([]byte, 32)...) // Preallocated space.
+	path := writeFile(t, dir, "open-1", data)
+
+	entries, end, err := raftlog.ReadSegment(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, int64(8+len(first)+len(second)), end)
+	assert.Equal(t, raftlog.Change, entries[0].Type)
+	assert.Equal(t, uint64(2), entries[2].Term)
+
+	configuration, err := raftlog.DecodeConfiguration(entries[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, servers, configuration)
+
+	// Corrupt the data of the second batch.
+	data[8+len(first)+len(second)-1] = 1
+	path = writeFile(t, dir, "open-1", data)
+
+	entries, end, err = raftlog.ReadSegment(path)
+	assert.EqualError(t, err, fmt.Sprintf("batch at offset %d: data checksum mismatch", 8+len(first)))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(8+len(first)), end)
+}
+
+func encodeMetadata(version, term, votedFor uint64) []byte {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint64(data, 1)
+	binary.LittleEndian.PutUint64(data[8:], version)
+	binary.LittleEndian.PutUint64(data[16:], term)
+	binary.LittleEndian.PutUint64(data[24:], votedFor)
+	return data
+}
+
+func encodeConfiguration(servers []raftlog.Server) []byte {
+	data := []byte{1}
+	data = appendUint64(data, uint64(len(servers)))
+	for _, server := range servers {
+		data = appendUint64(data, server.ID)
+		data = append(data, server.Address...)
+		data = append(data, 0, byte(server.Role))
+	}
+	for len(data)%8 != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+func encodeBatch(entries ...raftlog.Entry) []byte {
+	header := appendUint64(nil, uint64(len(entries)))
+	var data []byte
+	for _, entry := range entries {
+		header = appendUint64(header, entry.Term)
+		header = append(header, byte(entry.Type), 0, 0, 0)
+		header = append(header, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(header[len(header)-4:], uint32(len(entry.Data)))
+		data = append(data, entry.Data...)
+	}
+
+	batch := make([]byte, 8)
+	binary.LittleEndian.PutUint32(batch, checksum(header))
+	binary.LittleEndian.PutUint32(batch[4:], checksum(data))
+	batch = append(batch, header...)
+	return append(batch, data...)
+}
+
+// Compute the checksum of the given data like the raft engine does, one bit at
+// a time, independently of the table-driven implementation under test.
+func checksum(data []byte) uint32 {
+	crc := uint32(0)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return append(buf, b...)
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func newDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "dqlite-raftlog-test-")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestCheck_Healthy(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	writeFile(t, dir, "metadata1", encodeMetadata(1, 1, 1))
+	writeFile(t, dir, "0000000000000001-0000000000000002", encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Barrier, Data: make([]byte, 8)}),
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)}),
+	))
+	writeFile(t, dir, "open-1", append(encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)}),
+	), make([]byte, 64)...))
+
+	report, err := raftlog.Check(dir)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	assert.Nil(t, report.Tail)
+}
+
+func TestCheck_TruncateClosedSegment(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	first := encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)})
+	second := encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)})
+	data := encodeSegment(first, second)
+	writeFile(t, dir, "0000000000000001-0000000000000003", data[:len(data)-4])
+	writeFile(t, dir, "0000000000000004-0000000000000004", encodeSegment(first))
+	writeFile(t, dir, "open-1", encodeSegment(first))
+
+	report, err := raftlog.Check(dir)
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, "0000000000000001-0000000000000003", report.Problems[0].File)
+
+	tail := report.Tail
+	require.NotNil(t, tail)
+	assert.Equal(t, int64(8+len(first)), tail.Offset)
+	assert.Equal(t, 1, tail.Entries)
+	assert.Len(t, tail.Dropped, 2)
+
+	require.NoError(t, raftlog.Truncate(dir, tail))
+
+	segments, _, err := raftlog.List(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, uint64(1), segments[0].LastIndex)
+
+	report, err = raftlog.Check(dir)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+}
+
+func TestCheck_TruncateOpenSegment(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	first := encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)})
+	data := encodeSegment(first, first)
+	data[len(data)-1] = 1
+	data = append(data, make([]byte, 64)...)
+	path := writeFile(t, dir, "open-1", data)
+
+	report, err := raftlog.Check(dir)
+	require.NoError(t, err)
+	require.NotNil(t, report.Tail)
+
+	require.NoError(t, raftlog.Truncate(dir, report.Tail))
+
+	entries, _, err := raftlog.ReadSegment(path)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+}
+
+func TestCheck_Gap(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	batch := encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)})
+	writeFile(t, dir, "0000000000000001-0000000000000001", encodeSegment(batch))
+	writeFile(t, dir, "0000000000000003-0000000000000003", encodeSegment(batch))
+
+	report, err := raftlog.Check(dir)
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, "0000000000000003-0000000000000003: expected first index 2", report.Problems[0].String())
+	require.NotNil(t, report.Tail)
+	assert.Equal(t, 0, report.Tail.Entries)
+}
+
+func encodeSegment(batches ...[]byte) []byte {
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	for _, batch := range batches {
+		data = append(data, batch...)
+	}
+	return data
+}
+
+func TestReadConfiguration(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	servers, index, err := raftlog.ReadConfiguration(dir)
+	require.NoError(t, err)
+	assert.Nil(t, servers)
+	assert.Equal(t, uint64(0), index)
+
+	first := []raftlog.Server{{ID: 1, Address: "1", Role: raftlog.Voter}}
+	second := append(first, raftlog.Server{ID: 2, Address: "2", Role: raftlog.StandBy})
+
+	writeFile(t, dir, "0000000000000001-0000000000000002", encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Change, Data: encodeConfiguration(first)}),
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Barrier, Data: make([]byte, 8)}),
+	))
+	writeFile(t, dir, "open-1", append(encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Change, Data: encodeConfiguration(second)}),
+	), make([]byte, 16)...))
+
+	servers, index, err = raftlog.ReadConfiguration(dir)
+	require.NoError(t, err)
+	assert.Equal(t, second, servers)
+	assert.Equal(t, uint64(3), index)
+}
+
+// The testdata/datadir directory holds the files of a two-node cluster, laid
+// out and checksummed as the raft engine writes them:
+//
+//   - node 1 bootstrapped alone at index 1, then won the election of term 2,
+//     voting for itself, and appended a barrier at index 2;
+//   - node 2 was added as spare at index 3, followed by a command at index 4;
+//   - a snapshot was taken at index 4, with the configuration of index 3;
+//   - node 2 was promoted to voter at index 5, in the first open segment.
+func TestDataDir(t *testing.T) {
+	dir := filepath.Join("testdata", "datadir")
+
+	metadata, err := raftlog.ReadMetadata(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &raftlog.Metadata{Version: 2, Term: 2, VotedFor: 1}, metadata)
+
+	report, err := raftlog.Check(dir)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	assert.Nil(t, report.Tail)
+
+	segments, snapshots, err := raftlog.List(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 4)
+
+	entries, end, err := raftlog.ReadSegment(segments[1].Path)
+	require.NoError(t, err)
+	assert.Equal(t, segments[1].Size, end)
+	require.Len(t, entries, 3)
+	assert.Equal(t, raftlog.Barrier, entries[0].Type)
+	assert.Equal(t, raftlog.Command, entries[2].Type)
+	assert.Equal(t, "command\x00", string(entries[2].Data))
+
+	voter := raftlog.Server{ID: 1, Address: "127.0.0.1:9001", Role: raftlog.Voter}
+	spare := raftlog.Server{ID: 2, Address: "127.0.0.1:9002", Role: raftlog.Spare}
+
+	require.Len(t, snapshots, 1)
+	require.NoError(t, snapshots[0].Err)
+	assert.Equal(t, uint64(3), snapshots[0].ConfigurationIndex)
+	assert.Equal(t, []raftlog.Server{voter, spare}, snapshots[0].Configuration)
+}
+
+func TestReadConfiguration_DataDir(t *testing.T) {
+	servers, index, err := raftlog.ReadConfiguration(filepath.Join("testdata", "datadir"))
+	require.NoError(t, err)
+	assert.Equal(t, []raftlog.Server{
+		{ID: 1, Address: "127.0.0.1:9001", Role: raftlog.Voter},
+		{ID: 2, Address: "127.0.0.1:9002", Role: raftlog.Voter},
+	}, servers)
+	assert.Equal(t, uint64(5), index)
+}
+
+// A damaged batch is only skipped at the end of the last open segment.
+func TestReadConfiguration_Damaged(t *testing.T) {
+	dir, cleanup := newDir(t)
+	defer cleanup()
+
+	first := []raftlog.Server{{ID: 1, Address: "1", Role: raftlog.Voter}}
+	second := append(first, raftlog.Server{ID: 2, Address: "2", Role: raftlog.StandBy})
+
+	writeFile(t, dir, "0000000000000001-0000000000000001", encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Change, Data: encodeConfiguration(first)}),
+	))
+	data := encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Change, Data: encodeConfiguration(second)}),
+	)
+	data[len(data)-1] ^= 1
+	writeFile(t, dir, "open-1", append(data, make([]byte, 16)...))
+	writeFile(t, dir, "open-2", make([]byte, 64))
+
+	servers, index, err := raftlog.ReadConfiguration(dir)
+	require.NoError(t, err)
+	assert.Equal(t, first, servers)
+	assert.Equal(t, uint64(1), index)
+
+	writeFile(t, dir, "open-2", encodeSegment(
+		encodeBatch(raftlog.Entry{Term: 1, Type: raftlog.Command, Data: make([]byte, 8)}),
+	))
+
+	_, _, err = raftlog.ReadConfiguration(dir)
+	assert.EqualError(t, err, "open-1: batch at offset 8: data checksum mismatch")
+}
@@ -0,0 +1,85 @@
+package raftlog
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ReadConfiguration returns the last cluster configuration stored in the
+// given directory, either in a Change entry of the log or in the metadata of
+// a snapshot, along with its index. It returns nil if there is none.
+//
+// A damaged batch at the end of the last written open segment is ignored, as
+// the raft engine does when loading the log: it's left by a write interrupted
+// by a crash. Any other damage is reported as an error, since later entries
+// might hold a newer configuration. See Check and Truncate for repairing the
+// log.
+func ReadConfiguration(dir string) ([]Server, uint64, error) {
+	segments, snapshots, err := List(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var configuration []Server
+	var index uint64
+	for _, snapshot := range snapshots {
+		if snapshot.Err == nil && snapshot.ConfigurationIndex >= index {
+			configuration = snapshot.Configuration
+			index = snapshot.ConfigurationIndex
+		}
+	}
+
+	// Index of the next entry, or zero if unknown. Entries whose index is
+	// unknown can only follow the last snapshot, so they are the most
+	// recent.
+	next := uint64(0)
+	if len(snapshots) == 0 {
+		next = 1
+	}
+	for i, segment := range segments {
+		if !segment.Open {
+			next = segment.FirstIndex
+		}
+		entries, _, err := ReadSegment(segment.Path)
+		for i, entry := range entries {
+			if entry.Type != Change {
+				continue
+			}
+			entryIndex := uint64(0)
+			if next != 0 {
+				entryIndex = next + uint64(i)
+				if entryIndex < index {
+					continue
+				}
+			}
+			servers, err := DecodeConfiguration(entry.Data)
+			if err != nil {
+				return nil, 0, err
+			}
+			configuration = servers
+			index = entryIndex
+		}
+		if err != nil {
+			if segment.Open && !hasEntries(segments[i+1:]) {
+				break
+			}
+			return nil, 0, fmt.Errorf("%s: %w", filepath.Base(segment.Path), err)
+		}
+		if next != 0 {
+			next += uint64(len(entries))
+		}
+	}
+
+	return configuration, index, nil
+}
+
+// Return true if any of the given segments holds entries.
+func hasEntries(segments []Segment) bool {
+	for _, segment := range segments {
+		entries, _, err := ReadSegment(segment.Path)
+		if len(entries) > 0 || err != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -45,4 +45,5 @@ func defaultOptions() *options {
 const (
 	formatTabular = "tabular"
 	formatJson    = "json"
+	formatCsv     = "csv"
 )
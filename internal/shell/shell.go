@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -35,11 +36,8 @@ func New(database string, store client.NodeStore, options ...Option) (*Shell, er
 		option(o)
 	}
 
-	switch o.Format {
-	case formatTabular:
-	case formatJson:
-	default:
-		return nil, fmt.Errorf("unknown format %s", o.Format)
+	if err := checkFormat(o.Format); err != nil {
+		return nil, err
 	}
 
 	driver, err := driver.New(store, driver.WithDialFunc(o.Dial))
@@ -72,6 +70,22 @@ func (s *Shell) Process(ctx context.Context, line string) (string, error) {
 		return s.processLeader(ctx, line)
 	case ".help":
 		return s.processHelp(), nil
+	case ".databases":
+		return s.processDatabases(ctx, line)
+	case ".dump":
+		return s.processDumpSQL(ctx, line)
+	}
+	if strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " ")), ".mode") {
+		return s.processMode(ctx, line)
+	}
+	if strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " ")), ".import") {
+		return s.processImport(ctx, line)
+	}
+	if strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " ")), ".tables") {
+		return s.processTables(ctx, line)
+	}
+	if strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " ")), ".schema") {
+		return s.processSchema(ctx, line)
 	}
 	if strings.HasPrefix(strings.ToLower(strings.TrimLeft(line, " ")), ".remove") {
 		return s.processRemove(ctx, line)
@@ -101,8 +115,14 @@ Enter a SQL statement to execute it, or one of the following built-in commands:
   .remove <address>                 Remove a node from the cluster
   .describe <address>               Show the details of a node
   .weight <address> <weight>        Set the weight of a node
-  .dump <address> [<database>]      Dump the database
+  .databases                        List the databases of the connection
+  .tables [<pattern>]               List the tables matching a LIKE pattern
+  .schema [<pattern>]               Show the CREATE statements of matching tables
+  .dump                             Render the database as SQL text
+  .dump <address> [<database>]      Dump the database files of a node
   .reconfigure <dir> <clusteryaml>  Reconfigure the cluster
+  .mode [tabular|json|csv]          Show or set the output format of queries
+  .import <file> <table>            Import the rows of a CSV file into a table
 `[1:]
 }
 
@@ -247,6 +267,194 @@ func (s *Shell) processDump(ctx context.Context, line string) (string, error) {
 	return "OK", nil
 }
 
+func (s *Shell) processDatabases(ctx context.Context, line string) (string, error) {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA database_list")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	lines := []string{}
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", name, file))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Shell) processTables(ctx context.Context, line string) (string, error) {
+	parts := strings.Fields(line)
+	if len(parts) > 2 {
+		return "", fmt.Errorf("bad command format, should be: .tables [<pattern>]")
+	}
+	pattern := "%"
+	if len(parts) == 2 {
+		pattern = parts[1]
+	}
+
+	names, err := s.queryStrings(ctx, `
+SELECT name FROM sqlite_master
+ WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' AND name LIKE ?
+ ORDER BY name`, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(names, "\n"), nil
+}
+
+func (s *Shell) processSchema(ctx context.Context, line string) (string, error) {
+	parts := strings.Fields(line)
+	if len(parts) > 2 {
+		return "", fmt.Errorf("bad command format, should be: .schema [<pattern>]")
+	}
+	pattern := "%"
+	if len(parts) == 2 {
+		pattern = parts[1]
+	}
+
+	statements, err := s.queryStrings(ctx, `
+SELECT sql || ';' FROM sqlite_master
+ WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' AND tbl_name LIKE ?
+ ORDER BY tbl_name, type DESC, name`, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(statements, "\n"), nil
+}
+
+// Render the content of the database as SQL text, in the same format as the
+// .dump command of the sqlite3 shell.
+func (s *Shell) processDumpSQL(ctx context.Context, line string) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sb strings.Builder
+	sb.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n")
+
+	tables, err := queryPairs(ctx, tx, `
+SELECT name, sql FROM sqlite_master
+ WHERE type = 'table' AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+ ORDER BY rowid`)
+	if err != nil {
+		return "", err
+	}
+	for _, table := range tables {
+		sb.WriteString(table[1] + ";\n")
+		if err := dumpTable(ctx, tx, table[0], &sb); err != nil {
+			return "", err
+		}
+	}
+
+	others, err := queryPairs(ctx, tx, `
+SELECT name, sql FROM sqlite_master
+ WHERE type IN ('index', 'trigger', 'view') AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+ ORDER BY rowid`)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range others {
+		sb.WriteString(other[1] + ";\n")
+	}
+
+	sb.WriteString("COMMIT;")
+
+	return sb.String(), nil
+}
+
+// Write an INSERT statement for each row of the given table.
+func dumpTable(ctx context.Context, tx *sql.Tx, table string, sb *strings.Builder) error {
+	name := `"` + strings.Replace(table, `"`, `""`, -1) + `"`
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", name))
+	if err != nil {
+		return fmt.Errorf("query table %s: %w", table, err)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("columns of table %s: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	// Let SQLite render the values as SQL literals.
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = `quote("` + strings.Replace(column, `"`, `""`, -1) + `")`
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, " || ',' || "), name)
+
+	rows, err = tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("query table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var values string
+		if err := rows.Scan(&values); err != nil {
+			return fmt.Errorf("scan table %s: %w", table, err)
+		}
+		fmt.Fprintf(sb, "INSERT INTO %s VALUES(%s);\n", name, values)
+	}
+
+	return rows.Err()
+}
+
+// Run the given query and return the single string column of all rows.
+func (s *Shell) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// Run the given query and return the two string columns of all rows.
+func queryPairs(ctx context.Context, tx *sql.Tx, query string) ([][2]string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := [][2]string{}
+	for rows.Next() {
+		var pair [2]string
+		if err := rows.Scan(&pair[0], &pair[1]); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, rows.Err()
+}
+
 func (s *Shell) processReconfigure(ctx context.Context, line string) (string, error) {
 	parts := strings.Split(line, " ")
 	if len(parts) != 3 {
@@ -340,13 +548,7 @@ func (s *Shell) processQuery(ctx context.Context, line string) (string, error) {
 	}
 	n := len(columns)
 
-	var sb strings.Builder
-	writer := tabwriter.NewWriter(&sb, 0, 8, 1, '\t', 0)
-	for _, col := range columns {
-		fmt.Fprintf(writer, "%s\t", col)
-	}
-	fmt.Fprintln(writer)
-
+	values := [][]interface{}{}
 	for rows.Next() {
 		row := make([]interface{}, n)
 		rowPointers := make([]interface{}, n)
@@ -362,10 +564,7 @@ func (s *Shell) processQuery(ctx context.Context, line string) (string, error) {
 			return "", err
 		}
 
-		for _, column := range row {
-			fmt.Fprintf(writer, "%v\t", column)
-		}
-		fmt.Fprintln(writer)
+		values = append(values, row)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -380,6 +579,31 @@ func (s *Shell) processQuery(ctx context.Context, line string) (string, error) {
 		return "", fmt.Errorf("commit: %w", err)
 	}
 
+	switch s.format {
+	case formatJson:
+		return formatRowsJson(columns, values)
+	case formatCsv:
+		return formatRowsCsv(columns, values)
+	default:
+		return formatRowsTabular(columns, values)
+	}
+}
+
+func formatRowsTabular(columns []string, values [][]interface{}) (string, error) {
+	var sb strings.Builder
+	writer := tabwriter.NewWriter(&sb, 0, 8, 1, '\t', 0)
+	for _, col := range columns {
+		fmt.Fprintf(writer, "%s\t", col)
+	}
+	fmt.Fprintln(writer)
+
+	for _, row := range values {
+		for _, column := range row {
+			fmt.Fprintf(writer, "%v\t", column)
+		}
+		fmt.Fprintln(writer)
+	}
+
 	if err := writer.Flush(); err != nil {
 		return "", fmt.Errorf("flush: %w", err)
 	}
@@ -387,6 +611,157 @@ func (s *Shell) processQuery(ctx context.Context, line string) (string, error) {
 	return strings.TrimRight(sb.String(), "\n"), nil
 }
 
+func formatRowsJson(columns []string, values [][]interface{}) (string, error) {
+	objects := make([]map[string]interface{}, len(values))
+	for i, row := range values {
+		object := make(map[string]interface{}, len(columns))
+		for j, column := range row {
+			if b, ok := column.([]byte); ok {
+				column = string(b)
+			}
+			object[columns[j]] = column
+		}
+		objects[i] = object
+	}
+
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return "", err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "\t"); err != nil {
+		return "", err
+	}
+
+	return indented.String(), nil
+}
+
+func formatRowsCsv(columns []string, values [][]interface{}) (string, error) {
+	var sb strings.Builder
+	writer := csv.NewWriter(&sb)
+	if err := writer.Write(columns); err != nil {
+		return "", err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range values {
+		for i, column := range row {
+			switch column := column.(type) {
+			case nil:
+				record[i] = ""
+			case []byte:
+				record[i] = string(column)
+			default:
+				record[i] = fmt.Sprintf("%v", column)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("flush: %w", err)
+	}
+
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case formatTabular:
+	case formatJson:
+	case formatCsv:
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+	return nil
+}
+
+func (s *Shell) processMode(ctx context.Context, line string) (string, error) {
+	parts := strings.Fields(line)
+	switch len(parts) {
+	case 1:
+		return s.format, nil
+	case 2:
+		if err := checkFormat(parts[1]); err != nil {
+			return "", err
+		}
+		s.format = parts[1]
+		return "", nil
+	default:
+		return "", fmt.Errorf("bad command format, should be: .mode [tabular|json|csv]")
+	}
+}
+
+// Import the rows of a CSV file into a table. As with the sqlite3 shell, if
+// the table does not exist it gets created, using the first row of the file as
+// column names.
+func (s *Shell) processImport(ctx context.Context, line string) (string, error) {
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("bad command format, should be: .import <file> <table>")
+	}
+	path := parts[1]
+	table := `"` + strings.Replace(parts[2], `"`, `""`, -1) + `"`
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", parts[2]).Scan(&count)
+	if err != nil {
+		return "", fmt.Errorf("check table: %w", err)
+	}
+	if count == 0 {
+		columns := make([]string, len(records[0]))
+		for i, name := range records[0] {
+			columns[i] = `"` + strings.Replace(name, `"`, `""`, -1) + `" TEXT`
+		}
+		query := fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(columns, ", "))
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return "", fmt.Errorf("create table: %w", err)
+		}
+		records = records[1:]
+	}
+
+	for i, record := range records {
+		params := strings.TrimSuffix(strings.Repeat("?, ", len(record)), ", ")
+		query := fmt.Sprintf("INSERT INTO %s VALUES(%s)", table, params)
+		args := make([]interface{}, len(record))
+		for j, value := range record {
+			args[j] = value
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return "", fmt.Errorf("insert row %d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit: %w", err)
+	}
+
+	return "", nil
+}
+
 func (s *Shell) processExec(ctx context.Context, line string) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -0,0 +1,213 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	dqlite "github.com/canonical/go-dqlite"
+	"github.com/canonical/go-dqlite/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess_Tables(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	process(t, shell, "CREATE TABLE foo (n INT)")
+	process(t, shell, "CREATE TABLE bar (n INT)")
+	process(t, shell, "CREATE VIEW baz AS SELECT n FROM foo")
+
+	assert.Equal(t, "bar\nbaz\nfoo", process(t, shell, ".tables"))
+	assert.Equal(t, "bar\nbaz", process(t, shell, ".tables ba%"))
+	assert.Equal(t, "", process(t, shell, ".tables nothing"))
+
+	_, err := shell.Process(context.Background(), ".tables a b")
+	assert.EqualError(t, err, "bad command format, should be: .tables [<pattern>]")
+}
+
+func TestProcess_Schema(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	process(t, shell, "CREATE TABLE foo (n INT)")
+	process(t, shell, "CREATE INDEX foo_n ON foo (n)")
+	process(t, shell, "CREATE TABLE bar (s TEXT)")
+
+	assert.Equal(t, `
+CREATE TABLE bar (s TEXT);
+CREATE TABLE foo (n INT);
+CREATE INDEX foo_n ON foo (n);`[1:], process(t, shell, ".schema"))
+	assert.Equal(t, `
+CREATE TABLE foo (n INT);
+CREATE INDEX foo_n ON foo (n);`[1:], process(t, shell, ".schema foo"))
+}
+
+// The SQL dump quotes names and values, and lists indexes and views after the
+// content of the tables.
+func TestProcess_DumpSQL(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	process(t, shell, `CREATE TABLE "a""b" (n INT, s TEXT, b BLOB)`)
+	process(t, shell, `INSERT INTO "a""b" VALUES(1, 'it''s', x'0102'), (NULL, NULL, NULL)`)
+	process(t, shell, `CREATE INDEX ab_n ON "a""b" (n)`)
+	process(t, shell, `CREATE VIEW v AS SELECT n FROM "a""b"`)
+
+	assert.Equal(t, `
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE "a""b" (n INT, s TEXT, b BLOB);
+INSERT INTO "a""b" VALUES(1,'it''s',X'0102');
+INSERT INTO "a""b" VALUES(NULL,NULL,NULL);
+CREATE INDEX ab_n ON "a""b" (n);
+CREATE VIEW v AS SELECT n FROM "a""b";
+COMMIT;`[1:], process(t, shell, ".dump"))
+}
+
+func TestFormatRowsCsv(t *testing.T) {
+	columns := []string{"n", "s", "b"}
+	values := [][]interface{}{
+		{int64(1), "a,b", []byte("blob")},
+		{nil, `say "hi"`, nil},
+	}
+
+	result, err := formatRowsCsv(columns, values)
+	require.NoError(t, err)
+	assert.Equal(t, `
+n,s,b
+1,"a,b",blob
+,"say ""hi""",`[1:], result)
+}
+
+func TestFormatRowsJson(t *testing.T) {
+	columns := []string{"n", "s", "b"}
+	values := [][]interface{}{
+		{int64(1), "a", []byte("blob")},
+		{nil, "b", nil},
+	}
+
+	result, err := formatRowsJson(columns, values)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"n": 1, "s": "a", "b": "blob"},
+		{"n": null, "s": "b", "b": null}
+	]`, result)
+
+	result, err = formatRowsJson(columns, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", result)
+}
+
+// The output format of queries can be changed with .mode.
+func TestProcess_Mode(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	process(t, shell, "CREATE TABLE foo (n INT, s TEXT)")
+	process(t, shell, "INSERT INTO foo VALUES(1, 'a'), (2, 'b')")
+
+	assert.Equal(t, formatTabular, process(t, shell, ".mode"))
+
+	process(t, shell, ".mode csv")
+	assert.Equal(t, "csv", process(t, shell, ".mode"))
+	assert.Equal(t, "n,s\n1,a\n2,b", process(t, shell, "SELECT * FROM foo ORDER BY n"))
+
+	process(t, shell, ".mode json")
+	assert.JSONEq(t, `[{"n": 1, "s": "a"}, {"n": 2, "s": "b"}]`, process(t, shell, "SELECT * FROM foo ORDER BY n"))
+
+	_, err := shell.Process(context.Background(), ".mode xml")
+	assert.EqualError(t, err, "unknown format xml")
+	assert.Equal(t, "json", process(t, shell, ".mode"))
+}
+
+// Importing into a missing table creates it with the columns named in the
+// first row, while importing into an existing table inserts all rows.
+func TestProcess_Import(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	path := writeFile(t, "n,s\n1,a\n2,\"b,c\"\n")
+	defer os.Remove(path)
+
+	process(t, shell, ".import "+path+" foo")
+	process(t, shell, ".mode csv")
+	assert.Equal(t, "n,s\n1,a\n2,\"b,c\"", process(t, shell, "SELECT * FROM foo ORDER BY n"))
+
+	process(t, shell, "CREATE TABLE bar (n INT, s TEXT)")
+	process(t, shell, ".import "+path+" bar")
+	assert.Equal(t, "count(*)\n3", process(t, shell, "SELECT count(*) FROM bar"))
+
+	_, err := shell.Process(context.Background(), ".import "+path)
+	assert.EqualError(t, err, "bad command format, should be: .import <file> <table>")
+}
+
+// A row that can't be inserted aborts the whole import.
+func TestProcess_ImportError(t *testing.T) {
+	shell, cleanup := newShell(t)
+	defer cleanup()
+
+	path := writeFile(t, "1,a\n2,b\n")
+	defer os.Remove(path)
+
+	process(t, shell, "CREATE TABLE foo (n INT CHECK (n < 2), s TEXT)")
+	_, err := shell.Process(context.Background(), ".import "+path+" foo")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "insert row 2: CHECK constraint failed")
+
+	process(t, shell, ".mode csv")
+	assert.Equal(t, "count(*)\n0", process(t, shell, "SELECT count(*) FROM foo"))
+}
+
+// Process the given line, which must succeed.
+func process(t *testing.T, shell *Shell, line string) string {
+	t.Helper()
+	result, err := shell.Process(context.Background(), line)
+	require.NoError(t, err)
+	return result
+}
+
+// Write the given content to a temporary file and return its path.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	file, err := ioutil.TempFile("", "dqlite-shell-test-")
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+	return file.Name()
+}
+
+// Used to register the driver of each shell under a different name.
+var shellCount int64
+
+func newShell(t *testing.T) (*Shell, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dqlite-shell-test-")
+	require.NoError(t, err)
+
+	n := atomic.AddInt64(&shellCount, 1)
+	address := fmt.Sprintf("@dqlite-shell-test-%d", n)
+	node, err := dqlite.New(1, address, dir, dqlite.WithBindAddress(address))
+	require.NoError(t, err)
+	require.NoError(t, node.Start())
+
+	store := client.NewInmemNodeStore()
+	require.NoError(t, store.Set(context.Background(), []client.NodeInfo{{ID: 1, Address: address}}))
+
+	shell, err := New("test.db", store, WithDriverName(fmt.Sprintf("dqlite-shell-test-%d", n)))
+	require.NoError(t, err)
+
+	cleanup := func() {
+		require.NoError(t, shell.db.Close())
+		require.NoError(t, node.Close())
+		require.NoError(t, os.RemoveAll(dir))
+	}
+
+	return shell, cleanup
+}
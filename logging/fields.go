@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is a key/value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is passed as last argument to a Func, matching a trailing %v verb
+// in the format string, when a message carries structured fields. See
+// WithFields.
+//
+// Fields formats itself as space-separated key=value pairs with a leading
+// space, so plain printf-style functions like the one returned by Stdout
+// render them at the end of the message, while functions returned by NewKV
+// or NewSlog turn them into proper structured fields.
+type Fields []Field
+
+func (fields Fields) String() string {
+	var b strings.Builder
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", field.Key, value)
+	}
+	return b.String()
+}
+
+// FuncKV is a logging function accepting structured fields alongside an
+// already formatted message.
+type FuncKV func(l Level, msg string, fields ...Field)
+
+// NewKV returns a logging function that formats messages and forwards them to
+// the given function, along with the fields attached with WithFields.
+func NewKV(f FuncKV) Func {
+	return func(l Level, format string, a ...interface{}) {
+		format, a, fields := splitFields(format, a)
+		f(l, fmt.Sprintf(format, a...), fields...)
+	}
+}
+
+// WithFields returns a logging function that attaches the given fields to all
+// messages before passing them to the given function.
+//
+// Fields attached to the messages by the caller come after the given ones.
+func WithFields(f Func, fields ...Field) Func {
+	return func(l Level, format string, a ...interface{}) {
+		format, a, more := splitFields(format, a)
+		all := make(Fields, 0, len(fields)+len(more))
+		all = append(all, fields...)
+		all = append(all, more...)
+		f(l, format+"%v", append(a, all)...)
+	}
+}
+
+// Separate the fields attached to a message from its format and arguments.
+func splitFields(format string, a []interface{}) (string, []interface{}, Fields) {
+	n := len(a)
+	if n == 0 || !strings.HasSuffix(format, "%v") {
+		return format, a, nil
+	}
+	fields, ok := a[n-1].(Fields)
+	if !ok {
+		return format, a, nil
+	}
+	// Cap the arguments, so callers appending to them don't overwrite the
+	// fields in the caller's slice.
+	a = a[:n-1]
+	return strings.TrimSuffix(format, "%v"), a[:len(a):len(a)], fields
+}
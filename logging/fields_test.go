@@ -0,0 +1,43 @@
+package logging_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFields(t *testing.T) {
+	var plain []string
+	f := logging.WithFields(func(l logging.Level, format string, a ...interface{}) {
+		plain = append(plain, fmt.Sprintf(format, a...))
+	}, logging.Field{Key: "node_id", Value: 1})
+
+	f(logging.Info, "hello %s", "world")
+	logging.WithFields(f, logging.Field{Key: "database", Value: "my db"})(logging.Info, "opened")
+
+	assert.Equal(t, []string{
+		`hello world node_id=1`,
+		`opened node_id=1 database="my db"`,
+	}, plain)
+}
+
+func TestNewKV(t *testing.T) {
+	var msgs []string
+	var fields [][]logging.Field
+	f := logging.NewKV(func(l logging.Level, msg string, f ...logging.Field) {
+		msgs = append(msgs, msg)
+		fields = append(fields, f)
+	})
+
+	f(logging.Info, "hello %s", "world")
+	f = logging.WithFields(f, logging.Field{Key: "node_id", Value: 1})
+	logging.WithFields(f, logging.Field{Key: "database", Value: "test"})(logging.Info, "%d%%", 100)
+
+	assert.Equal(t, []string{"hello world", "100%"}, msgs)
+	assert.Equal(t, [][]logging.Field{
+		nil,
+		{{Key: "node_id", Value: 1}, {Key: "database", Value: "test"}},
+	}, fields)
+}
@@ -1,5 +1,7 @@
 package logging
 
+import "sync/atomic"
+
 // Level defines the logging level.
 type Level int
 
@@ -26,3 +28,30 @@ func (l Level) String() string {
 		return "UNKNOWN"
 	}
 }
+
+// LevelVar is a Level that can be safely changed while in use, see Filter.
+type LevelVar struct {
+	level int64
+}
+
+// Level returns the current level.
+func (v *LevelVar) Level() Level {
+	return Level(atomic.LoadInt64(&v.level))
+}
+
+// Set changes the current level.
+func (v *LevelVar) Set(l Level) {
+	atomic.StoreInt64(&v.level, int64(l))
+}
+
+// Filter returns a logging function that forwards to the given function only
+// the messages whose level is at least the current level of the given
+// variable.
+func Filter(f Func, level *LevelVar) Func {
+	return func(l Level, format string, a ...interface{}) {
+		if l < level.Level() {
+			return
+		}
+		f(l, format, a...)
+	}
+}
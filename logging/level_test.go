@@ -16,3 +16,23 @@ func TestLevel_String(t *testing.T) {
 	unknown := logging.Level(666)
 	assert.Equal(t, "UNKNOWN", unknown.String())
 }
+
+func TestFilter(t *testing.T) {
+	var levels []logging.Level
+	level := &logging.LevelVar{}
+	level.Set(logging.Warn)
+
+	f := logging.Filter(func(l logging.Level, format string, a ...interface{}) {
+		levels = append(levels, l)
+	}, level)
+
+	f(logging.Info, "dropped")
+	f(logging.Warn, "hello")
+	f(logging.Error, "hello")
+
+	level.Set(logging.Debug)
+	assert.Equal(t, logging.Debug, level.Level())
+	f(logging.Debug, "hello")
+
+	assert.Equal(t, []logging.Level{logging.Warn, logging.Error, logging.Debug}, levels)
+}
@@ -0,0 +1,18 @@
+module github.com/canonical/go-dqlite/logging/logruslog
+
+go 1.20
+
+require (
+	github.com/canonical/go-dqlite v1.11.9
+	github.com/sirupsen/logrus v1.9.3
+	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
+)
+
+replace github.com/canonical/go-dqlite => ../..
@@ -0,0 +1,57 @@
+// Package logruslog turns a logrus logger into a dqlite logging function.
+//
+// It lives in its own module, so that applications not using logrus don't
+// pull in its dependencies.
+package logruslog
+
+import (
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// New returns a logging function that forwards messages to the given logrus
+// entry, formatting them printf-style. Fields attached with
+// logging.WithFields become logrus fields, in addition to the ones of the
+// entry:
+//
+//	app.New(dir, app.WithLogFunc(logruslog.New(logrus.NewEntry(logger))))
+//
+// Messages logged with level None are discarded.
+func New(entry *logrus.Entry) logging.Func {
+	log := logging.NewKV(func(l logging.Level, msg string, fields ...logging.Field) {
+		level, _ := logrusLevel(l)
+		e := entry
+		if len(fields) > 0 {
+			logrusFields := make(logrus.Fields, len(fields))
+			for _, field := range fields {
+				logrusFields[field.Key] = field.Value
+			}
+			e = e.WithFields(logrusFields)
+		}
+		e.Log(level, msg)
+	})
+	return func(l logging.Level, format string, a ...interface{}) {
+		// Don't format messages that would be discarded.
+		level, ok := logrusLevel(l)
+		if !ok || !entry.Logger.IsLevelEnabled(level) {
+			return
+		}
+		log(l, format, a...)
+	}
+}
+
+// Convert the given level to its logrus equivalent.
+func logrusLevel(l logging.Level) (logrus.Level, bool) {
+	switch l {
+	case logging.Debug:
+		return logrus.DebugLevel, true
+	case logging.Info:
+		return logrus.InfoLevel, true
+	case logging.Warn:
+		return logrus.WarnLevel, true
+	case logging.Error:
+		return logrus.ErrorLevel, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,68 @@
+package logruslog_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/canonical/go-dqlite/logging/logruslog"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Levels(t *testing.T) {
+	cases := []struct {
+		level  logging.Level
+		logrus logrus.Level
+	}{
+		{logging.Debug, logrus.DebugLevel},
+		{logging.Info, logrus.InfoLevel},
+		{logging.Warn, logrus.WarnLevel},
+		{logging.Error, logrus.ErrorLevel},
+	}
+	for _, c := range cases {
+		t.Run(c.level.String(), func(t *testing.T) {
+			logger, hook := newLogger(logrus.DebugLevel)
+			f := logruslog.New(logrus.NewEntry(logger))
+
+			f(c.level, "hello %s", "world")
+
+			entries := hook.AllEntries()
+			require.Len(t, entries, 1)
+			assert.Equal(t, c.logrus, entries[0].Level)
+			assert.Equal(t, "hello world", entries[0].Message)
+		})
+	}
+}
+
+// Messages with level None or below the level of the logger are discarded.
+func TestNew_Discarded(t *testing.T) {
+	logger, hook := newLogger(logrus.InfoLevel)
+	f := logruslog.New(logrus.NewEntry(logger))
+
+	f(logging.None, "dropped")
+	f(logging.Debug, "dropped")
+
+	assert.Empty(t, hook.AllEntries())
+}
+
+// Fields attached with logging.WithFields are added to the ones of the entry.
+func TestNew_Fields(t *testing.T) {
+	logger, hook := newLogger(logrus.DebugLevel)
+	f := logruslog.New(logger.WithField("node_id", 1))
+
+	logging.WithFields(f, logging.Field{Key: "database", Value: "test"})(logging.Info, "opened")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, logrus.Fields{"node_id": 1, "database": "test"}, entries[0].Data)
+}
+
+func newLogger(level logrus.Level) (*logrus.Logger, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	logger.SetOutput(ioutil.Discard)
+	logger.SetLevel(level)
+	return logger, hook
+}
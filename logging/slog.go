@@ -0,0 +1,59 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// NewSlog returns a logging function that forwards messages to the given
+// slog handler, formatting them printf-style. The given attributes are added
+// to every record, which is handy to identify the node emitting it:
+//
+//	log := logging.NewSlog(handler,
+//		slog.Uint64("node_id", id),
+//		slog.String("address", address))
+//
+// Fields attached with WithFields are added as attributes of the records.
+// Messages logged with level None are discarded.
+func NewSlog(handler slog.Handler, attrs ...slog.Attr) Func {
+	if len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	return func(l Level, format string, a ...interface{}) {
+		level, ok := slogLevel(l)
+		if !ok {
+			return
+		}
+		ctx := context.Background()
+		if !handler.Enabled(ctx, level) {
+			return
+		}
+		format, a, fields := splitFields(format, a)
+		record := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, a...), 0)
+		for _, field := range fields {
+			record.AddAttrs(slog.Any(field.Key, field.Value))
+		}
+		handler.Handle(ctx, record)
+	}
+}
+
+// Convert the given level to its slog equivalent.
+func slogLevel(l Level) (slog.Level, bool) {
+	switch l {
+	case Debug:
+		return slog.LevelDebug, true
+	case Info:
+		return slog.LevelInfo, true
+	case Warn:
+		return slog.LevelWarn, true
+	case Error:
+		return slog.LevelError, true
+	default:
+		return 0, false
+	}
+}
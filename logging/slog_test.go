@@ -0,0 +1,39 @@
+//go:build go1.21
+// +build go1.21
+
+package logging_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	f := logging.NewSlog(handler, slog.Uint64("node_id", 1), slog.String("address", "@1"))
+	f(logging.Debug, "dropped")
+	f(logging.None, "dropped")
+	f(logging.Warn, "hello %s", "world")
+	logging.WithFields(f, logging.Field{Key: "database", Value: "test"})(logging.Info, "opened")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		`level=WARN msg="hello world" node_id=1 address=@1`,
+		`level=INFO msg=opened node_id=1 address=@1 database=test`,
+	}, lines)
+}
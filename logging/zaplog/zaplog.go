@@ -0,0 +1,55 @@
+// Package zaplog turns a zap logger into a dqlite logging function.
+//
+// It lives in its own module, so that applications not using zap don't pull
+// in its dependencies.
+package zaplog
+
+import (
+	"github.com/canonical/go-dqlite/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New returns a logging function that forwards messages to the given zap
+// logger, formatting them printf-style. Fields attached with
+// logging.WithFields become zap fields:
+//
+//	app.New(dir, app.WithLogFunc(zaplog.New(logger)))
+//
+// Messages logged with level None are discarded.
+func New(logger *zap.Logger) logging.Func {
+	log := logging.NewKV(func(l logging.Level, msg string, fields ...logging.Field) {
+		level, _ := zapLevel(l)
+		if entry := logger.Check(level, msg); entry != nil {
+			zapFields := make([]zap.Field, len(fields))
+			for i, field := range fields {
+				zapFields[i] = zap.Any(field.Key, field.Value)
+			}
+			entry.Write(zapFields...)
+		}
+	})
+	return func(l logging.Level, format string, a ...interface{}) {
+		// Don't format messages that would be discarded.
+		level, ok := zapLevel(l)
+		if !ok || !logger.Core().Enabled(level) {
+			return
+		}
+		log(l, format, a...)
+	}
+}
+
+// Convert the given level to its zap equivalent.
+func zapLevel(l logging.Level) (zapcore.Level, bool) {
+	switch l {
+	case logging.Debug:
+		return zapcore.DebugLevel, true
+	case logging.Info:
+		return zapcore.InfoLevel, true
+	case logging.Warn:
+		return zapcore.WarnLevel, true
+	case logging.Error:
+		return zapcore.ErrorLevel, true
+	default:
+		return 0, false
+	}
+}
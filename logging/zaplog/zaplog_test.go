@@ -0,0 +1,60 @@
+package zaplog_test
+
+import (
+	"testing"
+
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/canonical/go-dqlite/logging/zaplog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew_Levels(t *testing.T) {
+	cases := []struct {
+		level logging.Level
+		zap   zapcore.Level
+	}{
+		{logging.Debug, zapcore.DebugLevel},
+		{logging.Info, zapcore.InfoLevel},
+		{logging.Warn, zapcore.WarnLevel},
+		{logging.Error, zapcore.ErrorLevel},
+	}
+	for _, c := range cases {
+		t.Run(c.level.String(), func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			f := zaplog.New(zap.New(core))
+
+			f(c.level, "hello %s", "world")
+
+			entries := logs.AllUntimed()
+			require.Len(t, entries, 1)
+			assert.Equal(t, c.zap, entries[0].Level)
+			assert.Equal(t, "hello world", entries[0].Message)
+		})
+	}
+}
+
+// Messages with level None or below the level of the logger are discarded.
+func TestNew_Discarded(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	f := zaplog.New(zap.New(core))
+
+	f(logging.None, "dropped")
+	f(logging.Debug, "dropped")
+
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestNew_Fields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	f := zaplog.New(zap.New(core))
+
+	logging.WithFields(f, logging.Field{Key: "database", Value: "test"})(logging.Info, "opened")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{"database": "test"}, entries[0].ContextMap())
+}
@@ -0,0 +1,20 @@
+module github.com/canonical/go-dqlite/logging/zerologlog
+
+go 1.20
+
+require (
+	github.com/canonical/go-dqlite v1.11.9
+	github.com/rs/zerolog v1.31.0
+	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
+)
+
+replace github.com/canonical/go-dqlite => ../..
@@ -0,0 +1,52 @@
+// Package zerologlog turns a zerolog logger into a dqlite logging function.
+//
+// It lives in its own module, so that applications not using zerolog don't
+// pull in its dependencies.
+package zerologlog
+
+import (
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/rs/zerolog"
+)
+
+// New returns a logging function that forwards messages to the given zerolog
+// logger, formatting them printf-style. Fields attached with
+// logging.WithFields become zerolog fields:
+//
+//	app.New(dir, app.WithLogFunc(zerologlog.New(logger)))
+//
+// Messages logged with level None are discarded.
+func New(logger zerolog.Logger) logging.Func {
+	log := logging.NewKV(func(l logging.Level, msg string, fields ...logging.Field) {
+		level, _ := zerologLevel(l)
+		event := logger.WithLevel(level)
+		for _, field := range fields {
+			event = event.Interface(field.Key, field.Value)
+		}
+		event.Msg(msg)
+	})
+	return func(l logging.Level, format string, a ...interface{}) {
+		// Don't format messages that would be discarded.
+		level, ok := zerologLevel(l)
+		if !ok || level < logger.GetLevel() || level < zerolog.GlobalLevel() {
+			return
+		}
+		log(l, format, a...)
+	}
+}
+
+// Convert the given level to its zerolog equivalent.
+func zerologLevel(l logging.Level) (zerolog.Level, bool) {
+	switch l {
+	case logging.Debug:
+		return zerolog.DebugLevel, true
+	case logging.Info:
+		return zerolog.InfoLevel, true
+	case logging.Warn:
+		return zerolog.WarnLevel, true
+	case logging.Error:
+		return zerolog.ErrorLevel, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,53 @@
+package zerologlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/canonical/go-dqlite/logging"
+	"github.com/canonical/go-dqlite/logging/zerologlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_Levels(t *testing.T) {
+	cases := []struct {
+		level   logging.Level
+		zerolog zerolog.Level
+	}{
+		{logging.Debug, zerolog.DebugLevel},
+		{logging.Info, zerolog.InfoLevel},
+		{logging.Warn, zerolog.WarnLevel},
+		{logging.Error, zerolog.ErrorLevel},
+	}
+	for _, c := range cases {
+		t.Run(c.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			f := zerologlog.New(zerolog.New(&buf))
+
+			f(c.level, "hello %s", "world")
+
+			assert.JSONEq(t, `{"level":"`+c.zerolog.String()+`","message":"hello world"}`, buf.String())
+		})
+	}
+}
+
+// Messages with level None or below the level of the logger are discarded.
+func TestNew_Discarded(t *testing.T) {
+	var buf bytes.Buffer
+	f := zerologlog.New(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	f(logging.None, "dropped")
+	f(logging.Debug, "dropped")
+
+	assert.Empty(t, buf.String())
+}
+
+func TestNew_Fields(t *testing.T) {
+	var buf bytes.Buffer
+	f := zerologlog.New(zerolog.New(&buf))
+
+	logging.WithFields(f, logging.Field{Key: "database", Value: "test"})(logging.Info, "opened")
+
+	assert.JSONEq(t, `{"level":"info","database":"test","message":"opened"}`, buf.String())
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"time"
+
+	dqlitedriver "github.com/canonical/go-dqlite/driver"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DriverCollector is a prometheus.Collector exporting metrics about the
+// activity of a dqlite driver. It must be registered on the driver with
+// driver.WithObserver:
+//
+//	collector := metrics.NewDriverCollector()
+//	drv, err := driver.New(store, driver.WithObserver(collector))
+//	...
+//	prometheus.MustRegister(collector)
+type DriverCollector struct {
+	latency     *prometheus.HistogramVec
+	errors      *prometheus.CounterVec
+	connections prometheus.Counter
+}
+
+// NewDriverCollector creates a new collector for driver metrics.
+func NewDriverCollector() *DriverCollector {
+	return &DriverCollector{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "driver",
+			Name:      "query_duration_seconds",
+			Help:      "Round-trip time of statements executed against the leader, by statement kind.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"kind"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "driver",
+			Name:      "errors_total",
+			Help:      "Errors returned by the driver, by SQLite error code.",
+		}, []string{"code"}),
+		connections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "driver",
+			Name:      "connections_total",
+			Help:      "Connections established with the leader.",
+		}),
+	}
+}
+
+// ObserveQuery implements driver.Observer.
+func (c *DriverCollector) ObserveQuery(kind dqlitedriver.StatementKind, latency time.Duration) {
+	c.latency.WithLabelValues(kind.String()).Observe(latency.Seconds())
+}
+
+// ObserveError implements driver.Observer.
+func (c *DriverCollector) ObserveError(err error) {
+	c.errors.WithLabelValues(errorCode(err)).Inc()
+}
+
+// ObserveConnection implements driver.Observer.
+func (c *DriverCollector) ObserveConnection() {
+	c.connections.Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (c *DriverCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.latency.Describe(ch)
+	c.errors.Describe(ch)
+	c.connections.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *DriverCollector) Collect(ch chan<- prometheus.Metric) {
+	c.latency.Collect(ch)
+	c.errors.Collect(ch)
+	c.connections.Collect(ch)
+}
+
+// Return the label value identifying the given error.
+func errorCode(err error) string {
+	var dqliteErr dqlitedriver.Error
+	switch {
+	case errors.As(err, &dqliteErr):
+		return strconv.Itoa(dqliteErr.Code)
+	case errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,42 @@
+package metrics_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dqlitedriver "github.com/canonical/go-dqlite/driver"
+	"github.com/canonical/go-dqlite/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverCollector(t *testing.T) {
+	collector := metrics.NewDriverCollector()
+
+	collector.ObserveConnection()
+	collector.ObserveQuery(dqlitedriver.StatementInsert, time.Millisecond)
+	collector.ObserveQuery(dqlitedriver.StatementSelect, time.Millisecond)
+	collector.ObserveQuery(dqlitedriver.StatementSelect, time.Millisecond)
+	collector.ObserveError(dqlitedriver.Error{Code: 5})
+	collector.ObserveError(driver.ErrBadConn)
+	collector.ObserveError(errors.New("boom"))
+
+	expected := `
+# HELP dqlite_driver_connections_total Connections established with the leader.
+# TYPE dqlite_driver_connections_total counter
+dqlite_driver_connections_total 1
+# HELP dqlite_driver_errors_total Errors returned by the driver, by SQLite error code.
+# TYPE dqlite_driver_errors_total counter
+dqlite_driver_errors_total{code="5"} 1
+dqlite_driver_errors_total{code="bad_conn"} 1
+dqlite_driver_errors_total{code="other"} 1
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"dqlite_driver_connections_total", "dqlite_driver_errors_total"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(collector, "dqlite_driver_query_duration_seconds"))
+}
@@ -0,0 +1,9 @@
+// Package metrics exports dqlite driver and node metrics as Prometheus
+// collectors.
+//
+// It lives in its own module, so that applications not using Prometheus
+// don't pull in its dependencies.
+package metrics
+
+// Namespace of all exported metrics.
+const namespace = "dqlite"
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	dqlite "github.com/canonical/go-dqlite"
+	"github.com/canonical/go-dqlite/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NodeCollector is a prometheus.Collector exporting metrics about the raft
+// leadership as seen by a dqlite node.
+//
+// Leadership is sampled every time metrics are collected, by asking the node
+// which member of the cluster is the current leader.
+type NodeCollector struct {
+	id      uint64 // ID of the node.
+	address string // Address to connect to in order to query the node.
+	dial    client.DialFunc
+	timeout time.Duration
+
+	mu       sync.Mutex
+	leader   uint64 // ID of the last leader seen.
+	changes  prometheus.Counter
+	isLeader prometheus.Gauge
+	up       prometheus.Gauge
+}
+
+// NodeOption can be used to tweak node collector parameters.
+type NodeOption func(*nodeOptions)
+
+type nodeOptions struct {
+	DialFunc client.DialFunc
+}
+
+// WithDialFunc sets the function used to connect to the node. It must be
+// set when the node only accepts TLS connections on its bind address:
+//
+//	dial := client.DialFuncWithTLS(client.DefaultDialFunc, config)
+//	collector := metrics.NewNodeCollector(node, metrics.WithDialFunc(dial))
+func WithDialFunc(dial client.DialFunc) NodeOption {
+	return func(options *nodeOptions) {
+		options.DialFunc = dial
+	}
+}
+
+// NewNodeCollector creates a new collector for the given node, which must be
+// started.
+func NewNodeCollector(node *dqlite.Node, options ...NodeOption) *NodeCollector {
+	return newNodeCollector(node.ID(), node.Address(), node.BindAddress(), options...)
+}
+
+func newNodeCollector(id uint64, address, bindAddress string, options ...NodeOption) *NodeCollector {
+	o := defaultNodeOptions()
+
+	for _, option := range options {
+		option(o)
+	}
+
+	labels := prometheus.Labels{"address": address}
+	return &NodeCollector{
+		id:      id,
+		address: bindAddress,
+		dial:    o.DialFunc,
+		timeout: time.Second,
+		changes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "node",
+			Name:        "leadership_changes_total",
+			Help:        "Changes of the raft leader observed by the node.",
+			ConstLabels: labels,
+		}),
+		isLeader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "node",
+			Name:        "is_leader",
+			Help:        "Whether the node is the current raft leader.",
+			ConstLabels: labels,
+		}),
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "node",
+			Name:        "up",
+			Help:        "Whether the node could be queried for the current leader.",
+			ConstLabels: labels,
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *NodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.changes.Describe(ch)
+	c.isLeader.Describe(ch)
+	c.up.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *NodeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sample()
+
+	c.changes.Collect(ch)
+	c.isLeader.Collect(ch)
+	c.up.Collect(ch)
+}
+
+// Ask the node about the current leader and update the metrics accordingly.
+func (c *NodeCollector) sample() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	cli, err := client.New(ctx, c.address, client.WithDialFunc(c.dial))
+	if err != nil {
+		c.up.Set(0)
+		return
+	}
+	defer cli.Close()
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		c.up.Set(0)
+		return
+	}
+	c.up.Set(1)
+
+	var id uint64
+	if leader != nil {
+		id = leader.ID
+	}
+	if id != c.leader {
+		if c.leader != 0 {
+			c.changes.Inc()
+		}
+		c.leader = id
+	}
+
+	if id == c.id {
+		c.isLeader.Set(1)
+	} else {
+		c.isLeader.Set(0)
+	}
+}
+
+func defaultNodeOptions() *nodeOptions {
+	return &nodeOptions{
+		DialFunc: client.DefaultDialFunc,
+	}
+}
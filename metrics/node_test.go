@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The node is queried with the configured dial function, and reported as down
+// if it can't be reached.
+func TestNodeCollector_Dial(t *testing.T) {
+	var dialed []string
+	dial := func(ctx context.Context, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return nil, errors.New("unreachable")
+	}
+	collector := newNodeCollector(1, "10.0.0.1:9001", "@1", WithDialFunc(dial))
+
+	expected := `
+# HELP dqlite_node_up Whether the node could be queried for the current leader.
+# TYPE dqlite_node_up gauge
+dqlite_node_up{address="10.0.0.1:9001"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "dqlite_node_up"))
+	assert.Equal(t, []string{"@1"}, dialed)
+}
@@ -2,6 +2,12 @@ package dqlite
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/canonical/go-dqlite/client"
@@ -18,8 +24,14 @@ type Node struct {
 	address     string
 	bindAddress string
 	cancel      context.CancelFunc
+	mu          sync.Mutex // Serializes Start and Close.
+	closed      bool       // Whether Close was called.
 }
 
+// ErrAlreadyClosed is returned by Node.Start and Node.Close when the node has
+// already been closed.
+var ErrAlreadyClosed = errors.New("node already closed")
+
 // NodeInfo is a convenience alias for client.NodeInfo.
 type NodeInfo = client.NodeInfo
 
@@ -31,6 +43,17 @@ type NodeInfo = client.NodeInfo
 // taking a snapshot.
 type SnapshotParams = bindings.SnapshotParams
 
+// ScalarFunc implements a custom SQL scalar function, see WithScalarFunction.
+//
+// Arguments are passed as int64, float64, string, []byte or nil, and the
+// result can be any of those types, or an int or a bool.
+type ScalarFunc = bindings.ScalarFunc
+
+// Aggregate accumulates the rows of a group for a custom SQL aggregate
+// function, see WithAggregateFunction. Step is called for each row, with the
+// same argument types as ScalarFunc, and Final returns the result.
+type Aggregate = bindings.Aggregate
+
 // Option can be used to tweak node parameters.
 type Option func(*options)
 
@@ -49,6 +72,14 @@ func WithBindAddress(address string) Option {
 }
 
 // WithNetworkLatency sets the average one-way network latency.
+//
+// The raft heartbeat and election timeouts are scaled proportionally to it.
+// The defaults are tuned for local networks, so clusters spanning regions
+// with high round-trip times should set it, typically to half the round-trip
+// time between the most distant voters, to avoid spurious leader elections.
+// All nodes of a cluster should use the same value.
+//
+// The latency must be at least one millisecond.
 func WithNetworkLatency(latency time.Duration) Option {
 	return func(options *options) {
 		options.NetworkLatency = uint64(latency.Nanoseconds())
@@ -94,6 +125,47 @@ func WithAutoRecovery(recovery bool) Option {
 	}
 }
 
+// WithScalarFunction registers a custom SQL scalar function with the given
+// name, taking nargs arguments, or any number of them if nargs is -1.
+//
+// Functions are executed by the leader, so every node of the cluster must
+// register the same functions, and they must be deterministic: a function
+// returning different results on different nodes would make the outcome of a
+// statement depend on which node happens to be the leader.
+//
+// Since SQLite functions are registered process-wide, the function is also
+// available to other nodes running in the same process.
+func WithScalarFunction(name string, nargs int, fn ScalarFunc) Option {
+	return func(options *options) {
+		options.Functions = append(options.Functions, function{name: name, nargs: nargs, scalar: fn})
+	}
+}
+
+// WithAggregateFunction registers a custom SQL aggregate function with the
+// given name, taking nargs arguments, or any number of them if nargs is -1.
+// The newAggregate function is called to create the state of each group.
+//
+// The same constraints as WithScalarFunction apply.
+func WithAggregateFunction(name string, nargs int, newAggregate func() Aggregate) Option {
+	return func(options *options) {
+		options.Functions = append(options.Functions, function{name: name, nargs: nargs, aggregate: newAggregate})
+	}
+}
+
+// WithExtensions loads the SQLite extensions with the given names from the
+// given directory, for example "fts5" or "spellfix". A name without a file
+// extension gets the ".so" suffix. Only the named extensions are loaded, not
+// every library found in the directory.
+//
+// As with custom functions, all nodes of the cluster must load the same
+// extensions, and extensions are loaded process-wide.
+func WithExtensions(dir string, names ...string) Option {
+	return func(options *options) {
+		options.ExtensionsDir = dir
+		options.Extensions = append(options.Extensions, names...)
+	}
+}
+
 // New creates a new Node instance.
 func New(id uint64, address string, dir string, options ...Option) (*Node, error) {
 	o := defaultOptions()
@@ -102,6 +174,31 @@ func New(id uint64, address string, dir string, options ...Option) (*Node, error
 		option(o)
 	}
 
+	// libdqlite works with milliseconds, rejecting anything shorter.
+	if o.NetworkLatency != 0 && int64(o.NetworkLatency) < int64(time.Millisecond) {
+		return nil, errors.Errorf("invalid network latency %s: must be at least 1ms", time.Duration(o.NetworkLatency))
+	}
+
+	// Functions must be registered before the node opens any database.
+	for _, f := range o.Functions {
+		if err := bindings.RegisterFunction(f.name, f.nargs, f.scalar, f.aggregate); err != nil {
+			return nil, errors.Wrapf(err, "register SQL function %s", f.name)
+		}
+	}
+
+	for _, name := range o.Extensions {
+		if name == "" || strings.ContainsRune(name, filepath.Separator) || name == ".." {
+			return nil, errors.Errorf("invalid SQLite extension name %q", name)
+		}
+		if filepath.Ext(name) == "" {
+			name += ".so"
+		}
+		path := filepath.Join(o.ExtensionsDir, name)
+		if err := bindings.LoadExtension(path, ""); err != nil {
+			return nil, errors.Wrapf(err, "load SQLite extension %s", name)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	server, err := bindings.NewNode(ctx, id, address, dir)
 	if err != nil {
@@ -164,6 +261,17 @@ func New(id uint64, address string, dir string, options ...Option) (*Node, error
 	return s, nil
 }
 
+// ID returns the raft ID of the node.
+func (s *Node) ID() uint64 {
+	return s.id
+}
+
+// Address returns the raft address of the node, as known by other members of
+// the cluster.
+func (s *Node) Address() string {
+	return s.address
+}
+
 // BindAddress returns the network address the node is listening to.
 func (s *Node) BindAddress() string {
 	return s.server.GetBindAddress()
@@ -171,9 +279,44 @@ func (s *Node) BindAddress() string {
 
 // Start serving requests.
 func (s *Node) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrAlreadyClosed
+	}
+
 	return s.server.Start()
 }
 
+// Dump writes the content of the database with the given name to the given
+// directory, as a plain SQLite database file with the same name as the
+// database, plus its WAL file with the "-wal" suffix. The resulting files can
+// be inspected with standard SQLite tooling.
+//
+// The node must be running.
+func (s *Node) Dump(ctx context.Context, name string, dir string) error {
+	cli, err := client.New(ctx, s.BindAddress())
+	if err != nil {
+		return errors.Wrap(err, "connect to node")
+	}
+	defer cli.Close()
+
+	files, err := cli.Dump(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name)
+		if err := ioutil.WriteFile(path, file.Data, 0600); err != nil {
+			return errors.Wrapf(err, "write %s", path)
+		}
+	}
+
+	return nil
+}
+
 // Recover a node by forcing a new cluster configuration.
 //
 // Deprecated: use ReconfigureMembershipExt instead, which does not require
@@ -192,21 +335,64 @@ type options struct {
 	SnapshotParams bindings.SnapshotParams
 	DiskMode       bool
 	AutoRecovery   bool
+	Functions      []function
+	ExtensionsDir  string
+	Extensions     []string
+}
+
+// A custom SQL function to register, see WithScalarFunction.
+type function struct {
+	name      string
+	nargs     int
+	scalar    ScalarFunc
+	aggregate func() Aggregate
 }
 
 // Close the server, releasing all resources it created.
+//
+// It's safe to call Close multiple times and concurrently with Start: calls
+// after the first successful one return ErrAlreadyClosed. If the node fails
+// to stop, Close can be called again.
 func (s *Node) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrAlreadyClosed
+	}
+
 	s.cancel()
 	// Send a stop signal to the dqlite event loop.
 	if err := s.server.Stop(); err != nil {
 		return errors.Wrap(err, "server failed to stop")
 	}
+	s.closed = true
 
 	s.server.Close()
 
 	return nil
 }
 
+// CloseContext is like Close, but returns the context error if the context is
+// done before the node has stopped, for example because of an orchestration
+// deadline. In that case the node keeps shutting down in the background.
+//
+// Since Close waits for any ongoing snapshot to complete, a context without a
+// deadline can be used to wait as long as needed.
+func (s *Node) CloseContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // BootstrapID is a magic ID that should be used for the fist node in a
 // cluster. Alternatively ID 1 can be used as well.
 const BootstrapID = 0x2dc171858c3155be
@@ -217,6 +403,33 @@ func GenerateID(address string) uint64 {
 	return bindings.GenerateID(address)
 }
 
+// GenerateNodeID returns an ID for a node with the given address, derived
+// from a SHA-256 hash of it. Unlike GenerateID, the result is always the same
+// for the same address, so automation can compute the ID of a node without
+// storing it. Distinct addresses yield distinct IDs with overwhelming
+// probability, and the zero ID and the bootstrap IDs are never returned.
+//
+// The address is normalized with client.NormalizeAddress first, so different
+// spellings of the same address, like "10.0.0.1" and "10.0.0.1:9000", yield
+// the same ID. Addresses that can't be normalized are hashed as they are.
+//
+// A node re-created with a fresh data directory at the address of a node that
+// is still part of the cluster gets the same ID, so the old node must be
+// removed from the cluster first.
+func GenerateNodeID(address string) uint64 {
+	if normalized, err := client.NormalizeAddress(address); err == nil {
+		address = normalized
+	}
+	sum := sha256.Sum256([]byte(address))
+	for {
+		id := binary.LittleEndian.Uint64(sum[:8])
+		if id != 0 && id != 1 && id != BootstrapID {
+			return id
+		}
+		sum = sha256.Sum256(sum[:])
+	}
+}
+
 // ReconfigureMembership forces a new cluster configuration.
 //
 // Deprecated: this function ignores the provided node roles and makes every
@@ -0,0 +1,15 @@
+package dqlite
+
+// LockNode acquires the lock of the given node, blocking Close until the
+// returned function is called.
+func LockNode(node *Node) (unlock func()) {
+	node.mu.Lock()
+	return node.mu.Unlock
+}
+
+// NodeClosed returns whether the given node was closed.
+func NodeClosed(node *Node) bool {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.closed
+}
@@ -1,10 +1,26 @@
 package dqlite_test
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"sort"
+	"testing"
+	"time"
 
 	dqlite "github.com/canonical/go-dqlite"
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/driver"
+	_ "github.com/mattn/go-sqlite3" // Used to read dumped databases.
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type infoSorter []dqlite.LastEntryInfo
@@ -34,3 +50,204 @@ func ExampleLastEntryInfo() {
 	// [{1 1} {1 2} {2 1} {2 2}]
 
 }
+
+func TestNew_InvalidNetworkLatency(t *testing.T) {
+	_, err := dqlite.New(1, "1", "", dqlite.WithNetworkLatency(time.Microsecond))
+	assert.EqualError(t, err, "invalid network latency 1µs: must be at least 1ms")
+}
+
+func TestNew_InvalidFunction(t *testing.T) {
+	_, err := dqlite.New(1, "1", "", dqlite.WithScalarFunction("f", 200, nil))
+	assert.EqualError(t, err, "register SQL function f: invalid number of arguments 200")
+}
+
+func TestNew_InvalidExtension(t *testing.T) {
+	_, err := dqlite.New(1, "1", "", dqlite.WithExtensions("/etc", "../passwd"))
+	assert.EqualError(t, err, `invalid SQLite extension name "../passwd"`)
+}
+
+func TestGenerateNodeID(t *testing.T) {
+	id := dqlite.GenerateNodeID("10.0.0.1:9000")
+	assert.Equal(t, id, dqlite.GenerateNodeID("10.0.0.1:9000"))
+	assert.NotEqual(t, id, dqlite.GenerateNodeID("10.0.0.2:9000"))
+	assert.NotEqual(t, uint64(0), id)
+	assert.NotEqual(t, uint64(dqlite.BootstrapID), id)
+
+	port := client.DefaultPort
+	assert.Equal(t, dqlite.GenerateNodeID("10.0.0.1:"+port), dqlite.GenerateNodeID("10.0.0.1"))
+	assert.Equal(t, dqlite.GenerateNodeID("[::1]:"+port), dqlite.GenerateNodeID("::1"))
+}
+
+func TestConnMatcher(t *testing.T) {
+	cases := []struct {
+		title   string
+		preface uint64
+		match   bool
+	}{
+		{"version one", 1, true},
+		{"legacy version", 0x86104dd760433fe5, true},
+		{"authentication", 0x68747561656c7164, true},
+		{"http", binary.LittleEndian.Uint64([]byte("GET / HT")), false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.title, func(t *testing.T) {
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, c.preface)
+			assert.Equal(t, c.match, dqlite.ConnMatcher()(bytes.NewReader(buf)))
+		})
+	}
+
+	assert.False(t, dqlite.ConnMatcher()(bytes.NewReader([]byte{1, 0, 0})))
+}
+
+// Closing a node twice returns ErrAlreadyClosed, and a closed node can't be
+// started again.
+func TestNode_CloseTwice(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	require.NoError(t, node.Close())
+	assert.Equal(t, dqlite.ErrAlreadyClosed, node.Close())
+	assert.Equal(t, dqlite.ErrAlreadyClosed, node.Start())
+}
+
+// Only one of several concurrent calls to Close actually closes the node.
+func TestNode_CloseConcurrent(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- node.Close()
+		}()
+	}
+
+	closed := 0
+	for i := 0; i < cap(errs); i++ {
+		err := <-errs
+		if err == nil {
+			closed++
+			continue
+		}
+		assert.Equal(t, dqlite.ErrAlreadyClosed, err)
+	}
+	assert.Equal(t, 1, closed)
+}
+
+func TestNode_CloseContext(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	require.NoError(t, node.CloseContext(context.Background()))
+	assert.Equal(t, dqlite.ErrAlreadyClosed, node.CloseContext(context.Background()))
+}
+
+// If the context is done before the node has stopped, CloseContext returns
+// its error, and the node keeps shutting down in the background.
+func TestNode_CloseContextDeadline(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+
+	unlock := dqlite.LockNode(node)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := node.CloseContext(ctx)
+	unlock()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.Eventually(t, func() bool {
+		return dqlite.NodeClosed(node)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// The dumped database and WAL files can be read with standard SQLite tooling.
+func TestNode_Dump(t *testing.T) {
+	node, cleanup := newNode(t)
+	defer cleanup()
+	defer node.Close()
+
+	store := client.NewInmemNodeStore()
+	require.NoError(t, store.Set(context.Background(), []client.NodeInfo{{ID: 1, Address: node.BindAddress()}}))
+	drv, err := driver.New(store)
+	require.NoError(t, err)
+	conn, err := drv.Open("test.db")
+	require.NoError(t, err)
+	defer conn.Close()
+	execer := conn.(sqldriver.ExecerContext)
+	_, err = execer.ExecContext(context.Background(), "CREATE TABLE foo (n INT)", nil)
+	require.NoError(t, err)
+	_, err = execer.ExecContext(context.Background(), "INSERT INTO foo VALUES(123)", nil)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "dqlite-node-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, node.Dump(context.Background(), "test.db", dir))
+	assert.FileExists(t, filepath.Join(dir, "test.db"))
+	assert.FileExists(t, filepath.Join(dir, "test.db-wal"))
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	var n int
+	require.NoError(t, db.QueryRow("SELECT n FROM foo").Scan(&n))
+	assert.Equal(t, 123, n)
+
+	err = node.Dump(context.Background(), "test.db", filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestNode_HandleConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dqlite-node-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	node, err := dqlite.New(1, "@1", dir, dqlite.WithBindAddress("@1"))
+	require.NoError(t, err)
+	require.NoError(t, node.Start())
+	defer node.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go node.HandleConn(conn)
+		}
+	}()
+
+	cli, err := client.New(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	leader, err := cli.Leader(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), leader.ID)
+}
+
+// Create and start a node, returning a function which removes its data
+// directory. Tests are responsible for closing the node.
+func newNode(t *testing.T) (*dqlite.Node, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dqlite-node-test-")
+	require.NoError(t, err)
+
+	node, err := dqlite.New(1, "@1", dir, dqlite.WithBindAddress("@1"))
+	require.NoError(t, err)
+	require.NoError(t, node.Start())
+
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	return node, cleanup
+}
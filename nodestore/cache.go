@@ -0,0 +1,98 @@
+// Package nodestore holds helpers for implementing client.NodeStore on top of
+// external services.
+//
+// The stores themselves live in sub-directories, each in its own module, so
+// that applications don't pull in the dependencies of services they don't
+// use.
+package nodestore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/canonical/go-dqlite/client"
+)
+
+// Cache holds a local copy of a list of nodes and notifies watchers when it
+// changes. It's meant to be embedded by stores that keep the list up to date
+// in the background, so that Get never hits the network.
+//
+// It's safe for concurrent use, and the zero value holds an empty list.
+type Cache struct {
+	mu       sync.RWMutex
+	servers  []client.NodeInfo
+	watchers map[chan []client.NodeInfo]struct{}
+}
+
+// Get returns a copy of the current list of nodes.
+func (c *Cache) Get(ctx context.Context) ([]client.NodeInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyNodes(c.servers), nil
+}
+
+// Update replaces the current list of nodes and sends it to all watchers.
+//
+// Nothing happens if the list is the same as the current one, so stores can
+// call Update every time they reload the list without triggering spurious
+// notifications. The return value tells whether the list changed.
+func (c *Cache) Update(servers []client.NodeInfo) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if equalNodes(c.servers, servers) {
+		return false
+	}
+	c.servers = copyNodes(servers)
+
+	// Notify watchers, replacing any list they didn't receive yet.
+	for ch := range c.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- copyNodes(servers)
+	}
+
+	return true
+}
+
+// Watch implements client.NodeStoreWatcher, returning a channel receiving the
+// new list of nodes every time it's updated, until the given context is done.
+func (c *Cache) Watch(ctx context.Context) <-chan []client.NodeInfo {
+	ch := make(chan []client.NodeInfo, 1)
+
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = map[chan []client.NodeInfo]struct{}{}
+	}
+	c.watchers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		delete(c.watchers, ch)
+		close(ch)
+		c.mu.Unlock()
+	}()
+
+	return ch
+}
+
+func copyNodes(servers []client.NodeInfo) []client.NodeInfo {
+	ret := make([]client.NodeInfo, len(servers))
+	copy(ret, servers)
+	return ret
+}
+
+func equalNodes(a, b []client.NodeInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
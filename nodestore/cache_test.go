@@ -0,0 +1,65 @@
+package nodestore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/nodestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Get(t *testing.T) {
+	cache := &nodestore.Cache{}
+
+	servers, err := cache.Get(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, servers, 0)
+
+	update := []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}
+	cache.Update(update)
+	update[0].Address = "5.6.7.8:666"
+
+	servers, err = cache.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}, servers)
+}
+
+// Watchers receive the most recent list, and their channel is closed when
+// their context is done.
+func TestCache_Watch(t *testing.T) {
+	cache := &nodestore.Cache{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := cache.Watch(ctx)
+
+	cache.Update([]client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}})
+	cache.Update([]client.NodeInfo{{ID: 2, Address: "5.6.7.8:666"}})
+
+	servers := <-ch
+	assert.Equal(t, []client.NodeInfo{{ID: 2, Address: "5.6.7.8:666"}}, servers)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+// Updating the cache with the list it already holds doesn't notify watchers.
+func TestCache_UpdateUnchanged(t *testing.T) {
+	cache := &nodestore.Cache{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := cache.Watch(ctx)
+
+	assert.True(t, cache.Update([]client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}))
+	<-ch
+
+	assert.False(t, cache.Update([]client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}))
+	select {
+	case servers := <-ch:
+		t.Fatalf("unexpected notification: %v", servers)
+	default:
+	}
+}
@@ -0,0 +1,133 @@
+// Package consul provides a client.NodeStore keeping the list of dqlite nodes
+// in a Consul KV key.
+//
+// It lives in its own module, so that applications not using Consul don't
+// pull in its dependencies.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/nodestore"
+	"github.com/hashicorp/consul/api"
+)
+
+// Store implements client.NodeStore on top of a Consul KV key holding the JSON
+// encoded list of nodes.
+//
+// The list is cached locally and kept up to date with blocking queries on the
+// key, so Get never hits the network and always returns the most recent list
+// written by any client sharing the key.
+type Store struct {
+	kv     *api.KV
+	key    string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	cache nodestore.Cache // Local copy of the list of nodes.
+}
+
+// New creates a new Store backed by the given Consul KV key, loading its
+// current value and starting to watch it for changes. Call Close to stop
+// watching.
+func New(ctx context.Context, cli *api.Client, key string) (*Store, error) {
+	s := &Store{
+		kv:   cli.KV(),
+		key:  key,
+		done: make(chan struct{}),
+	}
+
+	index, err := s.load(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go s.watch(ctx, index)
+
+	return s, nil
+}
+
+// Get the current servers.
+func (s *Store) Get(ctx context.Context) ([]client.NodeInfo, error) {
+	return s.cache.Get(ctx)
+}
+
+// Set the servers.
+func (s *Store) Set(ctx context.Context, servers []client.NodeInfo) error {
+	data, err := json.Marshal(servers)
+	if err != nil {
+		return fmt.Errorf("encode servers: %w", err)
+	}
+
+	pair := &api.KVPair{Key: s.key, Value: data}
+	if _, err := s.kv.Put(pair, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("put key %q: %w", s.key, err)
+	}
+
+	s.cache.Update(servers)
+
+	return nil
+}
+
+// Close stops watching the key. It does not close the Consul client.
+func (s *Store) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Load the value of the key, blocking until it changes if the given index is
+// not zero, and return the new index.
+func (s *Store) load(ctx context.Context, index uint64) (uint64, error) {
+	options := (&api.QueryOptions{WaitIndex: index}).WithContext(ctx)
+	pair, meta, err := s.kv.Get(s.key, options)
+	if err != nil {
+		return 0, fmt.Errorf("get key %q: %w", s.key, err)
+	}
+
+	servers := []client.NodeInfo{}
+	if pair != nil {
+		if err := json.Unmarshal(pair.Value, &servers); err != nil {
+			return 0, fmt.Errorf("decode servers: %w", err)
+		}
+	}
+	s.cache.Update(servers)
+
+	// Reset the index if it goes backwards, as recommended by the Consul
+	// documentation on blocking queries.
+	if meta.LastIndex < index {
+		return 0, nil
+	}
+
+	return meta.LastIndex, nil
+}
+
+// Watch the key for changes, until the given context is done.
+func (s *Store) watch(ctx context.Context, index uint64) {
+	defer close(s.done)
+
+	for {
+		next, err := s.load(ctx, index)
+		if err == nil {
+			index = next
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Watch implements client.NodeStoreWatcher, returning a channel receiving the
+// new list of servers every time the key changes.
+func (s *Store) Watch(ctx context.Context) <-chan []client.NodeInfo {
+	return s.cache.Watch(ctx)
+}
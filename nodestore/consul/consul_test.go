@@ -0,0 +1,176 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/nodestore/consul"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_SetGet(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	store := newStore(t, server)
+	defer store.Close()
+
+	servers, err := store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, servers)
+
+	nodes := []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}
+	require.NoError(t, store.Set(context.Background(), nodes))
+
+	servers, err = store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, nodes, servers)
+	assert.JSONEq(t, `[{"ID":1,"Address":"1.2.3.4:666","Role":0}]`, server.value())
+}
+
+// Changes made by other clients are picked up by the blocking queries and
+// sent to watchers.
+func TestStore_Watch(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	store := newStore(t, server)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := store.Watch(ctx)
+
+	server.put(`[{"ID":2,"Address":"5.6.7.8:666"}]`)
+
+	select {
+	case servers := <-ch:
+		assert.Equal(t, []client.NodeInfo{{ID: 2, Address: "5.6.7.8:666"}}, servers)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+}
+
+// Blocking queries returning without any change don't notify watchers.
+func TestStore_WatchUnchanged(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	server.put(`[{"ID":1,"Address":"1.2.3.4:666"}]`)
+	store := newStore(t, server)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := store.Watch(ctx)
+
+	server.waitQueries(t, 3)
+	select {
+	case servers := <-ch:
+		t.Fatalf("unexpected notification: %v", servers)
+	default:
+	}
+}
+
+func newStore(t *testing.T, server *fakeConsul) *consul.Store {
+	cli, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	store, err := consul.New(context.Background(), cli, "dqlite")
+	require.NoError(t, err)
+	return store
+}
+
+// Consul HTTP API serving a single KV key from memory. Blocking queries
+// return after a short wait with the same index if nothing changed, like a
+// real agent does when its wait time expires.
+type fakeConsul struct {
+	*httptest.Server
+	mu      sync.Mutex
+	data    []byte
+	index   uint64
+	queries int           // Number of GET requests served.
+	changed chan struct{} // Closed and replaced on every change.
+}
+
+func newFakeConsul() *fakeConsul {
+	c := &fakeConsul{index: 1, changed: make(chan struct{})}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *fakeConsul) value() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.data)
+}
+
+func (c *fakeConsul) put(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = []byte(value)
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Wait until the given number of GET requests was served.
+func (c *fakeConsul) waitQueries(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		c.mu.Lock()
+		queries := c.queries
+		c.mu.Unlock()
+		if queries >= n {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("less than %d queries served", n)
+}
+
+func (c *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.put(string(data))
+		w.Write([]byte("true"))
+	case http.MethodGet:
+		wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		c.mu.Lock()
+		c.queries++
+		changed := c.changed
+		index := c.index
+		c.mu.Unlock()
+		if wait != 0 && wait >= index {
+			select {
+			case <-changed:
+			case <-time.After(50 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		c.mu.Lock()
+		data, index := c.data, c.index
+		c.mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		w.Header().Set("X-Consul-LastContact", "0")
+		if data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]*api.KVPair{{Key: "dqlite", Value: data}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,147 @@
+// Package etcd provides a client.NodeStore keeping the list of dqlite nodes in
+// an etcd key.
+//
+// It lives in its own module, so that applications not using etcd don't pull
+// in its dependencies.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/nodestore"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Store implements client.NodeStore on top of an etcd key holding the JSON
+// encoded list of nodes.
+//
+// The list is cached locally and kept up to date by watching the key, so Get
+// never hits the network and always returns the most recent list written by
+// any client sharing the key.
+type Store struct {
+	client *clientv3.Client
+	key    string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	cache nodestore.Cache // Local copy of the list of nodes.
+}
+
+// New creates a new Store backed by the given etcd key, loading its current
+// value and starting to watch it for changes. Call Close to stop watching.
+func New(ctx context.Context, cli *clientv3.Client, key string) (*Store, error) {
+	s := &Store{
+		client: cli,
+		key:    key,
+		done:   make(chan struct{}),
+	}
+
+	revision, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go s.watch(ctx, revision)
+
+	return s, nil
+}
+
+// Get the current servers.
+func (s *Store) Get(ctx context.Context) ([]client.NodeInfo, error) {
+	return s.cache.Get(ctx)
+}
+
+// Set the servers.
+func (s *Store) Set(ctx context.Context, servers []client.NodeInfo) error {
+	data, err := json.Marshal(servers)
+	if err != nil {
+		return fmt.Errorf("encode servers: %w", err)
+	}
+
+	if _, err := s.client.Put(ctx, s.key, string(data)); err != nil {
+		return fmt.Errorf("put key %q: %w", s.key, err)
+	}
+
+	s.cache.Update(servers)
+
+	return nil
+}
+
+// Close stops watching the key. It does not close the etcd client.
+func (s *Store) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Load the current value of the key, returning its revision.
+func (s *Store) load(ctx context.Context) (int64, error) {
+	response, err := s.client.Get(ctx, s.key)
+	if err != nil {
+		return 0, fmt.Errorf("get key %q: %w", s.key, err)
+	}
+
+	servers := []client.NodeInfo{}
+	if len(response.Kvs) > 0 {
+		if err := json.Unmarshal(response.Kvs[0].Value, &servers); err != nil {
+			return 0, fmt.Errorf("decode servers: %w", err)
+		}
+	}
+	s.cache.Update(servers)
+
+	return response.Header.Revision, nil
+}
+
+// Watch the key for changes made after the given revision, until the given
+// context is done.
+func (s *Store) watch(ctx context.Context, revision int64) {
+	defer close(s.done)
+
+	for {
+		watchCtx, cancel := context.WithCancel(ctx)
+		watch := s.client.Watch(watchCtx, s.key, clientv3.WithRev(revision+1))
+		for response := range watch {
+			if response.Err() != nil {
+				break
+			}
+			for _, event := range response.Events {
+				servers := []client.NodeInfo{}
+				if event.Type == mvccpb.PUT {
+					if err := json.Unmarshal(event.Kv.Value, &servers); err != nil {
+						continue
+					}
+				}
+				s.cache.Update(servers)
+				revision = event.Kv.ModRevision
+			}
+		}
+		cancel()
+
+		// The watch got cancelled, possibly because the revision we
+		// were watching from got compacted: reload the key and start
+		// over.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			var err error
+			if revision, err = s.load(ctx); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// Watch implements client.NodeStoreWatcher, returning a channel receiving the
+// new list of servers every time the key changes.
+func (s *Store) Watch(ctx context.Context) <-chan []client.NodeInfo {
+	return s.cache.Watch(ctx)
+}
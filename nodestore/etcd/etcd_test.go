@@ -0,0 +1,194 @@
+package etcd_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/nodestore/etcd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestStore_SetGet(t *testing.T) {
+	server := newFakeEtcd()
+	store := newStore(t, server)
+	defer store.Close()
+
+	servers, err := store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, servers)
+
+	nodes := []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}
+	require.NoError(t, store.Set(context.Background(), nodes))
+
+	servers, err = store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, nodes, servers)
+	assert.JSONEq(t, `[{"ID":1,"Address":"1.2.3.4:666","Role":0}]`, server.value())
+}
+
+// Changes made by other clients are sent to watchers, but the watch event of
+// a change made by the store itself doesn't notify them a second time.
+func TestStore_Watch(t *testing.T) {
+	server := newFakeEtcd()
+	store := newStore(t, server)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := store.Watch(ctx)
+
+	nodes := []client.NodeInfo{{ID: 1, Address: "1.2.3.4:666"}}
+	require.NoError(t, store.Set(context.Background(), nodes))
+	assert.Equal(t, nodes, <-ch)
+	server.event(t, server.value())
+	select {
+	case servers := <-ch:
+		t.Fatalf("unexpected notification: %v", servers)
+	default:
+	}
+
+	server.event(t, `[{"ID":2,"Address":"5.6.7.8:666"}]`)
+	assert.Equal(t, []client.NodeInfo{{ID: 2, Address: "5.6.7.8:666"}}, <-ch)
+}
+
+// Reloading the key after the watch got cancelled doesn't notify watchers if
+// the key didn't change.
+func TestStore_WatchCompacted(t *testing.T) {
+	server := newFakeEtcd()
+	server.put(`[{"ID":1,"Address":"1.2.3.4:666"}]`)
+	store := newStore(t, server)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := store.Watch(ctx)
+
+	server.send(t, clientv3.WatchResponse{CompactRevision: 1})
+	server.waitWatches(t, 2)
+	select {
+	case servers := <-ch:
+		t.Fatalf("unexpected notification: %v", servers)
+	default:
+	}
+}
+
+func newStore(t *testing.T, server *fakeEtcd) *etcd.Store {
+	cli := clientv3.NewCtxClient(context.Background())
+	cli.KV = server
+	cli.Watcher = server
+	store, err := etcd.New(context.Background(), cli, "dqlite")
+	require.NoError(t, err)
+	return store
+}
+
+// In-memory etcd KV and watcher serving a single key. Watch responses are
+// only sent when tests ask for them.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+
+	mu       sync.Mutex
+	data     []byte
+	revision int64
+	out      chan clientv3.WatchResponse // Channel of the current watch.
+	watches  int                         // Number of watches started.
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{revision: 1}
+}
+
+func (e *fakeEtcd) value() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return string(e.data)
+}
+
+func (e *fakeEtcd) put(value string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.data = []byte(value)
+	e.revision++
+	return e.revision
+}
+
+// Send a watch event for a new value of the key, and wait for the store to
+// process it.
+func (e *fakeEtcd) event(t *testing.T, value string) {
+	revision := e.put(value)
+	event := &clientv3.Event{
+		Type: mvccpb.PUT,
+		Kv:   &mvccpb.KeyValue{Value: []byte(value), ModRevision: revision},
+	}
+	e.send(t, clientv3.WatchResponse{Events: []*clientv3.Event{event}})
+
+	// The store is done with the event once it receives the next
+	// response.
+	e.send(t, clientv3.WatchResponse{})
+}
+
+// Send a response on the current watch, waiting for the store to receive it.
+func (e *fakeEtcd) send(t *testing.T, response clientv3.WatchResponse) {
+	e.waitWatches(t, 1)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case e.out <- response:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch response not received")
+	}
+}
+
+// Wait until the given number of watches was started.
+func (e *fakeEtcd) waitWatches(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		e.mu.Lock()
+		watches := e.watches
+		e.mu.Unlock()
+		if watches >= n {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("less than %d watches started", n)
+}
+
+func (e *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	response := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: e.revision}}
+	if e.data != nil {
+		response.Kvs = []*mvccpb.KeyValue{{Key: []byte(key), Value: e.data}}
+	}
+	return response, nil
+}
+
+func (e *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	revision := e.put(val)
+	return &clientv3.PutResponse{Header: &pb.ResponseHeader{Revision: revision}}, nil
+}
+
+func (e *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	out := make(chan clientv3.WatchResponse)
+
+	e.mu.Lock()
+	e.out = out
+	e.watches++
+	e.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		close(out)
+		e.mu.Unlock()
+	}()
+
+	return out
+}
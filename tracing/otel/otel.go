@@ -0,0 +1,135 @@
+// Package otel provides a tracing.Tracer backed by OpenTelemetry.
+//
+// It lives in its own module, so that applications not using OpenTelemetry
+// don't pull in its dependencies.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/canonical/go-dqlite/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Key of the attribute holding the text of traced queries, following the
+// OpenTelemetry semantic conventions for databases.
+const statementKey = "db.statement"
+
+// Tracer implements tracing.Tracer on top of an OpenTelemetry tracer.
+type Tracer struct {
+	tracer     trace.Tracer
+	attributes []attribute.KeyValue
+}
+
+// Option can be used to tweak tracer parameters.
+type Option func(*options)
+
+type options struct {
+	Attributes []attribute.KeyValue
+}
+
+// WithAttributes sets extra attributes added to every span, for example to
+// identify the application issuing the queries.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return func(options *options) {
+		options.Attributes = append(options.Attributes, attributes...)
+	}
+}
+
+// New creates a new Tracer emitting spans through the given OpenTelemetry
+// tracer.
+//
+// Use it with tracing.WithTracer to trace the requests issued with a context:
+//
+//	tracer := otel.New(provider.Tracer("dqlite"))
+//	ctx = tracing.WithTracer(ctx, tracer)
+func New(tracer trace.Tracer, options ...Option) *Tracer {
+	o := defaultOptions()
+
+	for _, option := range options {
+		option(o)
+	}
+
+	attributes := []attribute.KeyValue{attribute.String("db.system", "dqlite")}
+	attributes = append(attributes, o.Attributes...)
+
+	return &Tracer{
+		tracer:     tracer,
+		attributes: attributes,
+	}
+}
+
+// Start creates a client span named after the given operation, with the query
+// text as attribute. The span will be a child of any span already contained
+// in the given context.
+func (t *Tracer) Start(ctx context.Context, name, query string) (context.Context, tracing.Span) {
+	attributes := make([]attribute.KeyValue, 0, len(t.attributes)+1)
+	attributes = append(attributes, t.attributes...)
+	if query != "" {
+		attributes = append(attributes, attribute.String(statementKey, query))
+	}
+
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+
+	return ctx, &Span{span: span}
+}
+
+// Span wraps an OpenTelemetry span, implementing tracing.Span,
+// tracing.AttributeSetter and tracing.Propagator.
+type Span struct {
+	span trace.Span
+}
+
+// SetAttributes records the given attributes on the span, such as the
+// address of the node serving the request and the ID of the leader.
+func (s *Span) SetAttributes(attributes ...tracing.Attribute) {
+	converted := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		converted = append(converted, convertAttribute(a))
+	}
+	s.span.SetAttributes(converted...)
+}
+
+// TraceParent returns the span context as a W3C traceparent value.
+func (s *Span) TraceParent() string {
+	sc := s.span.SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// End completes the span.
+func (s *Span) End() {
+	s.span.End()
+}
+
+func defaultOptions() *options {
+	return &options{}
+}
+
+// Convert a dqlite attribute to its OpenTelemetry equivalent.
+func convertAttribute(a tracing.Attribute) attribute.KeyValue {
+	key := attribute.Key(a.Key)
+	switch value := a.Value.(type) {
+	case string:
+		return key.String(value)
+	case bool:
+		return key.Bool(value)
+	case int:
+		return key.Int(value)
+	case int64:
+		return key.Int64(value)
+	case uint64:
+		return key.Int64(int64(value))
+	case float64:
+		return key.Float64(value)
+	default:
+		return key.String(fmt.Sprint(value))
+	}
+}
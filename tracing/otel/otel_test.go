@@ -0,0 +1,69 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/canonical/go-dqlite/tracing"
+	"github.com/canonical/go-dqlite/tracing/otel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Spans started through the tracing package are recorded as OpenTelemetry
+// client spans, with the query and the attributes set by dqlite.
+func TestTracer_Start(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := otel.New(provider.Tracer("dqlite"), otel.WithAttributes(attribute.String("app", "test")))
+
+	ctx := tracing.WithTracer(context.Background(), tracer)
+	ctx, parent := tracing.Start(ctx, "parent", "")
+	_, span := tracing.Start(ctx, "query", "SELECT 1")
+	tracing.SetAttributes(span,
+		tracing.Attribute{Key: tracing.NodeAddressKey, Value: "@1"},
+		tracing.Attribute{Key: tracing.LeaderIDKey, Value: uint64(1)},
+	)
+	span.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	query := spans[0]
+	assert.Equal(t, "query", query.Name())
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("db.system", "dqlite"),
+		attribute.String("app", "test"),
+		attribute.String("db.statement", "SELECT 1"),
+		attribute.String(tracing.NodeAddressKey, "@1"),
+		attribute.Int64(tracing.LeaderIDKey, 1),
+	}, query.Attributes())
+}
+
+func TestSpan_TraceParent(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	tracer := otel.New(provider.Tracer("dqlite"))
+
+	_, span := tracer.Start(context.Background(), "query", "SELECT 1")
+	defer span.End()
+
+	traceParent := span.(tracing.Propagator).TraceParent()
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, traceParent)
+}
+
+// Spans that are not recorded have no valid context to propagate.
+func TestSpan_TraceParentInvalid(t *testing.T) {
+	tracer := otel.New(noop.NewTracerProvider().Tracer("dqlite"))
+
+	_, span := tracer.Start(context.Background(), "query", "SELECT 1")
+	defer span.End()
+
+	assert.Equal(t, "", span.(tracing.Propagator).TraceParent())
+}
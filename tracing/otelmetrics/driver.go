@@ -0,0 +1,115 @@
+package otelmetrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"time"
+
+	dqlitedriver "github.com/canonical/go-dqlite/driver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// DriverObserver records metrics about the activity of a dqlite driver. It
+// must be registered on the driver with driver.WithObserver:
+//
+//	observer, err := otelmetrics.NewDriverObserver(provider.Meter("dqlite"))
+//	...
+//	drv, err := driver.New(store, driver.WithObserver(observer))
+//	...
+//	err = otelmetrics.ObserveDriverStats(provider.Meter("dqlite"), drv)
+type DriverObserver struct {
+	latency     metric.Float64Histogram
+	errors      metric.Int64Counter
+	connections metric.Int64Counter
+}
+
+// NewDriverObserver creates a new observer recording driver metrics with the
+// given meter.
+func NewDriverObserver(meter metric.Meter) (*DriverObserver, error) {
+	latency, err := meter.Float64Histogram(prefix+"driver.query.duration",
+		metric.WithDescription("Round-trip time of statements executed against the leader, by statement kind."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	errs, err := meter.Int64Counter(prefix+"driver.errors",
+		metric.WithDescription("Errors returned by the driver, by SQLite error code."))
+	if err != nil {
+		return nil, err
+	}
+	connections, err := meter.Int64Counter(prefix+"driver.connections",
+		metric.WithDescription("Connections established with the leader."))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DriverObserver{
+		latency:     latency,
+		errors:      errs,
+		connections: connections,
+	}, nil
+}
+
+// ObserveQuery implements driver.Observer.
+func (o *DriverObserver) ObserveQuery(kind dqlitedriver.StatementKind, latency time.Duration) {
+	o.latency.Record(context.Background(), latency.Seconds(),
+		metric.WithAttributes(attribute.String("kind", kind.String())))
+}
+
+// ObserveError implements driver.Observer.
+func (o *DriverObserver) ObserveError(err error) {
+	o.errors.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("code", errorCode(err))))
+}
+
+// ObserveConnection implements driver.Observer.
+func (o *DriverObserver) ObserveConnection() {
+	o.connections.Add(context.Background(), 1)
+}
+
+// ObserveDriverStats registers asynchronous instruments reporting the
+// counters returned by the Stats method of the given driver, such as the
+// number of retried attempts to find the leader.
+func ObserveDriverStats(meter metric.Meter, drv *dqlitedriver.Driver) error {
+	retries, err := meter.Int64ObservableCounter(prefix+"driver.retries",
+		metric.WithDescription("Retried attempts to find the leader."))
+	if err != nil {
+		return err
+	}
+	reconnections, err := meter.Int64ObservableCounter(prefix+"driver.reconnections",
+		metric.WithDescription("Connections dropped because of network errors or leadership loss."))
+	if err != nil {
+		return err
+	}
+	transactions, err := meter.Int64ObservableUpDownCounter(prefix+"driver.transactions",
+		metric.WithDescription("Transactions currently in progress."))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := drv.Stats()
+		o.ObserveInt64(retries, stats.Retries)
+		o.ObserveInt64(reconnections, stats.Reconnections)
+		o.ObserveInt64(transactions, stats.Transactions)
+		return nil
+	}, retries, reconnections, transactions)
+
+	return err
+}
+
+// Return the attribute value identifying the given error.
+func errorCode(err error) string {
+	var dqliteErr dqlitedriver.Error
+	switch {
+	case errors.As(err, &dqliteErr):
+		return strconv.Itoa(dqliteErr.Code)
+	case errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	default:
+		return "other"
+	}
+}
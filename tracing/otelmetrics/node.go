@@ -0,0 +1,139 @@
+package otelmetrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	dqlite "github.com/canonical/go-dqlite"
+	"github.com/canonical/go-dqlite/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// NodeOption can be used to tweak the sampling of node metrics.
+type NodeOption func(*nodeOptions)
+
+type nodeOptions struct {
+	DialFunc client.DialFunc
+}
+
+// WithDialFunc sets the function used to connect to the node. It must be
+// set when the node only accepts TLS connections on its bind address.
+func WithDialFunc(dial client.DialFunc) NodeOption {
+	return func(options *nodeOptions) {
+		options.DialFunc = dial
+	}
+}
+
+// ObserveNode registers asynchronous instruments reporting the raft
+// leadership as seen by the given node, which must be started.
+//
+// Leadership is sampled every time metrics are collected, by asking the node
+// which member of the cluster is the current leader.
+func ObserveNode(meter metric.Meter, node *dqlite.Node, options ...NodeOption) error {
+	return observeNode(meter, node.ID(), node.Address(), node.BindAddress(), options...)
+}
+
+func observeNode(meter metric.Meter, id uint64, address, bindAddress string, options ...NodeOption) error {
+	o := defaultNodeOptions()
+
+	for _, option := range options {
+		option(o)
+	}
+
+	changes, err := meter.Int64ObservableCounter(prefix+"node.leadership_changes",
+		metric.WithDescription("Changes of the raft leader observed by the node."))
+	if err != nil {
+		return err
+	}
+	isLeader, err := meter.Int64ObservableGauge(prefix+"node.is_leader",
+		metric.WithDescription("Whether the node is the current raft leader."))
+	if err != nil {
+		return err
+	}
+	up, err := meter.Int64ObservableGauge(prefix+"node.up",
+		metric.WithDescription("Whether the node could be queried for the current leader."))
+	if err != nil {
+		return err
+	}
+
+	s := &nodeSampler{
+		id:      id,
+		address: bindAddress,
+		dial:    o.DialFunc,
+		timeout: time.Second,
+	}
+	attributes := metric.WithAttributes(attribute.String("address", address))
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.sample(ctx)
+
+		o.ObserveInt64(changes, s.changes, attributes)
+		o.ObserveInt64(isLeader, boolToInt64(s.leader != 0 && s.leader == s.id), attributes)
+		o.ObserveInt64(up, boolToInt64(s.up), attributes)
+		return nil
+	}, changes, isLeader, up)
+
+	return err
+}
+
+// Keeps track of the leadership as seen by a node.
+type nodeSampler struct {
+	id      uint64 // ID of the node.
+	address string // Address to connect to in order to query the node.
+	dial    client.DialFunc
+	timeout time.Duration
+
+	mu      sync.Mutex
+	leader  uint64 // ID of the last leader seen.
+	changes int64  // Number of leader changes seen.
+	up      bool   // Whether the last sample succeeded.
+}
+
+// Ask the node about the current leader and update the state accordingly.
+func (s *nodeSampler) sample(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cli, err := client.New(ctx, s.address, client.WithDialFunc(s.dial))
+	if err != nil {
+		s.up = false
+		return
+	}
+	defer cli.Close()
+
+	leader, err := cli.Leader(ctx)
+	if err != nil {
+		s.up = false
+		return
+	}
+	s.up = true
+
+	var id uint64
+	if leader != nil {
+		id = leader.ID
+	}
+	if id != s.leader {
+		if s.leader != 0 {
+			s.changes++
+		}
+		s.leader = id
+	}
+}
+
+func defaultNodeOptions() *nodeOptions {
+	return &nodeOptions{
+		DialFunc: client.DefaultDialFunc,
+	}
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
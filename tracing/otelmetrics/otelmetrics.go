@@ -0,0 +1,9 @@
+// Package otelmetrics exports dqlite driver and node metrics as OpenTelemetry
+// instruments, mirroring the Prometheus collectors of the metrics package.
+//
+// It lives in its own module, so that applications not using OpenTelemetry
+// don't pull in its dependencies.
+package otelmetrics
+
+// Prefix of the names of all instruments.
+const prefix = "dqlite."
@@ -0,0 +1,86 @@
+package otelmetrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	dqlitedriver "github.com/canonical/go-dqlite/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestDriverObserver(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("dqlite")
+	observer, err := NewDriverObserver(meter)
+	require.NoError(t, err)
+
+	observer.ObserveConnection()
+	observer.ObserveQuery(dqlitedriver.StatementSelect, time.Millisecond)
+	observer.ObserveQuery(dqlitedriver.StatementSelect, time.Millisecond)
+	observer.ObserveError(dqlitedriver.Error{Code: 5})
+	observer.ObserveError(driver.ErrBadConn)
+	observer.ObserveError(errors.New("boom"))
+
+	metrics := collect(t, reader)
+
+	connections := metrics["dqlite.driver.connections"].(metricdata.Sum[int64])
+	require.Len(t, connections.DataPoints, 1)
+	assert.Equal(t, int64(1), connections.DataPoints[0].Value)
+
+	errs := map[string]int64{}
+	for _, point := range metrics["dqlite.driver.errors"].(metricdata.Sum[int64]).DataPoints {
+		code, _ := point.Attributes.Value("code")
+		errs[code.AsString()] = point.Value
+	}
+	assert.Equal(t, map[string]int64{"5": 1, "bad_conn": 1, "other": 1}, errs)
+
+	latency := metrics["dqlite.driver.query.duration"].(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, uint64(2), latency.DataPoints[0].Count)
+	kind, _ := latency.DataPoints[0].Attributes.Value("kind")
+	assert.Equal(t, dqlitedriver.StatementSelect.String(), kind.AsString())
+}
+
+// The node is queried with the configured dial function, and reported as down
+// if it can't be reached.
+func TestObserveNode_Dial(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("dqlite")
+
+	var dialed []string
+	dial := func(ctx context.Context, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return nil, errors.New("unreachable")
+	}
+	require.NoError(t, observeNode(meter, 1, "10.0.0.1:9001", "@1", WithDialFunc(dial)))
+
+	metrics := collect(t, reader)
+
+	up := metrics["dqlite.node.up"].(metricdata.Gauge[int64])
+	require.Len(t, up.DataPoints, 1)
+	assert.Equal(t, int64(0), up.DataPoints[0].Value)
+	assert.Equal(t, attribute.NewSet(attribute.String("address", "10.0.0.1:9001")), up.DataPoints[0].Attributes)
+	assert.Equal(t, []string{"@1"}, dialed)
+}
+
+// Collect the metrics exported by the given reader, by name.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
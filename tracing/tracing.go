@@ -8,6 +8,21 @@ const (
 	traceContextKey contextKey = "trace"
 )
 
+// Keys of the attributes set by dqlite on the spans it starts.
+const (
+	// NodeAddressKey is the address of the node serving the request.
+	NodeAddressKey = "dqlite.node.address"
+
+	// LeaderIDKey is the ID of the cluster leader serving the request.
+	LeaderIDKey = "dqlite.leader.id"
+
+	// NodeIDKey is the ID of the node targeted by a membership change.
+	NodeIDKey = "dqlite.node.id"
+
+	// NodeRoleKey is the role assigned to a node by a membership change.
+	NodeRoleKey = "dqlite.node.role"
+)
+
 // WithTracer returns a context with the tracer embedded in the context
 // under the context key.
 func WithTracer(ctx context.Context, tracer Tracer) context.Context {
@@ -56,6 +71,47 @@ type Span interface {
 	End()
 }
 
+// Attribute is a key/value pair annotating a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// AttributeSetter is implemented by spans that can record attributes.
+type AttributeSetter interface {
+	// SetAttributes sets the given attributes on the span, overwriting
+	// any existing attribute with the same key.
+	SetAttributes(...Attribute)
+}
+
+// SetAttributes sets the given attributes on the span, if it implements
+// AttributeSetter. Otherwise it's a noop.
+func SetAttributes(span Span, attributes ...Attribute) {
+	setter, ok := span.(AttributeSetter)
+	if !ok {
+		return
+	}
+	setter.SetAttributes(attributes...)
+}
+
+// Propagator is implemented by spans whose context can be propagated to
+// remote peers.
+type Propagator interface {
+	// TraceParent returns the span context encoded as a W3C traceparent
+	// header value, or an empty string if the span context is invalid.
+	TraceParent() string
+}
+
+// TraceParent returns the W3C traceparent value of the given span, if it
+// implements Propagator. Otherwise it returns an empty string.
+func TraceParent(span Span) string {
+	propagator, ok := span.(Propagator)
+	if !ok {
+		return ""
+	}
+	return propagator.TraceParent()
+}
+
 // noopSpan is a span that does nothing.
 type noopSpan struct{}
 
@@ -0,0 +1,171 @@
+// Package websocket tunnels the dqlite protocol over WebSocket connections,
+// for clusters whose nodes can only reach each other through HTTP ingress
+// paths, such as load balancers or proxies that don't forward raw TCP.
+//
+// Nodes accept tunneled connections with an HTTP handler, and connect to each
+// other with a matching dial function. Both plug into app.WithExternalConn:
+//
+//	acceptCh := make(chan net.Conn)
+//	http.Handle("/dqlite", websocket.Handler(acceptCh))
+//	go http.ListenAndServe(":8443", nil)
+//
+//	dial := websocket.NewDialFunc(websocket.WithTLS(config))
+//	node, err := app.New(dir,
+//		app.WithAddress("node1.example.com:8443"),
+//		app.WithExternalConn(dial, acceptCh))
+//
+// Node addresses are the "host:port" of the HTTP server exposing the handler.
+//
+// It lives in its own module, so that applications not using WebSockets
+// don't pull in its dependencies.
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/canonical/go-dqlite/client"
+	ws "github.com/coder/websocket"
+)
+
+// DefaultPath is the path used by the dial function if none is set with
+// WithPath.
+const DefaultPath = "/dqlite"
+
+// Subprotocol is the WebSocket subprotocol negotiated by the dial function
+// and the handler.
+const Subprotocol = "dqlite"
+
+// DialOption can be used to tweak the dial function returned by NewDialFunc.
+type DialOption func(*dialOptions)
+
+// WithPath sets the path of the URL that the handler is exposed at.
+func WithPath(path string) DialOption {
+	return func(options *dialOptions) {
+		options.Path = path
+	}
+}
+
+// WithTLS makes the dial function use secure WebSockets (wss://), with the
+// given TLS configuration.
+func WithTLS(config *tls.Config) DialOption {
+	return func(options *dialOptions) {
+		options.TLS = config
+	}
+}
+
+// WithHeader sets additional headers to send with the upgrade request, for
+// example to authenticate against an ingress.
+func WithHeader(header http.Header) DialOption {
+	return func(options *dialOptions) {
+		options.Header = header
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send the upgrade request. It
+// overrides WithTLS.
+func WithHTTPClient(client *http.Client) DialOption {
+	return func(options *dialOptions) {
+		options.HTTPClient = client
+	}
+}
+
+type dialOptions struct {
+	Path       string
+	TLS        *tls.Config
+	Header     http.Header
+	HTTPClient *http.Client
+}
+
+// NewDialFunc returns a dial function that connects to the node at the given
+// address by upgrading an HTTP request for DefaultPath, or the path set with
+// WithPath, to a WebSocket connection.
+func NewDialFunc(options ...DialOption) client.DialFunc {
+	o := &dialOptions{Path: DefaultPath}
+	for _, option := range options {
+		option(o)
+	}
+
+	scheme := "ws"
+	if o.TLS != nil {
+		scheme = "wss"
+	}
+	httpClient := o.HTTPClient
+	if httpClient == nil && o.TLS != nil {
+		httpClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: o.TLS},
+		}
+	}
+
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		url := scheme + "://" + address + o.Path
+		conn, _, err := ws.Dial(ctx, url, &ws.DialOptions{
+			HTTPClient:   httpClient,
+			HTTPHeader:   o.Header,
+			Subprotocols: []string{Subprotocol},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return netConn(conn), nil
+	}
+}
+
+// AcceptOption can be used to tweak the handler returned by Handler.
+type AcceptOption func(*acceptOptions)
+
+// WithOriginPatterns sets the host patterns of the origins allowed to connect,
+// in addition to the host of the handler itself. It is only relevant to
+// requests sent by browsers, which dqlite nodes aren't.
+func WithOriginPatterns(patterns ...string) AcceptOption {
+	return func(options *acceptOptions) {
+		options.OriginPatterns = patterns
+	}
+}
+
+type acceptOptions struct {
+	OriginPatterns []string
+}
+
+// Handler returns an HTTP handler that upgrades requests to WebSocket
+// connections and sends them to the given channel, which should be passed to
+// app.WithExternalConn.
+func Handler(acceptCh chan<- net.Conn, options ...AcceptOption) http.Handler {
+	o := &acceptOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Accept(w, r, &ws.AcceptOptions{
+			Subprotocols:   []string{Subprotocol},
+			OriginPatterns: o.OriginPatterns,
+		})
+		if err != nil {
+			return // Accept already replied with an error.
+		}
+		if conn.Subprotocol() != Subprotocol {
+			conn.Close(ws.StatusPolicyViolation, "dqlite subprotocol required")
+			return
+		}
+
+		select {
+		case acceptCh <- netConn(conn):
+		case <-r.Context().Done():
+			conn.Close(ws.StatusGoingAway, "")
+		}
+	})
+}
+
+// Wrap the given WebSocket connection in a net.Conn transferring the dqlite
+// protocol as binary messages.
+func netConn(conn *ws.Conn) net.Conn {
+	// Messages are as large as dqlite writes, so don't limit them.
+	conn.SetReadLimit(-1)
+
+	// The connection outlives the dial or the HTTP request that created
+	// it, and is closed by its user.
+	return ws.NetConn(context.Background(), conn, ws.MessageBinary)
+}
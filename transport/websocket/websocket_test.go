@@ -0,0 +1,130 @@
+package websocket_test
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-dqlite/client"
+	"github.com/canonical/go-dqlite/transport/websocket"
+	ws "github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Data written on either side of a tunneled connection reaches the other
+// side.
+func TestDialFunc(t *testing.T) {
+	acceptCh := make(chan net.Conn, 1)
+	server := httptest.NewServer(websocket.Handler(acceptCh))
+	defer server.Close()
+
+	dial := websocket.NewDialFunc(websocket.WithPath("/"))
+	testTunnel(t, dial, address(server), acceptCh)
+}
+
+func TestDialFunc_TLS(t *testing.T) {
+	acceptCh := make(chan net.Conn, 1)
+	server := httptest.NewTLSServer(websocket.Handler(acceptCh))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	config := server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	config.RootCAs = pool
+
+	dial := websocket.NewDialFunc(websocket.WithPath("/"), websocket.WithTLS(config))
+	testTunnel(t, dial, address(server), acceptCh)
+}
+
+// The upgrade request is sent to the configured path, with the configured
+// headers.
+func TestDialFunc_PathAndHeader(t *testing.T) {
+	acceptCh := make(chan net.Conn, 1)
+	mux := http.NewServeMux()
+	handler := websocket.Handler(acceptCh)
+	mux.Handle(websocket.DefaultPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := websocket.NewDialFunc()
+	_, err := dial(context.Background(), address(server))
+	assert.Error(t, err)
+
+	dial = websocket.NewDialFunc(websocket.WithHeader(http.Header{"Authorization": {"Bearer secret"}}))
+	testTunnel(t, dial, address(server), acceptCh)
+}
+
+// Connections not negotiating the dqlite subprotocol are rejected.
+func TestHandler_Subprotocol(t *testing.T) {
+	acceptCh := make(chan net.Conn, 1)
+	server := httptest.NewServer(websocket.Handler(acceptCh))
+	defer server.Close()
+
+	conn, _, err := ws.Dial(context.Background(), "ws://"+address(server), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	_, _, err = conn.Read(context.Background())
+	assert.Equal(t, ws.StatusPolicyViolation, ws.CloseStatus(err))
+	assert.Len(t, acceptCh, 0)
+}
+
+func testTunnel(t *testing.T, dial client.DialFunc, address string, acceptCh chan net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx, address)
+	require.NoError(t, err)
+
+	var accepted net.Conn
+	select {
+	case accepted = <-acceptCh:
+	case <-ctx.Done():
+		conn.Close()
+		t.Fatal("connection not accepted")
+	}
+
+	// Close both sides at the same time, so that each one receives the
+	// close frame of the other without waiting for the handshake to time
+	// out.
+	defer func() {
+		done := make(chan struct{})
+		go func() {
+			accepted.Close()
+			close(done)
+		}()
+		conn.Close()
+		<-done
+	}()
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(accepted, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	_, err = accepted.Write([]byte("world"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf))
+}
+
+// Return the "host:port" address of the given test server.
+func address(server *httptest.Server) string {
+	return strings.TrimPrefix(strings.TrimPrefix(server.URL, "http://"), "https://")
+}